@@ -38,7 +38,7 @@ func main() {
 		log.Fatalf("error starting logger: %v", err)
 	}
 
-	a := app.New(cfg)
+	a := app.New(cfg, buildVersion)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer cancel()
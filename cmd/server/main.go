@@ -14,10 +14,15 @@ import (
 	"time"
 
 	"github.com/koyif/metrics/internal/app"
+	"github.com/koyif/metrics/internal/clientip"
 	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/graphite"
+	_ "github.com/koyif/metrics/internal/grpc/compression"
 	grpcinterceptor "github.com/koyif/metrics/internal/grpc/interceptor"
 	grpcserver "github.com/koyif/metrics/internal/grpc/server"
+	"github.com/koyif/metrics/internal/ingest"
 	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/statsd"
 	"github.com/koyif/metrics/pkg/logger"
 	"google.golang.org/grpc"
 
@@ -70,7 +75,11 @@ func main() {
 		wg.Add(1)
 	}
 
-	application, err := app.New(ctx, &wg, cfg)
+	// Storage outlives the listeners, so what they flush on shutdown is persisted too.
+	storageCtx, stopStorage := context.WithCancel(context.Background())
+	defer stopStorage()
+
+	application, err := app.New(storageCtx, &wg, cfg)
 	if err != nil {
 		log.Fatalf("failed to initialize application: %v", err)
 	}
@@ -82,6 +91,15 @@ func main() {
 		grpcSrv = startGRPCServer(application, &wg)
 	}
 
+	listeners := sync.WaitGroup{}
+	if cfg.StatsdAddr != "" {
+		startStatsD(ctx, application, &listeners)
+	}
+
+	if cfg.GraphiteAddr != "" {
+		startGraphite(ctx, application, &listeners)
+	}
+
 	<-ctx.Done()
 	logger.Log.Info("shutting down gracefully")
 
@@ -100,6 +118,10 @@ func main() {
 		grpcSrv.GracefulStop()
 	}
 
+	// Protocol listeners flush their last metrics before storage stops
+	listeners.Wait()
+	stopStorage()
+
 	// Wait for background tasks (file persistence) to complete
 	wg.Wait()
 	logger.Log.Info("shutdown complete")
@@ -129,10 +151,21 @@ func startServer(a *app.App) *http.Server {
 func startGRPCServer(a *app.App, wg *sync.WaitGroup) *grpc.Server {
 	wg.Add(1)
 
-	interceptor := grpcinterceptor.IPCheckInterceptor(a.Config.TrustedSubnet)
-	grpcSrv := grpc.NewServer(grpc.UnaryInterceptor(interceptor))
-	metricsServer := grpcserver.NewMetricsServer(a.MetricsService, a.Config, a.AuditManager)
+	interceptors := grpcinterceptor.Chain(grpcinterceptor.Config{
+		ClientIP:      a.ClientIP,
+		TrustedSubnet: a.Config.TrustedSubnet,
+		HashKey:       a.Config.HashKey,
+		Replay:        a.Replay,
+		RateLimiter:   a.RateLimiter,
+		Authenticator: a.Authenticator,
+		Agents:        a.Agents,
+		Idempotency:   a.Idempotency,
+	})
+
+	grpcSrv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	metricsServer := grpcserver.NewMetricsServer(a.MetricsService, a.Config, a.AuditManager, a.SeriesLimiter)
 	proto.RegisterMetricsServer(grpcSrv, metricsServer)
+	proto.RegisterAgentsServer(grpcSrv, grpcserver.NewAgentsServer(a.Agents))
 
 	lis, err := net.Listen("tcp", a.Config.GRPCAddr)
 	if err != nil {
@@ -149,3 +182,75 @@ func startGRPCServer(a *app.App, wg *sync.WaitGroup) *grpc.Server {
 
 	return grpcSrv
 }
+
+func startStatsD(ctx context.Context, a *app.App, wg *sync.WaitGroup) {
+	// The listener cannot check tokens, so only the trusted subnet keeps
+	// unauthenticated senders out.
+	if a.Authenticator != nil && a.Config.TrustedSubnet == "" {
+		logger.Log.Error("statsd listener not started: token authentication requires a trusted subnet for it")
+		return
+	}
+
+	trustedSubnets, err := clientip.ParseCIDRs(a.Config.TrustedSubnet)
+	if err != nil {
+		logger.Log.Fatal("invalid trusted subnet configuration", logger.Error(err))
+	}
+
+	srv := statsd.NewServer(statsd.Options{
+		Addr:           a.Config.StatsdAddr,
+		FlushInterval:  a.Config.StatsdFlushInterval.Value(),
+		TrustedSubnets: trustedSubnets,
+		RateLimiter:    lineRateLimiter(a),
+		Persist:        a.Config.StoreInterval.Value() == 0 && a.Config.DatabaseURL == "",
+	}, a.MetricsService, a.AuditManager, a.SeriesLimiter)
+	if err := srv.Listen(); err != nil {
+		logger.Log.Fatal("failed to start statsd listener", logger.Error(err))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		logger.Log.Info("starting statsd listener", logger.String("address", a.Config.StatsdAddr))
+		srv.Serve(ctx)
+	}()
+}
+
+// lineRateLimiter returns the rate limiter of the line protocol listeners,
+// nil when rate limiting is not enabled.
+func lineRateLimiter(a *app.App) ingest.RateLimiter {
+	if a.RateLimiter == nil {
+		return nil
+	}
+
+	return a.RateLimiter
+}
+
+func startGraphite(ctx context.Context, a *app.App, wg *sync.WaitGroup) {
+	if a.Authenticator != nil && a.Config.TrustedSubnet == "" {
+		logger.Log.Error("graphite listener not started: token authentication requires a trusted subnet for it")
+		return
+	}
+
+	trustedSubnets, err := clientip.ParseCIDRs(a.Config.TrustedSubnet)
+	if err != nil {
+		logger.Log.Fatal("invalid trusted subnet configuration", logger.Error(err))
+	}
+
+	srv := graphite.NewServer(graphite.Options{
+		Addr:           a.Config.GraphiteAddr,
+		TrustedSubnets: trustedSubnets,
+		RateLimiter:    lineRateLimiter(a),
+		Rules:          a.GraphiteRules,
+		Persist:        a.Config.StoreInterval.Value() == 0 && a.Config.DatabaseURL == "",
+	}, a.MetricsService, a.AuditManager, a.SeriesLimiter)
+	if err := srv.Listen(); err != nil {
+		logger.Log.Fatal("failed to start graphite listener", logger.Error(err))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		logger.Log.Info("starting graphite listener", logger.String("address", a.Config.GraphiteAddr))
+		srv.Serve(ctx)
+	}()
+}
@@ -25,23 +25,43 @@ const docTemplate = `{
     "paths": {
         "/": {
             "get": {
-                "description": "Retrieve an HTML page displaying all stored counter and gauge metrics",
+                "description": "Interactive HTML dashboard with sortable, filterable tables of gauges and counters, last-updated times and sparklines.\nThe page polls /api/v1/dashboard for data; its scripts and styles are embedded and served from /static/.",
                 "produces": [
                     "text/html"
                 ],
                 "tags": [
                     "metrics"
                 ],
-                "summary": "Get all metrics summary",
+                "summary": "Dashboard",
                 "responses": {
                     "200": {
-                        "description": "HTML table with all metrics",
+                        "description": "Dashboard page",
                         "schema": {
                             "type": "string"
                         }
+                    }
+                }
+            }
+        },
+        "/admin/quotas": {
+            "get": {
+                "description": "Retrieve configured series limits, per-client series usage and rejected series counts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Series quota usage",
+                "responses": {
+                    "200": {
+                        "description": "Current quota usage",
+                        "schema": {
+                            "$ref": "#/definitions/quota.Usage"
+                        }
                     },
                     "500": {
-                        "description": "Internal Server Error - Template failure",
+                        "description": "Internal Server Error - Encoding failure",
                         "schema": {
                             "type": "string"
                         }
@@ -49,25 +69,28 @@ const docTemplate = `{
                 }
             }
         },
-        "/ping": {
+        "/agents": {
             "get": {
-                "description": "Check service health and database connectivity",
+                "description": "List agents that reported to the server with their identity, last-seen time, transport and metric count",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "health"
+                    "admin"
                 ],
-                "summary": "Health check",
+                "summary": "Registered agents",
                 "responses": {
                     "200": {
-                        "description": "pong",
+                        "description": "Known agents sorted by ID",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/registry.Agent"
+                            }
                         }
                     },
                     "500": {
-                        "description": "Service Unavailable",
+                        "description": "Internal Server Error - Encoding failure",
                         "schema": {
                             "type": "string"
                         }
@@ -75,48 +98,37 @@ const docTemplate = `{
                 }
             }
         },
-        "/update/": {
-            "post": {
-                "description": "Store a single counter or gauge metric with validation and optional persistence",
-                "consumes": [
-                    "application/json"
-                ],
+        "/api/v1/dashboard": {
+            "get": {
+                "description": "Current value, last update time and recent history of every metric the token may read, split by type and sorted by name.\nUpdate times and history only cover updates received since the server started.",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
                     "metrics"
                 ],
-                "summary": "Store a single metric",
-                "parameters": [
-                    {
-                        "description": "Metric data (counter with delta or gauge with value)",
-                        "name": "metric",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/dto.Metrics"
-                        }
-                    }
-                ],
+                "summary": "Dashboard data",
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "Metrics split by type",
+                        "schema": {
+                            "$ref": "#/definitions/dto.DashboardResponse"
+                        }
                     },
-                    "400": {
-                        "description": "Bad Request - Invalid JSON or unknown metric type",
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "404": {
-                        "description": "Not Found - Empty metric ID",
+                    "403": {
+                        "description": "Forbidden - Token lacks the read scope",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error - Storage failure",
+                        "description": "Internal Server Error - Encoding failure",
                         "schema": {
                             "type": "string"
                         }
@@ -124,44 +136,74 @@ const docTemplate = `{
                 }
             }
         },
-        "/update/counter/{metric}/{value}": {
-            "post": {
-                "description": "Legacy endpoint to store a counter metric via URL path parameters",
+        "/api/v1/metrics": {
+            "get": {
+                "description": "List stored metrics with their value and last update time, ordered by name and type.\nFilters are combined; results are paginated with an opaque cursor returned as next_cursor.",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "deprecated"
+                    "metrics"
                 ],
-                "summary": "Store counter metric (deprecated)",
+                "summary": "List metrics",
                 "parameters": [
                     {
+                        "enum": [
+                            "gauge",
+                            "counter"
+                        ],
                         "type": "string",
-                        "description": "Metric name",
-                        "name": "metric",
-                        "in": "path",
-                        "required": true
+                        "description": "Only list metrics of this type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only list metrics whose name starts with the prefix",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only list metrics whose name matches the regular expression",
+                        "name": "regex",
+                        "in": "query"
                     },
                     {
                         "type": "integer",
-                        "description": "Counter value (integer)",
-                        "name": "value",
-                        "in": "path",
-                        "required": true
+                        "default": 100,
+                        "description": "Page size, 1 to 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor from next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "One page of metrics the token may read",
+                        "schema": {
+                            "$ref": "#/definitions/dto.MetricList"
+                        }
                     },
                     "400": {
-                        "description": "Bad Request - Invalid value format",
+                        "description": "Bad Request - Invalid type, regex, limit or cursor",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "404": {
-                        "description": "Not Found - Empty metric name",
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the read scope",
                         "schema": {
                             "type": "string"
                         }
@@ -175,50 +217,46 @@ const docTemplate = `{
                 }
             }
         },
-        "/update/gauge/{metric}/{value}": {
-            "post": {
-                "description": "Legacy endpoint to store a gauge metric via URL path parameters",
+        "/api/v1/query": {
+            "get": {
+                "description": "Evaluate an expression over the metrics the token may read.\nSelectors match a metric name, or a prefix when they end with \"*\", and report gauge values and counter totals: cpu.load, http.*.\nrate(http.*[5m]) is the per-second increase of counters over the window; quantile(0.95, latency[10m]) is a quantile of the gauge samples within the window.\nsum, avg, min and max reduce any expression to one value without an ID: sum(rate(http.*[1m])). Windows are durations such as 30s, 5m or 1h.\nWindows only cover the in-memory history of recent updates since the server started, limited to history_size samples per metric.",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "deprecated"
+                    "metrics"
                 ],
-                "summary": "Store gauge metric (deprecated)",
+                "summary": "Query metrics",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Metric name",
-                        "name": "metric",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "number",
-                        "description": "Gauge value (float)",
-                        "name": "value",
-                        "in": "path",
+                        "description": "Expression to evaluate",
+                        "name": "query",
+                        "in": "query",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "Values of the expression",
+                        "schema": {
+                            "$ref": "#/definitions/dto.QueryResponse"
+                        }
                     },
                     "400": {
-                        "description": "Bad Request - Invalid value format",
+                        "description": "Bad Request - Missing or invalid expression",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "404": {
-                        "description": "Not Found - Empty metric name",
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error - Storage failure",
+                    "403": {
+                        "description": "Forbidden - Token lacks the read scope",
                         "schema": {
                             "type": "string"
                         }
@@ -226,11 +264,11 @@ const docTemplate = `{
                 }
             }
         },
-        "/updates/": {
+        "/api/v1/write": {
             "post": {
-                "description": "Store an array of metrics (counters and gauges) in a single batch operation",
+                "description": "Receive samples with the Prometheus remote-write protocol (a snappy-compressed protobuf WriteRequest).\nEvery series is stored as one metric named after its labels, e.g. up{job=\"node\"}.\nThe type is chosen by the remote_write_rules, then by the metadata sent, then by the name:\n_total, _count, _sum and _bucket series are counters and get the increase since the last total, the rest are gauges.\nSeries rejected by the validation policy are reported with 400 after the others are stored,\nso Prometheus doesn't retry them.",
                 "consumes": [
-                    "application/json"
+                    "application/x-protobuf"
                 ],
                 "produces": [
                     "text/plain"
@@ -238,91 +276,52 @@ const docTemplate = `{
                 "tags": [
                     "metrics"
                 ],
-                "summary": "Store multiple metrics in batch",
+                "summary": "Prometheus remote write",
                 "parameters": [
                     {
-                        "description": "Array of metrics to store",
-                        "name": "metrics",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/dto.Metrics"
-                            }
-                        }
+                        "type": "string",
+                        "description": "snappy",
+                        "name": "Content-Encoding",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK"
+                    "204": {
+                        "description": "No Content"
                     },
                     "400": {
-                        "description": "Bad Request - Invalid JSON format",
+                        "description": "Bad Request - Malformed request or series rejected by validation policy",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/dto.BatchErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found - Empty metric ID or empty array",
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error - Storage failure",
+                    "403": {
+                        "description": "Forbidden - Token lacks the write scope or a metric prefix",
                         "schema": {
                             "type": "string"
                         }
-                    }
-                }
-            }
-        },
-        "/value/": {
-            "post": {
-                "description": "Retrieve the current value of a counter or gauge metric",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "metrics"
-                ],
-                "summary": "Get a metric value",
-                "parameters": [
-                    {
-                        "description": "Metric identifier (id and type required)",
-                        "name": "metric",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/dto.Metrics"
-                        }
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "Metric with current value (delta for counter, value for gauge)",
-                        "schema": {
-                            "$ref": "#/definitions/dto.Metrics"
-                        }
                     },
-                    "400": {
-                        "description": "Bad Request - Invalid JSON or unknown metric type",
+                    "415": {
+                        "description": "Unsupported Media Type - Unknown content encoding",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "404": {
-                        "description": "Not Found - Empty metric ID or metric not found",
+                    "429": {
+                        "description": "Too Many Requests - Series quota exceeded",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error - Retrieval failure",
+                        "description": "Internal Server Error - Storage failure",
                         "schema": {
                             "type": "string"
                         }
@@ -330,90 +329,1088 @@ const docTemplate = `{
                 }
             }
         },
-        "/value/counter/{metric}": {
+        "/api/v2/metrics": {
             "get": {
-                "description": "Legacy endpoint to retrieve a counter metric value via URL path",
+                "description": "List stored metrics with their value and last update time, ordered by name and type.\nFilters are combined; results are paginated with an opaque cursor returned as next_cursor.",
                 "produces": [
-                    "text/plain"
+                    "application/json",
+                    "application/problem+json"
                 ],
                 "tags": [
-                    "deprecated"
+                    "v2"
                 ],
-                "summary": "Get counter metric (deprecated)",
+                "summary": "List metrics",
                 "parameters": [
                     {
+                        "enum": [
+                            "gauge",
+                            "counter"
+                        ],
                         "type": "string",
-                        "description": "Metric name",
-                        "name": "metric",
-                        "in": "path",
-                        "required": true
+                        "description": "Only list metrics of this type",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only list metrics whose name starts with the prefix",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only list metrics whose name matches the regular expression",
+                        "name": "regex",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 100,
+                        "description": "Page size, 1 to 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor from next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Counter value as plain text",
+                        "description": "One page of metrics the token may read",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/dto.MetricList"
                         }
                     },
-                    "404": {
-                        "description": "Not Found - Empty metric name or metric not found",
+                    "400": {
+                        "description": "unknown_type or invalid_parameter",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error - Retrieval failure",
+                        "description": "storage_error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/dto.Problem"
                         }
                     }
                 }
-            }
-        },
-        "/value/gauge/{metric}": {
-            "get": {
-                "description": "Legacy endpoint to retrieve a gauge metric value via URL path",
+            },
+            "post": {
+                "description": "Store a single counter or gauge metric.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
-                    "text/plain"
+                    "application/problem+json"
                 ],
                 "tags": [
-                    "deprecated"
+                    "v2"
                 ],
-                "summary": "Get gauge metric (deprecated)",
+                "summary": "Store a metric",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Metric name",
+                        "description": "Metric data (counter with delta or gauge with value)",
                         "name": "metric",
-                        "in": "path",
-                        "required": true
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.Metrics"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Gauge value as plain text",
+                    "204": {
+                        "description": "Stored"
+                    },
+                    "400": {
+                        "description": "invalid_json",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/dto.Problem"
                         }
                     },
-                    "404": {
-                        "description": "Not Found - Empty metric name or metric not found",
+                    "401": {
+                        "description": "unauthorized",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden or metric_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed, with the rejected metric in errors",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "series_quota_exceeded or rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error - Retrieval failure",
+                        "description": "storage_error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/dto.Problem"
                         }
                     }
                 }
             }
-        }
-    },
+        },
+        "/api/v2/metrics/batch": {
+            "post": {
+                "description": "Store an array of metrics. By default the batch is all-or-nothing and a stored batch is answered with 204.\nWith partial=true valid metrics are stored and the response lists accepted and rejected items;\na partial batch in which every metric is rejected is answered with 422.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "tags": [
+                    "v2"
+                ],
+                "summary": "Store a batch of metrics",
+                "parameters": [
+                    {
+                        "description": "Array of metrics to store",
+                        "name": "metrics",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.Metrics"
+                            }
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Store valid metrics even if some are rejected",
+                        "name": "partial",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Batch key; a replay with the same key returns the stored response without applying the batch again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Partial mode: accepted and rejected metrics",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchResult"
+                        }
+                    },
+                    "204": {
+                        "description": "Stored"
+                    },
+                    "400": {
+                        "description": "invalid_json, empty_batch or invalid_idempotency_key",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden or metric_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "idempotency_conflict",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "validation_failed, with the rejected metrics in errors",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "series_quota_exceeded or rate_limited",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "storage_error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v2/metrics/{type}/{id}": {
+            "get": {
+                "description": "Retrieve the current value of a counter or gauge metric. The name may contain slashes.",
+                "produces": [
+                    "application/json",
+                    "application/problem+json"
+                ],
+                "tags": [
+                    "v2"
+                ],
+                "summary": "Get a metric",
+                "parameters": [
+                    {
+                        "enum": [
+                            "gauge",
+                            "counter"
+                        ],
+                        "type": "string",
+                        "description": "Metric type",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Metric name",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Metric with current value (delta for counter, value for gauge)",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Metrics"
+                        }
+                    },
+                    "400": {
+                        "description": "unknown_type or invalid_parameter",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "forbidden or metric_forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "metric_not_found",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "storage_error",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/ping": {
+            "get": {
+                "description": "Check service health and database connectivity",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "pong",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/stream": {
+            "get": {
+                "description": "Stream every stored metric update as Server-Sent Events. Each event is named \"metric\" and carries the update as JSON in its data field.\nA client that can't keep up is disconnected with a final \"dropped\" event and should reconnect.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Stream metric updates",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only stream metrics whose name starts with the prefix",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "gauge",
+                            "counter"
+                        ],
+                        "type": "string",
+                        "description": "Only stream metrics of this type",
+                        "name": "type",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stream of metric events",
+                        "schema": {
+                            "$ref": "#/definitions/pubsub.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request - Unknown metric type",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the read scope",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable - Too many subscribers",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/update/": {
+            "post": {
+                "description": "Store a single counter or gauge metric with validation and optional persistence",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Store a single metric",
+                "parameters": [
+                    {
+                        "description": "Metric data (counter with delta or gauge with value)",
+                        "name": "metric",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.Metrics"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request - Invalid JSON, unknown metric type or metric rejected by validation policy",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the write scope or the metric prefix",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found - Empty metric ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests - Series quota exceeded",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error - Storage failure",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/update/counter/{metric}/{value}": {
+            "post": {
+                "description": "Legacy endpoint to store a counter metric via URL path parameters",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "deprecated"
+                ],
+                "summary": "Store counter metric (deprecated)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Metric name",
+                        "name": "metric",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Counter value (integer)",
+                        "name": "value",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request - Invalid value format or metric rejected by validation policy",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the write scope or the metric prefix",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found - Empty metric name",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests - Series quota exceeded",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error - Storage failure",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/update/gauge/{metric}/{value}": {
+            "post": {
+                "description": "Legacy endpoint to store a gauge metric via URL path parameters",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "deprecated"
+                ],
+                "summary": "Store gauge metric (deprecated)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Metric name",
+                        "name": "metric",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "Gauge value (float)",
+                        "name": "value",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request - Invalid value format or metric rejected by validation policy",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the write scope or the metric prefix",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found - Empty metric name",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests - Series quota exceeded",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error - Storage failure",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/updates/": {
+            "post": {
+                "description": "Store an array of metrics (counters and gauges) in a single batch operation.\nBy default the batch is all-or-nothing: if any metric is invalid, nothing is stored.\nWith partial=true valid metrics are stored and the response lists accepted and rejected items; new series over the quota are rejected items too.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain",
+                    "application/json"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Store multiple metrics in batch",
+                "parameters": [
+                    {
+                        "description": "Array of metrics to store",
+                        "name": "metrics",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/dto.Metrics"
+                            }
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Store valid metrics even if some are rejected",
+                        "name": "partial",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Batch key; a replay with the same key returns the stored response without applying the batch again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK (body is returned in partial mode only)",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request - Invalid JSON format or metrics rejected by validation policy",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the write scope or a metric prefix",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found - Empty metric ID or empty array",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict - A request with the same idempotency key is in progress",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests - Series quota exceeded, unless partial",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error - Storage failure",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/value/": {
+            "post": {
+                "description": "Retrieve the current value of a counter or gauge metric",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "Get a metric value",
+                "parameters": [
+                    {
+                        "description": "Metric identifier (id and type required)",
+                        "name": "metric",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/dto.Metrics"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Metric with current value (delta for counter, value for gauge)",
+                        "schema": {
+                            "$ref": "#/definitions/dto.Metrics"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request - Invalid JSON or unknown metric type",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the read scope or the metric prefix",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found - Empty metric ID or metric not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error - Retrieval failure",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/value/counter/{metric}": {
+            "get": {
+                "description": "Legacy endpoint to retrieve a counter metric value via URL path",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "deprecated"
+                ],
+                "summary": "Get counter metric (deprecated)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Metric name",
+                        "name": "metric",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Counter value as plain text",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the read scope or the metric prefix",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found - Empty metric name or metric not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error - Retrieval failure",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/value/gauge/{metric}": {
+            "get": {
+                "description": "Legacy endpoint to retrieve a gauge metric value via URL path",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "deprecated"
+                ],
+                "summary": "Get gauge metric (deprecated)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Metric name",
+                        "name": "metric",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Gauge value as plain text",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the read scope or the metric prefix",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found - Empty metric name or metric not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error - Retrieval failure",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/write": {
+            "post": {
+                "description": "Receive points in the InfluxDB line protocol, one per line, optionally gzip-compressed.\nEvery numeric field is stored as one metric named measurement_field; tags are kept as labels,\ne.g. cpu_usage_idle{cpu=\"cpu0\"}, or folded into the name, e.g. cpu_usage_idle;cpu=cpu0, as set by influx_tags.\nFields are gauges unless their name ends with one of the influx_counter_suffixes; counters are sent as totals.\nLines that can't be parsed and metrics rejected by the validation policy are reported with 400\nafter the others are stored, so the sender doesn't retry them. The db and precision parameters are ignored.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "metrics"
+                ],
+                "summary": "InfluxDB line protocol write",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "gzip or zstd",
+                        "name": "Content-Encoding",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request - Unparsable lines or metrics rejected by validation policy",
+                        "schema": {
+                            "$ref": "#/definitions/dto.BatchErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Missing or invalid token",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden - Token lacks the write scope or a metric prefix",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type - Unknown content encoding",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests - Series quota exceeded",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error - Storage failure",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
     "definitions": {
+        "dto.AcceptedMetric": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID is the name of the stored metric.",
+                    "type": "string"
+                },
+                "index": {
+                    "description": "Index is the position of the metric in the request batch.",
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "MType is the type of the stored metric.",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.BatchErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Error is a short description of the failure.",
+                    "type": "string"
+                },
+                "rejected": {
+                    "description": "Rejected lists every metric that failed validation.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.RejectedMetric"
+                    }
+                }
+            }
+        },
+        "dto.BatchResult": {
+            "type": "object",
+            "properties": {
+                "accepted": {
+                    "description": "Accepted lists the metrics that were stored.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.AcceptedMetric"
+                    }
+                },
+                "rejected": {
+                    "description": "Rejected lists the metrics that were refused, with reasons.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.RejectedMetric"
+                    }
+                }
+            }
+        },
+        "dto.DashboardMetric": {
+            "type": "object",
+            "properties": {
+                "delta": {
+                    "description": "Delta holds the counter total. Non-nil only for counter metrics.",
+                    "type": "integer"
+                },
+                "history": {
+                    "description": "History holds the recent values, oldest first. Counters report their running total.",
+                    "type": "array",
+                    "items": {
+                        "type": "number"
+                    }
+                },
+                "id": {
+                    "description": "ID is the unique name/identifier of the metric.",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "MType specifies the metric type: \"counter\" or \"gauge\".",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "description": "UpdatedAt is the time of the last update since the server started, if any.",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Value holds the gauge value. Non-nil only for gauge metrics.",
+                    "type": "number"
+                }
+            }
+        },
+        "dto.DashboardResponse": {
+            "type": "object",
+            "properties": {
+                "counters": {
+                    "description": "Counters lists the counter metrics sorted by ID.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.DashboardMetric"
+                    }
+                },
+                "gauges": {
+                    "description": "Gauges lists the gauge metrics sorted by ID.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.DashboardMetric"
+                    }
+                },
+                "generated_at": {
+                    "description": "GeneratedAt is the server time the snapshot was taken.",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.ListedMetric": {
+            "type": "object",
+            "properties": {
+                "delta": {
+                    "description": "Delta holds the counter total. Non-nil only for counter metrics.",
+                    "type": "integer"
+                },
+                "id": {
+                    "description": "ID is the unique name/identifier of the metric.",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "MType specifies the metric type: \"counter\" or \"gauge\".",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "description": "UpdatedAt is the time of the last update. Omitted when the storage doesn't know it.",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Value holds the gauge value. Non-nil only for gauge metrics.",
+                    "type": "number"
+                }
+            }
+        },
+        "dto.MetricList": {
+            "type": "object",
+            "properties": {
+                "metrics": {
+                    "description": "Metrics lists the metrics of the page ordered by ID and type.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.ListedMetric"
+                    }
+                },
+                "next_cursor": {
+                    "description": "NextCursor is passed as the cursor parameter to fetch the next page.\nIt is omitted on the last page.",
+                    "type": "string"
+                }
+            }
+        },
         "dto.Metrics": {
             "type": "object",
             "properties": {
@@ -434,6 +1431,217 @@ const docTemplate = `{
                     "type": "number"
                 }
             }
+        },
+        "dto.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code is a stable machine-readable error code, e.g. \"validation_failed\".",
+                    "type": "string"
+                },
+                "detail": {
+                    "description": "Detail explains this occurrence of the problem.",
+                    "type": "string"
+                },
+                "errors": {
+                    "description": "Errors lists the rejected metrics when validation failed.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.RejectedMetric"
+                    }
+                },
+                "instance": {
+                    "description": "Instance is the path of the request that failed.",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status is the HTTP status code.",
+                    "type": "integer"
+                },
+                "title": {
+                    "description": "Title is a short summary of the problem type.",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type is a URI identifying the problem type.",
+                    "type": "string"
+                }
+            }
+        },
+        "dto.QueryResponse": {
+            "type": "object",
+            "properties": {
+                "evaluated_at": {
+                    "description": "EvaluatedAt is the server time the windows end at.",
+                    "type": "string"
+                },
+                "query": {
+                    "description": "Query is the evaluated expression.",
+                    "type": "string"
+                },
+                "result": {
+                    "description": "Result lists the values sorted by ID and type; it is empty when nothing matched.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/dto.QueryResult"
+                    }
+                }
+            }
+        },
+        "dto.QueryResult": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID is the metric the value was computed from. Omitted for aggregations.",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "MType is the type of the metric. Omitted for aggregations.",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Value is the computed value.",
+                    "type": "number"
+                }
+            }
+        },
+        "dto.RejectedMetric": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID is the name of the rejected metric.",
+                    "type": "string"
+                },
+                "index": {
+                    "description": "Index is the position of the metric in the request batch.",
+                    "type": "integer"
+                },
+                "message": {
+                    "description": "Message is a human-readable explanation.",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "Reason is a stable machine-readable rejection code, e.g. \"invalid_name\", or the series quota exceeded, e.g. \"max_series\".",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "MType is the type of the rejected metric as sent by the client.",
+                    "type": "string"
+                }
+            }
+        },
+        "pubsub.Event": {
+            "type": "object",
+            "properties": {
+                "delta": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "timestamp": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "number"
+                }
+            }
+        },
+        "quota.ClientUsage": {
+            "type": "object",
+            "properties": {
+                "client": {
+                    "type": "string"
+                },
+                "rejected_series": {
+                    "type": "integer"
+                },
+                "series": {
+                    "type": "integer"
+                }
+            }
+        },
+        "quota.Limits": {
+            "type": "object",
+            "properties": {
+                "max_new_series_per_minute": {
+                    "type": "integer"
+                },
+                "max_series": {
+                    "type": "integer"
+                },
+                "max_series_per_client": {
+                    "type": "integer"
+                }
+            }
+        },
+        "quota.Usage": {
+            "type": "object",
+            "properties": {
+                "clients": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/quota.ClientUsage"
+                    }
+                },
+                "limits": {
+                    "$ref": "#/definitions/quota.Limits"
+                },
+                "new_series_current_minute": {
+                    "type": "integer"
+                },
+                "rejected_by_reason": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer",
+                        "format": "int64"
+                    }
+                },
+                "total_series": {
+                    "type": "integer"
+                }
+            }
+        },
+        "registry.Agent": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "alive": {
+                    "type": "boolean"
+                },
+                "first_seen": {
+                    "type": "string"
+                },
+                "hostname": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_seen": {
+                    "type": "string"
+                },
+                "metrics_received": {
+                    "type": "integer"
+                },
+                "requests": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "transport": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -13,6 +13,7 @@ import (
 	"github.com/koyif/metrics/internal/agent/grpcclient"
 	"github.com/koyif/metrics/internal/agent/scraper"
 	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/registry"
 	"github.com/koyif/metrics/pkg/logger"
 )
 
@@ -22,12 +23,18 @@ type metricsClient interface {
 }
 
 type App struct {
-	cfg *config.Config
+	cfg       *config.Config
+	version   string
+	startedAt time.Time
 }
 
-func New(cfg *config.Config) *App {
+// New creates the agent application. The version is reported to the server
+// as part of the agent identity.
+func New(cfg *config.Config, version string) *App {
 	return &App{
-		cfg: cfg,
+		cfg:       cfg,
+		version:   version,
+		startedAt: time.Now(),
 	}
 }
 
@@ -35,7 +42,13 @@ func (app *App) Run(ctx context.Context, wg *sync.WaitGroup) error {
 	sc := scraper.New(app.cfg)
 	metricsCh := sc.Start(ctx)
 
-	metricsClient, err := newMetricsClient(app.cfg)
+	identity, err := newIdentity(app.cfg, app.version, app.startedAt)
+	if err != nil {
+		return fmt.Errorf("failed to resolve agent identity: %w", err)
+	}
+	logger.Log.Info("agent identity", logger.String("id", identity.ID), logger.String("hostname", identity.Hostname))
+
+	metricsClient, err := newMetricsClient(app.cfg, identity)
 
 	if err != nil {
 		return fmt.Errorf("failed to create metrics client: %w", err)
@@ -47,12 +60,12 @@ func (app *App) Run(ctx context.Context, wg *sync.WaitGroup) error {
 	return nil
 }
 
-func newMetricsClient(cfg *config.Config) (metricsClient, error) {
+func newMetricsClient(cfg *config.Config, identity registry.Identity) (metricsClient, error) {
 	if cfg.UseGRPC {
 		logger.Log.Info("using gRPC client")
-		return grpcclient.New(cfg)
+		return grpcclient.New(cfg, identity)
 	} else {
 		logger.Log.Info("using HTTP client")
-		return client.New(cfg, &http.Client{Timeout: 10 * time.Second})
+		return client.New(cfg, &http.Client{Timeout: 10 * time.Second}, identity)
 	}
 }
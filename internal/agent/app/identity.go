@@ -0,0 +1,103 @@
+package app
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/koyif/metrics/internal/agent/config"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// newIdentity builds the identity the agent reports to the server.
+func newIdentity(cfg *config.Config, version string, startedAt time.Time) (registry.Identity, error) {
+	id, err := agentID(cfg)
+	if err != nil {
+		return registry.Identity{}, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Log.Warn("failed to detect hostname", logger.Error(err))
+	}
+
+	return registry.Identity{
+		ID:        id,
+		Hostname:  hostname,
+		Version:   version,
+		StartedAt: startedAt,
+	}, nil
+}
+
+// agentID returns the configured agent ID. Without one, the ID is read from
+// the ID file, which is created with a random ID on first start, so the agent
+// keeps its identity across restarts. The ID file defaults to one in the
+// user's state directory.
+func agentID(cfg *config.Config) (string, error) {
+	if cfg.AgentID != "" {
+		return cfg.AgentID, nil
+	}
+
+	file := cfg.AgentIDFile
+	if file == "" {
+		var err error
+		if file, err = defaultAgentIDFile(); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read agent ID file: %w", err)
+	}
+
+	id, err := newAgentID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create agent ID directory: %w", err)
+	}
+	if err := os.WriteFile(file, []byte(id+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write agent ID file: %w", err)
+	}
+	logger.Log.Info("generated new agent ID", logger.String("id", id), logger.String("file", file))
+
+	return id, nil
+}
+
+// defaultAgentIDFile returns the ID file in the user's state directory:
+// XDG_STATE_HOME if set, the user's config directory otherwise.
+func defaultAgentIDFile() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return "", fmt.Errorf("no state directory for the agent ID file, set its path: %w", err)
+		}
+	}
+
+	return filepath.Join(dir, "metrics-agent", "id"), nil
+}
+
+// newAgentID returns a random version 4 UUID.
+func newAgentID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate agent ID: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
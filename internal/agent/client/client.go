@@ -2,22 +2,25 @@ package client
 
 import (
 	"bytes"
-	"crypto/hmac"
 	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/koyif/metrics/internal/agent/config"
+	"github.com/koyif/metrics/internal/idempotency"
 	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/compress"
 	"github.com/koyif/metrics/pkg/crypto"
 	"github.com/koyif/metrics/pkg/errutil"
 	"github.com/koyif/metrics/pkg/logger"
-	"github.com/koyif/metrics/pkg/netutil"
 )
 
 type MetricsClient struct {
@@ -25,12 +28,23 @@ type MetricsClient struct {
 	baseURL    *url.URL
 	cfg        *config.Config
 	publicKey  *rsa.PublicKey
-	localIP    string
+	identity   registry.Identity
 }
 
-const errClosingResponseBody = "error closing response body"
+const (
+	errClosingResponseBody = "error closing response body"
+	// maxRetryAfter caps the delay requested by the server through Retry-After.
+	maxRetryAfter = 30 * time.Second
+)
+
+var (
+	// ErrUnsignedResponse is returned when a hash key is configured but the server response has no signature.
+	ErrUnsignedResponse = errors.New("response is not signed")
+	// ErrInvalidResponseSignature is returned when the response body does not match its signature.
+	ErrInvalidResponseSignature = errors.New("response signature is not valid")
+)
 
-func New(cfg *config.Config, c *http.Client) (*MetricsClient, error) {
+func New(cfg *config.Config, c *http.Client, identity registry.Identity) (*MetricsClient, error) {
 	baseURL, err := url.Parse(fmt.Sprintf("http://%s", cfg.Addr))
 	if err != nil {
 		return nil, fmt.Errorf("error creating MetricsClient: %w", err)
@@ -40,6 +54,11 @@ func New(cfg *config.Config, c *http.Client) (*MetricsClient, error) {
 		httpClient: c,
 		baseURL:    baseURL,
 		cfg:        cfg,
+		identity:   identity,
+	}
+
+	if !compress.Supported(cfg.Compression) {
+		return nil, fmt.Errorf("%w: %q", compress.ErrUnsupportedEncoding, cfg.Compression)
 	}
 
 	if cfg.CryptoKey != "" {
@@ -51,13 +70,6 @@ func New(cfg *config.Config, c *http.Client) (*MetricsClient, error) {
 		logger.Log.Info("public key loaded successfully for encryption")
 	}
 
-	localIP, err := netutil.GetOutboundIP()
-	if err != nil {
-		return nil, fmt.Errorf("failed to detect local IP address: %w", err)
-	}
-	client.localIP = localIP
-	logger.Log.Info("detected local IP address", logger.String("ip", localIP))
-
 	return client, nil
 }
 
@@ -69,11 +81,15 @@ func (c *MetricsClient) SendMetric(metric models.Metrics) error {
 
 	updateURL := c.baseURL.JoinPath("update")
 
-	response, err := c.httpClient.Post(
-		updateURL.String(),
-		"application/json",
-		bytes.NewReader(requestBody),
-	)
+	req, err := http.NewRequest(http.MethodPost, updateURL.String(), bytes.NewReader(requestBody))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.sign(req, requestBody)
+	c.setAuthorization(req)
+
+	response, err := c.httpClient.Do(req)
 
 	if err != nil {
 		if response != nil && response.Body != nil {
@@ -96,7 +112,7 @@ func (c *MetricsClient) SendMetric(metric models.Metrics) error {
 		return fmt.Errorf("incorrect response status from Metrics Server: %d", response.StatusCode)
 	}
 
-	return nil
+	return c.verifyResponse(response)
 }
 
 func (c *MetricsClient) SendMetrics(metrics []models.Metrics) error {
@@ -117,9 +133,15 @@ func (c *MetricsClient) retry(updatesURL *url.URL, requestBody []byte) error {
 	var response *http.Response
 	var classifier = NewHTTPErrorClassifier()
 
-	dataToSend := requestBody
+	// The body is compressed before it is encrypted, since ciphertext doesn't compress.
+	// The signature still covers the plain JSON.
+	dataToSend, err := compress.Encode(c.cfg.Compression, requestBody)
+	if err != nil {
+		return fmt.Errorf("failed to compress request body: %w", err)
+	}
+
 	if c.publicKey != nil {
-		encryptedData, err := crypto.EncryptData(c.publicKey, requestBody)
+		encryptedData, err := crypto.EncryptData(c.publicKey, dataToSend)
 		if err != nil {
 			return fmt.Errorf("failed to encrypt request body: %w", err)
 		}
@@ -136,34 +158,58 @@ func (c *MetricsClient) retry(updatesURL *url.URL, requestBody []byte) error {
 	} else {
 		req.Header.Set("Content-Type", "application/json")
 	}
-
-	if c.cfg.HashKey != "" {
-		h := hmac.New(sha256.New, []byte(c.cfg.HashKey))
-		_, err = h.Write(requestBody)
-		if err != nil {
-			return fmt.Errorf("error creating HMAC: %w", err)
-		}
-
-		req.Header.Set("HashSHA256", fmt.Sprintf("%x", h.Sum(nil)))
+	if c.cfg.Compression != "" && c.cfg.Compression != compress.Identity {
+		req.Header.Set("Content-Encoding", c.cfg.Compression)
 	}
 
-	req.Header.Set("X-Real-IP", c.localIP)
+	c.identity.SetHeaders(req.Header)
+	c.setAuthorization(req)
+	// The key stays the same across attempts, so the server applies the batch only once
+	// even if a response was lost after the batch had been stored.
+	req.Header.Set(idempotency.HeaderName, idempotency.NewKey())
 
 	for i := range maxAttempts {
+		if i > 0 {
+			// The previous attempt consumed the body, rewind it before resending.
+			body, err := req.GetBody()
+			if err != nil {
+				return fmt.Errorf("error rewinding request body: %w", err)
+			}
+			req.Body = body
+		}
+		// Every attempt gets a fresh nonce, the server rejects reused ones.
+		c.sign(req, requestBody)
+
 		response, lastErr = c.httpClient.Do(req)
 		if lastErr == nil {
-			if response.StatusCode >= 500 {
-				logger.Log.Warn("failed to execute query, retrying")
-				time.Sleep(time.Duration(i) * ((time.Second * 2) + 1))
+			if isRetriableStatus(response.StatusCode) {
+				lastErr = fmt.Errorf("incorrect response status from Metrics Server: %d", response.StatusCode)
+				delay := retryDelay(i)
+				if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+					delay = min(retryAfter, maxRetryAfter)
+				}
+
+				err := response.Body.Close()
+				if err != nil {
+					logger.Log.Error(errClosingResponseBody, logger.Error(err))
+				}
+
+				if i == maxAttempts-1 {
+					break
+				}
+
+				logger.Log.Warn("failed to execute query, retrying", logger.String("delay", delay.String()))
+				time.Sleep(delay)
 				continue
 			}
 
+			verifyErr := c.verifyResponse(response)
 			err := response.Body.Close()
 			if err != nil {
 				logger.Log.Error(errClosingResponseBody, logger.Error(err))
 			}
 
-			return nil
+			return verifyErr
 		} else {
 			if classifier.Classify(lastErr) == errutil.NonRetriable {
 				return fmt.Errorf("failed to execute query: %w", lastErr)
@@ -177,3 +223,75 @@ func (c *MetricsClient) retry(updatesURL *url.URL, requestBody []byte) error {
 
 	return fmt.Errorf("failed to execute query after %d attempts, last error: %w", maxAttempts, lastErr)
 }
+
+// verifyResponse checks the HashSHA256 signature of the response body when a hash key is configured.
+// The batch has already been accepted at this point, so a bad signature is reported but not retried.
+func (c *MetricsClient) verifyResponse(response *http.Response) error {
+	if c.cfg.HashKey == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	signature := response.Header.Get(crypto.HashHeader)
+	if signature == "" {
+		return ErrUnsignedResponse
+	}
+	if !crypto.Verify(c.cfg.HashKey, body, signature) {
+		return ErrInvalidResponseSignature
+	}
+
+	return nil
+}
+
+// sign adds the HashSHA256 signature of the body bound to a fresh timestamp and nonce
+// when a hash key is configured.
+func (c *MetricsClient) sign(req *http.Request, body []byte) {
+	if c.cfg.HashKey == "" {
+		return
+	}
+
+	replay.SignHTTP(req, c.cfg.HashKey, body)
+}
+
+func (c *MetricsClient) setAuthorization(req *http.Request) {
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+}
+
+// isRetriableStatus reports whether the batch may be resent. 409 means the server is still
+// processing an earlier attempt with the same idempotency key.
+func isRetriableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests ||
+		statusCode == http.StatusConflict ||
+		statusCode >= http.StatusInternalServerError
+}
+
+// retryDelay returns the backoff after the attempt-th response with a retriable
+// status when the server sent no Retry-After: 2s, 4s and so on. Even the first
+// retry waits, since the server is either overloaded or, after 409, still
+// processing the batch.
+func retryDelay(attempt int) time.Duration {
+	return time.Duration(attempt+1) * 2 * time.Second
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(0, time.Until(date)), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/agent/config"
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/compress"
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+func TestMetricsClient_RetryHonorsRetryAfter(t *testing.T) {
+	bodies := make([]string, 0)
+	keys := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+		keys = append(keys, r.Header.Get(idempotency.HeaderName))
+
+		if len(bodies) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Addr: strings.TrimPrefix(server.URL, "http://")}
+	c, err := New(cfg, &http.Client{Timeout: time.Second}, registry.Identity{ID: "agent-1"})
+	require.NoError(t, err)
+
+	value := 1.5
+	err = c.SendMetrics([]models.Metrics{{ID: "gauge", MType: models.Gauge, Value: &value}})
+	require.NoError(t, err)
+
+	require.Len(t, bodies, 2)
+	assert.Equal(t, bodies[0], bodies[1], "retried request must carry the same body")
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1], "retried request must carry the same idempotency key")
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	d, ok := parseRetryAfter("5")
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, d)
+
+	d, ok = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.Greater(t, d, 59*time.Minute)
+
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 2*time.Second, retryDelay(0), "the first retry waits too")
+	assert.Equal(t, 4*time.Second, retryDelay(1))
+}
+
+func TestMetricsClient_VerifiesResponseSignature(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature func(body []byte) string
+		wantErr   error
+	}{
+		{name: "valid", signature: func(body []byte) string { return crypto.Sign("secret", body) }},
+		{name: "missing", signature: func([]byte) string { return "" }, wantErr: ErrUnsignedResponse},
+		{name: "wrong key", signature: func(body []byte) string { return crypto.Sign("other", body) }, wantErr: ErrInvalidResponseSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.True(t, crypto.VerifyRequest(
+					"secret",
+					r.Header.Get(replay.TimestampHeader),
+					r.Header.Get(replay.NonceHeader),
+					body,
+					r.Header.Get(crypto.HashHeader),
+				), "request must be signed")
+
+				response := []byte(`{"accepted":[]}`)
+				if signature := tt.signature(response); signature != "" {
+					w.Header().Set(crypto.HashHeader, signature)
+				}
+				_, _ = w.Write(response)
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{Addr: strings.TrimPrefix(server.URL, "http://"), HashKey: "secret"}
+			c, err := New(cfg, &http.Client{Timeout: time.Second}, registry.Identity{ID: "agent-1"})
+			require.NoError(t, err)
+
+			value := 1.5
+			err = c.SendMetrics([]models.Metrics{{ID: "gauge", MType: models.Gauge, Value: &value}})
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetricsClient_RetryUsesFreshNonce(t *testing.T) {
+	guard := replay.New(time.Minute, 10)
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		timestamp, nonce := r.Header.Get(replay.TimestampHeader), r.Header.Get(replay.NonceHeader)
+		require.True(t, crypto.VerifyRequest("secret", timestamp, nonce, body, r.Header.Get(crypto.HashHeader)))
+		require.NoError(t, guard.Check(timestamp, nonce))
+
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(crypto.HashHeader, crypto.Sign("secret", nil))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Addr: strings.TrimPrefix(server.URL, "http://"), HashKey: "secret"}
+	c, err := New(cfg, &http.Client{Timeout: time.Second}, registry.Identity{ID: "agent-1"})
+	require.NoError(t, err)
+
+	value := 1.5
+	require.NoError(t, c.SendMetrics([]models.Metrics{{ID: "gauge", MType: models.Gauge, Value: &value}}))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestMetricsClient_CompressesBatches(t *testing.T) {
+	for _, encoding := range []string{compress.Gzip, compress.Zstd} {
+		t.Run(encoding, func(t *testing.T) {
+			var received []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, encoding, r.Header.Get("Content-Encoding"))
+				reader, err := compress.NewReader(r.Header.Get("Content-Encoding"), r.Body)
+				require.NoError(t, err)
+				defer reader.Close()
+				received, err = io.ReadAll(reader)
+				require.NoError(t, err)
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{Addr: strings.TrimPrefix(server.URL, "http://"), Compression: encoding}
+			c, err := New(cfg, &http.Client{Timeout: time.Second}, registry.Identity{ID: "agent-1"})
+			require.NoError(t, err)
+
+			value := 1.5
+			require.NoError(t, c.SendMetrics([]models.Metrics{{ID: "gauge", MType: models.Gauge, Value: &value}}))
+			assert.JSONEq(t, `[{"id":"gauge","type":"gauge","value":1.5}]`, string(received))
+		})
+	}
+
+	_, err := New(&config.Config{Addr: "localhost:8080", Compression: "br"}, http.DefaultClient, registry.Identity{})
+	assert.ErrorIs(t, err, compress.ErrUnsupportedEncoding)
+}
@@ -21,6 +21,10 @@ type Config struct {
 	RateLimit      int                     `json:"rate_limit" env:"RATE_LIMIT" env-default:"3"`
 	CryptoKey      string                  `json:"crypto_key" env:"CRYPTO_KEY"`
 	UseGRPC        bool                    `json:"use_grpc" env:"USE_GRPC" env-default:"false"`
+	AgentID        string                  `json:"agent_id" env:"AGENT_ID"`
+	AgentIDFile    string                  `json:"agent_id_file" env:"AGENT_ID_FILE"`
+	Token          string                  `json:"token" env:"TOKEN"`
+	Compression    string                  `json:"compression" env:"COMPRESSION"`
 	ConfigPath     string                  `json:"-"`
 }
 
@@ -75,6 +79,10 @@ func setupFlags(cfg *Config) {
 	flag.StringVar(&cfg.Addr, "a", cfg.Addr, "адрес эндпоинта HTTP-сервера")
 	flag.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "путь до файла с публичным ключом")
 	flag.BoolVar(&cfg.UseGRPC, "use-grpc", cfg.UseGRPC, "использовать gRPC вместо HTTP")
+	flag.StringVar(&cfg.Compression, "compression", cfg.Compression, "сжатие отправляемых пакетов метрик: gzip или zstd")
+	flag.StringVar(&cfg.AgentID, "id", cfg.AgentID, "идентификатор агента")
+	flag.StringVar(&cfg.AgentIDFile, "id-file", cfg.AgentIDFile, "путь к файлу с идентификатором агента (по умолчанию в каталоге состояния пользователя)")
+	flag.StringVar(&cfg.Token, "token", cfg.Token, "токен доступа к серверу")
 
 	flag.Parse()
 }
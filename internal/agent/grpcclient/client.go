@@ -2,40 +2,56 @@ package grpcclient
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/koyif/metrics/internal/agent/config"
+	_ "github.com/koyif/metrics/internal/grpc/compression"
 	"github.com/koyif/metrics/internal/grpc/converter"
+	"github.com/koyif/metrics/internal/grpc/signing"
+	"github.com/koyif/metrics/internal/idempotency"
 	"github.com/koyif/metrics/internal/models"
 	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/pkg/compress"
+	"github.com/koyif/metrics/pkg/crypto"
 	"github.com/koyif/metrics/pkg/logger"
-	"github.com/koyif/metrics/pkg/netutil"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/metadata"
 )
 
+var (
+	// ErrUnsignedResponse is returned when a hash key is configured but the server response has no signature.
+	ErrUnsignedResponse = errors.New("response is not signed")
+	// ErrInvalidResponseSignature is returned when the response does not match its signature.
+	ErrInvalidResponseSignature = errors.New("response signature is not valid")
+)
+
 // GRPCMetricsClient implements the metrics client interface for gRPC transport.
 type GRPCMetricsClient struct {
-	conn    *grpc.ClientConn
-	client  proto.MetricsClient
-	localIP string
-	cfg     *config.Config
+	conn     *grpc.ClientConn
+	client   proto.MetricsClient
+	cfg      *config.Config
+	identity registry.Identity
 }
 
 // New creates a new gRPC metrics client.
-// It detects the local IP address and establishes a connection to the gRPC server.
-func New(cfg *config.Config) (*GRPCMetricsClient, error) {
-	localIP, err := netutil.GetOutboundIP()
-	if err != nil {
-		return nil, fmt.Errorf("failed to detect local IP address: %w", err)
+// It establishes a connection to the gRPC server and compresses requests
+// with the configured compressor.
+func New(cfg *config.Config, identity registry.Identity) (*GRPCMetricsClient, error) {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if cfg.Compression != "" && cfg.Compression != compress.Identity {
+		if encoding.GetCompressor(cfg.Compression) == nil {
+			return nil, fmt.Errorf("%w: %q", compress.ErrUnsupportedEncoding, cfg.Compression)
+		}
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(cfg.Compression)))
 	}
-	logger.Log.Info("detected local IP address", logger.String("ip", localIP))
 
-	conn, err := grpc.NewClient(
-		cfg.Addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	conn, err := grpc.NewClient(cfg.Addr, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
 	}
@@ -45,15 +61,16 @@ func New(cfg *config.Config) (*GRPCMetricsClient, error) {
 	logger.Log.Info("gRPC client initialized", logger.String("server", cfg.Addr))
 
 	return &GRPCMetricsClient{
-		conn:    conn,
-		client:  client,
-		localIP: localIP,
-		cfg:     cfg,
+		conn:     conn,
+		client:   client,
+		cfg:      cfg,
+		identity: identity,
 	}, nil
 }
 
 // SendMetrics sends a batch of metrics to the gRPC server.
-// It adds the local IP address to the request metadata and converts the metrics to proto format.
+// It adds the agent identity and a fresh idempotency key to the request metadata
+// and converts the metrics to proto format.
 func (c *GRPCMetricsClient) SendMetrics(metrics []models.Metrics) error {
 	if len(metrics) == 0 {
 		return nil
@@ -63,22 +80,60 @@ func (c *GRPCMetricsClient) SendMetrics(metrics []models.Metrics) error {
 
 	ctx := metadata.AppendToOutgoingContext(
 		context.Background(),
-		"x-real-ip", c.localIP,
+		idempotency.MetadataKey, idempotency.NewKey(),
 	)
+	ctx = metadata.AppendToOutgoingContext(ctx, c.identity.MetadataPairs()...)
+	if c.cfg.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.cfg.Token)
+	}
 
 	req := &proto.UpdateMetricsRequest{
 		Metrics: protoMetrics,
 	}
 
-	_, err := c.client.UpdateMetrics(ctx, req)
+	if c.cfg.HashKey != "" {
+		var err error
+		if ctx, err = signing.AppendRequestSignature(ctx, c.cfg.HashKey, req); err != nil {
+			return err
+		}
+	}
+
+	var header metadata.MD
+	resp, err := c.client.UpdateMetrics(ctx, req, grpc.Header(&header))
 	if err != nil {
 		return fmt.Errorf("failed to send metrics via gRPC: %w", err)
 	}
 
+	if err := c.verifyResponse(resp, header); err != nil {
+		return err
+	}
+
 	logger.Log.Debug("successfully sent metrics via gRPC", logger.Int("count", len(metrics)))
 	return nil
 }
 
+// verifyResponse checks the hashsha256 signature of the response when a hash key is configured.
+func (c *GRPCMetricsClient) verifyResponse(resp *proto.UpdateMetricsResponse, header metadata.MD) error {
+	if c.cfg.HashKey == "" {
+		return nil
+	}
+
+	hashes := header.Get(crypto.HashMetadataKey)
+	if len(hashes) == 0 {
+		return ErrUnsignedResponse
+	}
+
+	valid, err := signing.Verify(c.cfg.HashKey, resp, hashes[0])
+	if err != nil {
+		return fmt.Errorf("failed to verify response: %w", err)
+	}
+	if !valid {
+		return ErrInvalidResponseSignature
+	}
+
+	return nil
+}
+
 // SendMetric sends a single metric to the gRPC server.
 // It wraps the metric in a slice and calls SendMetrics.
 func (c *GRPCMetricsClient) SendMetric(metric models.Metrics) error {
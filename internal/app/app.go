@@ -4,18 +4,38 @@ import (
 	"context"
 	"crypto/rsa"
 	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/koyif/metrics/pkg/crypto"
 	"github.com/koyif/metrics/pkg/logger"
 
 	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/clientip"
 	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/cumulative"
+	"github.com/koyif/metrics/internal/export"
+	"github.com/koyif/metrics/internal/federation"
+	"github.com/koyif/metrics/internal/history"
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/internal/influx"
 	"github.com/koyif/metrics/internal/models"
 	"github.com/koyif/metrics/internal/persistence/database"
+	"github.com/koyif/metrics/internal/pubsub"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/ratelimit"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/internal/remotewrite"
+	"github.com/koyif/metrics/internal/replay"
 	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/retention"
 	"github.com/koyif/metrics/internal/service"
+	"github.com/koyif/metrics/internal/typerule"
+	"github.com/koyif/metrics/internal/validation"
 )
 
 type metricsRepository interface {
@@ -25,29 +45,55 @@ type metricsRepository interface {
 	StoreGauge(metricName string, value float64) error
 	Gauge(metricName string) (float64, error)
 	AllGauges() map[string]float64
+	AllMetrics() []models.Metrics
 	StoreAll(metrics []models.Metrics) error
+	ListMetrics(ctx context.Context, filter models.ListFilter) ([]models.MetricRecord, error)
 	Ping(ctx context.Context) error
 }
 
 type App struct {
 	Config         *config.Config
 	MetricsService *service.MetricsService
+	Hub            *pubsub.Hub
+	History        *history.Store
+	RemoteWrite    *remotewrite.Converter
+	Influx         *influx.Converter
+	GraphiteRules  []typerule.Rule
 	AuditManager   *audit.Manager
+	SeriesLimiter  *quota.Limiter
+	RateLimiter    *ratelimit.Limiter
+	Idempotency    idempotency.Store
+	Agents         *registry.Registry
+	Authenticator  *auth.Authenticator
+	ClientIP       *clientip.Resolver
+	Replay         *replay.Guard
 	PrivateKey     *rsa.PrivateKey
 }
 
 func New(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*App, error) {
 	var metricsRepository metricsRepository
 	var fileService *service.FileService
+	var idempotencyStore idempotency.Store
+	var db *database.Database
+
+	retentionPolicy, err := retention.Parse(cfg.SampleRetention)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sample retention: %w", err)
+	}
+	if retentionPolicy.Enabled() && cfg.DatabaseURL == "" {
+		return nil, errors.New("sample retention requires a database")
+	}
 
 	if cfg.DatabaseURL != "" {
 		wg.Done()
-		db, err := database.New(ctx, cfg.DatabaseURL)
+		db, err = database.New(ctx, cfg.DatabaseURL)
 		if err != nil {
 			return nil, err
 		}
 		metricsRepository = repository.NewDatabaseRepository(db)
+		idempotencyStore = database.NewIdempotencyStore(db, cfg.IdempotencyTTL.Value())
 	} else {
+		idempotencyStore = idempotency.NewMemoryStore(cfg.IdempotencyTTL.Value(), cfg.IdempotencyCacheSize)
 		fileRepository := repository.NewFileRepository(cfg.FileStoragePath)
 		metricsRepository = repository.NewMetricsRepository()
 		fileService = service.NewFileService(fileRepository, metricsRepository)
@@ -60,9 +106,66 @@ func New(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*App, err
 		fileService.SchedulePersist(ctx, wg, cfg.StoreInterval.Value())
 	}
 
-	metricsService := service.NewMetricsService(metricsRepository, fileService)
+	validator, err := validation.New(validation.Policy{
+		NamePattern:   cfg.MetricNamePattern,
+		MaxNameLength: cfg.MaxMetricNameLength,
+		NegativeDelta: validation.NegativeDeltaPolicy(cfg.NegativeDeltaPolicy),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hub := pubsub.New(pubsub.DefaultBufferSize, pubsub.DefaultMaxSubscribers)
+	historyStore := history.New(cfg.HistorySize, history.DefaultMaxSeries)
+	historyStore.Seed(metricsRepository.AllCounters())
+	metricsService := service.NewMetricsService(metricsRepository, fileService, validator, pubsub.Publishers{historyStore, hub})
+
+	// Protocols sending cumulative counters share the totals, as they write the same series.
+	totals := cumulative.NewTracker(metricsService)
+	remoteWriteRules, err := typerule.Parse(cfg.RemoteWriteRules)
+	if err != nil {
+		return nil, err
+	}
+
+	graphiteRules, err := typerule.Parse(cfg.GraphiteRules)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Federation.Validate(); err != nil {
+		return nil, err
+	}
+
+	influxOptions, err := influx.ParseOptions(cfg.InfluxTags, cfg.InfluxCounterSuffixes)
+	if err != nil {
+		return nil, err
+	}
 
 	auditManager := initializeAudit(cfg)
+	seriesLimiter := initializeSeriesLimiter(cfg, metricsRepository)
+
+	rateLimiter, err := initializeRateLimiter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator, err := initializeAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := clientip.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	if _, err := clientip.ParseCIDRs(cfg.TrustedSubnet); err != nil {
+		return nil, fmt.Errorf("invalid trusted subnet: %w", err)
+	}
+
+	var replayGuard *replay.Guard
+	if cfg.HashKey != "" {
+		replayGuard = replay.New(cfg.SignatureMaxSkew.Value(), cfg.NonceCacheSize)
+	}
 
 	var privateKey *rsa.PrivateKey
 	if cfg.CryptoKey != "" {
@@ -74,14 +177,115 @@ func New(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config) (*App, err
 		logger.Log.Info("private key loaded successfully for decryption")
 	}
 
+	if err := startCompactor(ctx, wg, cfg, retentionPolicy, db, metricsService); err != nil {
+		return nil, err
+	}
+	if err := startExporters(ctx, wg, cfg, metricsService, hub); err != nil {
+		return nil, err
+	}
+	if err := startFederation(ctx, wg, cfg, metricsService, totals, auditManager, seriesLimiter); err != nil {
+		return nil, err
+	}
+
 	return &App{
 		Config:         cfg,
 		MetricsService: metricsService,
+		Hub:            hub,
+		History:        historyStore,
+		RemoteWrite:    remotewrite.NewConverter(remoteWriteRules, totals),
+		Influx:         influx.NewConverter(influxOptions, totals),
+		GraphiteRules:  graphiteRules,
 		AuditManager:   auditManager,
+		SeriesLimiter:  seriesLimiter,
+		RateLimiter:    rateLimiter,
+		Idempotency:    idempotencyStore,
+		Agents:         registry.New(cfg.AgentAliveTimeout.Value()),
+		Authenticator:  authenticator,
+		ClientIP:       clientip.NewResolver(trustedProxies),
+		Replay:         replayGuard,
 		PrivateKey:     privateKey,
 	}, nil
 }
 
+// startExporters runs the configured exporters until the context is done.
+// They stop together with the storage, so their last export holds the final state.
+func startExporters(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, metricsService *service.MetricsService, hub *pubsub.Hub) error {
+	exporters, err := export.NewExporters(cfg.Exporters, metricsService, hub)
+	if err != nil {
+		return err
+	}
+
+	for _, exporter := range exporters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exporter.Run(ctx)
+		}()
+	}
+
+	return nil
+}
+
+// startFederation pulls the pulled upstreams and aggregates all upstreams until the context is done.
+func startFederation(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	cfg *config.Config,
+	metricsService *service.MetricsService,
+	totals *cumulative.Tracker,
+	auditManager *audit.Manager,
+	seriesLimiter *quota.Limiter,
+) error {
+	if len(cfg.Federation.Pulled()) == 0 && cfg.Federation.AggregateNamespace == "" {
+		return nil
+	}
+
+	persist := cfg.StoreInterval.Value() == 0 && cfg.DatabaseURL == ""
+	puller, err := federation.NewPuller(cfg.Federation, metricsService, totals, auditManager, seriesLimiter, persist)
+	if err != nil {
+		return err
+	}
+
+	logger.Log.Info("federation enabled", logger.Int("upstreams", len(cfg.Federation.Pulled())))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		puller.Run(ctx)
+	}()
+
+	return nil
+}
+
+// startCompactor records samples and compacts them until the context is done.
+// The partitions of the coming days are created before any sample is stored.
+func startCompactor(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	cfg *config.Config,
+	policy retention.Policy,
+	db *database.Database,
+	metricsService *service.MetricsService,
+) error {
+	if !policy.Enabled() {
+		return nil
+	}
+
+	compactor := retention.NewCompactor(db, policy, cfg.CompactionInterval.Value(), metricsService)
+	if err := compactor.Prepare(ctx); err != nil {
+		return fmt.Errorf("failed to create sample partitions: %w", err)
+	}
+	db.EnableSamples()
+
+	logger.Log.Info("sample storage enabled", logger.String("retention", policy.String()))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		compactor.Run(ctx)
+	}()
+
+	return nil
+}
+
 func initializeAudit(cfg *config.Config) *audit.Manager {
 	manager := audit.NewManager()
 
@@ -107,3 +311,73 @@ func initializeAudit(cfg *config.Config) *audit.Manager {
 
 	return manager
 }
+
+func initializeSeriesLimiter(cfg *config.Config, repository metricsRepository) *quota.Limiter {
+	limits := quota.Limits{
+		MaxSeries:             cfg.MaxSeries,
+		MaxNewSeriesPerMinute: cfg.MaxNewSeriesPerMinute,
+		MaxSeriesPerClient:    cfg.MaxSeriesPerClient,
+	}
+	limiter := quota.NewLimiter(limits)
+
+	counters := slices.Collect(maps.Keys(repository.AllCounters()))
+	gauges := slices.Collect(maps.Keys(repository.AllGauges()))
+	limiter.Seed(models.Counter, counters)
+	limiter.Seed(models.Gauge, gauges)
+
+	if limits.Enabled() {
+		logger.Log.Info(
+			"series quotas enabled",
+			logger.Int("max_series", cfg.MaxSeries),
+			logger.Int("max_new_series_per_minute", cfg.MaxNewSeriesPerMinute),
+			logger.Int("max_series_per_client", cfg.MaxSeriesPerClient),
+			logger.Int("existing_series", len(counters)+len(gauges)),
+		)
+	}
+
+	return limiter
+}
+
+func initializeRateLimiter(cfg *config.Config) (*ratelimit.Limiter, error) {
+	rules, err := ratelimit.ParseRules(cfg.RateLimitCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := ratelimit.New(cfg.RateLimit, cfg.RateBurst, rules)
+	if !limiter.Enabled() {
+		return nil, nil
+	}
+
+	logger.Log.Info(
+		"rate limiting enabled",
+		logger.Float("rate", cfg.RateLimit),
+		logger.Int("burst", cfg.RateBurst),
+		logger.Int("cidr_rules", len(rules)),
+	)
+
+	return limiter, nil
+}
+
+// initializeAuthenticator returns nil when no tokens are configured, which leaves
+// every endpoint open as before. Pushing federation upstreams add their tokens,
+// which only work alongside the others: they would lock every other client out.
+func initializeAuthenticator(cfg *config.Config) (*auth.Authenticator, error) {
+	pushTokens := cfg.Federation.PushTokens()
+	if len(cfg.Tokens) == 0 {
+		if len(pushTokens) > 0 {
+			return nil, errors.New("federation upstream tokens require token authentication to be configured")
+		}
+		return nil, nil
+	}
+
+	tokens := append(append([]auth.TokenConfig{}, cfg.Tokens...), pushTokens...)
+	authenticator, err := auth.New(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token configuration: %w", err)
+	}
+
+	logger.Log.Info("token authentication enabled", logger.Int("tokens", len(tokens)))
+
+	return authenticator, nil
+}
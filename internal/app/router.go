@@ -1,91 +1,189 @@
 package app
 
 import (
+	"net/http"
 	_ "net/http/pprof"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
 	swagger "github.com/swaggo/http-swagger/v2"
 
+	"github.com/koyif/metrics/internal/auth"
 	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/handler/admin"
+	"github.com/koyif/metrics/internal/handler/dashboard"
 	"github.com/koyif/metrics/internal/handler/deprecated"
 	"github.com/koyif/metrics/internal/handler/health"
 	"github.com/koyif/metrics/internal/handler/metrics"
 	custommiddleware "github.com/koyif/metrics/internal/handler/middleware"
+	"github.com/koyif/metrics/internal/query"
 	"github.com/koyif/metrics/pkg/logger"
 )
 
+// apiV2Prefix is the path prefix of the v2 API, which reports errors as problem details.
+const apiV2Prefix = "/api/v2/"
+
 func (app App) Router() *chi.Mux {
 	r := chi.NewRouter()
 
+	r.Use(custommiddleware.WithClientIP(app.ClientIP))
+	r.Use(custommiddleware.WithProblemDetails(apiV2Prefix))
 	r.Use(custommiddleware.WithLogger)
 	r.Use(custommiddleware.WithGzip)
 
-	summaryHandler := metrics.NewSummaryHandler(app.MetricsService)
+	dashboardHandler := dashboard.NewPageHandler()
+	dashboardDataHandler := dashboard.NewDataHandler(app.MetricsService, app.History)
 	getHandler := metrics.NewGetHandler(app.MetricsService)
-	storeHandler := metrics.NewStoreHandler(app.MetricsService, app.Config, app.AuditManager)
-	storeAllHandler := metrics.NewStoreAllHandler(app.MetricsService, app.Config, app.AuditManager)
+	listHandler := metrics.NewListHandler(app.MetricsService)
+	queryHandler := metrics.NewQueryHandler(query.NewEngine(app.MetricsService, app.History))
+	v2GetHandler := metrics.NewV2GetHandler(app.MetricsService)
+	v2StoreHandler := metrics.NewV2StoreHandler(app.MetricsService, app.Config, app.AuditManager, app.SeriesLimiter)
+	v2BatchHandler := metrics.NewV2BatchHandler(app.MetricsService, app.Config, app.AuditManager, app.SeriesLimiter)
+	storeHandler := metrics.NewStoreHandler(app.MetricsService, app.Config, app.AuditManager, app.SeriesLimiter)
+	storeAllHandler := metrics.NewStoreAllHandler(app.MetricsService, app.Config, app.AuditManager, app.SeriesLimiter)
+	remoteWriteHandler := metrics.NewRemoteWriteHandler(app.MetricsService, app.RemoteWrite, app.Config, app.AuditManager, app.SeriesLimiter)
+	influxWriteHandler := metrics.NewInfluxWriteHandler(app.MetricsService, app.Influx, app.Config, app.AuditManager, app.SeriesLimiter)
 
 	counterGetHandler := deprecated.NewCountersGetHandler(app.MetricsService)
 	gaugeGetHandler := deprecated.NewGaugesGetHandler(app.MetricsService)
-	counterPostHandler := deprecated.NewCountersPostHandler(app.MetricsService)
-	gaugePostHandler := deprecated.NewGaugesPostHandler(app.MetricsService)
+	counterPostHandler := deprecated.NewCountersPostHandler(app.MetricsService, app.SeriesLimiter)
+	gaugePostHandler := deprecated.NewGaugesPostHandler(app.MetricsService, app.SeriesLimiter)
+
+	quotaHandler := admin.NewQuotaHandler(app.SeriesLimiter)
+	agentsHandler := admin.NewAgentsHandler(app.Agents)
+	streamHandler := metrics.NewStreamHandler(app.Hub)
 
-	r.Mount("/debug", middleware.Profiler())
+	r.Group(func(r chi.Router) {
+		app.requireScope(r, auth.ScopeAdmin)
+		r.Mount("/debug", middleware.Profiler())
+	})
 	r.Get("/swagger/*", swagger.Handler(
 		swagger.URL("/swagger/doc.json"),
 	))
 
+	ipCheckMiddleware, err := custommiddleware.WithIPCheck(app.Config.TrustedSubnet)
+	if err != nil {
+		logger.Log.Fatal("invalid trusted subnet configuration", logger.Error(err))
+	}
+
+	// Prometheus and Telegraf can neither encrypt nor sign their requests, so
+	// their write endpoints rely on the trusted subnet and tokens alone.
 	r.Group(func(r chi.Router) {
-		if app.Config.TrustedSubnet != "" {
-			ipCheckMiddleware, err := custommiddleware.WithIPCheck(app.Config.TrustedSubnet)
-			if err != nil {
-				logger.Log.Fatal("invalid trusted subnet configuration", logger.Error(err))
-			}
-			r.Use(ipCheckMiddleware)
-		}
+		r.Use(ipCheckMiddleware)
+		r.Use(custommiddleware.WithDecompression)
+		app.requireWrite(r)
+
+		r.Post("/api/v1/write", remoteWriteHandler.Handle)
+		r.Post("/write", influxWriteHandler.Handle)
+	})
+
+	// Browsers can neither encrypt nor sign their requests, so the dashboard
+	// and the stream rely on the trusted subnet and tokens alone. The page and
+	// its assets carry no metric data; the page asks for a token when the data
+	// API requires one.
+	r.Group(func(r chi.Router) {
+		r.Use(ipCheckMiddleware)
+
+		r.Get("/", dashboardHandler.Handle)
+		r.Get(dashboard.StaticPrefix+"*", dashboard.Assets().ServeHTTP)
+
+		r.Group(func(r chi.Router) {
+			app.requireScope(r, auth.ScopeRead)
+
+			r.Get("/api/v1/dashboard", dashboardDataHandler.Handle)
+			r.Get("/stream", streamHandler.Handle)
+		})
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(ipCheckMiddleware)
 
 		if app.PrivateKey != nil {
 			r.Use(custommiddleware.WithDecryption(app.PrivateKey))
 		}
 
+		r.Use(custommiddleware.WithDecompression)
+
 		if app.Config.HashKey != "" {
-			r.Use(custommiddleware.WithHashCheck(app.Config.HashKey))
+			r.Use(custommiddleware.WithResponseSigning(app.Config.HashKey))
+			r.Use(custommiddleware.WithHashCheck(app.Config.HashKey, app.Replay))
 		}
 
-		r.Get("/", summaryHandler.Handle)
-
-		r.Post("/updates/", storeAllHandler.Handle)
-
 		pingHandler := health.NewPingHandler(app.MetricsService)
 		r.Get("/ping", pingHandler.Handle)
 
-		r.Route("/value", func(r chi.Router) {
-			r.Post("/", getHandler.Handle)
+		r.Group(func(r chi.Router) {
+			app.requireScope(r, auth.ScopeAdmin)
+
+			r.Get("/admin/quotas", quotaHandler.Handle)
+			r.Get("/agents", agentsHandler.Handle)
+		})
+
+		r.Group(func(r chi.Router) {
+			app.requireScope(r, auth.ScopeRead)
 
-			r.Route("/counter", func(r chi.Router) {
-				r.NotFound(handler.MetricNotFound)
-				r.Get("/{metric}", counterGetHandler.Handle)
+			r.Get("/api/v1/metrics", listHandler.Handle)
+			r.Get("/api/v1/query", queryHandler.Handle)
+
+			r.Route("/value", func(r chi.Router) {
+				r.Post("/", getHandler.Handle)
+
+				r.Route("/counter", func(r chi.Router) {
+					r.NotFound(handler.MetricNotFound)
+					r.Get("/{metric}", counterGetHandler.Handle)
+				})
+
+				r.Route("/gauge", func(r chi.Router) {
+					r.NotFound(handler.MetricNotFound)
+					r.Get("/{metric}", gaugeGetHandler.Handle)
+				})
 			})
+		})
+
+		r.Group(func(r chi.Router) {
+			app.requireWrite(r)
+
+			r.Post("/updates/", storeAllHandler.Handle)
 
-			r.Route("/gauge", func(r chi.Router) {
-				r.NotFound(handler.MetricNotFound)
-				r.Get("/{metric}", gaugeGetHandler.Handle)
+			r.Route("/update", func(r chi.Router) {
+				r.Post("/", storeHandler.Handle)
+
+				r.Route("/counter", func(r chi.Router) {
+					r.NotFound(handler.MetricNotFound)
+					r.Post("/{metric}/{value}", counterPostHandler.Handle)
+				})
+
+				r.Route("/gauge", func(r chi.Router) {
+					r.NotFound(handler.MetricNotFound)
+					r.Post("/{metric}/{value}", gaugePostHandler.Handle)
+				})
 			})
 		})
 
-		r.Route("/update", func(r chi.Router) {
-			r.Post("/", storeHandler.Handle)
+		r.Route(strings.TrimSuffix(apiV2Prefix, "/"), func(r chi.Router) {
+			v2 := r
+			r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+				handler.Problem(w, r, http.StatusNotFound, handler.CodeNotFound, "no such route")
+			})
+			r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+				allowMethods(w, v2, chi.RouteContext(r.Context()).RoutePath)
+				handler.Problem(w, r, http.StatusMethodNotAllowed, handler.CodeMethodNotAllowed, "method not allowed")
+			})
+
+			r.Group(func(r chi.Router) {
+				app.requireScope(r, auth.ScopeRead)
 
-			r.Route("/counter", func(r chi.Router) {
-				r.NotFound(handler.MetricNotFound)
-				r.Post("/{metric}/{value}", counterPostHandler.Handle)
+				r.Get("/metrics", listHandler.HandleV2)
+				r.Get("/metrics/{type}/*", v2GetHandler.Handle)
 			})
 
-			r.Route("/gauge", func(r chi.Router) {
-				r.NotFound(handler.MetricNotFound)
-				r.Post("/{metric}/{value}", gaugePostHandler.Handle)
+			r.Group(func(r chi.Router) {
+				app.requireWrite(r)
+
+				r.Post("/metrics", v2StoreHandler.Handle)
+				r.Post("/metrics/batch", v2BatchHandler.Handle)
 			})
 		})
 
@@ -94,3 +192,40 @@ func (app App) Router() *chi.Mux {
 
 	return r
 }
+
+// requireWrite sets up the middleware of the ingestion routes.
+func (app App) requireWrite(r chi.Router) {
+	if app.RateLimiter != nil {
+		r.Use(custommiddleware.WithRateLimit(app.RateLimiter))
+	}
+
+	app.requireScope(r, auth.ScopeWrite)
+
+	r.Use(custommiddleware.WithAgentRegistry(app.Agents))
+
+	if app.Idempotency != nil {
+		r.Use(custommiddleware.WithIdempotency(app.Idempotency))
+	}
+}
+
+// allowMethods sets the Allow header that chi's default 405 handler sets,
+// as it is lost once a custom handler is installed. The routes must not
+// contain mounted subrouters, whose Match accepts every method.
+func allowMethods(w http.ResponseWriter, routes chi.Routes, path string) {
+	for _, method := range []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions,
+	} {
+		if routes.Match(chi.NewRouteContext(), method, path) {
+			w.Header().Add("Allow", method)
+		}
+	}
+}
+
+// requireScope protects the routes of the group with token authentication
+// when tokens are configured.
+func (app App) requireScope(r chi.Router, scope string) {
+	if app.Authenticator != nil {
+		r.Use(custommiddleware.WithAuth(app.Authenticator, scope))
+	}
+}
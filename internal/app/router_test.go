@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/koyif/metrics/internal/clientip"
+	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/history"
+	"github.com/koyif/metrics/internal/pubsub"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/service"
+)
+
+func TestRouter_BrowserRoutesWithHashKey(t *testing.T) {
+	hub := pubsub.New(0, 0)
+	store := history.New(10, 10)
+	app := App{
+		Config:         &config.Config{HashKey: "secret"},
+		MetricsService: service.NewMetricsService(repository.NewMetricsRepository(), nil, nil, hub),
+		Hub:            hub,
+		History:        store,
+		SeriesLimiter:  quota.NewLimiter(quota.Limits{}),
+		Agents:         registry.New(time.Minute),
+		ClientIP:       clientip.NewResolver(nil),
+		Replay:         replay.New(time.Minute, 100),
+	}
+	router := app.Router()
+
+	for _, path := range []string{"/", "/static/app.js", "/api/v1/dashboard", "/stream"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		if path == "/stream" {
+			cancel()
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx))
+		cancel()
+		assert.Equal(t, http.StatusOK, rec.Code, "%s needs no signature", path)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/metrics", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "the API still requires signed requests")
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes a token can be granted. The admin scope implies every other scope.
+const (
+	ScopeWrite = "write"
+	ScopeRead  = "read"
+	ScopeAdmin = "admin"
+)
+
+var (
+	// ErrUnauthenticated is returned when a request carries no valid token.
+	ErrUnauthenticated = errors.New("missing or invalid token")
+	// ErrForbidden is returned when the token lacks a scope or a metric is outside its prefixes.
+	ErrForbidden = errors.New("access denied")
+)
+
+// TokenConfig describes a token in the server config file.
+// Prefixes restrict the metric names the token may read or write; an empty list allows all names.
+type TokenConfig struct {
+	Name     string   `json:"name"`
+	Token    string   `json:"token"`
+	Scopes   []string `json:"scopes"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// String hides the token value, so the config can be logged safely.
+func (t TokenConfig) String() string {
+	return fmt.Sprintf("{Name:%s Scopes:%v Prefixes:%v}", t.Name, t.Scopes, t.Prefixes)
+}
+
+// Principal is the identity a token authenticates as.
+type Principal struct {
+	Name     string
+	Scopes   []string
+	Prefixes []string
+}
+
+// HasScope reports whether the principal was granted the scope, directly or through admin.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// AllowsMetric reports whether the metric name falls within the principal's prefixes.
+func (p *Principal) AllowsMetric(name string) bool {
+	if len(p.Prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range p.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticator resolves bearer tokens to principals.
+// Tokens are looked up by their SHA-256 digest, so lookups do not leak
+// the token value through timing.
+type Authenticator struct {
+	principals map[[sha256.Size]byte]*Principal
+}
+
+// New creates an authenticator from the configured tokens.
+// Returns an error if a token is empty, duplicated, or has no or unknown scopes.
+func New(tokens []TokenConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		principals: make(map[[sha256.Size]byte]*Principal, len(tokens)),
+	}
+
+	for i, t := range tokens {
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("token #%d", i+1)
+		}
+
+		if t.Token == "" {
+			return nil, fmt.Errorf("%s: token is empty", name)
+		}
+		if len(t.Scopes) == 0 {
+			return nil, fmt.Errorf("%s: no scopes granted", name)
+		}
+		for _, scope := range t.Scopes {
+			switch scope {
+			case ScopeWrite, ScopeRead, ScopeAdmin:
+			default:
+				return nil, fmt.Errorf("%s: unknown scope %q", name, scope)
+			}
+		}
+
+		digest := sha256.Sum256([]byte(t.Token))
+		if _, ok := a.principals[digest]; ok {
+			return nil, fmt.Errorf("%s: duplicate token", name)
+		}
+		a.principals[digest] = &Principal{
+			Name:     name,
+			Scopes:   slices.Clone(t.Scopes),
+			Prefixes: slices.Clone(t.Prefixes),
+		}
+	}
+
+	return a, nil
+}
+
+// Authenticate checks the token and the required scope.
+// Returns ErrUnauthenticated for an unknown token and ErrForbidden if the scope is not granted.
+func (a *Authenticator) Authenticate(token, scope string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	p, ok := a.principals[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	if !p.HasScope(scope) {
+		return p, fmt.Errorf("%w: %s lacks scope %s", ErrForbidden, p.Name, scope)
+	}
+
+	return p, nil
+}
+
+// BearerToken extracts the token from an Authorization header value.
+func BearerToken(header string) string {
+	const prefix = "bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the authenticated principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of the request, or nil if authentication is disabled.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// CheckMetrics returns ErrForbidden if any of the metric names falls outside
+// the prefixes of the request's principal. Requests without a principal are allowed.
+func CheckMetrics(ctx context.Context, names ...string) error {
+	p := FromContext(ctx)
+	if p == nil {
+		return nil
+	}
+
+	for _, name := range names {
+		if !p.AllowsMetric(name) {
+			return fmt.Errorf("%w: %s may not access metric %q", ErrForbidden, p.Name, name)
+		}
+	}
+
+	return nil
+}
+
+// AllowsMetric reports whether the request's principal may access the metric.
+// Requests without a principal are allowed.
+func AllowsMetric(ctx context.Context, name string) bool {
+	return CheckMetrics(ctx, name) == nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_RejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []TokenConfig
+	}{
+		{name: "empty token", tokens: []TokenConfig{{Name: "a", Scopes: []string{ScopeRead}}}},
+		{name: "no scopes", tokens: []TokenConfig{{Name: "a", Token: "x"}}},
+		{name: "unknown scope", tokens: []TokenConfig{{Name: "a", Token: "x", Scopes: []string{"delete"}}}},
+		{name: "duplicate", tokens: []TokenConfig{
+			{Name: "a", Token: "x", Scopes: []string{ScopeRead}},
+			{Name: "b", Token: "x", Scopes: []string{ScopeWrite}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.tokens)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	a, err := New([]TokenConfig{
+		{Name: "agent", Token: "agent-token", Scopes: []string{ScopeWrite}, Prefixes: []string{"host1."}},
+		{Name: "ops", Token: "admin-token", Scopes: []string{ScopeAdmin}},
+	})
+	require.NoError(t, err)
+
+	p, err := a.Authenticate("agent-token", ScopeWrite)
+	require.NoError(t, err)
+	assert.Equal(t, "agent", p.Name)
+
+	_, err = a.Authenticate("agent-token", ScopeRead)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = a.Authenticate("wrong", ScopeWrite)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	_, err = a.Authenticate("", ScopeWrite)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	for _, scope := range []string{ScopeRead, ScopeWrite, ScopeAdmin} {
+		_, err = a.Authenticate("admin-token", scope)
+		assert.NoError(t, err, "admin implies %s", scope)
+	}
+}
+
+func TestCheckMetrics(t *testing.T) {
+	assert.NoError(t, CheckMetrics(context.Background(), "anything"), "no principal means auth is disabled")
+
+	ctx := NewContext(context.Background(), &Principal{Name: "agent", Prefixes: []string{"host1.", "shared_"}})
+	assert.NoError(t, CheckMetrics(ctx, "host1.cpu", "shared_total"))
+	assert.ErrorIs(t, CheckMetrics(ctx, "host1.cpu", "host2.cpu"), ErrForbidden)
+	assert.False(t, AllowsMetric(ctx, "host2.cpu"))
+}
+
+func TestBearerToken(t *testing.T) {
+	assert.Equal(t, "abc", BearerToken("Bearer abc"))
+	assert.Equal(t, "abc", BearerToken("bearer  abc "))
+	assert.Empty(t, BearerToken("Basic abc"))
+	assert.Empty(t, BearerToken(""))
+}
+
+func TestTokenConfig_StringHidesToken(t *testing.T) {
+	s := TokenConfig{Name: "agent", Token: "s3cret", Scopes: []string{ScopeWrite}}.String()
+	assert.NotContains(t, s, "s3cret")
+}
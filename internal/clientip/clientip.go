@@ -0,0 +1,163 @@
+// Package clientip resolves the address of the client behind a connection.
+//
+// The address comes from the TCP peer. Forwarding headers such as X-Forwarded-For
+// and X-Real-IP are honored only when the peer is a trusted proxy, so a client
+// connecting directly cannot claim another address.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Header and metadata names consulted when the peer is a trusted proxy.
+const (
+	ForwardedForHeader = "X-Forwarded-For"
+	RealIPHeader       = "X-Real-IP"
+	ForwardedForKey    = "x-forwarded-for"
+	RealIPKey          = "x-real-ip"
+)
+
+// ParseCIDRs parses a comma-separated list of networks, e.g. "10.0.0.0/8,2001:db8::/32".
+// A bare address is treated as a single-host network. Empty items are skipped.
+func ParseCIDRs(list string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+			networks = append(networks, hostNetwork(ip))
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR notation %q: %w", item, err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// Contains reports whether ip belongs to any of the networks.
+func Contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolver picks the client address from the peer address and, for trusted proxies,
+// from the forwarding headers they add.
+type Resolver struct {
+	trustedProxies []*net.IPNet
+}
+
+// NewResolver creates a resolver that trusts forwarding headers from the given proxies.
+// With no proxies the peer address is always used.
+func NewResolver(trustedProxies []*net.IPNet) *Resolver {
+	return &Resolver{trustedProxies: trustedProxies}
+}
+
+// Resolve returns the client address for a connection from peer ("host:port" or a bare host).
+// forwardedFor holds the X-Forwarded-For values in the order they were received.
+//
+// X-Forwarded-For is walked from the right, skipping trusted proxies, and the first
+// untrusted hop is the client. X-Real-IP is used only when X-Forwarded-For is absent.
+// Returns nil if the peer address cannot be parsed.
+func (r *Resolver) Resolve(peer string, forwardedFor []string, realIP string) net.IP {
+	client := ParseIP(peer)
+	if client == nil || !r.trusted(client) {
+		return client
+	}
+
+	hops := splitForwardedFor(forwardedFor)
+	if len(hops) == 0 {
+		if ip := ParseIP(realIP); ip != nil {
+			return ip
+		}
+		return client
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := ParseIP(hops[i])
+		if hop == nil {
+			// A malformed entry means everything to its left is untrustworthy.
+			return client
+		}
+		client = hop
+		if !r.trusted(hop) {
+			return hop
+		}
+	}
+
+	return client
+}
+
+func (r *Resolver) trusted(ip net.IP) bool {
+	return r != nil && Contains(r.trustedProxies, ip)
+}
+
+// ParseIP parses an address with an optional port. IPv4-mapped IPv6 addresses
+// are returned in their 4-byte form so they match IPv4 networks.
+func ParseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+
+	ip := net.ParseIP(addr)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+
+	return ip
+}
+
+func splitForwardedFor(values []string) []string {
+	hops := make([]string, 0)
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	return hops
+}
+
+func hostNetwork(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the resolved client address.
+func NewContext(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// FromContext returns the client address stored by NewContext, or nil.
+func FromContext(ctx context.Context) net.IP {
+	ip, _ := ctx.Value(contextKey{}).(net.IP)
+	return ip
+}
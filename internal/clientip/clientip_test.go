@@ -0,0 +1,74 @@
+package clientip
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	networks, err := ParseCIDRs("10.0.0.0/8, 2001:db8::/32,,192.168.1.10")
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+
+	assert.True(t, Contains(networks, net.ParseIP("10.1.2.3")))
+	assert.True(t, Contains(networks, net.ParseIP("2001:db8::1")))
+	assert.True(t, Contains(networks, net.ParseIP("192.168.1.10")))
+	assert.False(t, Contains(networks, net.ParseIP("192.168.1.11")))
+
+	_, err = ParseCIDRs("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = ParseCIDRs("not-an-ip")
+	assert.Error(t, err)
+}
+
+func TestParseIP(t *testing.T) {
+	assert.Equal(t, "10.0.0.1", ParseIP("10.0.0.1:8080").String())
+	assert.Equal(t, "2001:db8::1", ParseIP("[2001:db8::1]:8080").String())
+	assert.Equal(t, "2001:db8::1", ParseIP("2001:db8::1").String())
+	assert.Equal(t, "10.0.0.1", ParseIP("::ffff:10.0.0.1").String())
+	assert.Nil(t, ParseIP("example.com:80"))
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	proxies, err := ParseCIDRs("10.0.0.0/8,fd00::/8")
+	require.NoError(t, err)
+	resolver := NewResolver(proxies)
+
+	tests := []struct {
+		name         string
+		peer         string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{name: "direct client ignores headers", peer: "203.0.113.5:1234", forwardedFor: []string{"198.51.100.1"}, realIP: "198.51.100.2", want: "203.0.113.5"},
+		{name: "trusted proxy without headers", peer: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "trusted proxy with real ip", peer: "10.0.0.1:1234", realIP: "198.51.100.2", want: "198.51.100.2"},
+		{name: "forwarded for wins over real ip", peer: "10.0.0.1:1234", forwardedFor: []string{"198.51.100.1"}, realIP: "198.51.100.2", want: "198.51.100.1"},
+		{name: "rightmost untrusted hop", peer: "10.0.0.1:1234", forwardedFor: []string{"1.1.1.1, 198.51.100.1", "10.0.0.2"}, want: "198.51.100.1"},
+		{name: "all hops trusted", peer: "10.0.0.1:1234", forwardedFor: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "malformed hop", peer: "10.0.0.1:1234", forwardedFor: []string{"198.51.100.1, garbage"}, want: "10.0.0.1"},
+		{name: "ipv6 proxy", peer: "[fd00::1]:1234", forwardedFor: []string{"2001:db8::5"}, want: "2001:db8::5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolver.Resolve(tt.peer, tt.forwardedFor, tt.realIP)
+			require.NotNil(t, got)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+
+	assert.Nil(t, resolver.Resolve("invalid", nil, ""))
+}
+
+func TestContext(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+
+	ctx := NewContext(context.Background(), net.ParseIP("10.0.0.1"))
+	assert.Equal(t, "10.0.0.1", FromContext(ctx).String())
+}
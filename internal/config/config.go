@@ -7,22 +7,53 @@ import (
 
 	"github.com/ilyakaznacheev/cleanenv"
 
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/export"
+	"github.com/koyif/metrics/internal/federation"
 	"github.com/koyif/metrics/pkg/types"
 )
 
 type Config struct {
-	Addr            string                  `json:"address" env:"ADDRESS" env-default:"localhost:8080"`
-	StoreInterval   types.DurationInSeconds `json:"store_interval" env:"STORE_INTERVAL" env-default:"300"`
-	FileStoragePath string                  `json:"store_file" env:"FILE_STORAGE_PATH" env-default:"/tmp/storage"`
-	Restore         bool                    `json:"restore" env:"RESTORE" env-default:"false"`
-	DatabaseURL     string                  `json:"database_dsn" env:"DATABASE_DSN"`
-	FilePath        string                  `json:"audit_file" env:"AUDIT_FILE"`
-	URL             string                  `json:"audit_url" env:"AUDIT_URL"`
-	HashKey         string                  `json:"hash_key" env:"KEY"`
-	CryptoKey       string                  `json:"crypto_key" env:"CRYPTO_KEY"`
-	TrustedSubnet   string                  `json:"trusted_subnet" env:"TRUSTED_SUBNET"`
-	GRPCAddr        string                  `json:"grpc_address" env:"GRPC_ADDRESS"`
-	ConfigPath      string                  `json:"-"`
+	Addr                  string                  `json:"address" env:"ADDRESS" env-default:"localhost:8080"`
+	StoreInterval         types.DurationInSeconds `json:"store_interval" env:"STORE_INTERVAL" env-default:"300"`
+	FileStoragePath       string                  `json:"store_file" env:"FILE_STORAGE_PATH" env-default:"/tmp/storage"`
+	Restore               bool                    `json:"restore" env:"RESTORE" env-default:"false"`
+	DatabaseURL           string                  `json:"database_dsn" env:"DATABASE_DSN"`
+	FilePath              string                  `json:"audit_file" env:"AUDIT_FILE"`
+	URL                   string                  `json:"audit_url" env:"AUDIT_URL"`
+	HashKey               string                  `json:"hash_key" env:"KEY"`
+	CryptoKey             string                  `json:"crypto_key" env:"CRYPTO_KEY"`
+	TrustedSubnet         string                  `json:"trusted_subnet" env:"TRUSTED_SUBNET"`
+	TrustedProxies        string                  `json:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	GRPCAddr              string                  `json:"grpc_address" env:"GRPC_ADDRESS"`
+	MaxSeries             int                     `json:"max_series" env:"MAX_SERIES"`
+	MaxNewSeriesPerMinute int                     `json:"max_new_series_per_minute" env:"MAX_NEW_SERIES_PER_MINUTE"`
+	MaxSeriesPerClient    int                     `json:"max_series_per_client" env:"MAX_SERIES_PER_CLIENT"`
+	RateLimit             float64                 `json:"rate_limit" env:"RATE_LIMIT"`
+	RateBurst             int                     `json:"rate_burst" env:"RATE_BURST"`
+	RateLimitCIDRs        string                  `json:"rate_limit_cidrs" env:"RATE_LIMIT_CIDRS"`
+	MetricNamePattern     string                  `json:"metric_name_pattern" env:"METRIC_NAME_PATTERN" env-default:"^[[:graph:]]+$"`
+	MaxMetricNameLength   int                     `json:"max_metric_name_length" env:"MAX_METRIC_NAME_LENGTH" env-default:"255"`
+	NegativeDeltaPolicy   string                  `json:"negative_delta_policy" env:"NEGATIVE_DELTA_POLICY" env-default:"allow"`
+	IdempotencyTTL        types.DurationInSeconds `json:"idempotency_ttl" env:"IDEMPOTENCY_TTL" env-default:"600"`
+	IdempotencyCacheSize  int                     `json:"idempotency_cache_size" env:"IDEMPOTENCY_CACHE_SIZE" env-default:"10000"`
+	AgentAliveTimeout     types.DurationInSeconds `json:"agent_alive_timeout" env:"AGENT_ALIVE_TIMEOUT" env-default:"60"`
+	SignatureMaxSkew      types.DurationInSeconds `json:"signature_max_skew" env:"SIGNATURE_MAX_SKEW" env-default:"300"`
+	NonceCacheSize        int                     `json:"nonce_cache_size" env:"NONCE_CACHE_SIZE" env-default:"100000"`
+	HistorySize           int                     `json:"history_size" env:"HISTORY_SIZE" env-default:"60"`
+	RemoteWriteRules      string                  `json:"remote_write_rules" env:"REMOTE_WRITE_RULES"`
+	InfluxTags            string                  `json:"influx_tags" env:"INFLUX_TAGS" env-default:"labels"`
+	InfluxCounterSuffixes string                  `json:"influx_counter_suffixes" env:"INFLUX_COUNTER_SUFFIXES"`
+	StatsdAddr            string                  `json:"statsd_address" env:"STATSD_ADDRESS"`
+	StatsdFlushInterval   types.DurationInSeconds `json:"statsd_flush_interval" env:"STATSD_FLUSH_INTERVAL" env-default:"10"`
+	GraphiteAddr          string                  `json:"graphite_address" env:"GRAPHITE_ADDRESS"`
+	GraphiteRules         string                  `json:"graphite_rules" env:"GRAPHITE_RULES"`
+	SampleRetention       string                  `json:"sample_retention" env:"SAMPLE_RETENTION"`
+	CompactionInterval    types.DurationInSeconds `json:"compaction_interval" env:"COMPACTION_INTERVAL" env-default:"60"`
+	Tokens                []auth.TokenConfig      `json:"tokens"`
+	Exporters             []export.Config         `json:"exporters"`
+	Federation            federation.Config       `json:"federation"`
+	ConfigPath            string                  `json:"-"`
 }
 
 func Load() *Config {
@@ -83,8 +114,33 @@ func setupFlags(cfg *Config) {
 	flag.StringVar(&cfg.FilePath, "audit-file", cfg.FilePath, "путь к файлу для логов аудита")
 	flag.StringVar(&cfg.URL, "audit-url", cfg.URL, "URL для отправки логов аудита")
 	flag.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "путь до файла с приватным ключом")
-	flag.StringVar(&cfg.TrustedSubnet, "t", cfg.TrustedSubnet, "доверенная подсеть в формате CIDR")
+	flag.StringVar(&cfg.TrustedSubnet, "t", cfg.TrustedSubnet, "доверенные подсети в формате CIDR через запятую")
+	flag.StringVar(&cfg.TrustedProxies, "trusted-proxies", cfg.TrustedProxies, "подсети доверенных прокси в формате CIDR через запятую, от которых принимаются X-Forwarded-For и X-Real-IP")
 	flag.StringVar(&cfg.GRPCAddr, "g", cfg.GRPCAddr, "адрес gRPC-сервера")
+	flag.IntVar(&cfg.MaxSeries, "max-series", cfg.MaxSeries, "максимальное количество уникальных метрик")
+	flag.IntVar(&cfg.MaxNewSeriesPerMinute, "max-new-series-per-minute", cfg.MaxNewSeriesPerMinute, "максимальное количество новых метрик в минуту")
+	flag.IntVar(&cfg.MaxSeriesPerClient, "max-series-per-client", cfg.MaxSeriesPerClient, "максимальное количество уникальных метрик от одного клиента")
+	flag.Float64Var(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "лимит запросов в секунду от одного клиента")
+	flag.IntVar(&cfg.RateBurst, "rate-burst", cfg.RateBurst, "допустимый всплеск запросов от одного клиента")
+	flag.StringVar(&cfg.RateLimitCIDRs, "rate-limit-cidrs", cfg.RateLimitCIDRs, "лимиты запросов для подсетей в формате cidr=rate:burst через запятую")
+	flag.StringVar(&cfg.MetricNamePattern, "metric-name-pattern", cfg.MetricNamePattern, "регулярное выражение для имён метрик")
+	flag.IntVar(&cfg.MaxMetricNameLength, "max-metric-name-length", cfg.MaxMetricNameLength, "максимальная длина имени метрики в байтах")
+	flag.StringVar(&cfg.NegativeDeltaPolicy, "negative-delta-policy", cfg.NegativeDeltaPolicy, "обработка отрицательных приращений счётчиков: allow, reject или clamp")
+	flag.Func("idempotency-ttl", "время хранения ключей идемпотентности в секундах", func(s string) error { return cfg.IdempotencyTTL.SetValue(s) })
+	flag.IntVar(&cfg.IdempotencyCacheSize, "idempotency-cache-size", cfg.IdempotencyCacheSize, "максимальное количество ключей идемпотентности в памяти")
+	flag.Func("agent-alive-timeout", "время в секундах, в течение которого агент без запросов считается активным", func(s string) error { return cfg.AgentAliveTimeout.SetValue(s) })
+	flag.Func("signature-max-skew", "допустимое расхождение времени подписи запроса с часами сервера в секундах", func(s string) error { return cfg.SignatureMaxSkew.SetValue(s) })
+	flag.IntVar(&cfg.NonceCacheSize, "nonce-cache-size", cfg.NonceCacheSize, "максимальное количество запоминаемых nonce подписанных запросов")
+	flag.IntVar(&cfg.HistorySize, "history-size", cfg.HistorySize, "количество последних значений каждой метрики, хранимых в памяти для дашборда и запросов /api/v1/query")
+	flag.StringVar(&cfg.RemoteWriteRules, "remote-write-rules", cfg.RemoteWriteRules, "правила выбора типа метрик Prometheus remote write в формате regexp=counter|gauge|drop через запятую")
+	flag.StringVar(&cfg.InfluxTags, "influx-tags", cfg.InfluxTags, "теги InfluxDB line protocol: labels — метками в имени метрики, name — в формате Graphite через точку с запятой")
+	flag.StringVar(&cfg.InfluxCounterSuffixes, "influx-counter-suffixes", cfg.InfluxCounterSuffixes, "суффиксы имён полей InfluxDB line protocol, сохраняемых как счётчики, через запятую")
+	flag.StringVar(&cfg.StatsdAddr, "statsd-address", cfg.StatsdAddr, "адрес приёма метрик по протоколу StatsD (UDP и TCP)")
+	flag.Func("statsd-flush-interval", "интервал агрегации метрик StatsD в секундах", func(s string) error { return cfg.StatsdFlushInterval.SetValue(s) })
+	flag.StringVar(&cfg.GraphiteAddr, "graphite-address", cfg.GraphiteAddr, "адрес приёма метрик по протоколу Graphite plaintext (TCP)")
+	flag.StringVar(&cfg.GraphiteRules, "graphite-rules", cfg.GraphiteRules, "правила выбора типа метрик Graphite в формате regexp=counter|gauge|drop через запятую; по умолчанию gauge")
+	flag.StringVar(&cfg.SampleRetention, "sample-retention", cfg.SampleRetention, "сроки хранения значений метрик в БД, например raw=24h,1m=30d,1h=365d; пусто — значения не сохраняются")
+	flag.Func("compaction-interval", "интервал агрегации и удаления устаревших значений метрик в секундах", func(s string) error { return cfg.CompactionInterval.SetValue(s) })
 
 	// Parse flags again - command-line flags will override JSON/env values
 	flag.Parse()
@@ -0,0 +1,85 @@
+// Package cumulative turns cumulative counter totals, as sent by Prometheus or
+// Telegraf, into the deltas stored by the metrics service.
+package cumulative
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/koyif/metrics/internal/repository/dberror"
+)
+
+type counterGetter interface {
+	Counter(metricName string) (int64, error)
+}
+
+// Tracker remembers the last total of every counter. A counter seen for the
+// first time continues from its stored value, so restarts don't count the
+// total twice. The stored value is the sum of the increases, which is only the
+// source's total while the source never reset, so a first total below it is
+// taken as the baseline and counts nothing, instead of as a reset that would
+// count the whole total again. It is safe for concurrent use.
+type Tracker struct {
+	counters counterGetter
+
+	mu     sync.Mutex
+	totals map[string]float64
+}
+
+// NewTracker creates a tracker reading stored counters from counters.
+func NewTracker(counters counterGetter) *Tracker {
+	return &Tracker{
+		counters: counters,
+		totals:   make(map[string]float64),
+	}
+}
+
+// Advance returns the increase of the counter over the totals, oldest first,
+// and records the latest one. A total lower than the previous one is taken as
+// a reset; negative totals are ignored. Counter values are whole numbers, so
+// fractional totals only count once they pass the next integer.
+func (t *Tracker) Advance(id string, totals ...float64) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, seen := t.totals[id]
+	if !seen {
+		stored, err := t.counters.Counter(id)
+		if err != nil && !errors.Is(err, dberror.ErrValueNotFound) {
+			return 0, fmt.Errorf("failed to read counter %s: %w", id, err)
+		}
+		last = float64(stored)
+	}
+
+	var delta int64
+	for _, total := range totals {
+		if total < 0 || math.IsNaN(total) || math.IsInf(total, 0) {
+			continue
+		}
+		switch {
+		case total < last && !seen:
+			// The source reset at some point before; its total is the baseline.
+		case total < last:
+			delta += int64(math.Floor(total))
+		default:
+			delta += int64(math.Floor(total)) - int64(math.Floor(last))
+		}
+		last, seen = total, true
+	}
+	t.totals[id] = last
+
+	return delta, nil
+}
+
+// Forget discards the totals of the counters, e.g. when their deltas weren't
+// stored, so their next totals continue from the stored values again.
+func (t *Tracker) Forget(ids ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, id := range ids {
+		delete(t.totals, id)
+	}
+}
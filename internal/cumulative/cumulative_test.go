@@ -0,0 +1,91 @@
+package cumulative
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/repository/dberror"
+)
+
+type storedCounters map[string]int64
+
+func (s storedCounters) Counter(name string) (int64, error) {
+	if v, ok := s[name]; ok {
+		return v, nil
+	}
+	return 0, dberror.ErrValueNotFound
+}
+
+func TestTracker_Advance(t *testing.T) {
+	stored := storedCounters{"restored": 100, "reset": 100}
+	tracker := NewTracker(stored)
+
+	advance := func(id string, totals ...float64) int64 {
+		t.Helper()
+		delta, err := tracker.Advance(id, totals...)
+		require.NoError(t, err)
+		return delta
+	}
+
+	assert.Equal(t, int64(10), advance("requests", 10), "a new counter counts its whole total")
+	assert.Equal(t, int64(5), advance("requests", 12, 15))
+	assert.Equal(t, int64(0), advance("requests", 15), "a repeated total adds nothing")
+	assert.Equal(t, int64(4), advance("requests", 4), "a lower total is a reset")
+	assert.Equal(t, int64(8), advance("requests", 8, 2, 4), "resets between totals")
+	assert.Equal(t, int64(0), advance("requests", -1, math.NaN()), "invalid totals are ignored")
+
+	assert.Equal(t, int64(20), advance("restored", 120), "continues from the stored counter")
+
+	assert.Equal(t, int64(0), advance("seconds", 0.4))
+	assert.Equal(t, int64(1), advance("seconds", 1.2), "fractional totals count whole units")
+	assert.Equal(t, int64(0), advance("seconds", 1.9))
+
+	assert.Equal(t, int64(0), advance("reset", 50), "a total below the stored counter is the baseline")
+	assert.Equal(t, int64(5), advance("reset", 55))
+	assert.Equal(t, int64(3), advance("reset", 3), "a later lower total is a reset")
+
+	tracker.Forget("requests")
+	stored["requests"] = 4
+	assert.Equal(t, int64(1), advance("requests", 5), "forgotten totals continue from the stored counter")
+}
+
+func TestTracker_ResetThenRestart(t *testing.T) {
+	stored := storedCounters{}
+	advance := func(tracker *Tracker, total float64) int64 {
+		t.Helper()
+		delta, err := tracker.Advance("requests", total)
+		require.NoError(t, err)
+		stored["requests"] += delta
+		return delta
+	}
+
+	tracker := NewTracker(stored)
+	advance(tracker, 10)
+	assert.Equal(t, int64(2), advance(tracker, 2), "the source resets")
+	require.Equal(t, int64(12), stored["requests"])
+
+	for restart := 0; restart < 2; restart++ {
+		tracker = NewTracker(stored)
+		assert.Equal(t, int64(0), advance(tracker, 3), "the first total after a restart is the baseline")
+		assert.Equal(t, int64(1), advance(tracker, 4))
+	}
+	assert.Equal(t, int64(14), stored["requests"], "the reset is never counted again")
+}
+
+type failingCounters struct{}
+
+func (failingCounters) Counter(string) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestTracker_StorageError(t *testing.T) {
+	tracker := NewTracker(failingCounters{})
+
+	_, err := tracker.Advance("requests", 1)
+	assert.Error(t, err)
+	assert.Empty(t, tracker.totals)
+}
@@ -0,0 +1,145 @@
+// Package export pushes stored metrics to remote sinks: another server of this
+// kind over /updates/ or gRPC, a Prometheus remote-write endpoint, or a webhook.
+//
+// An exporter either sends a snapshot of the current state every interval or
+// streams the updates stored since the previous interval. Batches wait in a
+// queue, on disk when a queue directory is set, until the sink accepts them,
+// and are retried with backoff; batches the sink rejects outright are dropped.
+package export
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/koyif/metrics/pkg/compress"
+	"github.com/koyif/metrics/pkg/types"
+)
+
+// Sink types.
+const (
+	// TypeUpdates federates into another server through POST /updates/.
+	TypeUpdates = "updates"
+	// TypeGRPC federates into another server through the UpdateMetrics RPC.
+	TypeGRPC = "grpc"
+	// TypeRemoteWrite sends Prometheus remote-write requests.
+	TypeRemoteWrite = "remote_write"
+	// TypeWebhook posts batches as JSON.
+	TypeWebhook = "webhook"
+)
+
+// Modes: what an exporter sends every interval.
+const (
+	// ModeSnapshot sends the current value of every metric.
+	ModeSnapshot = "snapshot"
+	// ModeStream sends the metrics updated since the previous interval.
+	ModeStream = "stream"
+)
+
+// Defaults for unset Config fields.
+const (
+	DefaultInterval        = 10 * time.Second
+	DefaultBatchSize       = 1000
+	DefaultMaxRetries      = 3
+	DefaultMaxQueueBatches = 1000
+)
+
+// Config describes an exporter in the server config file.
+type Config struct {
+	// Name identifies the exporter in logs.
+	Name string `json:"name"`
+	// Type is TypeUpdates, TypeGRPC, TypeRemoteWrite or TypeWebhook.
+	Type string `json:"type"`
+	// URL is the server address for TypeUpdates and TypeGRPC, e.g. central:8080,
+	// and the endpoint for the others.
+	URL string `json:"url"`
+	// Mode is ModeSnapshot or ModeStream, ModeSnapshot if unset.
+	Mode string `json:"mode"`
+	// Prefix limits the exported metrics to IDs starting with it.
+	Prefix string `json:"prefix"`
+	// Namespace is put in front of the exported IDs, so a federating server
+	// can tell the sources apart, e.g. eu.hits for the namespace eu.
+	Namespace string `json:"namespace"`
+	// Interval, BatchSize, MaxRetries and MaxQueueBatches fall back to the
+	// defaults when unset; a negative MaxRetries disables retries. Without
+	// QueueDir the queue is kept in memory and lost on restart. When the
+	// queue is full the queued batches but the oldest are merged with the
+	// next ones, so nothing is lost; the merged batches hold one metric per
+	// series, which can exceed MaxQueueBatches when there are many series.
+	Interval        types.DurationInSeconds `json:"interval"`
+	BatchSize       int                     `json:"batch_size"`
+	MaxRetries      int                     `json:"max_retries"`
+	QueueDir        string                  `json:"queue_dir"`
+	MaxQueueBatches int                     `json:"max_queue_batches"`
+	// Token is sent as a bearer token.
+	Token string `json:"token"`
+	// HashKey signs federation requests like an agent does.
+	HashKey string `json:"hash_key"`
+	// CryptoKey is the path to the public key encrypting /updates/ requests.
+	CryptoKey   string `json:"crypto_key"`
+	Compression string `json:"compression"`
+	// Headers are added to remote-write and webhook requests.
+	Headers map[string]string `json:"headers"`
+}
+
+// String hides the credentials, so the config can be logged safely.
+func (c Config) String() string {
+	return fmt.Sprintf("{Name:%s Type:%s URL:%s Mode:%s Prefix:%s Namespace:%s QueueDir:%s}",
+		c.Name, c.Type, c.URL, c.Mode, c.Prefix, c.Namespace, c.QueueDir)
+}
+
+// withDefaults validates the config and fills in the unset fields.
+func (c Config) withDefaults() (Config, error) {
+	if c.Name == "" {
+		c.Name = c.Type
+	}
+
+	switch c.Type {
+	case TypeUpdates, TypeGRPC, TypeRemoteWrite, TypeWebhook:
+	default:
+		return Config{}, fmt.Errorf("exporter %s: invalid type %q: expected %s, %s, %s or %s",
+			c.Name, c.Type, TypeUpdates, TypeGRPC, TypeRemoteWrite, TypeWebhook)
+	}
+
+	if c.URL == "" {
+		return Config{}, fmt.Errorf("exporter %s: url is required", c.Name)
+	}
+	if c.Type == TypeUpdates && !strings.Contains(c.URL, "://") {
+		c.URL = "http://" + c.URL
+	}
+	if c.Type != TypeGRPC {
+		if _, err := url.ParseRequestURI(c.URL); err != nil {
+			return Config{}, fmt.Errorf("exporter %s: invalid url: %w", c.Name, err)
+		}
+	}
+
+	switch c.Mode {
+	case "":
+		c.Mode = ModeSnapshot
+	case ModeSnapshot, ModeStream:
+	default:
+		return Config{}, fmt.Errorf("exporter %s: invalid mode %q: expected %s or %s", c.Name, c.Mode, ModeSnapshot, ModeStream)
+	}
+
+	if !compress.Supported(c.Compression) {
+		return Config{}, fmt.Errorf("exporter %s: %w: %q", c.Name, compress.ErrUnsupportedEncoding, c.Compression)
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = types.DurationInSeconds(DefaultInterval)
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	} else if c.MaxRetries == 0 {
+		c.MaxRetries = DefaultMaxRetries
+	}
+	if c.MaxQueueBatches <= 0 {
+		c.MaxQueueBatches = DefaultMaxQueueBatches
+	}
+
+	return c, nil
+}
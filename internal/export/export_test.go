@@ -0,0 +1,392 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/pubsub"
+	"github.com/koyif/metrics/internal/repository/dberror"
+	"github.com/koyif/metrics/pkg/types"
+)
+
+type source struct {
+	counters map[string]int64
+	gauges   map[string]float64
+}
+
+func (s *source) AllMetrics() []models.Metrics {
+	metrics := make([]models.Metrics, 0, len(s.counters)+len(s.gauges))
+	for id, delta := range s.counters {
+		metrics = append(metrics, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+	}
+	for id, value := range s.gauges {
+		metrics = append(metrics, models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+	}
+	return metrics
+}
+
+func (s *source) Counter(metricName string) (int64, error) {
+	value, ok := s.counters[metricName]
+	if !ok {
+		return 0, dberror.ErrValueNotFound
+	}
+	return value, nil
+}
+
+// receiver records the /updates/ requests and answers with the queued statuses.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	keys     []string
+	batches  [][]models.Metrics
+}
+
+func (rcv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	status := http.StatusOK
+	if len(rcv.statuses) > 0 {
+		status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+	}
+	rcv.keys = append(rcv.keys, r.Header.Get(idempotency.HeaderName))
+	if status == http.StatusOK {
+		var metrics []models.Metrics
+		if err := json.NewDecoder(r.Body).Decode(&metrics); err == nil {
+			rcv.batches = append(rcv.batches, metrics)
+		}
+	}
+	w.WriteHeader(status)
+}
+
+func byID(batches [][]models.Metrics) map[string]models.Metrics {
+	m := make(map[string]models.Metrics)
+	for _, batch := range batches {
+		for _, metric := range batch {
+			m[metric.ID] = metric
+		}
+	}
+	return m
+}
+
+func TestConfig_withDefaults(t *testing.T) {
+	cfg, err := Config{Type: TypeUpdates, URL: "central:8080"}.withDefaults()
+	require.NoError(t, err)
+	assert.Equal(t, "http://central:8080", cfg.URL)
+	assert.Equal(t, TypeUpdates, cfg.Name)
+	assert.Equal(t, ModeSnapshot, cfg.Mode)
+	assert.Equal(t, DefaultInterval, cfg.Interval.Value())
+	assert.Equal(t, DefaultBatchSize, cfg.BatchSize)
+	assert.Equal(t, DefaultMaxRetries, cfg.MaxRetries)
+
+	for _, cfg := range []Config{
+		{Type: "kafka", URL: "http://x"},
+		{Type: TypeWebhook},
+		{Type: TypeWebhook, URL: "not a url"},
+		{Type: TypeWebhook, URL: "http://x", Mode: "sometimes"},
+		{Type: TypeWebhook, URL: "http://x", Compression: "br"},
+	} {
+		_, err := cfg.withDefaults()
+		assert.Error(t, err, cfg)
+	}
+
+	assert.NotContains(t, Config{Type: TypeUpdates, Token: "secret", HashKey: "key"}.String(), "secret")
+}
+
+func TestExporter_SnapshotDeltas(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	src := &source{
+		counters: map[string]int64{"app.requests": 10, "other.requests": 5},
+		gauges:   map[string]float64{"app.load": 0.5},
+	}
+	dir := t.TempDir()
+	cfg := Config{Type: TypeUpdates, URL: srv.URL, Prefix: "app.", QueueDir: dir}
+	e, err := New(cfg, src, nil)
+	require.NoError(t, err)
+
+	e.Export()
+	e.deliver(context.Background(), 0)
+	got := byID(rcv.batches)
+	require.Len(t, got, 2, "only metrics with the prefix are exported")
+	assert.Equal(t, int64(10), *got["app.requests"].Delta, "the first snapshot sends the totals")
+	assert.InDelta(t, 0.5, *got["app.load"].Value, 0)
+
+	src.counters["app.requests"] = 13
+	rcv.batches = nil
+	e.Export()
+	e.deliver(context.Background(), 0)
+	assert.Equal(t, int64(3), *byID(rcv.batches)["app.requests"].Delta, "later snapshots send the increase")
+
+	// A restarted exporter continues from the saved totals.
+	src.counters["app.requests"] = 14
+	rcv.batches = nil
+	e, err = New(cfg, src, nil)
+	require.NoError(t, err)
+	e.Export()
+	e.deliver(context.Background(), 0)
+	assert.Equal(t, int64(1), *byID(rcv.batches)["app.requests"].Delta)
+}
+
+func TestExporter_Retries(t *testing.T) {
+	rcv := &receiver{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	src := &source{gauges: map[string]float64{"load": 1}}
+	e, err := New(Config{Type: TypeUpdates, URL: srv.URL}, src, nil)
+	require.NoError(t, err)
+	e.retryDelay = time.Millisecond
+
+	e.Export()
+	e.deliver(context.Background(), 1)
+	assert.Equal(t, 1, e.queue.Len(), "the batch stays queued when retries run out")
+
+	e.deliver(context.Background(), 1)
+	assert.Equal(t, 0, e.queue.Len())
+	require.Len(t, rcv.batches, 1)
+	require.Len(t, rcv.keys, 3)
+	assert.Equal(t, rcv.keys[0], rcv.keys[2], "retries keep the idempotency key")
+
+	rcv.statuses = []int{http.StatusBadRequest}
+	e.Export()
+	e.Export()
+	e.deliver(context.Background(), 3)
+	assert.Equal(t, 0, e.queue.Len(), "rejected batches are dropped")
+	assert.Len(t, rcv.batches, 2, "later batches are still delivered")
+}
+
+func TestExporter_Namespace(t *testing.T) {
+	src := &source{counters: map[string]int64{"hits": 3}}
+	e, err := New(Config{Type: TypeWebhook, URL: "http://localhost", Namespace: "eu"}, src, nil)
+	require.NoError(t, err)
+
+	e.Export()
+	batch, ok := e.queue.Front()
+	require.True(t, ok)
+	require.Len(t, batch.Metrics, 1)
+	assert.Equal(t, "eu.hits", batch.Metrics[0].ID)
+}
+
+func TestExporter_BatchingAndQueueLimit(t *testing.T) {
+	src := &source{gauges: map[string]float64{"a": 1, "b": 2, "c": 3}}
+	e, err := New(Config{Type: TypeWebhook, URL: "http://localhost", BatchSize: 2, MaxQueueBatches: 3}, src, nil)
+	require.NoError(t, err)
+
+	e.Export()
+	assert.Equal(t, 2, e.queue.Len())
+	batch, _ := e.queue.Front()
+	assert.Len(t, batch.Metrics, 2)
+
+	src.gauges["a"] = 4
+	e.Export()
+	assert.Equal(t, 3, e.queue.Len(), "queued batches are merged when the queue is full")
+	batch, _ = e.queue.Front()
+	assert.Equal(t, []string{"a", "b"}, ids(batch.Metrics), "the oldest batch stays as it was")
+
+	var queued []models.Metrics
+	for e.queue.Len() > 0 {
+		batch, _ = e.queue.Front()
+		queued = append(queued, batch.Metrics...)
+		require.NoError(t, e.queue.Pop())
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a", "b"}, ids(queued))
+	assert.InDelta(t, 4, *queued[3].Value, 0, "merged gauges keep the last value")
+}
+
+func TestExporter_QueueLimitKeepsDeltas(t *testing.T) {
+	src := &source{counters: map[string]int64{"hits": 1, "errors": 1}}
+	e, err := New(Config{Type: TypeUpdates, URL: "http://localhost", BatchSize: 1, MaxQueueBatches: 3}, src, nil)
+	require.NoError(t, err)
+
+	e.Export()
+	src.counters["hits"], src.counters["errors"] = 3, 2
+	e.Export()
+	src.counters["hits"] = 6
+	e.Export()
+
+	sums := make(map[string]int64)
+	for e.queue.Len() > 0 {
+		batch, _ := e.queue.Front()
+		for _, m := range batch.Metrics {
+			sums[m.ID] += *m.Delta
+		}
+		require.NoError(t, e.queue.Pop())
+	}
+	assert.Equal(t, map[string]int64{"hits": 6, "errors": 2}, sums, "no increase is lost when the queue is full")
+}
+
+func TestExporter_SnapshotTotalBelowExported(t *testing.T) {
+	src := &source{counters: map[string]int64{"hits": 10}}
+	e, err := New(Config{Type: TypeUpdates, URL: "http://localhost"}, src, nil)
+	require.NoError(t, err)
+
+	e.Export()
+	require.NoError(t, e.queue.Pop())
+
+	// The server restarted without its metrics and counted 4 since.
+	src.counters["hits"] = 4
+	e.Export()
+	batch, ok := e.queue.Front()
+	require.True(t, ok)
+	require.Len(t, batch.Metrics, 1)
+	assert.Equal(t, int64(4), *batch.Metrics[0].Delta)
+}
+
+func ids(metrics []models.Metrics) []string {
+	ids := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestExporter_Stream(t *testing.T) {
+	hub := pubsub.New(0, 0)
+	src := &source{counters: map[string]int64{"hits": 42}}
+
+	tests := []struct {
+		sinkType  string
+		wantDelta int64
+	}{
+		{sinkType: TypeUpdates, wantDelta: 3},
+		{sinkType: TypeRemoteWrite, wantDelta: 42},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sinkType, func(t *testing.T) {
+			e, err := New(Config{Type: tt.sinkType, URL: "http://localhost", Mode: ModeStream}, src, hub)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go e.receive(ctx, done)
+			require.Eventually(t, func() bool { return hub.Subscribers() == 1 }, time.Second, time.Millisecond)
+
+			one, two, load, last := int64(1), int64(2), 0.5, 0.7
+			hub.Publish([]models.Metrics{
+				{ID: "hits", MType: models.Counter, Delta: &one},
+				{ID: "load", MType: models.Gauge, Value: &load},
+				{ID: "hits", MType: models.Counter, Delta: &two},
+				{ID: "load", MType: models.Gauge, Value: &last},
+			})
+			cancel()
+			<-done
+
+			metrics := e.collectUpdates()
+			require.Len(t, metrics, 2, "updates are merged per series")
+			assert.Equal(t, tt.wantDelta, *metrics[0].Delta)
+			assert.InDelta(t, 0.7, *metrics[1].Value, 0)
+			assert.Empty(t, e.collectUpdates())
+		})
+	}
+}
+
+func TestExporter_Run(t *testing.T) {
+	rcv := &receiver{}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	src := &source{counters: map[string]int64{"hits": 7}}
+	e, err := New(Config{Type: TypeUpdates, URL: srv.URL, Interval: types.DurationInSeconds(time.Hour)}, src, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e.Run(ctx)
+
+	assert.Equal(t, int64(7), *byID(rcv.batches)["hits"].Delta, "shutting down exports the final state")
+}
+
+func TestNewExporters_SharedQueueDir(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewExporters([]Config{
+		{Name: "a", Type: TypeWebhook, URL: "http://a", QueueDir: dir},
+		{Name: "b", Type: TypeWebhook, URL: "http://b", QueueDir: dir + "/"},
+	}, &source{}, nil)
+	assert.Error(t, err)
+}
+
+func TestFileQueue(t *testing.T) {
+	dir := t.TempDir()
+	q, err := newFileQueue(dir)
+	require.NoError(t, err)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Push(Batch{Key: key}))
+	}
+	require.NoError(t, q.Pop())
+
+	q, err = newFileQueue(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, q.Len(), "batches survive a restart")
+	batch, ok := q.Front()
+	require.True(t, ok)
+	assert.Equal(t, "b", batch.Key)
+
+	require.NoError(t, q.Push(Batch{Key: "d"}))
+	var keys []string
+	for batch, ok := q.Front(); ok; batch, ok = q.Front() {
+		keys = append(keys, batch.Key)
+		require.NoError(t, q.Pop())
+	}
+	assert.Equal(t, []string{"b", "c", "d"}, keys)
+}
+
+func TestRemoteWriteSink(t *testing.T) {
+	var got proto.WriteRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "tenant-1", r.Header.Get("X-Scope-OrgID"))
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		require.NoError(t, protobuf.Unmarshal(data, &got))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s := newRemoteWriteSink(Config{URL: srv.URL, Headers: map[string]string{"X-Scope-OrgID": "tenant-1"}})
+	total, load := int64(12), 0.25
+	now := time.UnixMilli(1700000000000)
+	require.NoError(t, s.Send(context.Background(), Batch{Timestamp: now, Metrics: []models.Metrics{
+		{ID: `http_requests_total{code="200"}`, MType: models.Counter, Delta: &total},
+		{ID: "cron.backup-duration", MType: models.Gauge, Value: &load},
+	}}))
+
+	require.Len(t, got.Timeseries, 2)
+	labels := got.Timeseries[0].Labels
+	require.Len(t, labels, 2)
+	assert.Equal(t, "__name__", labels[0].Name)
+	assert.Equal(t, "http_requests_total", labels[0].Value)
+	assert.Equal(t, "code", labels[1].Name)
+	assert.InDelta(t, 12, got.Timeseries[0].Samples[0].Value, 0)
+	assert.Equal(t, now.UnixMilli(), got.Timeseries[0].Samples[0].Timestamp)
+
+	assert.Equal(t, "cron_backup_duration", got.Timeseries[1].Labels[0].Value)
+	require.Len(t, got.Metadata, 2)
+	assert.Equal(t, proto.MetricMetadata_GAUGE, got.Metadata[0].Type)
+	assert.Equal(t, proto.MetricMetadata_COUNTER, got.Metadata[1].Type)
+}
+
+func TestPromName(t *testing.T) {
+	assert.Equal(t, "cpu_load", promName("cpu.load"))
+	assert.Equal(t, "_1m:load", promName("1m:load"))
+	assert.Equal(t, "Alloc", promName("Alloc"))
+}
@@ -0,0 +1,508 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koyif/metrics/internal/federation"
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/pubsub"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const (
+	// shutdownTimeout bounds the last delivery on shutdown; what isn't
+	// delivered by then stays queued.
+	shutdownTimeout = 5 * time.Second
+	// maxRetryDelay caps the backoff between retries.
+	maxRetryDelay = 30 * time.Second
+	// stateFile keeps the counter totals of the last snapshot in the queue directory.
+	stateFile = "snapshot.json"
+)
+
+type metricsSource interface {
+	AllMetrics() []models.Metrics
+	Counter(metricName string) (int64, error)
+}
+
+type subscriber interface {
+	Subscribe(filter pubsub.Filter) (*pubsub.Subscription, error)
+	Unsubscribe(s *pubsub.Subscription)
+}
+
+// Exporter pushes metrics to one sink.
+type Exporter struct {
+	cfg        Config
+	sink       sink
+	queue      queue
+	source     metricsSource
+	hub        subscriber
+	form       int
+	retryDelay time.Duration
+
+	// exported holds the counter totals of the last snapshot, for sinks taking
+	// deltas. It is saved with the queue, so restarts don't send the totals again.
+	exported map[string]int64
+
+	mu      sync.Mutex
+	pending map[string]models.Metrics
+	order   []string
+}
+
+// NewExporters creates an exporter per config. Exporters with a queue
+// directory need one of their own.
+func NewExporters(configs []Config, source metricsSource, hub subscriber) ([]*Exporter, error) {
+	exporters := make([]*Exporter, 0, len(configs))
+	queueDirs := make(map[string]string)
+	for _, cfg := range configs {
+		e, err := New(cfg, source, hub)
+		if err != nil {
+			for _, created := range exporters {
+				_ = created.sink.Close()
+			}
+			return nil, err
+		}
+
+		if dir := e.cfg.QueueDir; dir != "" {
+			dir = filepath.Clean(dir)
+			if other, ok := queueDirs[dir]; ok {
+				_ = e.sink.Close()
+				for _, created := range exporters {
+					_ = created.sink.Close()
+				}
+				return nil, fmt.Errorf("exporters %s and %s share the queue directory %s", other, e.cfg.Name, dir)
+			}
+			queueDirs[dir] = e.cfg.Name
+		}
+
+		exporters = append(exporters, e)
+	}
+
+	return exporters, nil
+}
+
+// New creates an exporter reading metrics from source and, in stream mode,
+// updates from hub.
+func New(cfg Config, source metricsSource, hub subscriber) (*Exporter, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Exporter{
+		cfg:        cfg,
+		source:     source,
+		hub:        hub,
+		form:       counterForm(cfg.Type),
+		retryDelay: time.Second,
+		exported:   make(map[string]int64),
+		pending:    make(map[string]models.Metrics),
+	}
+
+	if cfg.QueueDir == "" {
+		e.queue = newMemoryQueue()
+	} else {
+		q, err := newFileQueue(cfg.QueueDir)
+		if err != nil {
+			return nil, fmt.Errorf("exporter %s: %w", cfg.Name, err)
+		}
+		e.queue = q
+
+		if err := e.loadState(); err != nil {
+			return nil, fmt.Errorf("exporter %s: %w", cfg.Name, err)
+		}
+	}
+
+	e.sink, err = newSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Run exports every interval until the context is done, then exports once
+// more and makes a last delivery attempt.
+func (e *Exporter) Run(ctx context.Context) {
+	defer func() {
+		if err := e.sink.Close(); err != nil {
+			logger.Log.Warn("failed to close exporter", logger.String("exporter", e.cfg.Name), logger.Error(err))
+		}
+	}()
+
+	receiving := make(chan struct{})
+	if e.cfg.Mode == ModeStream {
+		go e.receive(ctx, receiving)
+	} else {
+		close(receiving)
+	}
+
+	logger.Log.Info("starting exporter",
+		logger.String("exporter", e.cfg.Name),
+		logger.String("type", e.cfg.Type),
+		logger.String("mode", e.cfg.Mode),
+		logger.Int("queued", e.queue.Len()))
+
+	ticker := time.NewTicker(e.cfg.Interval.Value())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			<-receiving
+			e.Export()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			e.deliver(shutdownCtx, 0)
+			cancel()
+
+			if n := e.queue.Len(); n > 0 {
+				logger.Log.Warn("exporter stopped with undelivered batches", logger.String("exporter", e.cfg.Name), logger.Int("queued", n))
+			}
+			return
+		case <-ticker.C:
+			e.Export()
+			e.deliver(ctx, e.cfg.MaxRetries)
+		}
+	}
+}
+
+// Export queues the metrics of the current interval in batches.
+func (e *Exporter) Export() {
+	metrics, commit := e.collect()
+	if len(metrics) == 0 {
+		return
+	}
+	if e.cfg.Namespace != "" {
+		for i := range metrics {
+			metrics[i].ID = federation.Namespaced(e.cfg.Namespace, metrics[i].ID)
+		}
+	}
+
+	batches := (len(metrics) + e.cfg.BatchSize - 1) / e.cfg.BatchSize
+	if e.queue.Len()+batches > e.cfg.MaxQueueBatches && e.queue.Len() > 1 {
+		var err error
+		if metrics, err = e.compact(metrics); err != nil {
+			logger.Log.Error("failed to merge queued batches", logger.String("exporter", e.cfg.Name), logger.Error(err))
+			return
+		}
+	}
+
+	now := time.Now()
+	for start := 0; start < len(metrics); start += e.cfg.BatchSize {
+		end := min(start+e.cfg.BatchSize, len(metrics))
+		batch := Batch{Key: idempotency.NewKey(), Timestamp: now, Metrics: metrics[start:end]}
+		if err := e.queue.Push(batch); err != nil {
+			logger.Log.Error("failed to queue export batch", logger.String("exporter", e.cfg.Name), logger.Error(err))
+			return
+		}
+	}
+
+	if commit != nil {
+		commit()
+	}
+}
+
+// compact takes the queued batches but the oldest out of the queue and returns
+// them merged with the metrics. The oldest batch stays queued as it is: it may
+// already have reached the sink, and its key keeps a retry from counting it
+// twice, which merging it into a new batch wouldn't.
+func (e *Exporter) compact(metrics []models.Metrics) ([]models.Metrics, error) {
+	logger.Log.Warn("exporter queue is full, merging the queued batches", logger.String("exporter", e.cfg.Name), logger.Int("queued", e.queue.Len()))
+
+	oldest, _ := e.queue.Front()
+	if err := e.queue.Pop(); err != nil {
+		return nil, err
+	}
+
+	var queued [][]models.Metrics
+	for {
+		batch, ok := e.queue.Front()
+		if !ok {
+			break
+		}
+		if err := e.queue.Pop(); err != nil {
+			return nil, err
+		}
+		queued = append(queued, batch.Metrics)
+	}
+
+	if err := e.queue.Push(oldest); err != nil {
+		return nil, err
+	}
+
+	return e.merge(append(queued, metrics)...), nil
+}
+
+// merge folds the metrics of the batches, oldest first, into one per series:
+// counter increases add up, while gauges and counter totals keep the last value.
+func (e *Exporter) merge(batches ...[]models.Metrics) []models.Metrics {
+	merged := make([]models.Metrics, 0)
+	index := make(map[string]int)
+	for _, batch := range batches {
+		for _, m := range batch {
+			key := m.MType + ":" + m.ID
+			i, seen := index[key]
+			if !seen {
+				index[key] = len(merged)
+				merged = append(merged, m)
+				continue
+			}
+			if m.MType == models.Counter && e.sendsIncreases() && m.Delta != nil && merged[i].Delta != nil {
+				delta := *merged[i].Delta + *m.Delta
+				m.Delta = &delta
+			}
+			merged[i] = m
+		}
+	}
+
+	return merged
+}
+
+// sendsIncreases reports whether the queued counters are increases rather than totals.
+func (e *Exporter) sendsIncreases() bool {
+	switch e.form {
+	case countersAsDeltas:
+		return true
+	case countersAsTotals:
+		return false
+	default:
+		return e.cfg.Mode == ModeStream
+	}
+}
+
+// collect returns the metrics of the current interval in the form the sink
+// expects. The snapshot totals are only recorded by commit, once the metrics
+// are queued.
+func (e *Exporter) collect() ([]models.Metrics, func()) {
+	if e.cfg.Mode == ModeStream {
+		return e.collectUpdates(), nil
+	}
+
+	return e.collectSnapshot()
+}
+
+func (e *Exporter) collectUpdates() []models.Metrics {
+	e.mu.Lock()
+	order, pending := e.order, e.pending
+	e.order, e.pending = nil, make(map[string]models.Metrics)
+	e.mu.Unlock()
+
+	metrics := make([]models.Metrics, 0, len(order))
+	for _, id := range order {
+		m := pending[id]
+		if m.MType == models.Counter && e.form == countersAsTotals {
+			total, err := e.source.Counter(id)
+			if err != nil {
+				logger.Log.Warn("failed to read exported counter", logger.String("exporter", e.cfg.Name), logger.String("name", id), logger.Error(err))
+				continue
+			}
+			m.Delta = &total
+		}
+		metrics = append(metrics, m)
+	}
+
+	return metrics
+}
+
+func (e *Exporter) collectSnapshot() ([]models.Metrics, func()) {
+	all := e.source.AllMetrics()
+
+	metrics := make([]models.Metrics, 0, len(all))
+	totals := make(map[string]int64)
+	for _, m := range all {
+		if !strings.HasPrefix(m.ID, e.cfg.Prefix) {
+			continue
+		}
+		if m.MType == models.Gauge {
+			metrics = append(metrics, m)
+			continue
+		}
+		id, total := m.ID, *m.Delta
+		totals[id] = total
+
+		delta := total
+		if e.form == countersAsDeltas {
+			// A total below the exported one means the counter started over,
+			// e.g. after a restart without restored metrics, so all of it is
+			// new; counters that disappeared and came back start from zero too.
+			if exported := e.exported[id]; total >= exported {
+				delta -= exported
+			}
+			if delta == 0 {
+				continue
+			}
+		}
+		metrics = append(metrics, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].ID < metrics[j].ID })
+
+	if e.form != countersAsDeltas {
+		return metrics, nil
+	}
+
+	return metrics, func() {
+		e.exported = totals
+		if err := e.saveState(); err != nil {
+			logger.Log.Error("failed to save exporter state", logger.String("exporter", e.cfg.Name), logger.Error(err))
+		}
+	}
+}
+
+// receive records the stored updates until the context is done. When the
+// exporter falls behind the hub drops it and the missed updates are lost.
+func (e *Exporter) receive(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		sub, err := e.hub.Subscribe(pubsub.Filter{Prefix: e.cfg.Prefix})
+		if err != nil {
+			logger.Log.Warn("exporter failed to subscribe to updates", logger.String("exporter", e.cfg.Name), logger.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.cfg.Interval.Value()):
+				continue
+			}
+		}
+
+		stop := context.AfterFunc(ctx, func() { e.hub.Unsubscribe(sub) })
+		for event := range sub.Events() {
+			e.record(event)
+		}
+		stop()
+
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Log.Warn("exporter fell behind the updates, some were lost", logger.String("exporter", e.cfg.Name))
+	}
+}
+
+// record merges the update into the interval: gauges keep the last value,
+// counter increases add up.
+func (e *Exporter) record(event pubsub.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	m, seen := e.pending[event.ID]
+	if !seen {
+		e.order = append(e.order, event.ID)
+	}
+
+	switch {
+	case event.MType == models.Counter && event.Delta != nil:
+		var delta int64
+		if seen && m.Delta != nil {
+			delta = *m.Delta
+		}
+		delta += *event.Delta
+		m = models.Metrics{ID: event.ID, MType: models.Counter, Delta: &delta}
+	case event.Value != nil:
+		value := *event.Value
+		m = models.Metrics{ID: event.ID, MType: event.MType, Value: &value}
+	default:
+		if !seen {
+			e.order = e.order[:len(e.order)-1]
+		}
+		return
+	}
+	e.pending[event.ID] = m
+}
+
+// deliver sends the queued batches in order until the queue is empty or a
+// batch can't be delivered even after retries; it stays queued for the next interval.
+func (e *Exporter) deliver(ctx context.Context, retries int) {
+	for {
+		batch, ok := e.queue.Front()
+		if !ok {
+			return
+		}
+
+		err := e.send(ctx, batch, retries)
+		if err != nil && !errors.Is(err, errRejected) {
+			logger.Log.Warn("export failed, batch stays queued",
+				logger.String("exporter", e.cfg.Name),
+				logger.Int("queued", e.queue.Len()),
+				logger.Error(err))
+			return
+		}
+
+		if err != nil {
+			logger.Log.Error("export batch rejected, dropping it",
+				logger.String("exporter", e.cfg.Name),
+				logger.Int("metrics", len(batch.Metrics)),
+				logger.Error(err))
+		} else {
+			logger.Log.Debug("exported batch", logger.String("exporter", e.cfg.Name), logger.Int("metrics", len(batch.Metrics)))
+		}
+
+		if err := e.queue.Pop(); err != nil {
+			logger.Log.Error("failed to remove delivered batch", logger.String("exporter", e.cfg.Name), logger.Error(err))
+			return
+		}
+	}
+}
+
+// send delivers the batch, retrying with exponential backoff.
+func (e *Exporter) send(ctx context.Context, batch Batch, retries int) error {
+	delay := e.retryDelay
+	var err error
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		err = e.sink.Send(attemptCtx, batch)
+		cancel()
+		if err == nil || errors.Is(err, errRejected) || attempt >= retries {
+			return err
+		}
+
+		logger.Log.Debug("export failed, retrying",
+			logger.String("exporter", e.cfg.Name),
+			logger.String("delay", delay.String()),
+			logger.Error(err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxRetryDelay)
+	}
+}
+
+func (e *Exporter) loadState() error {
+	data, err := os.ReadFile(filepath.Join(e.cfg.QueueDir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read exporter state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &e.exported); err != nil {
+		return fmt.Errorf("failed to parse exporter state: %w", err)
+	}
+
+	return nil
+}
+
+func (e *Exporter) saveState() error {
+	if e.cfg.QueueDir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(e.exported)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(e.cfg.QueueDir, stateFile), data)
+}
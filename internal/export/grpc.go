@@ -0,0 +1,81 @@
+package export
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	_ "github.com/koyif/metrics/internal/grpc/compression"
+	"github.com/koyif/metrics/internal/grpc/converter"
+	"github.com/koyif/metrics/internal/grpc/signing"
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/pkg/compress"
+)
+
+// grpcSink federates into another server through the UpdateMetrics RPC.
+type grpcSink struct {
+	cfg    Config
+	conn   *grpc.ClientConn
+	client proto.MetricsClient
+}
+
+func newGRPCSink(cfg Config) (*grpcSink, error) {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if cfg.Compression != "" && cfg.Compression != compress.Identity {
+		if encoding.GetCompressor(cfg.Compression) == nil {
+			return nil, fmt.Errorf("exporter %s: %w: %q", cfg.Name, compress.ErrUnsupportedEncoding, cfg.Compression)
+		}
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(cfg.Compression)))
+	}
+
+	conn, err := grpc.NewClient(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("exporter %s: failed to create gRPC connection: %w", cfg.Name, err)
+	}
+
+	return &grpcSink{
+		cfg:    cfg,
+		conn:   conn,
+		client: proto.NewMetricsClient(conn),
+	}, nil
+}
+
+func (s *grpcSink) Send(ctx context.Context, batch Batch) error {
+	req := &proto.UpdateMetricsRequest{Metrics: converter.ModelsToProto(batch.Metrics)}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, idempotency.MetadataKey, batch.Key)
+	if s.cfg.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+s.cfg.Token)
+	}
+	if s.cfg.HashKey != "" {
+		var err error
+		if ctx, err = signing.AppendRequestSignature(ctx, s.cfg.HashKey, req); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.client.UpdateMetrics(ctx, req); err != nil {
+		switch status.Code(err) {
+		case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded,
+			codes.Canceled, codes.Internal, codes.Unknown:
+			return err
+		default:
+			return fmt.Errorf("%w: %w", errRejected, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *grpcSink) Close() error {
+	return s.conn.Close()
+}
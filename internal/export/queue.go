@@ -0,0 +1,166 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const batchFileSuffix = ".batch.json"
+
+// Batch is a unit of delivery. Its key stays the same across retries, so a
+// federated server stores it once even if a response was lost.
+type Batch struct {
+	Key       string           `json:"key"`
+	Timestamp time.Time        `json:"timestamp"`
+	Metrics   []models.Metrics `json:"metrics"`
+}
+
+// queue holds the batches waiting for delivery, oldest first.
+type queue interface {
+	Push(batch Batch) error
+	Front() (Batch, bool)
+	Pop() error
+	Len() int
+}
+
+type memoryQueue struct {
+	batches []Batch
+}
+
+func newMemoryQueue() *memoryQueue {
+	return &memoryQueue{}
+}
+
+func (q *memoryQueue) Push(batch Batch) error {
+	q.batches = append(q.batches, batch)
+	return nil
+}
+
+func (q *memoryQueue) Front() (Batch, bool) {
+	if len(q.batches) == 0 {
+		return Batch{}, false
+	}
+	return q.batches[0], true
+}
+
+func (q *memoryQueue) Pop() error {
+	if len(q.batches) > 0 {
+		q.batches[0] = Batch{}
+		q.batches = q.batches[1:]
+	}
+	return nil
+}
+
+func (q *memoryQueue) Len() int {
+	return len(q.batches)
+}
+
+// fileQueue keeps every batch in its own file, so batches survive restarts.
+// Files are named after a sequence number that orders them.
+type fileQueue struct {
+	dir   string
+	next  uint64
+	files []string
+}
+
+func newFileQueue(dir string) (*fileQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue directory: %w", err)
+	}
+
+	q := &fileQueue{dir: dir}
+	for _, entry := range entries {
+		seq, ok := strings.CutSuffix(entry.Name(), batchFileSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		n, err := strconv.ParseUint(seq, 10, 64)
+		if err != nil {
+			continue
+		}
+		q.files = append(q.files, entry.Name())
+		q.next = max(q.next, n+1)
+	}
+	sort.Strings(q.files)
+
+	return q, nil
+}
+
+func (q *fileQueue) Push(batch Batch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch: %w", err)
+	}
+
+	name := fmt.Sprintf("%020d%s", q.next, batchFileSuffix)
+	if err := writeFileAtomic(filepath.Join(q.dir, name), data); err != nil {
+		return fmt.Errorf("failed to queue batch: %w", err)
+	}
+	q.next++
+	q.files = append(q.files, name)
+
+	return nil
+}
+
+// Front returns the oldest batch. Batches that can't be read are discarded.
+func (q *fileQueue) Front() (Batch, bool) {
+	for len(q.files) > 0 {
+		path := filepath.Join(q.dir, q.files[0])
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var batch Batch
+			if err = json.Unmarshal(data, &batch); err == nil {
+				return batch, true
+			}
+		}
+
+		logger.Log.Error("discarding unreadable queued batch", logger.String("file", path), logger.Error(err))
+		if err := q.Pop(); err != nil {
+			return Batch{}, false
+		}
+	}
+
+	return Batch{}, false
+}
+
+func (q *fileQueue) Pop() error {
+	if len(q.files) == 0 {
+		return nil
+	}
+
+	if err := os.Remove(filepath.Join(q.dir, q.files[0])); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove queued batch: %w", err)
+	}
+	q.files = q.files[1:]
+
+	return nil
+}
+
+func (q *fileQueue) Len() int {
+	return len(q.files)
+}
+
+// writeFileAtomic replaces the file, so readers never see it half-written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,128 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/pkg/compress"
+)
+
+// remoteWriteSink sends Prometheus remote-write requests. Metric IDs in the
+// exposition format keep their labels; other characters Prometheus doesn't
+// allow in names are replaced with underscores.
+type remoteWriteSink struct {
+	cfg    Config
+	client *http.Client
+}
+
+func newRemoteWriteSink(cfg Config) *remoteWriteSink {
+	return &remoteWriteSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (s *remoteWriteSink) Send(ctx context.Context, batch Batch) error {
+	data, err := protobuf.Marshal(writeRequest(batch))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errRejected, err)
+	}
+	data, err = compress.Encode(compress.Snappy, data)
+	if err != nil {
+		return fmt.Errorf("failed to compress batch: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", compress.Snappy)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	}
+	for name, value := range s.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	return do(s.client, req)
+}
+
+func (s *remoteWriteSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// writeRequest turns the batch into one series with a single sample per metric.
+func writeRequest(batch Batch) *proto.WriteRequest {
+	timestamp := batch.Timestamp.UnixMilli()
+	req := &proto.WriteRequest{}
+	families := make(map[string]proto.MetricMetadata_MetricType)
+	for _, m := range batch.Metrics {
+		name, labels, ok := models.SplitLabeledName(m.ID)
+		if !ok {
+			labels = nil
+		}
+		name = promName(name)
+
+		series := &proto.TimeSeries{Labels: []*proto.Label{{Name: "__name__", Value: name}}}
+		for _, l := range labels {
+			series.Labels = append(series.Labels, &proto.Label{Name: promName(l.Name), Value: l.Value})
+		}
+		sort.Slice(series.Labels, func(i, j int) bool { return series.Labels[i].Name < series.Labels[j].Name })
+
+		sample := &proto.Sample{Timestamp: timestamp}
+		switch {
+		case m.MType == models.Counter && m.Delta != nil:
+			sample.Value = float64(*m.Delta)
+			families[name] = proto.MetricMetadata_COUNTER
+		case m.Value != nil:
+			sample.Value = *m.Value
+			families[name] = proto.MetricMetadata_GAUGE
+		default:
+			continue
+		}
+		series.Samples = []*proto.Sample{sample}
+		req.Timeseries = append(req.Timeseries, series)
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		req.Metadata = append(req.Metadata, &proto.MetricMetadata{Type: families[name], MetricFamilyName: name})
+	}
+
+	return req
+}
+
+// promName replaces the characters not allowed in Prometheus metric and label names.
+func promName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// requestTimeout bounds a single delivery attempt.
+const requestTimeout = 10 * time.Second
+
+// errRejected marks batches the sink refused outright; resending them won't help.
+var errRejected = errors.New("batch rejected")
+
+type sink interface {
+	Send(ctx context.Context, batch Batch) error
+	Close() error
+}
+
+// Counter forms: how a sink expects counters.
+const (
+	// countersAsSent keeps counters as the mode produces them:
+	// totals in snapshots, increases in streams.
+	countersAsSent = iota
+	// countersAsDeltas sends the increase since the previous export, as
+	// federated servers add it to their own counters.
+	countersAsDeltas
+	// countersAsTotals sends the stored totals.
+	countersAsTotals
+)
+
+func counterForm(sinkType string) int {
+	switch sinkType {
+	case TypeUpdates, TypeGRPC:
+		return countersAsDeltas
+	case TypeRemoteWrite:
+		return countersAsTotals
+	default:
+		return countersAsSent
+	}
+}
+
+func newSink(cfg Config) (sink, error) {
+	switch cfg.Type {
+	case TypeUpdates:
+		return newUpdatesSink(cfg)
+	case TypeGRPC:
+		return newGRPCSink(cfg)
+	case TypeRemoteWrite:
+		return newRemoteWriteSink(cfg), nil
+	default:
+		return newWebhookSink(cfg), nil
+	}
+}
+
+// do sends the request and maps the response status: 429, 409 and 5xx are
+// worth retrying, other client errors reject the batch.
+func do(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusBadRequest {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	if resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusConflict ||
+		resp.StatusCode >= http.StatusInternalServerError {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", errRejected, err)
+}
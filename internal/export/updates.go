@@ -0,0 +1,95 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/compress"
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+// updatesSink federates into another server through POST /updates/, signing,
+// compressing and encrypting the requests like an agent does.
+type updatesSink struct {
+	cfg       Config
+	url       string
+	client    *http.Client
+	publicKey *rsa.PublicKey
+}
+
+func newUpdatesSink(cfg Config) (*updatesSink, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("exporter %s: invalid url: %w", cfg.Name, err)
+	}
+
+	s := &updatesSink{
+		cfg:    cfg,
+		url:    base.JoinPath("updates/").String(),
+		client: &http.Client{Timeout: requestTimeout},
+	}
+
+	if cfg.CryptoKey != "" {
+		publicKey, err := crypto.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("exporter %s: failed to load public key: %w", cfg.Name, err)
+		}
+		s.publicKey = publicKey
+	}
+
+	return s, nil
+}
+
+func (s *updatesSink) Send(ctx context.Context, batch Batch) error {
+	body, err := json.Marshal(batch.Metrics)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errRejected, err)
+	}
+
+	// The body is compressed before it is encrypted, since ciphertext doesn't compress.
+	// The signature still covers the plain JSON.
+	data, err := compress.Encode(s.cfg.Compression, body)
+	if err != nil {
+		return fmt.Errorf("failed to compress batch: %w", err)
+	}
+	if s.publicKey != nil {
+		if data, err = crypto.EncryptData(s.publicKey, data); err != nil {
+			return fmt.Errorf("failed to encrypt batch: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if s.publicKey != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.cfg.Compression != "" && s.cfg.Compression != compress.Identity {
+		req.Header.Set("Content-Encoding", s.cfg.Compression)
+	}
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	}
+	req.Header.Set(idempotency.HeaderName, batch.Key)
+	if s.cfg.HashKey != "" {
+		replay.SignHTTP(req, s.cfg.HashKey, body)
+	}
+
+	return do(s.client, req)
+}
+
+func (s *updatesSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
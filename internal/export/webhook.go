@@ -0,0 +1,61 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/pkg/compress"
+)
+
+// webhookSink posts every batch as a JSON object with its key, timestamp and
+// metrics. The key is also sent as the idempotency key header, so receivers
+// can skip batches they have already seen.
+type webhookSink struct {
+	cfg    Config
+	client *http.Client
+}
+
+func newWebhookSink(cfg Config) *webhookSink {
+	return &webhookSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (s *webhookSink) Send(ctx context.Context, batch Batch) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errRejected, err)
+	}
+	data, err := compress.Encode(s.cfg.Compression, body)
+	if err != nil {
+		return fmt.Errorf("failed to compress batch: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.Compression != "" && s.cfg.Compression != compress.Identity {
+		req.Header.Set("Content-Encoding", s.cfg.Compression)
+	}
+	req.Header.Set(idempotency.HeaderName, batch.Key)
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	}
+	for name, value := range s.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	return do(s.client, req)
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package federation gives a global server a view of regional servers.
+//
+// Every upstream's series are stored under its namespace, e.g. eu.hits for
+// hits on the upstream named eu. Pulled upstreams are read through the
+// ListMetrics RPC; their counter totals are turned into increases, so a
+// counter is never counted twice, also across restarts of either side.
+// Pushing upstreams send increases with an exporter setting the namespace,
+// and their token may only write series in it. With an aggregate namespace
+// the series of all upstreams, pulled or pushed, are also summed after every
+// pull, e.g. into all.hits.
+package federation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/pkg/compress"
+	"github.com/koyif/metrics/pkg/types"
+)
+
+// Separator joins a namespace and a metric ID.
+const Separator = "."
+
+// Upstream modes.
+const (
+	// ModePull reads the upstream every interval.
+	ModePull = "pull"
+	// ModePush accepts metrics the upstream exports.
+	ModePush = "push"
+)
+
+// DefaultInterval is used when Config leaves the pull interval unset.
+const DefaultInterval = 10 * time.Second
+
+// Config describes federation in the server config file.
+type Config struct {
+	// Interval is how often upstreams are pulled, DefaultInterval if unset.
+	Interval types.DurationInSeconds `json:"interval"`
+	// AggregateNamespace, if set, receives the sum of every series across upstreams.
+	AggregateNamespace string     `json:"aggregate_namespace"`
+	Upstreams          []Upstream `json:"upstreams"`
+}
+
+// Upstream describes a regional server.
+type Upstream struct {
+	// Name is the namespace of the upstream's series. It must not contain Separator.
+	Name string `json:"name"`
+	// Mode is ModePull or ModePush, ModePull if unset.
+	Mode string `json:"mode"`
+	// Address is the gRPC address of a pulled upstream.
+	Address string `json:"address"`
+	// Token is sent to a pulled upstream, and accepted from a pushing one
+	// for writing its namespace.
+	Token string `json:"token"`
+	// HashKey signs the requests to a pulled upstream and verifies its responses.
+	HashKey     string `json:"hash_key"`
+	Compression string `json:"compression"`
+	// Prefix limits the pulled metrics to IDs starting with it.
+	Prefix string `json:"prefix"`
+}
+
+// String hides the credentials, so the config can be logged safely.
+func (u Upstream) String() string {
+	return fmt.Sprintf("{Name:%s Mode:%s Address:%s Prefix:%s}", u.Name, u.Mode, u.Address, u.Prefix)
+}
+
+// Namespaced returns the ID of the metric in the namespace.
+func Namespaced(namespace, id string) string {
+	return namespace + Separator + id
+}
+
+// Validate checks the config and fills in the unset fields.
+func (c *Config) Validate() error {
+	if c.Interval <= 0 {
+		c.Interval = types.DurationInSeconds(DefaultInterval)
+	}
+	if strings.Contains(c.AggregateNamespace, Separator) {
+		return fmt.Errorf("federation aggregate namespace %s: must not contain %q", c.AggregateNamespace, Separator)
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Upstreams {
+		u := &c.Upstreams[i]
+		if u.Name == "" {
+			return fmt.Errorf("federation upstream %d: name is required", i)
+		}
+		if strings.Contains(u.Name, Separator) {
+			return fmt.Errorf("federation upstream %s: name must not contain %q", u.Name, Separator)
+		}
+		if names[u.Name] || u.Name == c.AggregateNamespace {
+			return fmt.Errorf("federation upstream %s: namespace is used twice", u.Name)
+		}
+		names[u.Name] = true
+
+		switch u.Mode {
+		case "":
+			u.Mode = ModePull
+		case ModePull, ModePush:
+		default:
+			return fmt.Errorf("federation upstream %s: invalid mode %q: expected %s or %s", u.Name, u.Mode, ModePull, ModePush)
+		}
+
+		if u.Mode == ModePull && u.Address == "" {
+			return fmt.Errorf("federation upstream %s: address is required", u.Name)
+		}
+		if !compress.Supported(u.Compression) {
+			return fmt.Errorf("federation upstream %s: %w: %q", u.Name, compress.ErrUnsupportedEncoding, u.Compression)
+		}
+	}
+
+	return nil
+}
+
+// Pulled returns the upstreams read by the server.
+func (c *Config) Pulled() []Upstream {
+	upstreams := make([]Upstream, 0)
+	for _, u := range c.Upstreams {
+		if u.Mode == ModePull {
+			upstreams = append(upstreams, u)
+		}
+	}
+
+	return upstreams
+}
+
+// PushTokens returns the tokens of the pushing upstreams, each allowed to
+// write its own namespace only.
+func (c *Config) PushTokens() []auth.TokenConfig {
+	tokens := make([]auth.TokenConfig, 0)
+	for _, u := range c.Upstreams {
+		if u.Mode == ModePush && u.Token != "" {
+			tokens = append(tokens, auth.TokenConfig{
+				Name:     "federation:" + u.Name,
+				Token:    u.Token,
+				Scopes:   []string{auth.ScopeWrite},
+				Prefixes: []string{u.Name + Separator},
+			})
+		}
+	}
+
+	return tokens
+}
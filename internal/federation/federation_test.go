@@ -0,0 +1,233 @@
+package federation_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/cumulative"
+	"github.com/koyif/metrics/internal/federation"
+	grpcinterceptor "github.com/koyif/metrics/internal/grpc/interceptor"
+	grpcserver "github.com/koyif/metrics/internal/grpc/server"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/service"
+	"github.com/koyif/metrics/internal/validation"
+	"github.com/koyif/metrics/pkg/types"
+)
+
+func newService(t *testing.T) (*service.MetricsService, *repository.MetricsRepository) {
+	t.Helper()
+
+	validator, err := validation.New(validation.Policy{})
+	require.NoError(t, err)
+	repo := repository.NewMetricsRepository()
+
+	return service.NewMetricsService(repo, nil, validator, nil), repo
+}
+
+// startUpstream serves the Metrics service of a regional server.
+func startUpstream(t *testing.T, svc *service.MetricsService, hashKey string) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var opts []grpc.ServerOption
+	if hashKey != "" {
+		opts = append(opts, grpc.ChainUnaryInterceptor(grpcinterceptor.HashCheckInterceptor(hashKey, replay.New(time.Minute, 100))))
+	}
+	srv := grpc.NewServer(opts...)
+	cfg := &config.Config{StoreInterval: types.DurationInSeconds(1)}
+	proto.RegisterMetricsServer(srv, grpcserver.NewMetricsServer(svc, cfg, nil, nil))
+	go func() { _ = srv.Serve(listener) }()
+	t.Cleanup(srv.Stop)
+
+	return listener.Addr().String()
+}
+
+func store(t *testing.T, svc *service.MetricsService, id string, delta int64) {
+	t.Helper()
+	require.NoError(t, svc.StoreCounter(id, delta))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cfg := federation.Config{Upstreams: []federation.Upstream{{Name: "eu", Address: "eu:3200"}, {Name: "us", Mode: federation.ModePush, Token: "secret"}}}
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, federation.DefaultInterval, cfg.Interval.Value())
+	assert.Equal(t, federation.ModePull, cfg.Upstreams[0].Mode)
+	assert.Len(t, cfg.Pulled(), 1)
+
+	tokens := cfg.PushTokens()
+	require.Len(t, tokens, 1)
+	assert.Equal(t, []string{"us."}, tokens[0].Prefixes)
+	assert.Equal(t, []string{auth.ScopeWrite}, tokens[0].Scopes)
+	assert.NotContains(t, cfg.Upstreams[1].String(), "secret")
+
+	for _, cfg := range []federation.Config{
+		{Upstreams: []federation.Upstream{{Address: "eu:3200"}}},
+		{Upstreams: []federation.Upstream{{Name: "eu"}}},
+		{Upstreams: []federation.Upstream{{Name: "eu", Address: "a"}, {Name: "eu", Address: "b"}}},
+		{AggregateNamespace: "eu", Upstreams: []federation.Upstream{{Name: "eu", Address: "a"}}},
+		{Upstreams: []federation.Upstream{{Name: "eu.west", Address: "a"}}},
+		{AggregateNamespace: "all.regions", Upstreams: []federation.Upstream{{Name: "eu", Address: "a"}}},
+		{Upstreams: []federation.Upstream{{Name: "eu", Mode: "poll", Address: "a"}}},
+	} {
+		assert.Error(t, cfg.Validate(), cfg)
+	}
+}
+
+func TestPuller(t *testing.T) {
+	eu, _ := newService(t)
+	us, _ := newService(t)
+	store(t, eu, "hits", 10)
+	store(t, us, "hits", 5)
+	require.NoError(t, eu.StoreGauge("queue", 3))
+	require.NoError(t, us.StoreGauge("queue", 4))
+
+	global, globalRepo := newService(t)
+	cfg := federation.Config{
+		AggregateNamespace: "all",
+		Upstreams: []federation.Upstream{
+			{Name: "eu", Address: startUpstream(t, eu, "key"), HashKey: "key"},
+			{Name: "us", Address: startUpstream(t, us, "")},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+
+	newPuller := func() *federation.Puller {
+		p, err := federation.NewPuller(cfg, global, cumulative.NewTracker(global), nil, nil, false)
+		require.NoError(t, err)
+		t.Cleanup(p.Close)
+		return p
+	}
+	counter := func(id string) int64 {
+		value, err := globalRepo.Counter(id)
+		require.NoError(t, err)
+		return value
+	}
+
+	p := newPuller()
+	p.Pull(context.Background())
+	assert.Equal(t, int64(10), counter("eu.hits"))
+	assert.Equal(t, int64(5), counter("us.hits"))
+	assert.Equal(t, int64(15), counter("all.hits"))
+	queue, err := globalRepo.Gauge("all.queue")
+	require.NoError(t, err)
+	assert.InDelta(t, 7, queue, 0)
+
+	// Pulling again only adds what changed upstream.
+	store(t, eu, "hits", 2)
+	p.Pull(context.Background())
+	assert.Equal(t, int64(12), counter("eu.hits"))
+	assert.Equal(t, int64(5), counter("us.hits"))
+	assert.Equal(t, int64(17), counter("all.hits"))
+
+	// A restarted puller continues from the stored counters.
+	store(t, us, "hits", 1)
+	p = newPuller()
+	p.Pull(context.Background())
+	assert.Equal(t, int64(12), counter("eu.hits"))
+	assert.Equal(t, int64(6), counter("us.hits"))
+	assert.Equal(t, int64(18), counter("all.hits"))
+}
+
+func TestPuller_AggregatesPushedUpstreams(t *testing.T) {
+	eu, _ := newService(t)
+	store(t, eu, "hits", 10)
+	require.NoError(t, eu.StoreGauge("queue", 3))
+
+	global, globalRepo := newService(t)
+	cfg := federation.Config{
+		AggregateNamespace: "all",
+		Upstreams: []federation.Upstream{
+			{Name: "eu", Address: startUpstream(t, eu, "")},
+			{Name: "us", Mode: federation.ModePush, Token: "secret"},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+	p, err := federation.NewPuller(cfg, global, cumulative.NewTracker(global), nil, nil, false)
+	require.NoError(t, err)
+	defer p.Close()
+
+	// The pushing upstream exports increases into its namespace.
+	store(t, global, "us.hits", 4)
+	require.NoError(t, global.StoreGauge("us.queue", 2))
+	store(t, global, "other.hits", 100)
+
+	p.Pull(context.Background())
+	hits, err := globalRepo.Counter("all.hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(14), hits, "series outside the upstream namespaces are left out")
+	queue, err := globalRepo.Gauge("all.queue")
+	require.NoError(t, err)
+	assert.InDelta(t, 5, queue, 0)
+
+	store(t, global, "us.hits", 1)
+	p.Pull(context.Background())
+	hits, err = globalRepo.Counter("all.hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), hits, "pushed increases are counted once")
+}
+
+func TestPuller_UnreachableUpstream(t *testing.T) {
+	eu, _ := newService(t)
+	store(t, eu, "hits", 1)
+	global, globalRepo := newService(t)
+
+	cfg := federation.Config{Upstreams: []federation.Upstream{
+		{Name: "eu", Address: startUpstream(t, eu, "")},
+		{Name: "down", Address: "127.0.0.1:1"},
+		{Name: "forged", Address: startUpstream(t, eu, ""), HashKey: "key"},
+	}}
+	require.NoError(t, cfg.Validate())
+	p, err := federation.NewPuller(cfg, global, cumulative.NewTracker(global), nil, nil, false)
+	require.NoError(t, err)
+	defer p.Close()
+
+	p.Pull(context.Background())
+
+	hits, err := globalRepo.Counter("eu.hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), hits, "other upstreams are still pulled")
+	_, err = globalRepo.Counter("forged.hits")
+	assert.Error(t, err, "unsigned responses are rejected")
+}
+
+func TestListMetrics_TokenPrefixes(t *testing.T) {
+	svc, _ := newService(t)
+	store(t, svc, "eu.hits", 1)
+	store(t, svc, "us.hits", 2)
+
+	authenticator, err := auth.New([]auth.TokenConfig{{Name: "reader", Token: "t", Scopes: []string{auth.ScopeRead}, Prefixes: []string{"eu."}}})
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(grpcinterceptor.AuthInterceptor(authenticator)))
+	proto.RegisterMetricsServer(srv, grpcserver.NewMetricsServer(svc, &config.Config{}, nil, nil))
+	go func() { _ = srv.Serve(listener) }()
+	defer srv.Stop()
+
+	cfg := federation.Config{Upstreams: []federation.Upstream{{Name: "global", Address: listener.Addr().String(), Token: "t"}}}
+	require.NoError(t, cfg.Validate())
+	global, globalRepo := newService(t)
+	p, err := federation.NewPuller(cfg, global, cumulative.NewTracker(global), nil, nil, false)
+	require.NoError(t, err)
+	defer p.Close()
+
+	p.Pull(context.Background())
+
+	hits, err := globalRepo.Counter("global.eu.hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), hits)
+	_, err = globalRepo.Counter("global.us.hits")
+	assert.Error(t, err, "tokens only read their prefixes")
+}
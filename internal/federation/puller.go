@@ -0,0 +1,285 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/cumulative"
+	_ "github.com/koyif/metrics/internal/grpc/compression"
+	"github.com/koyif/metrics/internal/grpc/converter"
+	"github.com/koyif/metrics/internal/grpc/signing"
+	"github.com/koyif/metrics/internal/ingest"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/pkg/compress"
+	"github.com/koyif/metrics/pkg/crypto"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const (
+	// Client identifies federated updates in series quotas and audit events.
+	Client = "federation"
+	// pullTimeout bounds reading one upstream.
+	pullTimeout = 10 * time.Second
+	// maxResponseSize bounds the metrics of one upstream.
+	maxResponseSize = 64 << 20
+)
+
+var (
+	// ErrUnsignedResponse is returned when a hash key is configured but the upstream response has no signature.
+	ErrUnsignedResponse = errors.New("response is not signed")
+	// ErrInvalidResponseSignature is returned when the upstream response does not match its signature.
+	ErrInvalidResponseSignature = errors.New("response signature is not valid")
+)
+
+type metricsService interface {
+	AllMetrics() []models.Metrics
+	Validate(metrics []models.Metrics) error
+	StoreAll(metrics []models.Metrics) error
+	Persist() error
+}
+
+type seriesLimiter interface {
+	ReservePartial(client string, metrics []models.Metrics) ([]models.Metrics, *quota.Reservation, error)
+}
+
+type upstream struct {
+	cfg    Upstream
+	conn   *grpc.ClientConn
+	client proto.MetricsClient
+}
+
+// Puller reads the pulled upstreams every interval and stores their metrics
+// in their namespaces, then the aggregates of every upstream.
+type Puller struct {
+	cfg        Config
+	upstreams  []*upstream
+	service    metricsService
+	sink       *ingest.Sink
+	totals     *cumulative.Tracker
+	namespaces map[string]bool
+}
+
+// NewPuller creates a puller for the pulled upstreams of a validated config.
+// The totals track the upstream counters. With persist set the storage is
+// saved after every pull, as with a zero store interval.
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewPuller(
+	cfg Config,
+	service metricsService,
+	totals *cumulative.Tracker,
+	auditManager *audit.Manager,
+	limiter seriesLimiter,
+	persist bool,
+) (*Puller, error) {
+	p := &Puller{
+		cfg:        cfg,
+		service:    service,
+		sink:       ingest.NewSink(Client, service, auditManager, limiter, persist),
+		totals:     totals,
+		namespaces: make(map[string]bool, len(cfg.Upstreams)),
+	}
+	for _, u := range cfg.Upstreams {
+		p.namespaces[u.Name] = true
+	}
+
+	for _, u := range cfg.Pulled() {
+		opts := []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxResponseSize)),
+		}
+		if u.Compression != "" && u.Compression != compress.Identity {
+			if encoding.GetCompressor(u.Compression) == nil {
+				p.Close()
+				return nil, fmt.Errorf("federation upstream %s: %w: %q", u.Name, compress.ErrUnsupportedEncoding, u.Compression)
+			}
+			opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(u.Compression)))
+		}
+
+		conn, err := grpc.NewClient(u.Address, opts...)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("federation upstream %s: failed to create gRPC connection: %w", u.Name, err)
+		}
+		p.upstreams = append(p.upstreams, &upstream{cfg: u, conn: conn, client: proto.NewMetricsClient(conn)})
+	}
+
+	return p, nil
+}
+
+// Run pulls right away and then every interval until the context is done.
+func (p *Puller) Run(ctx context.Context) {
+	defer p.Close()
+
+	ticker := time.NewTicker(p.cfg.Interval.Value())
+	defer ticker.Stop()
+
+	for {
+		p.Pull(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the upstream connections.
+func (p *Puller) Close() {
+	for _, u := range p.upstreams {
+		if err := u.conn.Close(); err != nil {
+			logger.Log.Warn("failed to close federation connection", logger.String("upstream", u.cfg.Name), logger.Error(err))
+		}
+	}
+}
+
+// Pull reads every pulled upstream at once and stores their metrics, then the
+// aggregates. Upstreams that can't be read are skipped until the next pull.
+func (p *Puller) Pull(ctx context.Context) {
+	results := make([][]models.Metrics, len(p.upstreams))
+	errs := make([]error, len(p.upstreams))
+
+	var wg sync.WaitGroup
+	for i, u := range p.upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = u.list(ctx)
+		}()
+	}
+	wg.Wait()
+
+	for i, u := range p.upstreams {
+		if errs[i] != nil {
+			logger.Log.Warn("failed to pull federation upstream", logger.String("upstream", u.cfg.Name), logger.Error(errs[i]))
+			continue
+		}
+
+		namespaced := make([]models.Metrics, 0, len(results[i]))
+		for _, m := range results[i] {
+			m.ID = Namespaced(u.cfg.Name, m.ID)
+			namespaced = append(namespaced, m)
+		}
+		p.store(namespaced)
+	}
+
+	if p.cfg.AggregateNamespace != "" {
+		p.store(p.aggregates())
+	}
+}
+
+// store stores the metrics, whose counters carry their totals.
+func (p *Puller) store(metrics []models.Metrics) {
+	increases := make([]models.Metrics, 0, len(metrics))
+	var counterIDs []string
+	for _, m := range metrics {
+		switch {
+		case m.MType == models.Gauge && m.Value != nil:
+			increases = append(increases, m)
+		case m.MType == models.Counter && m.Delta != nil:
+			delta, err := p.totals.Advance(m.ID, float64(*m.Delta))
+			if err != nil {
+				logger.Log.Warn("failed to read federated counter", logger.String("name", m.ID), logger.Error(err))
+				continue
+			}
+			counterIDs = append(counterIDs, m.ID)
+			increases = append(increases, models.Metrics{ID: m.ID, MType: models.Counter, Delta: &delta})
+		}
+	}
+
+	stored := p.sink.Store(increases, nil)
+
+	// Counters that weren't stored continue from the stored values next time.
+	storedIDs := make(map[string]bool, len(stored))
+	for _, m := range stored {
+		storedIDs[m.ID] = true
+	}
+	for _, id := range counterIDs {
+		if !storedIDs[id] {
+			p.totals.Forget(id)
+		}
+	}
+}
+
+// aggregates sums the stored series of every upstream namespace, pulled or
+// pushed. Counters carry the sum of their totals, which only grows as the
+// namespaced counters do, so their increases are counted once.
+func (p *Puller) aggregates() []models.Metrics {
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for _, m := range p.service.AllMetrics() {
+		namespace, id, ok := strings.Cut(m.ID, Separator)
+		if !ok || !p.namespaces[namespace] {
+			continue
+		}
+		switch m.MType {
+		case models.Gauge:
+			gauges[id] += *m.Value
+		case models.Counter:
+			counters[id] += *m.Delta
+		}
+	}
+
+	metrics := make([]models.Metrics, 0, len(counters)+len(gauges))
+	for id, value := range gauges {
+		metrics = append(metrics, models.Metrics{ID: Namespaced(p.cfg.AggregateNamespace, id), MType: models.Gauge, Value: &value})
+	}
+	for id, total := range counters {
+		metrics = append(metrics, models.Metrics{ID: Namespaced(p.cfg.AggregateNamespace, id), MType: models.Counter, Delta: &total})
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].ID < metrics[j].ID })
+
+	return metrics
+}
+
+// list reads the current metrics of the upstream; counters carry their totals.
+func (u *upstream) list(ctx context.Context) ([]models.Metrics, error) {
+	ctx, cancel := context.WithTimeout(ctx, pullTimeout)
+	defer cancel()
+
+	req := &proto.ListMetricsRequest{Prefix: u.cfg.Prefix}
+	if u.cfg.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+u.cfg.Token)
+	}
+	if u.cfg.HashKey != "" {
+		var err error
+		if ctx, err = signing.AppendRequestSignature(ctx, u.cfg.HashKey, req); err != nil {
+			return nil, err
+		}
+	}
+
+	var header metadata.MD
+	resp, err := u.client.ListMetrics(ctx, req, grpc.Header(&header))
+	if err != nil {
+		return nil, err
+	}
+
+	if u.cfg.HashKey != "" {
+		hashes := header.Get(crypto.HashMetadataKey)
+		if len(hashes) == 0 {
+			return nil, ErrUnsignedResponse
+		}
+		valid, err := signing.Verify(u.cfg.HashKey, resp, hashes[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify response: %w", err)
+		}
+		if !valid {
+			return nil, ErrInvalidResponseSignature
+		}
+	}
+
+	return converter.ProtoToModels(resp.Metrics), nil
+}
@@ -0,0 +1,136 @@
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/repository/dberror"
+	"github.com/koyif/metrics/internal/service"
+	"github.com/koyif/metrics/internal/typerule"
+	"github.com/koyif/metrics/internal/validation"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{line: "backup.files 1250 1700000000", want: Sample{Path: "backup.files", Value: 1250}},
+		{line: "cpu.load  0.75\t-1", want: Sample{Path: "cpu.load", Value: 0.75}},
+		{line: "cpu.load 0.75", want: Sample{Path: "cpu.load", Value: 0.75}},
+		{line: "cpu.load 1e3 1700000000.5", want: Sample{Path: "cpu.load", Value: 1000}},
+		{line: "cpu.load", wantErr: true},
+		{line: "cpu.load abc 1700000000", wantErr: true},
+		{line: "cpu.load NaN 1700000000", wantErr: true},
+		{line: "cpu.load 1 now", wantErr: true},
+		{line: "cpu load 1 1700000000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	validator, err := validation.New(validation.Policy{})
+	require.NoError(t, err)
+	repo := repository.NewMetricsRepository()
+	svc := service.NewMetricsService(repo, nil, validator, nil)
+
+	rules, err := typerule.Parse(`\.processed$=counter,^debug\.=drop`)
+	require.NoError(t, err)
+
+	srv := NewServer(Options{Addr: "127.0.0.1:0", FlushInterval: time.Hour, Rules: rules}, svc, nil, nil)
+	require.NoError(t, srv.Listen())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.Serve(ctx)
+		close(done)
+	}()
+
+	send := func(lines string) {
+		conn, err := net.Dial("tcp", srv.lines.Addr().String())
+		require.NoError(t, err)
+		_, err = fmt.Fprint(conn, lines)
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+	}
+	send("jobs.backup.processed 3 1700000000\njobs.backup.duration 12.5 1700000000\ninvalid line\n" +
+		"jobs.backup.processed 2 1700000060\njobs.backup.duration 14 1700000060\ndebug.trace 1 -1\n")
+
+	require.Eventually(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return srv.counters["jobs.backup.processed"] == 5 && srv.gauges["jobs.backup.duration"] == 14
+	}, time.Second, 10*time.Millisecond)
+
+	srv.Flush()
+	send("jobs.backup.processed 1 1700000120\n")
+	require.Eventually(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return srv.counters["jobs.backup.processed"] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// Shutting down flushes what was received.
+	cancel()
+	<-done
+
+	processed, err := repo.Counter("jobs.backup.processed")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), processed, "counter values are increases")
+
+	duration, err := repo.Gauge("jobs.backup.duration")
+	require.NoError(t, err)
+	assert.InDelta(t, 14, duration, 0, "gauges keep the last value")
+
+	_, err = repo.Gauge("debug.trace")
+	assert.ErrorIs(t, err, dberror.ErrValueNotFound, "dropped paths aren't stored")
+}
+
+type denyAll struct{}
+
+func (denyAll) Allow(string) (bool, time.Duration) {
+	return false, time.Second
+}
+
+func TestServer_PerSender(t *testing.T) {
+	repo := repository.NewMetricsRepository()
+	svc := service.NewMetricsService(repo, nil, nil, nil)
+	limiter := quota.NewLimiter(quota.Limits{MaxSeriesPerClient: 1})
+	srv := NewServer(Options{}, svc, nil, limiter)
+
+	srv.handleLine("10.0.0.1", "cpu.load 1 -1")
+	srv.handleLine("10.0.0.2", "mem.used 2 -1")
+	srv.handleLine("10.0.0.2", "disk.used 3 -1")
+	srv.Flush()
+
+	for _, path := range []string{"cpu.load", "mem.used"} {
+		_, err := repo.Gauge(path)
+		assert.NoError(t, err, "every sender has its own series quota")
+	}
+	_, err := repo.Gauge("disk.used")
+	assert.ErrorIs(t, err, dberror.ErrValueNotFound)
+
+	limited := NewServer(Options{RateLimiter: denyAll{}}, svc, nil, nil)
+	limited.handleLine("10.0.0.1", "net.rx 1 -1")
+	assert.Empty(t, limited.order, "rate limited lines are dropped")
+}
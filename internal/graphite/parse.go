@@ -0,0 +1,46 @@
+// Package graphite receives metrics in the Graphite plaintext protocol.
+//
+// A line has the form path value [timestamp], e.g. backup.files 1250 1700000000.
+// Every path becomes one metric named after the path. Metrics are gauges unless
+// a configured rule marks the path as a counter; counter values are the increase
+// since the previous report, as cron jobs send them. Timestamps are validated
+// but not kept: metrics only hold the latest value.
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var errMalformedLine = errors.New("malformed line")
+
+// Sample is a parsed line.
+type Sample struct {
+	Path  string
+	Value float64
+}
+
+// Parse parses a line of the plaintext protocol. The timestamp is optional;
+// senders use -1 for the time of receipt.
+func Parse(line string) (Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return Sample{}, fmt.Errorf("%w: expected path, value and timestamp", errMalformedLine)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Sample{}, fmt.Errorf("%w: invalid value %q", errMalformedLine, fields[1])
+	}
+
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return Sample{}, fmt.Errorf("%w: invalid timestamp %q", errMalformedLine, fields[2])
+		}
+	}
+
+	return Sample{Path: fields[0], Value: value}, nil
+}
@@ -0,0 +1,184 @@
+package graphite
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/ingest"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/typerule"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const (
+	// DefaultFlushInterval is used when Options leave the flush interval unset.
+	DefaultFlushInterval = 10 * time.Second
+	// DefaultMaxSeries bounds the series received within a flush interval.
+	DefaultMaxSeries = 100000
+	// Client identifies Graphite updates in audit events, since a flush mixes
+	// samples of many senders.
+	Client = "graphite"
+)
+
+type metricsService interface {
+	Validate(metrics []models.Metrics) error
+	StoreAll(metrics []models.Metrics) error
+	Persist() error
+}
+
+type seriesLimiter interface {
+	ReservePartial(client string, metrics []models.Metrics) ([]models.Metrics, *quota.Reservation, error)
+}
+
+// Options configure a Server.
+type Options struct {
+	// Addr is the TCP address listened on.
+	Addr string
+	// FlushInterval is how often received metrics are stored, DefaultFlushInterval if unset.
+	FlushInterval time.Duration
+	// TrustedSubnets restricts the senders; empty allows everyone.
+	TrustedSubnets []*net.IPNet
+	// RateLimiter limits every line of a sender; nil disables rate limiting.
+	RateLimiter ingest.RateLimiter
+	// Rules decide the type of a path; paths matching no rule are gauges.
+	Rules []typerule.Rule
+	// Persist saves the storage after every flush, as with a zero store interval.
+	Persist bool
+}
+
+// Server receives plaintext lines over TCP and stores them once per flush interval.
+// Within an interval gauges keep the last value and counter increases are summed.
+type Server struct {
+	opts  Options
+	sink  *ingest.Sink
+	lines *ingest.LineListener
+
+	mu       sync.Mutex
+	order    []string
+	gauges   map[string]float64
+	counters map[string]float64
+	// senders holds the sender that started each series of the interval.
+	senders map[string]string
+}
+
+// NewServer creates a Graphite server.
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewServer(opts Options, service metricsService, auditManager *audit.Manager, limiter seriesLimiter) *Server {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+
+	return &Server{
+		opts:     opts,
+		sink:     ingest.NewSink(Client, service, auditManager, limiter, opts.Persist),
+		gauges:   make(map[string]float64),
+		counters: make(map[string]float64),
+		senders:  make(map[string]string),
+	}
+}
+
+// Listen opens the TCP listener and starts accepting connections.
+func (s *Server) Listen() error {
+	lines, err := ingest.ListenLines(Client, s.opts.Addr, s.opts.TrustedSubnets, s.handleLine)
+	if err != nil {
+		return fmt.Errorf("failed to listen for graphite: %w", err)
+	}
+
+	s.lines = lines
+
+	return nil
+}
+
+// Serve flushes received metrics until the context is done, then closes
+// the listener and connections and flushes what was received last.
+func (s *Server) Serve(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.lines.Close()
+			s.Flush()
+			return
+		case <-ticker.C:
+			s.Flush()
+		}
+	}
+}
+
+// Flush stores the metrics received since the previous flush. Metrics
+// rejected by the validation policy or the series quota of their sender are
+// dropped.
+func (s *Server) Flush() {
+	s.mu.Lock()
+	metrics := make([]models.Metrics, 0, len(s.order))
+	for _, id := range s.order {
+		if value, ok := s.gauges[id]; ok {
+			metrics = append(metrics, models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+			continue
+		}
+
+		delta := int64(math.Round(s.counters[id]))
+		metrics = append(metrics, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+	}
+	s.order = nil
+	s.gauges = make(map[string]float64)
+	s.counters = make(map[string]float64)
+	senders := s.senders
+	s.senders = make(map[string]string)
+	s.mu.Unlock()
+
+	s.sink.Store(metrics, senders)
+}
+
+// add records a sample of the sender in the current interval.
+func (s *Server) add(sender string, sample Sample) {
+	mtype, ok := typerule.Match(s.opts.Rules, sample.Path)
+	if !ok {
+		mtype = models.Gauge
+	}
+	if mtype == typerule.Drop {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, isGauge := s.gauges[sample.Path]
+	_, isCounter := s.counters[sample.Path]
+	if !isGauge && !isCounter {
+		if len(s.order) >= DefaultMaxSeries {
+			logger.Log.Warn("graphite series limit reached, dropping sample", logger.String("path", sample.Path))
+			return
+		}
+		s.order = append(s.order, sample.Path)
+		s.senders[sample.Path] = sender
+	}
+
+	if mtype == models.Counter {
+		s.counters[sample.Path] += sample.Value
+	} else {
+		s.gauges[sample.Path] = sample.Value
+	}
+}
+
+func (s *Server) handleLine(sender, line string) {
+	if !ingest.Allowed(Client, s.opts.RateLimiter, sender) {
+		return
+	}
+
+	sample, err := Parse(line)
+	if err != nil {
+		logger.Log.Debug("invalid graphite line", logger.Error(err))
+		return
+	}
+
+	s.add(sender, sample)
+}
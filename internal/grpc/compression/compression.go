@@ -0,0 +1,88 @@
+// Package compression registers the gRPC compressors used between agents and the server.
+// Importing it makes gzip and zstd available on both sides; the server decodes whichever
+// the client picked and answers with the same coding.
+package compression
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // registers the gzip compressor
+
+	"github.com/koyif/metrics/pkg/compress"
+)
+
+func init() {
+	encoding.RegisterCompressor(newZstdCompressor())
+}
+
+// zstdCompressor implements encoding.Compressor. Encoders and decoders are pooled,
+// since creating them allocates large buffers.
+type zstdCompressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+func newZstdCompressor() *zstdCompressor {
+	return &zstdCompressor{}
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *zstdWriter) Close() error {
+	defer w.pool.Put(w)
+	return w.Encoder.Close()
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+	pool *sync.Pool
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	n, err := r.Decoder.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r)
+	}
+	return n, err
+}
+
+// Compress implements encoding.Compressor.
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	if zw, ok := c.encoders.Get().(*zstdWriter); ok {
+		zw.Reset(w)
+		return zw, nil
+	}
+
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+}
+
+// Decompress implements encoding.Compressor.
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	if zr, ok := c.decoders.Get().(*zstdReader); ok {
+		if err := zr.Reset(r); err != nil {
+			return nil, err
+		}
+		return zr, nil
+	}
+
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdReader{Decoder: dec, pool: &c.decoders}, nil
+}
+
+// Name implements encoding.Compressor.
+func (c *zstdCompressor) Name() string {
+	return compress.Zstd
+}
@@ -0,0 +1,41 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/encoding"
+
+	"github.com/koyif/metrics/pkg/compress"
+)
+
+func TestCompressorsRegistered(t *testing.T) {
+	data := bytes.Repeat([]byte("metric payload "), 100)
+
+	for _, name := range []string{compress.Gzip, compress.Zstd} {
+		t.Run(name, func(t *testing.T) {
+			c := encoding.GetCompressor(name)
+			require.NotNil(t, c)
+
+			// Run twice so pooled encoders and decoders are reused.
+			for range 2 {
+				var buf bytes.Buffer
+				w, err := c.Compress(&buf)
+				require.NoError(t, err)
+				_, err = w.Write(data)
+				require.NoError(t, err)
+				require.NoError(t, w.Close())
+				assert.Less(t, buf.Len(), len(data))
+
+				r, err := c.Decompress(&buf)
+				require.NoError(t, err)
+				decoded, err := io.ReadAll(r)
+				require.NoError(t, err)
+				assert.Equal(t, data, decoded)
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 )
 
 // ProtoToModels converts protobuf Metric messages to internal models.Metrics.
+// Proto3 scalars carry no presence information, so a zero delta or value is
+// a legitimate update and is converted like any other.
 func ProtoToModels(protoMetrics []*proto.Metric) []models.Metrics {
 	result := make([]models.Metrics, 0, len(protoMetrics))
 
@@ -17,16 +19,12 @@ func ProtoToModels(protoMetrics []*proto.Metric) []models.Metrics {
 		switch pm.Type {
 		case proto.Metric_COUNTER:
 			m.MType = models.Counter
-			if pm.Delta != 0 {
-				delta := pm.Delta
-				m.Delta = &delta
-			}
+			delta := pm.Delta
+			m.Delta = &delta
 		case proto.Metric_GAUGE:
 			m.MType = models.Gauge
-			if pm.Value != 0 {
-				value := pm.Value
-				m.Value = &value
-			}
+			value := pm.Value
+			m.Value = &value
 		}
 
 		result = append(result, m)
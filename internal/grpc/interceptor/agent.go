@@ -0,0 +1,33 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/koyif/metrics/internal/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// AgentRegistryInterceptor creates a gRPC UnaryServerInterceptor that registers agents
+// by the identity they send in metadata, mirroring the HTTP middleware.
+func AgentRegistryInterceptor(agents *registry.Registry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		identity := registry.IdentityFromMetadata(md)
+		if identity.ID == "" {
+			return handler(ctx, req)
+		}
+
+		clientIP, err := ClientIP(ctx)
+		if err != nil {
+			clientIP = "unknown"
+		}
+
+		agents.Observe(identity, registry.TransportGRPC, clientIP)
+		return handler(registry.NewContext(ctx, agents, identity.ID), req)
+	}
+}
@@ -0,0 +1,53 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// methodScopes maps gRPC methods to the scope they require.
+// Methods missing from the map require the admin scope.
+var methodScopes = map[string]string{
+	proto.Metrics_UpdateMetrics_FullMethodName: auth.ScopeWrite,
+	proto.Metrics_ListMetrics_FullMethodName:   auth.ScopeRead,
+	proto.Agents_ListAgents_FullMethodName:     auth.ScopeAdmin,
+}
+
+// AuthInterceptor creates a gRPC UnaryServerInterceptor that requires a bearer token
+// in the authorization metadata. Calls without a valid token fail with Unauthenticated,
+// calls with a token lacking the method's scope with PermissionDenied.
+func AuthInterceptor(authenticator *auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		scope, ok := methodScopes[info.FullMethod]
+		if !ok {
+			scope = auth.ScopeAdmin
+		}
+
+		var token string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("authorization"); len(values) > 0 {
+				token = auth.BearerToken(values[0])
+			}
+		}
+
+		principal, err := authenticator.Authenticate(token, scope)
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			logger.Log.Warn("call rejected: missing or invalid token", logger.String("method", info.FullMethod))
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if err != nil {
+			logger.Log.Warn("call rejected: insufficient scope", logger.String("method", info.FullMethod), logger.Error(err))
+			return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+		}
+
+		return handler(auth.NewContext(ctx, principal), req)
+	}
+}
@@ -0,0 +1,53 @@
+package interceptor
+
+import (
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/clientip"
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/internal/ratelimit"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/internal/replay"
+	"google.golang.org/grpc"
+)
+
+// Config selects the interceptors of the server. Nil fields and an empty hash
+// key leave their interceptor out.
+type Config struct {
+	ClientIP      *clientip.Resolver
+	TrustedSubnet string
+	HashKey       string
+	Replay        *replay.Guard
+	RateLimiter   *ratelimit.Limiter
+	Authenticator *auth.Authenticator
+	Agents        *registry.Registry
+	Idempotency   idempotency.Store
+}
+
+// Chain returns the interceptors of the server in the order they must run.
+// The client IP is resolved first, since the later ones depend on it. Forged
+// and replayed calls are rejected before they take up the rate limit, and the
+// caller is authenticated before agents are registered and idempotency keys,
+// which belong to the principal, are looked up.
+func Chain(cfg Config) []grpc.UnaryServerInterceptor {
+	interceptors := []grpc.UnaryServerInterceptor{
+		ClientIPInterceptor(cfg.ClientIP),
+		IPCheckInterceptor(cfg.TrustedSubnet),
+	}
+	if cfg.HashKey != "" {
+		interceptors = append(interceptors, HashCheckInterceptor(cfg.HashKey, cfg.Replay))
+	}
+	if cfg.RateLimiter != nil {
+		interceptors = append(interceptors, RateLimitInterceptor(cfg.RateLimiter))
+	}
+	if cfg.Authenticator != nil {
+		interceptors = append(interceptors, AuthInterceptor(cfg.Authenticator))
+	}
+	if cfg.Agents != nil {
+		interceptors = append(interceptors, AgentRegistryInterceptor(cfg.Agents))
+	}
+	if cfg.Idempotency != nil {
+		interceptors = append(interceptors, IdempotencyInterceptor(cfg.Idempotency))
+	}
+
+	return interceptors
+}
@@ -0,0 +1,139 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/clientip"
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/ratelimit"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+// incoming returns the context of a call from the IP carrying the metadata pairs.
+func incoming(ip string, kv ...string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...))
+	return peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 5000}})
+}
+
+// call runs the handler behind the interceptors the way grpc.ChainUnaryInterceptor does.
+func call(ctx context.Context, interceptors []grpc.UnaryServerInterceptor, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler(ctx, req)
+}
+
+func TestChain(t *testing.T) {
+	const hashKey = "secret"
+	authenticator, err := auth.New([]auth.TokenConfig{
+		{Name: "agent", Token: "agent-token", Scopes: []string{auth.ScopeWrite}},
+	})
+	require.NoError(t, err)
+
+	interceptors := Chain(Config{
+		ClientIP:      clientip.NewResolver(nil),
+		TrustedSubnet: "10.0.0.0/8",
+		HashKey:       hashKey,
+		RateLimiter:   ratelimit.New(0.001, 1, nil),
+		Authenticator: authenticator,
+		Agents:        registry.New(time.Minute),
+		Idempotency:   idempotency.NewMemoryStore(time.Minute, 100),
+	})
+
+	calls := 0
+	var principal *auth.Principal
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		principal = auth.FromContext(ctx)
+		return &proto.UpdateMetricsResponse{}, nil
+	}
+
+	req := updateRequest("Alloc")
+	signature := sign(t, hashKey, req)
+	send := func(ip string, kv ...string) codes.Code {
+		_, err := call(incoming(ip, kv...), interceptors, proto.Metrics_UpdateMetrics_FullMethodName, req, handler)
+		return status.Code(err)
+	}
+
+	tests := []struct {
+		name      string
+		ip        string
+		metadata  []string
+		wantCode  codes.Code
+		wantCalls int
+	}{
+		{
+			name:     "untrusted sender is rejected before its signature is checked",
+			ip:       "192.168.0.1",
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "forged call is rejected before the rate limit",
+			ip:       "10.0.0.1",
+			metadata: []string{crypto.HashMetadataKey, sign(t, "other", req), "authorization", "Bearer agent-token"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:      "signed call keeps the rate limit of the forged one",
+			ip:        "10.0.0.1",
+			metadata:  []string{crypto.HashMetadataKey, signature, "authorization", "Bearer agent-token"},
+			wantCode:  codes.OK,
+			wantCalls: 1,
+		},
+		{
+			name:     "rate limit applies before authentication",
+			ip:       "10.0.0.1",
+			metadata: []string{crypto.HashMetadataKey, signature},
+			wantCode: codes.ResourceExhausted,
+		},
+		{
+			name:     "missing token",
+			ip:       "10.0.0.2",
+			metadata: []string{crypto.HashMetadataKey, signature},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:      "idempotency keys belong to the principal",
+			ip:        "10.0.0.3",
+			metadata:  []string{crypto.HashMetadataKey, signature, "authorization", "Bearer agent-token", idempotency.MetadataKey, "batch-1"},
+			wantCode:  codes.OK,
+			wantCalls: 1,
+		},
+		{
+			name:     "replay from another address is served from the store",
+			ip:       "10.0.0.4",
+			metadata: []string{crypto.HashMetadataKey, signature, "authorization", "Bearer agent-token", idempotency.MetadataKey, "batch-1"},
+			wantCode: codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, principal = 0, nil
+			assert.Equal(t, tt.wantCode, send(tt.ip, tt.metadata...))
+			assert.Equal(t, tt.wantCalls, calls)
+			if tt.wantCalls > 0 {
+				require.NotNil(t, principal, "the handler runs as the authenticated principal")
+				assert.Equal(t, "agent", principal.Name)
+			}
+		})
+	}
+}
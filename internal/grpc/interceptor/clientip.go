@@ -0,0 +1,58 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/koyif/metrics/internal/clientip"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientIPInterceptor creates a gRPC UnaryServerInterceptor that resolves the client address
+// from the transport peer and, when the peer is a trusted proxy, from x-forwarded-for or
+// x-real-ip metadata. Later interceptors and handlers read the result with ClientIP.
+func ClientIPInterceptor(resolver *clientip.Resolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		p, ok := peer.FromContext(ctx)
+		if !ok || p.Addr == nil {
+			return handler(ctx, req)
+		}
+
+		var forwardedFor []string
+		var realIP string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			forwardedFor = md.Get(clientip.ForwardedForKey)
+			if ips := md.Get(clientip.RealIPKey); len(ips) > 0 {
+				realIP = ips[0]
+			}
+		}
+
+		ip := resolver.Resolve(p.Addr.String(), forwardedFor, realIP)
+		if ip == nil {
+			return handler(ctx, req)
+		}
+
+		return handler(clientip.NewContext(ctx, ip), req)
+	}
+}
+
+// ClientIP returns the client address resolved by ClientIPInterceptor, falling back
+// to the transport peer address. Metadata set by the client is never trusted here.
+func ClientIP(ctx context.Context) (string, error) {
+	if ip := clientip.FromContext(ctx); ip != nil {
+		return ip.String(), nil
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "", fmt.Errorf("missing peer address")
+	}
+
+	if ip := clientip.ParseIP(p.Addr.String()); ip != nil {
+		return ip.String(), nil
+	}
+
+	return "", fmt.Errorf("invalid peer address %q", p.Addr.String())
+}
@@ -0,0 +1,88 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/koyif/metrics/internal/grpc/signing"
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/crypto"
+	"github.com/koyif/metrics/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// HashCheckInterceptor creates a gRPC UnaryServerInterceptor that mirrors the HTTP hash check.
+// The request must carry the HMAC-SHA256 of its serialized message in hashsha256 metadata;
+// calls without it or with a wrong one fail with InvalidArgument. With a replay guard the
+// signature also covers the x-signature-timestamp and x-signature-nonce metadata, and stale
+// or repeated calls fail with InvalidArgument too. The guard can be nil.
+// Successful responses are signed the same way in the hashsha256 response header.
+func HashCheckInterceptor(hashKey string, guard *replay.Guard) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		hashes := md.Get(crypto.HashMetadataKey)
+		if len(hashes) == 0 || hashes[0] == "" {
+			logger.Log.Warn("hash is not provided", logger.String("method", info.FullMethod))
+			return nil, status.Error(codes.InvalidArgument, "hash is not provided")
+		}
+
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return nil, status.Error(codes.Internal, "unexpected request type")
+		}
+
+		timestamp := firstValue(md, replay.TimestampMetadataKey)
+		nonce := firstValue(md, replay.NonceMetadataKey)
+
+		var valid bool
+		var err error
+		if guard == nil {
+			valid, err = signing.Verify(hashKey, msg, hashes[0])
+		} else {
+			valid, err = signing.VerifyRequest(hashKey, timestamp, nonce, msg, hashes[0])
+		}
+		if err != nil {
+			logger.Log.Error("failed to verify request hash", logger.Error(err))
+			return nil, status.Error(codes.Internal, "failed to serialize request")
+		}
+		if !valid {
+			logger.Log.Warn("hash is not valid", logger.String("method", info.FullMethod))
+			return nil, status.Error(codes.InvalidArgument, "hash is not valid")
+		}
+
+		if guard != nil {
+			if err := guard.Check(timestamp, nonce); err != nil {
+				logger.Log.Warn("call rejected by replay protection", logger.String("method", info.FullMethod), logger.Error(err))
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+
+		if msg, ok := resp.(proto.Message); ok {
+			signature, err := signing.Sign(hashKey, msg)
+			if err != nil {
+				logger.Log.Error("failed to sign response", logger.Error(err))
+				return nil, status.Error(codes.Internal, "failed to serialize response")
+			}
+			if err := grpc.SetHeader(ctx, metadata.Pairs(crypto.HashMetadataKey, signature)); err != nil {
+				logger.Log.Debug("failed to set response hash header", logger.Error(err))
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,110 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/koyif/metrics/internal/grpc/signing"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+func updateRequest(ids ...string) *proto.UpdateMetricsRequest {
+	req := &proto.UpdateMetricsRequest{}
+	for _, id := range ids {
+		req.Metrics = append(req.Metrics, &proto.Metric{Id: id, Type: proto.Metric_GAUGE, Value: 1})
+	}
+	return req
+}
+
+func sign(t *testing.T, key string, msg *proto.UpdateMetricsRequest) string {
+	t.Helper()
+	signature, err := signing.Sign(key, msg)
+	require.NoError(t, err)
+	return signature
+}
+
+func TestHashCheckInterceptor(t *testing.T) {
+	const hashKey = "secret"
+	interceptors := []grpc.UnaryServerInterceptor{HashCheckInterceptor(hashKey, nil)}
+
+	tests := []struct {
+		name      string
+		signature string
+		wantCode  codes.Code
+	}{
+		{name: "valid signature", signature: sign(t, hashKey, updateRequest("Alloc")), wantCode: codes.OK},
+		{name: "missing signature", wantCode: codes.InvalidArgument},
+		{name: "tampered message", signature: sign(t, hashKey, updateRequest("Other")), wantCode: codes.InvalidArgument},
+		{name: "other key", signature: sign(t, "other", updateRequest("Alloc")), wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			ctx := incoming("10.0.0.1", crypto.HashMetadataKey, tt.signature)
+			_, err := call(ctx, interceptors, proto.Metrics_UpdateMetrics_FullMethodName, updateRequest("Alloc"),
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					reached = true
+					return &proto.UpdateMetricsResponse{}, nil
+				})
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantCode == codes.OK, reached)
+		})
+	}
+}
+
+func TestHashCheckInterceptor_ReplayProtection(t *testing.T) {
+	const hashKey = "secret"
+	interceptors := []grpc.UnaryServerInterceptor{HashCheckInterceptor(hashKey, replay.New(time.Minute, 100))}
+	req := updateRequest("Alloc")
+
+	signRequest := func(timestamp, nonce string) string {
+		signature, err := signing.SignRequest(hashKey, timestamp, nonce, req)
+		require.NoError(t, err)
+		return signature
+	}
+	now := replay.Timestamp(time.Now())
+	stale := replay.Timestamp(time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name      string
+		timestamp string
+		nonce     string
+		signature string
+		wantCode  codes.Code
+	}{
+		{name: "valid signature", timestamp: now, nonce: "nonce-1", signature: signRequest(now, "nonce-1"), wantCode: codes.OK},
+		{name: "replayed nonce", timestamp: now, nonce: "nonce-1", signature: signRequest(now, "nonce-1"), wantCode: codes.InvalidArgument},
+		{name: "nonce not covered by signature", timestamp: now, nonce: "nonce-2", signature: signRequest(now, "nonce-1"), wantCode: codes.InvalidArgument},
+		{name: "message-only signature", timestamp: now, nonce: "nonce-3", signature: sign(t, hashKey, req), wantCode: codes.InvalidArgument},
+		{name: "stale timestamp", timestamp: stale, nonce: "nonce-4", signature: signRequest(stale, "nonce-4"), wantCode: codes.InvalidArgument},
+		{name: "missing timestamp", nonce: "nonce-5", signature: signRequest("", "nonce-5"), wantCode: codes.InvalidArgument},
+		{name: "fresh nonce", timestamp: now, nonce: "nonce-6", signature: signRequest(now, "nonce-6"), wantCode: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := incoming("10.0.0.1",
+				crypto.HashMetadataKey, tt.signature,
+				replay.TimestampMetadataKey, tt.timestamp,
+				replay.NonceMetadataKey, tt.nonce,
+			)
+			_, err := call(ctx, interceptors, proto.Metrics_UpdateMetrics_FullMethodName, req,
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					return &proto.UpdateMetricsResponse{}, nil
+				})
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// IdempotencyInterceptor creates a gRPC UnaryServerInterceptor that deduplicates calls
+// carrying an idempotency-key metadata entry. The response of the first successful call
+// is stored and returned for replays with the same key, which also get an
+// idempotent-replayed header. A replay arriving while the first call is still running
+// fails with Aborted.
+//
+// Failed calls are not stored and the client may retry them with the same key, so
+// handlers must only fail calls that applied nothing: once a batch is stored, an
+// error saving it afterwards is logged rather than returned.
+func IdempotencyInterceptor(store idempotency.Store) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key := idempotencyKeyFromMetadata(ctx)
+		if key == "" {
+			return handler(ctx, req)
+		}
+
+		if len(key) > idempotency.MaxKeyLength {
+			return nil, status.Error(codes.InvalidArgument, "idempotency key is too long")
+		}
+
+		owner, err := idempotencyOwner(ctx)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		scopedKey := owner + " " + info.FullMethod + " " + key
+
+		result, err := store.Begin(ctx, scopedKey)
+		if errors.Is(err, idempotency.ErrInProgress) {
+			logger.Log.Warn("duplicate call is still in progress", logger.String("method", info.FullMethod))
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if err != nil {
+			logger.Log.Error("idempotency store failed", logger.Error(err))
+			return nil, status.Error(codes.Internal, "idempotency store failed")
+		}
+
+		if result != nil {
+			logger.Log.Info("replaying stored response", logger.String("method", info.FullMethod))
+			resp, err := decodeStoredResponse(result)
+			if err != nil {
+				logger.Log.Error("failed to decode stored response", logger.Error(err))
+				return nil, status.Error(codes.Internal, "failed to decode stored response")
+			}
+			if err := grpc.SetHeader(ctx, metadata.Pairs("idempotent-replayed", "true")); err != nil {
+				logger.Log.Debug("failed to set idempotent-replayed header", logger.Error(err))
+			}
+			return resp, nil
+		}
+
+		resp, handlerErr := handler(ctx, req)
+
+		// The key must be settled even if the client went away meanwhile.
+		ctx = context.WithoutCancel(ctx)
+
+		msg, ok := resp.(proto.Message)
+		if handlerErr != nil || !ok {
+			if err := store.Abort(ctx, scopedKey); err != nil {
+				logger.Log.Error("failed to release idempotency key", logger.Error(err))
+			}
+			return resp, handlerErr
+		}
+
+		body, err := proto.Marshal(msg)
+		if err != nil {
+			logger.Log.Error("failed to encode response for idempotency store", logger.Error(err))
+			_ = store.Abort(ctx, scopedKey)
+			return resp, nil
+		}
+
+		err = store.Complete(ctx, scopedKey, idempotency.Result{
+			StatusCode:  int(codes.OK),
+			ContentType: string(msg.ProtoReflect().Descriptor().FullName()),
+			Body:        body,
+		})
+		if err != nil {
+			logger.Log.Error("failed to store idempotent response", logger.Error(err))
+		}
+
+		return resp, nil
+	}
+}
+
+// idempotencyOwner identifies the client owning an idempotency key: the
+// authenticated principal, or the client IP when authentication is off.
+func idempotencyOwner(ctx context.Context) (string, error) {
+	if p := auth.FromContext(ctx); p != nil {
+		return "token:" + p.Name, nil
+	}
+
+	ip, err := ClientIP(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return "ip:" + ip, nil
+}
+
+func idempotencyKeyFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	keys := md.Get(idempotency.MetadataKey)
+	if len(keys) == 0 {
+		return ""
+	}
+
+	return keys[0]
+}
+
+// decodeStoredResponse restores the response message using the type name saved with it.
+func decodeStoredResponse(result *idempotency.Result) (proto.Message, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(result.ContentType))
+	if err != nil {
+		return nil, err
+	}
+
+	msg := mt.New().Interface()
+	if err := proto.Unmarshal(result.Body, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
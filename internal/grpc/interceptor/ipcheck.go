@@ -2,26 +2,20 @@ package interceptor
 
 import (
 	"context"
-	"fmt"
-	"net"
 
+	"github.com/koyif/metrics/internal/clientip"
 	"github.com/koyif/metrics/pkg/logger"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
-// IPCheckInterceptor creates a gRPC UnaryServerInterceptor that validates client IP against trusted subnet.
-// Returns a pass-through interceptor if trustedSubnet is empty (no validation).
-func IPCheckInterceptor(trustedSubnet string) grpc.UnaryServerInterceptor {
-	if trustedSubnet == "" {
-		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-			return handler(ctx, req)
-		}
-	}
-
-	_, ipNet, err := net.ParseCIDR(trustedSubnet)
+// IPCheckInterceptor creates a gRPC UnaryServerInterceptor that validates the client IP
+// against the trusted subnets, a comma-separated list of IPv4 or IPv6 networks in CIDR notation.
+// The client IP is the one resolved by ClientIPInterceptor, or the peer address without it.
+// Returns a pass-through interceptor if trustedSubnets is empty (no validation).
+func IPCheckInterceptor(trustedSubnets string) grpc.UnaryServerInterceptor {
+	networks, err := clientip.ParseCIDRs(trustedSubnets)
 	if err != nil {
 		logger.Log.Fatal("invalid CIDR notation for trusted subnet", logger.Error(err))
 		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
@@ -29,42 +23,28 @@ func IPCheckInterceptor(trustedSubnet string) grpc.UnaryServerInterceptor {
 		}
 	}
 
-	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			logger.Log.Warn(
-				"missing metadata in gRPC request",
-				logger.String("method", info.FullMethod),
-			)
-			return nil, status.Error(codes.PermissionDenied, "forbidden")
-		}
-
-		ips := md.Get("x-real-ip")
-		if len(ips) == 0 {
-			logger.Log.Warn(
-				"missing x-real-ip in gRPC metadata",
-				logger.String("method", info.FullMethod),
-			)
-			return nil, status.Error(codes.PermissionDenied, "forbidden")
+	if len(networks) == 0 {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			return handler(ctx, req)
 		}
+	}
 
-		clientIP := ips[0]
-
-		ip := net.ParseIP(clientIP)
-		if ip == nil {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		clientIP, err := ClientIP(ctx)
+		if err != nil {
 			logger.Log.Warn(
-				"invalid IP address in x-real-ip metadata",
-				logger.String("x-real-ip", clientIP),
+				"couldn't determine client IP",
 				logger.String("method", info.FullMethod),
+				logger.Error(err),
 			)
 			return nil, status.Error(codes.PermissionDenied, "forbidden")
 		}
 
-		if !ipNet.Contains(ip) {
+		if !clientip.Contains(networks, clientip.ParseIP(clientIP)) {
 			logger.Log.Warn(
 				"IP address not in trusted subnet",
-				logger.String("x-real-ip", clientIP),
-				logger.String("trusted_subnet", trustedSubnet),
+				logger.String("client_ip", clientIP),
+				logger.String("trusted_subnet", trustedSubnets),
 				logger.String("method", info.FullMethod),
 			)
 			return nil, status.Error(codes.PermissionDenied, "forbidden")
@@ -72,27 +52,11 @@ func IPCheckInterceptor(trustedSubnet string) grpc.UnaryServerInterceptor {
 
 		logger.Log.Debug(
 			"IP check passed",
-			logger.String("x-real-ip", clientIP),
-			logger.String("trusted_subnet", trustedSubnet),
+			logger.String("client_ip", clientIP),
+			logger.String("trusted_subnet", trustedSubnets),
 			logger.String("method", info.FullMethod),
 		)
 
 		return handler(ctx, req)
 	}
 }
-
-// ExtractIPFromMetadata extracts the client IP from gRPC metadata.
-// Returns the IP address and an error if not found or invalid.
-func ExtractIPFromMetadata(ctx context.Context) (string, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return "", fmt.Errorf("missing metadata")
-	}
-
-	ips := md.Get("x-real-ip")
-	if len(ips) == 0 {
-		return "", fmt.Errorf("missing x-real-ip in metadata")
-	}
-
-	return ips[0], nil
-}
@@ -0,0 +1,46 @@
+package interceptor
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/koyif/metrics/internal/ratelimit"
+	"github.com/koyif/metrics/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type rateLimiter interface {
+	Allow(clientIP string) (bool, time.Duration)
+}
+
+// RateLimitInterceptor creates a gRPC UnaryServerInterceptor that applies a per-client token bucket.
+// Rejected calls fail with ResourceExhausted and carry a retry-after header in seconds.
+func RateLimitInterceptor(limiter rateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		clientIP, err := ClientIP(ctx)
+		if err != nil {
+			clientIP = "unknown"
+		}
+
+		allowed, wait := limiter.Allow(clientIP)
+		if !allowed {
+			retryAfter := strconv.Itoa(ratelimit.RetryAfterSeconds(wait))
+			logger.Log.Warn(
+				"rate limit exceeded",
+				logger.String("client", clientIP),
+				logger.String("method", info.FullMethod),
+				logger.String("retry_after", retryAfter),
+			)
+			if err := grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter)); err != nil {
+				logger.Log.Debug("failed to set retry-after header", logger.Error(err))
+			}
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/registry"
+)
+
+type agentLister interface {
+	Agents() []registry.Agent
+}
+
+// AgentsServer implements the gRPC Agents service.
+type AgentsServer struct {
+	proto.UnimplementedAgentsServer
+	registry agentLister
+}
+
+// NewAgentsServer creates a new gRPC server exposing the agent registry.
+func NewAgentsServer(registry agentLister) *AgentsServer {
+	return &AgentsServer{
+		registry: registry,
+	}
+}
+
+// ListAgents implements the gRPC ListAgents RPC method.
+func (s *AgentsServer) ListAgents(_ context.Context, _ *proto.ListAgentsRequest) (*proto.ListAgentsResponse, error) {
+	agents := s.registry.Agents()
+
+	resp := &proto.ListAgentsResponse{
+		Agents: make([]*proto.Agent, 0, len(agents)),
+	}
+	for _, a := range agents {
+		resp.Agents = append(resp.Agents, &proto.Agent{
+			Id:              a.ID,
+			Hostname:        a.Hostname,
+			Version:         a.Version,
+			StartedAtUnix:   unixOrZero(a.StartedAt.Unix(), a.StartedAt.IsZero()),
+			FirstSeenUnix:   a.FirstSeen.Unix(),
+			LastSeenUnix:    a.LastSeen.Unix(),
+			Transport:       a.Transport,
+			Address:         a.Address,
+			Requests:        a.Requests,
+			MetricsReceived: a.MetricsReceived,
+			Alive:           a.Alive,
+		})
+	}
+
+	return resp, nil
+}
+
+func unixOrZero(unix int64, zero bool) int64 {
+	if zero {
+		return 0
+	}
+	return unix
+}
@@ -2,15 +2,24 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/auth"
 	"github.com/koyif/metrics/internal/config"
 	"github.com/koyif/metrics/internal/grpc/converter"
 	"github.com/koyif/metrics/internal/grpc/interceptor"
 	"github.com/koyif/metrics/internal/models"
 	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/internal/validation"
 	"github.com/koyif/metrics/pkg/logger"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -19,11 +28,21 @@ const (
 	metricIDEmptyErrorMessage          = "metric ID cannot be empty"
 	emptyMetricsErrorMessage           = "metrics array cannot be empty"
 	failedToPersistMetricsErrorMessage = "failed to persist metrics"
+	seriesQuotaExceededMessage         = "request rejected by series quota"
+	validationFailedMessage            = "metrics rejected by validation policy"
+	accessDeniedMessage                = "request rejected by token restrictions"
 )
 
 type metricsStorer interface {
 	StoreAll(metrics []models.Metrics) error
+	Validate(metrics []models.Metrics) error
 	Persist() error
+	AllMetrics() []models.Metrics
+}
+
+type seriesLimiter interface {
+	Reserve(client string, metrics []models.Metrics) (*quota.Reservation, error)
+	ReservePartial(client string, metrics []models.Metrics) ([]models.Metrics, *quota.Reservation, error)
 }
 
 // MetricsServer implements the gRPC Metrics service.
@@ -32,44 +51,140 @@ type MetricsServer struct {
 	service      metricsStorer
 	cfg          *config.Config
 	auditManager *audit.Manager
+	limiter      seriesLimiter
 }
 
 // NewMetricsServer creates a new gRPC metrics server.
-// The auditManager can be nil if auditing is not enabled.
-func NewMetricsServer(service metricsStorer, cfg *config.Config, auditManager *audit.Manager) *MetricsServer {
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewMetricsServer(service metricsStorer, cfg *config.Config, auditManager *audit.Manager, limiter seriesLimiter) *MetricsServer {
 	return &MetricsServer{
 		service:      service,
 		cfg:          cfg,
 		auditManager: auditManager,
+		limiter:      limiter,
 	}
 }
 
 // UpdateMetrics implements the gRPC UpdateMetrics RPC method.
 // It receives a batch of metrics from the agent, validates them, and stores them.
+// By default the batch is all-or-nothing and an invalid metric fails the whole call
+// with InvalidArgument. When the request sets partial, valid metrics are stored and
+// the response reports the outcome of every metric, new series over the
+// series quota included.
 func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *proto.UpdateMetricsRequest) (*proto.UpdateMetricsResponse, error) {
 	if len(req.Metrics) == 0 {
 		logger.Log.Warn(emptyMetricsErrorMessage)
 		return nil, status.Error(codes.InvalidArgument, emptyMetricsErrorMessage)
 	}
 
-	for _, metric := range req.Metrics {
-		if metric.Id == "" {
-			logger.Log.Warn(metricIDEmptyErrorMessage)
-			return nil, status.Error(codes.InvalidArgument, metricIDEmptyErrorMessage)
+	if !req.Partial {
+		for _, metric := range req.Metrics {
+			if metric.Id == "" {
+				logger.Log.Warn(metricIDEmptyErrorMessage)
+				return nil, status.Error(codes.InvalidArgument, metricIDEmptyErrorMessage)
+			}
 		}
 	}
 
 	metrics := converter.ProtoToModels(req.Metrics)
 
+	names := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		names = append(names, metric.ID)
+	}
+	if err := auth.CheckMetrics(ctx, names...); err != nil {
+		logger.Log.Warn(accessDeniedMessage, logger.Error(err))
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	validationErr := s.service.Validate(metrics)
+	if validationErr != nil {
+		logger.Log.Warn(validationFailedMessage, logger.Error(validationErr))
+		if !req.Partial {
+			return nil, validationStatus(validationErr)
+		}
+	}
+
+	valid, indexes, violations := validation.Partition(metrics, validationErr)
+
+	clientIP, err := interceptor.ClientIP(ctx)
+	if err != nil {
+		clientIP = "unknown"
+	}
+
+	var reservation *quota.Reservation
+	if len(valid) > 0 && s.limiter != nil {
+		if !req.Partial {
+			if reservation, err = s.limiter.Reserve(clientIP, valid); err != nil {
+				logger.Log.Warn(seriesQuotaExceededMessage, logger.Error(err))
+				return nil, status.Error(codes.ResourceExhausted, err.Error())
+			}
+		} else {
+			// New series over the quota are reported like invalid metrics.
+			_, reservation, err = s.limiter.ReservePartial(clientIP, valid)
+			var rejected []validation.Violation
+			valid, indexes, rejected = quota.Partition(valid, indexes, err)
+			violations = append(violations, rejected...)
+		}
+	}
+
+	if len(valid) > 0 {
+		if err := s.store(valid, clientIP, reservation); err != nil {
+			return nil, err
+		}
+		registry.RecordMetrics(ctx, len(valid))
+	}
+
+	results := make([]*proto.MetricResult, len(metrics))
+	for i, index := range indexes {
+		results[index] = &proto.MetricResult{
+			Index:    int32(index),
+			Id:       valid[i].ID,
+			Accepted: true,
+		}
+	}
+	for _, v := range violations {
+		results[v.Index] = &proto.MetricResult{
+			Index:   int32(v.Index),
+			Id:      v.ID,
+			Reason:  v.Reason,
+			Message: v.Message,
+		}
+	}
+
+	return &proto.UpdateMetricsResponse{Results: results}, nil
+}
+
+// ListMetrics implements the gRPC ListMetrics RPC method.
+// It returns the current value of every metric with the requested prefix that
+// the caller's token may access, sorted by name. Counters carry their totals.
+func (s *MetricsServer) ListMetrics(ctx context.Context, req *proto.ListMetricsRequest) (*proto.ListMetricsResponse, error) {
+	metrics := make([]models.Metrics, 0)
+	for _, metric := range s.service.AllMetrics() {
+		if strings.HasPrefix(metric.ID, req.Prefix) && auth.AllowsMetric(ctx, metric.ID) {
+			metrics = append(metrics, metric)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].ID < metrics[j].ID })
+
+	return &proto.ListMetricsResponse{Metrics: converter.ModelsToProto(metrics)}, nil
+}
+
+// store stores the metrics, settles the reservation of their series and
+// notifies auditors.
+func (s *MetricsServer) store(metrics []models.Metrics, clientIP string, reservation *quota.Reservation) error {
 	if err := s.service.StoreAll(metrics); err != nil {
+		reservation.Release()
 		logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
-		return nil, status.Error(codes.Internal, failedToPersistMetricsErrorMessage)
+		return status.Error(codes.Internal, failedToPersistMetricsErrorMessage)
 	}
+	reservation.Commit()
 
+	// The metrics are applied once stored: failing the call now would make the
+	// client retry and add its counters twice. They are saved with the next update.
 	if s.cfg.StoreInterval.Value() == 0 {
 		if err := s.service.Persist(); err != nil {
 			logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
-			return nil, status.Error(codes.Internal, failedToPersistMetricsErrorMessage)
 		}
 	}
 
@@ -79,15 +194,37 @@ func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *proto.UpdateMetr
 			metricNames = append(metricNames, metric.ID)
 		}
 
-		clientIP, err := interceptor.ExtractIPFromMetadata(ctx)
-		if err != nil {
-			clientIP = "unknown"
-		}
-
 		s.sendAuditEvent(metricNames, clientIP)
 	}
 
-	return &proto.UpdateMetricsResponse{}, nil
+	return nil
+}
+
+// validationStatus converts a validation error into an InvalidArgument status.
+// Every rejected metric is reported as a BadRequest field violation, so clients
+// can tell which items of the batch were invalid and why.
+func validationStatus(err error) error {
+	var validationErr *validation.Error
+	if !errors.As(err, &validationErr) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(validationErr.Violations))
+	for _, v := range validationErr.Violations {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       fmt.Sprintf("metrics[%d]", v.Index),
+			Description: v.Message,
+			Reason:      v.Reason,
+		})
+	}
+
+	st, detailsErr := status.New(codes.InvalidArgument, validationFailedMessage).
+		WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if detailsErr != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return st.Err()
 }
 
 // sendAuditEvent sends an audit event for the stored metrics.
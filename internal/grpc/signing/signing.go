@@ -0,0 +1,74 @@
+// Package signing computes HMAC-SHA256 signatures of protobuf messages exchanged over gRPC.
+// Messages are serialized deterministically so both sides sign the same bytes.
+package signing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+var marshalOptions = proto.MarshalOptions{Deterministic: true}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the serialized message under key.
+func Sign(key string, msg proto.Message) (string, error) {
+	b, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	return crypto.Sign(key, b), nil
+}
+
+// Verify reports whether signature matches the serialized message under key.
+func Verify(key string, msg proto.Message, signature string) (bool, error) {
+	b, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return false, fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	return crypto.Verify(key, b, signature), nil
+}
+
+// SignRequest returns the HMAC-SHA256 of the serialized request bound to its timestamp and nonce.
+func SignRequest(key, timestamp, nonce string, msg proto.Message) (string, error) {
+	b, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	return crypto.SignRequest(key, timestamp, nonce, b), nil
+}
+
+// VerifyRequest reports whether signature matches SignRequest for the same values.
+func VerifyRequest(key, timestamp, nonce string, msg proto.Message, signature string) (bool, error) {
+	b, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return false, fmt.Errorf("failed to serialize message: %w", err)
+	}
+
+	return crypto.VerifyRequest(key, timestamp, nonce, b, signature), nil
+}
+
+// AppendRequestSignature adds the signature of the request bound to a fresh
+// timestamp and nonce, and the metadata carrying them, to the outgoing context.
+func AppendRequestSignature(ctx context.Context, key string, msg proto.Message) (context.Context, error) {
+	timestamp := replay.Timestamp(time.Now())
+	nonce := replay.NewNonce()
+	signature, err := SignRequest(key, timestamp, nonce, msg)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx,
+		crypto.HashMetadataKey, signature,
+		replay.TimestampMetadataKey, timestamp,
+		replay.NonceMetadataKey, nonce,
+	), nil
+}
@@ -0,0 +1,110 @@
+package signing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+func request(ids ...string) *proto.UpdateMetricsRequest {
+	req := &proto.UpdateMetricsRequest{}
+	for _, id := range ids {
+		req.Metrics = append(req.Metrics, &proto.Metric{Id: id, Type: proto.Metric_GAUGE, Value: 1})
+	}
+	return req
+}
+
+// tamper changes the first hex digit of the signature.
+func tamper(signature string) string {
+	if signature[0] == '0' {
+		return "1" + signature[1:]
+	}
+	return "0" + signature[1:]
+}
+
+func TestVerify(t *testing.T) {
+	signature, err := Sign("secret", request("Alloc"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		key       string
+		msg       *proto.UpdateMetricsRequest
+		signature string
+		want      bool
+	}{
+		{name: "valid signature", key: "secret", msg: request("Alloc"), signature: signature, want: true},
+		{name: "tampered message", key: "secret", msg: request("Alloc", "Injected"), signature: signature},
+		{name: "other key", key: "other", msg: request("Alloc"), signature: signature},
+		{name: "tampered signature", key: "secret", msg: request("Alloc"), signature: tamper(signature)},
+		{name: "missing signature", key: "secret", msg: request("Alloc")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, err := Verify(tt.key, tt.msg, tt.signature)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, valid)
+		})
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	const timestamp, nonce = "1700000000", "nonce-1"
+	signature, err := SignRequest("secret", timestamp, nonce, request("Alloc"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		nonce     string
+		msg       *proto.UpdateMetricsRequest
+		signature string
+		want      bool
+	}{
+		{name: "valid signature", timestamp: timestamp, nonce: nonce, msg: request("Alloc"), signature: signature, want: true},
+		{name: "tampered message", timestamp: timestamp, nonce: nonce, msg: request("Injected"), signature: signature},
+		{name: "other timestamp", timestamp: "1700000001", nonce: nonce, msg: request("Alloc"), signature: signature},
+		{name: "other nonce", timestamp: timestamp, nonce: "nonce-2", msg: request("Alloc"), signature: signature},
+		{name: "tampered signature", timestamp: timestamp, nonce: nonce, msg: request("Alloc"), signature: tamper(signature)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, err := VerifyRequest("secret", tt.timestamp, tt.nonce, tt.msg, tt.signature)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, valid)
+		})
+	}
+}
+
+func TestAppendRequestSignature(t *testing.T) {
+	msg := request("Alloc")
+	ctx, err := AppendRequestSignature(context.Background(), "secret", msg)
+	require.NoError(t, err)
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	require.True(t, ok)
+	timestamp := md.Get(replay.TimestampMetadataKey)
+	nonce := md.Get(replay.NonceMetadataKey)
+	signature := md.Get(crypto.HashMetadataKey)
+	require.Len(t, timestamp, 1)
+	require.Len(t, nonce, 1)
+	require.Len(t, signature, 1)
+
+	valid, err := VerifyRequest("secret", timestamp[0], nonce[0], msg, signature[0])
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	next, err := AppendRequestSignature(context.Background(), "secret", msg)
+	require.NoError(t, err)
+	nextMD, _ := metadata.FromOutgoingContext(next)
+	assert.NotEqual(t, nonce, nextMD.Get(replay.NonceMetadataKey), "every request gets a fresh nonce")
+}
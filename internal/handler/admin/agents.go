@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/registry"
+)
+
+type agentLister interface {
+	Agents() []registry.Agent
+}
+
+// AgentsHandler handles HTTP requests for the agent registry.
+// It processes GET requests at /agents.
+type AgentsHandler struct {
+	registry agentLister
+}
+
+// NewAgentsHandler creates a new handler exposing the agent registry.
+func NewAgentsHandler(registry agentLister) *AgentsHandler {
+	return &AgentsHandler{
+		registry: registry,
+	}
+}
+
+// @Summary		Registered agents
+// @Description	List agents that reported to the server with their identity, last-seen time, transport and metric count
+// @Tags			admin
+// @Produce		json
+// @Success		200	{array}		registry.Agent	"Known agents sorted by ID"
+// @Failure		500	{string}	string			"Internal Server Error - Encoding failure"
+// @Router			/agents [get]
+func (h *AgentsHandler) Handle(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.registry.Agents()); err != nil {
+		handler.InternalServerError(w, err, "failed to encode agents")
+	}
+}
@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/quota"
+)
+
+type usageProvider interface {
+	Usage() quota.Usage
+}
+
+// QuotaHandler handles HTTP requests for series quota usage.
+// It processes GET requests at /admin/quotas.
+type QuotaHandler struct {
+	limiter usageProvider
+}
+
+// NewQuotaHandler creates a new handler exposing series quota usage.
+func NewQuotaHandler(limiter usageProvider) *QuotaHandler {
+	return &QuotaHandler{
+		limiter: limiter,
+	}
+}
+
+// @Summary		Series quota usage
+// @Description	Retrieve configured series limits, per-client series usage and rejected series counts
+// @Tags			admin
+// @Produce		json
+// @Success		200	{object}	quota.Usage	"Current quota usage"
+// @Failure		500	{string}	string		"Internal Server Error - Encoding failure"
+// @Router			/admin/quotas [get]
+func (h *QuotaHandler) Handle(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.limiter.Usage()); err != nil {
+		handler.InternalServerError(w, err, "failed to encode quota usage")
+	}
+}
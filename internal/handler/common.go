@@ -1,8 +1,13 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/koyif/metrics/internal/clientip"
+	"github.com/koyif/metrics/internal/validation"
+	"github.com/koyif/metrics/pkg/dto"
 	"github.com/koyif/metrics/pkg/logger"
 )
 
@@ -40,3 +45,76 @@ func BadRequest(w http.ResponseWriter, uri, m string) {
 func MetricNotFound(w http.ResponseWriter, r *http.Request) {
 	NotFound(w, r, "metric not found")
 }
+
+func TooManyRequests(w http.ResponseWriter, uri string, err error) {
+	logger.Log.Warn("request rejected by series quota", logger.String("URI", uri), logger.Error(err))
+	http.Error(
+		w,
+		http.StatusText(http.StatusTooManyRequests),
+		http.StatusTooManyRequests,
+	)
+}
+
+// Forbidden responds with 403 when the request's token may not access the metrics.
+func Forbidden(w http.ResponseWriter, uri string, err error) {
+	logger.Log.Warn("request rejected by token restrictions", logger.String("URI", uri), logger.Error(err))
+	http.Error(
+		w,
+		http.StatusText(http.StatusForbidden),
+		http.StatusForbidden,
+	)
+}
+
+// ValidationFailed responds with 400 and a JSON body listing every rejected metric.
+// Errors that do not carry per-metric violations are answered with a plain 400.
+func ValidationFailed(w http.ResponseWriter, uri string, err error) {
+	logger.Log.Warn("metrics rejected by validation policy", logger.String("URI", uri), logger.Error(err))
+
+	var validationErr *validation.Error
+	if !errors.As(err, &validationErr) {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	resp := dto.BatchErrorResponse{
+		Error:    "validation failed",
+		Rejected: RejectedMetrics(validationErr.Violations),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Log.Warn("failed to encode response", logger.Error(err))
+	}
+}
+
+// RejectedMetrics converts validation violations into their API representation.
+func RejectedMetrics(violations []validation.Violation) []dto.RejectedMetric {
+	rejected := make([]dto.RejectedMetric, 0, len(violations))
+	for _, v := range violations {
+		rejected = append(rejected, dto.RejectedMetric{
+			Index:   v.Index,
+			ID:      v.ID,
+			MType:   v.MType,
+			Reason:  v.Reason,
+			Message: v.Message,
+		})
+	}
+
+	return rejected
+}
+
+// ClientIP returns the address of the client that sent the request as resolved by
+// middleware.WithClientIP. Without it the TCP peer address is used; forwarding headers
+// are never trusted here because any client can set them.
+func ClientIP(r *http.Request) string {
+	if ip := clientip.FromContext(r.Context()); ip != nil {
+		return ip.String()
+	}
+
+	if ip := clientip.ParseIP(r.RemoteAddr); ip != nil {
+		return ip.String()
+	}
+
+	return r.RemoteAddr
+}
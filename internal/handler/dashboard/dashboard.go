@@ -0,0 +1,151 @@
+// Package dashboard serves the web dashboard: an HTML page with its scripts and
+// styles embedded into the binary, and the JSON API the page polls for data.
+// The page loads nothing from external hosts, so it works without internet access.
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/history"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/pkg/dto"
+)
+
+// StaticPrefix is the URL path the embedded assets are served under.
+const StaticPrefix = "/static/"
+
+//go:embed static
+var content embed.FS
+
+// static holds the embedded assets without the directory prefix.
+var static, _ = fs.Sub(content, "static")
+
+// PageHandler serves the dashboard page.
+// It processes GET requests at /.
+type PageHandler struct{}
+
+// NewPageHandler creates a new handler for the dashboard page.
+func NewPageHandler() *PageHandler {
+	return &PageHandler{}
+}
+
+// @Summary		Dashboard
+// @Description	Interactive HTML dashboard with sortable, filterable tables of gauges and counters, last-updated times and sparklines.
+// @Description	The page polls /api/v1/dashboard for data; its scripts and styles are embedded and served from /static/.
+// @Tags			metrics
+// @Produce		html
+// @Success		200	{string}	string	"Dashboard page"
+// @Router			/ [get]
+func (h *PageHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFileFS(w, r, static, "index.html")
+}
+
+// Assets returns a handler serving the embedded scripts and styles under StaticPrefix.
+func Assets() http.Handler {
+	return http.StripPrefix(StaticPrefix, http.FileServerFS(static))
+}
+
+type metricsGetter interface {
+	AllMetrics() []models.Metrics
+}
+
+type historyGetter interface {
+	Get(mtype, id string) (history.Series, bool)
+}
+
+// DataHandler handles HTTP requests for the dashboard data.
+// It processes GET requests at /api/v1/dashboard.
+type DataHandler struct {
+	service metricsGetter
+	history historyGetter
+}
+
+// NewDataHandler creates a new handler for the dashboard data.
+// The history can be nil, in which case metrics are reported without
+// update times and history.
+func NewDataHandler(service metricsGetter, history historyGetter) *DataHandler {
+	return &DataHandler{
+		service: service,
+		history: history,
+	}
+}
+
+// @Summary		Dashboard data
+// @Description	Current value, last update time and recent history of every metric the token may read, split by type and sorted by name.
+// @Description	Update times and history only cover updates received since the server started.
+// @Tags			metrics
+// @Produce		json
+// @Success		200	{object}	dto.DashboardResponse	"Metrics split by type"
+// @Failure		401	{string}	string					"Unauthorized - Missing or invalid token"
+// @Failure		403	{string}	string					"Forbidden - Token lacks the read scope"
+// @Failure		500	{string}	string					"Internal Server Error - Encoding failure"
+// @Router			/api/v1/dashboard [get]
+func (h *DataHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	resp := dto.DashboardResponse{
+		Gauges:      make([]dto.DashboardMetric, 0),
+		Counters:    make([]dto.DashboardMetric, 0),
+		GeneratedAt: time.Now(),
+	}
+
+	// Metrics outside the prefixes of the request's token are left out.
+	for _, metric := range h.service.AllMetrics() {
+		if !auth.AllowsMetric(r.Context(), metric.ID) {
+			continue
+		}
+		m := h.metric(metric.MType, metric.ID)
+		switch metric.MType {
+		case models.Gauge:
+			m.Value = metric.Value
+			resp.Gauges = append(resp.Gauges, m)
+		case models.Counter:
+			m.Delta = metric.Delta
+			resp.Counters = append(resp.Counters, m)
+		}
+	}
+
+	sortByID(resp.Gauges)
+	sortByID(resp.Counters)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		handler.InternalServerError(w, err, "failed to encode dashboard data")
+	}
+}
+
+func (h *DataHandler) metric(mtype, id string) dto.DashboardMetric {
+	m := dto.DashboardMetric{
+		ID:      id,
+		MType:   mtype,
+		History: make([]float64, 0),
+	}
+	if h.history == nil {
+		return m
+	}
+
+	series, ok := h.history.Get(mtype, id)
+	if !ok {
+		return m
+	}
+	if !series.Updated.IsZero() {
+		updated := series.Updated
+		m.UpdatedAt = &updated
+	}
+	for _, s := range series.Samples {
+		m.History = append(m.History, s.Value)
+	}
+
+	return m
+}
+
+func sortByID(metrics []dto.DashboardMetric) {
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].ID < metrics[j].ID })
+}
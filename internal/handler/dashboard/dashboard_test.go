@@ -0,0 +1,140 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/history"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/pkg/dto"
+)
+
+type metricsStub struct {
+	counters map[string]int64
+	gauges   map[string]float64
+}
+
+func (s metricsStub) AllMetrics() []models.Metrics {
+	metrics := make([]models.Metrics, 0, len(s.counters)+len(s.gauges))
+	for id, delta := range s.counters {
+		metrics = append(metrics, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+	}
+	for id, value := range s.gauges {
+		metrics = append(metrics, models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+	}
+	return metrics
+}
+
+func TestPageHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewPageHandler().Handle(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), StaticPrefix+"app.js")
+	assert.NotContains(t, w.Body.String(), "https://", "the page must not load external resources")
+}
+
+func TestAssets(t *testing.T) {
+	for _, name := range []string{"app.js", "style.css"} {
+		w := httptest.NewRecorder()
+		Assets().ServeHTTP(w, httptest.NewRequest(http.MethodGet, StaticPrefix+name, nil))
+
+		assert.Equal(t, http.StatusOK, w.Code, name)
+		assert.NotEmpty(t, w.Body.String(), name)
+	}
+
+	w := httptest.NewRecorder()
+	Assets().ServeHTTP(w, httptest.NewRequest(http.MethodGet, StaticPrefix+"missing.js", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDataHandler(t *testing.T) {
+	store := history.New(10, 10)
+	delta := int64(3)
+	value := 0.5
+	store.Publish([]models.Metrics{{ID: "host1.cpu", MType: models.Gauge, Value: &value}})
+	store.Publish([]models.Metrics{{ID: "requests", MType: models.Counter, Delta: &delta}})
+
+	service := metricsStub{
+		counters: map[string]int64{"requests": 3},
+		gauges:   map[string]float64{"host1.cpu": 0.5, "host2.cpu": 0.7, "alloc": 100},
+	}
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		wantGauges   []string
+		wantCounters []string
+	}{
+		{
+			name:         "all metrics without auth",
+			ctx:          context.Background(),
+			wantGauges:   []string{"alloc", "host1.cpu", "host2.cpu"},
+			wantCounters: []string{"requests"},
+		},
+		{
+			name:         "token prefixes filter metrics",
+			ctx:          auth.NewContext(context.Background(), &auth.Principal{Name: "viewer", Prefixes: []string{"host1."}}),
+			wantGauges:   []string{"host1.cpu"},
+			wantCounters: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/dashboard", nil).WithContext(tt.ctx)
+			w := httptest.NewRecorder()
+			NewDataHandler(service, store).Handle(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var resp dto.DashboardResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			assert.Equal(t, tt.wantGauges, ids(resp.Gauges))
+			assert.Equal(t, tt.wantCounters, ids(resp.Counters))
+
+			for _, m := range resp.Gauges {
+				require.NotNil(t, m.Value)
+				if m.ID == "host1.cpu" {
+					require.NotNil(t, m.UpdatedAt)
+					assert.Equal(t, []float64{0.5}, m.History)
+				} else {
+					assert.Nil(t, m.UpdatedAt, "metrics not updated since start have no update time")
+					assert.Empty(t, m.History)
+				}
+			}
+			for _, m := range resp.Counters {
+				require.NotNil(t, m.Delta)
+				assert.Equal(t, int64(3), *m.Delta)
+				assert.Equal(t, []float64{3}, m.History)
+			}
+		})
+	}
+}
+
+func TestDataHandler_NilHistory(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewDataHandler(metricsStub{gauges: map[string]float64{"cpu": 1}}, nil).
+		Handle(w, httptest.NewRequest(http.MethodGet, "/api/v1/dashboard", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), `"history":[]`))
+}
+
+func ids(metrics []dto.DashboardMetric) []string {
+	out := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		out = append(out, m.ID)
+	}
+	return out
+}
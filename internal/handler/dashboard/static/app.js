@@ -0,0 +1,227 @@
+"use strict";
+
+(function () {
+	const dataURL = "/api/v1/dashboard";
+	const tokenKey = "metrics.token";
+	const sparkWidth = 120;
+	const sparkHeight = 24;
+
+	const state = {
+		data: { gauges: [], counters: [] },
+		filter: "",
+		sort: {
+			gauges: { key: "id", dir: 1 },
+			counters: { key: "id", dir: 1 },
+		},
+		timer: null,
+	};
+
+	const el = (id) => document.getElementById(id);
+
+	function headers() {
+		const token = localStorage.getItem(tokenKey);
+		return token ? { Authorization: "Bearer " + token } : {};
+	}
+
+	function setStatus(text, isError) {
+		const status = el("status");
+		status.textContent = text;
+		status.classList.toggle("error", Boolean(isError));
+	}
+
+	async function load() {
+		let resp;
+		try {
+			resp = await fetch(dataURL, { headers: headers(), cache: "no-store" });
+		} catch (err) {
+			setStatus("Server unreachable", true);
+			return;
+		}
+
+		if (resp.status === 401 || resp.status === 403) {
+			el("login").hidden = false;
+			setStatus(resp.status === 401 ? "Sign in required" : "Token may not read metrics", true);
+			return;
+		}
+		if (!resp.ok) {
+			setStatus("Error " + resp.status, true);
+			return;
+		}
+
+		el("login").hidden = true;
+		state.data = await resp.json();
+		setStatus("Updated " + new Date(state.data.generated_at).toLocaleTimeString());
+		render();
+	}
+
+	function value(m) {
+		return m.type === "counter" ? m.delta : m.value;
+	}
+
+	function compare(key) {
+		switch (key) {
+			case "value":
+				return (a, b) => value(a) - value(b);
+			case "updated":
+				return (a, b) => Date.parse(a.updated_at || 0) - Date.parse(b.updated_at || 0);
+			default:
+				return (a, b) => a.id.localeCompare(b.id);
+		}
+	}
+
+	function ago(timestamp) {
+		if (!timestamp) {
+			return "—";
+		}
+		const seconds = Math.max(0, Math.round((Date.now() - Date.parse(timestamp)) / 1000));
+		if (seconds < 60) {
+			return seconds + "s ago";
+		}
+		if (seconds < 3600) {
+			return Math.floor(seconds / 60) + "m ago";
+		}
+		if (seconds < 86400) {
+			return Math.floor(seconds / 3600) + "h ago";
+		}
+		return new Date(timestamp).toLocaleString();
+	}
+
+	function sparkline(values) {
+		const ns = "http://www.w3.org/2000/svg";
+		const svg = document.createElementNS(ns, "svg");
+		svg.setAttribute("class", "spark");
+		svg.setAttribute("width", sparkWidth);
+		svg.setAttribute("height", sparkHeight);
+		svg.setAttribute("viewBox", "0 0 " + sparkWidth + " " + sparkHeight);
+		if (!values || values.length < 2) {
+			return svg;
+		}
+
+		const min = Math.min(...values);
+		const span = Math.max(...values) - min || 1;
+		const step = sparkWidth / (values.length - 1);
+		const points = values.map((v, i) => {
+			const x = i * step;
+			const y = sparkHeight - 1 - ((v - min) / span) * (sparkHeight - 2);
+			return x.toFixed(1) + "," + y.toFixed(1);
+		});
+
+		const line = document.createElementNS(ns, "polyline");
+		line.setAttribute("points", points.join(" "));
+		svg.appendChild(line);
+
+		const title = document.createElementNS(ns, "title");
+		title.textContent = "min " + min + ", max " + (min + span) + ", " + values.length + " samples";
+		svg.appendChild(title);
+
+		return svg;
+	}
+
+	function cell(text, className) {
+		const td = document.createElement("td");
+		td.textContent = text;
+		if (className) {
+			td.className = className;
+		}
+		return td;
+	}
+
+	function renderTable(name) {
+		const table = el(name);
+		const sort = state.sort[name];
+		const filter = state.filter.toLowerCase();
+
+		const rows = state.data[name]
+			.filter((m) => m.id.toLowerCase().includes(filter))
+			.sort((a, b) => compare(sort.key)(a, b) * sort.dir);
+
+		table.querySelectorAll("th[data-key]").forEach((th) => {
+			th.classList.toggle("asc", th.dataset.key === sort.key && sort.dir > 0);
+			th.classList.toggle("desc", th.dataset.key === sort.key && sort.dir < 0);
+		});
+
+		const body = document.createElement("tbody");
+		for (const m of rows) {
+			const tr = document.createElement("tr");
+			tr.appendChild(cell(m.id));
+			tr.appendChild(cell(String(value(m)), "num"));
+
+			const updated = cell(ago(m.updated_at));
+			if (m.updated_at) {
+				updated.title = new Date(m.updated_at).toLocaleString();
+			}
+			tr.appendChild(updated);
+
+			const spark = document.createElement("td");
+			spark.appendChild(sparkline(m.history));
+			tr.appendChild(spark);
+
+			body.appendChild(tr);
+		}
+		if (rows.length === 0) {
+			const empty = cell(state.data[name].length === 0 ? "No metrics" : "No matches", "empty");
+			empty.colSpan = 4;
+			const tr = document.createElement("tr");
+			tr.appendChild(empty);
+			body.appendChild(tr);
+		}
+		table.replaceChild(body, table.tBodies[0]);
+
+		el(name + "-count").textContent = rows.length === state.data[name].length
+			? "(" + rows.length + ")"
+			: "(" + rows.length + " of " + state.data[name].length + ")";
+	}
+
+	function render() {
+		renderTable("gauges");
+		renderTable("counters");
+	}
+
+	function schedule() {
+		clearInterval(state.timer);
+		const interval = Number(el("interval").value);
+		localStorage.setItem("metrics.interval", interval);
+		if (interval > 0) {
+			state.timer = setInterval(load, interval);
+		}
+	}
+
+	function init() {
+		const params = new URLSearchParams(location.search);
+		state.filter = params.get("filter") || "";
+		el("filter").value = state.filter;
+		el("filter").addEventListener("input", (e) => {
+			state.filter = e.target.value;
+			render();
+		});
+
+		for (const name of ["gauges", "counters"]) {
+			el(name).querySelectorAll("th[data-key]").forEach((th) => {
+				th.addEventListener("click", () => {
+					const sort = state.sort[name];
+					sort.dir = sort.key === th.dataset.key ? -sort.dir : 1;
+					sort.key = th.dataset.key;
+					renderTable(name);
+				});
+			});
+		}
+
+		const interval = localStorage.getItem("metrics.interval");
+		if (interval !== null && el("interval").querySelector('option[value="' + interval + '"]')) {
+			el("interval").value = interval;
+		}
+		el("interval").addEventListener("change", schedule);
+
+		el("login").addEventListener("submit", (e) => {
+			e.preventDefault();
+			localStorage.setItem(tokenKey, el("token").value);
+			el("token").value = "";
+			load();
+		});
+
+		load();
+		schedule();
+	}
+
+	init();
+})();
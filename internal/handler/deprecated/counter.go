@@ -5,11 +5,16 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/registry"
 	"github.com/koyif/metrics/internal/repository/dberror"
 	"github.com/koyif/metrics/pkg/logger"
 )
 
 type counterStorer interface {
+	metricValidator
 	StoreCounter(metricName string, value int64) error
 }
 
@@ -19,15 +24,19 @@ type counterGetter interface {
 
 type CountersPostHandler struct {
 	service counterStorer
+	limiter seriesLimiter
 }
 
 type CountersGetHandler struct {
 	service counterGetter
 }
 
-func NewCountersPostHandler(service counterStorer) *CountersPostHandler {
+// NewCountersPostHandler creates a new legacy counter handler.
+// The limiter can be nil if series quotas are not enabled.
+func NewCountersPostHandler(service counterStorer, limiter seriesLimiter) *CountersPostHandler {
 	return &CountersPostHandler{
 		service: service,
+		limiter: limiter,
 	}
 }
 
@@ -44,8 +53,11 @@ func NewCountersGetHandler(service counterGetter) *CountersGetHandler {
 // @Param			metric	path	string	true	"Metric name"
 // @Param			value	path	int		true	"Counter value (integer)"
 // @Success		200		"OK"
-// @Failure		400		{string}	string	"Bad Request - Invalid value format"
+// @Failure		400		{string}	string	"Bad Request - Invalid value format or metric rejected by validation policy"
+// @Failure		401		{string}	string	"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string	"Forbidden - Token lacks the write scope or the metric prefix"
 // @Failure		404		{string}	string	"Not Found - Empty metric name"
+// @Failure		429		{string}	string	"Too Many Requests - Series quota exceeded"
 // @Failure		500		{string}	string	"Internal Server Error - Storage failure"
 // @Router			/update/counter/{metric}/{value} [post]
 func (ch CountersPostHandler) Handle(w http.ResponseWriter, r *http.Request) {
@@ -58,12 +70,31 @@ func (ch CountersPostHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if v, err := strconv.ParseInt(value, 10, 64); err != nil {
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
 		logger.Log.Warn(incorrectValueFormatMessage, logger.String("URI", r.RequestURI))
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 
 		return
-	} else if err := ch.service.StoreCounter(mn, v); err != nil {
+	}
+
+	if err := auth.CheckMetrics(r.Context(), mn); err != nil {
+		handler.Forbidden(w, r.RequestURI, err)
+
+		return
+	}
+
+	if !validate(w, r, ch.service, models.Metrics{ID: mn, MType: models.Counter, Delta: &v}) {
+		return
+	}
+
+	reservation, ok := reserve(w, r, ch.limiter, mn, models.Counter)
+	if !ok {
+		return
+	}
+
+	if err := ch.service.StoreCounter(mn, v); err != nil {
+		reservation.Release()
 		logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
 		http.Error(
 			w,
@@ -73,7 +104,9 @@ func (ch CountersPostHandler) Handle(w http.ResponseWriter, r *http.Request) {
 
 		return
 	}
+	reservation.Commit()
 
+	registry.RecordMetrics(r.Context(), 1)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -83,6 +116,8 @@ func (ch CountersPostHandler) Handle(w http.ResponseWriter, r *http.Request) {
 // @Produce		plain
 // @Param			metric	path	string	true	"Metric name"
 // @Success		200		{string}	string	"Counter value as plain text"
+// @Failure		401		{string}	string	"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string	"Forbidden - Token lacks the read scope or the metric prefix"
 // @Failure		404		{string}	string	"Not Found - Empty metric name or metric not found"
 // @Failure		500		{string}	string	"Internal Server Error - Retrieval failure"
 // @Router			/value/counter/{metric} [get]
@@ -95,6 +130,12 @@ func (h CountersGetHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.CheckMetrics(r.Context(), mn); err != nil {
+		handler.Forbidden(w, r.RequestURI, err)
+
+		return
+	}
+
 	value, err := h.service.Counter(mn)
 	if err != nil && errors.Is(err, dberror.ErrValueNotFound) {
 		logger.Log.Warn(valueNotFoundErrorMessage, logger.String("URI", r.RequestURI), logger.String("ID", mn))
@@ -12,10 +12,17 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/validation"
 )
 
 type MockCountersRepository struct{}
 
+func (MockCountersRepository) Validate(metrics []models.Metrics) error {
+	return validation.Default().Validate(metrics)
+}
+
 func (MockCountersRepository) StoreCounter(metricName string, value int64) error {
 	return nil
 }
@@ -120,7 +127,7 @@ func TestCountersHandler_Handle(t *testing.T) {
 		},
 	}
 
-	handler := NewCountersPostHandler(MockCountersRepository{})
+	handler := NewCountersPostHandler(MockCountersRepository{}, nil)
 
 	r := chi.NewRouter()
 	r.Post("/update/counter/{metric}/{value}", handler.Handle)
@@ -5,11 +5,16 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/registry"
 	"github.com/koyif/metrics/internal/repository/dberror"
 	"github.com/koyif/metrics/pkg/logger"
 )
 
 type gaugeStorer interface {
+	metricValidator
 	StoreGauge(metricName string, value float64) error
 }
 
@@ -19,15 +24,19 @@ type gaugeGetter interface {
 
 type GaugesPostHandler struct {
 	service gaugeStorer
+	limiter seriesLimiter
 }
 
 type GaugesGetHandler struct {
 	service gaugeGetter
 }
 
-func NewGaugesPostHandler(service gaugeStorer) *GaugesPostHandler {
+// NewGaugesPostHandler creates a new legacy gauge handler.
+// The limiter can be nil if series quotas are not enabled.
+func NewGaugesPostHandler(service gaugeStorer, limiter seriesLimiter) *GaugesPostHandler {
 	return &GaugesPostHandler{
 		service: service,
+		limiter: limiter,
 	}
 }
 
@@ -44,8 +53,11 @@ func NewGaugesGetHandler(service gaugeGetter) *GaugesGetHandler {
 // @Param			metric	path	string	true	"Metric name"
 // @Param			value	path	number	true	"Gauge value (float)"
 // @Success		200		"OK"
-// @Failure		400		{string}	string	"Bad Request - Invalid value format"
+// @Failure		400		{string}	string	"Bad Request - Invalid value format or metric rejected by validation policy"
+// @Failure		401		{string}	string	"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string	"Forbidden - Token lacks the write scope or the metric prefix"
 // @Failure		404		{string}	string	"Not Found - Empty metric name"
+// @Failure		429		{string}	string	"Too Many Requests - Series quota exceeded"
 // @Failure		500		{string}	string	"Internal Server Error - Storage failure"
 // @Router			/update/gauge/{metric}/{value} [post]
 func (h GaugesPostHandler) Handle(w http.ResponseWriter, r *http.Request) {
@@ -66,7 +78,23 @@ func (h GaugesPostHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.CheckMetrics(r.Context(), mn); err != nil {
+		handler.Forbidden(w, r.RequestURI, err)
+
+		return
+	}
+
+	if !validate(w, r, h.service, models.Metrics{ID: mn, MType: models.Gauge, Value: &v}) {
+		return
+	}
+
+	reservation, ok := reserve(w, r, h.limiter, mn, models.Gauge)
+	if !ok {
+		return
+	}
+
 	if err := h.service.StoreGauge(mn, v); err != nil {
+		reservation.Release()
 		logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
 		http.Error(
 			w,
@@ -76,7 +104,9 @@ func (h GaugesPostHandler) Handle(w http.ResponseWriter, r *http.Request) {
 
 		return
 	}
+	reservation.Commit()
 
+	registry.RecordMetrics(r.Context(), 1)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -86,6 +116,8 @@ func (h GaugesPostHandler) Handle(w http.ResponseWriter, r *http.Request) {
 // @Produce		plain
 // @Param			metric	path	string	true	"Metric name"
 // @Success		200		{string}	string	"Gauge value as plain text"
+// @Failure		401		{string}	string	"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string	"Forbidden - Token lacks the read scope or the metric prefix"
 // @Failure		404		{string}	string	"Not Found - Empty metric name or metric not found"
 // @Failure		500		{string}	string	"Internal Server Error - Retrieval failure"
 // @Router			/value/gauge/{metric} [get]
@@ -98,6 +130,12 @@ func (h GaugesGetHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.CheckMetrics(r.Context(), mn); err != nil {
+		handler.Forbidden(w, r.RequestURI, err)
+
+		return
+	}
+
 	value, err := h.service.Gauge(mn)
 	if err != nil && errors.Is(err, dberror.ErrValueNotFound) {
 		logger.Log.Warn(valueNotFoundErrorMessage, logger.String("URI", r.RequestURI), logger.String("ID", mn))
@@ -12,10 +12,17 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/validation"
 )
 
 type MockGaugesRepository struct{}
 
+func (MockGaugesRepository) Validate(metrics []models.Metrics) error {
+	return validation.Default().Validate(metrics)
+}
+
 func (MockGaugesRepository) StoreGauge(metricName string, value float64) error {
 	return nil
 }
@@ -108,7 +115,7 @@ func TestGaugesHandler_Handle(t *testing.T) {
 		},
 	}
 
-	handler := NewGaugesPostHandler(MockGaugesRepository{})
+	handler := NewGaugesPostHandler(MockGaugesRepository{}, nil)
 
 	r := chi.NewRouter()
 	r.Post("/update/gauge/{metric}/{value}", handler.Handle)
@@ -0,0 +1,30 @@
+package deprecated
+
+import (
+	"net/http"
+
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/quota"
+)
+
+type seriesLimiter interface {
+	Reserve(client string, metrics []models.Metrics) (*quota.Reservation, error)
+}
+
+// reserve checks the metric against the series quota and writes a 429 response
+// when it is rejected. Returns false if the request must not be processed further;
+// otherwise the reservation must be committed or released once the metric is stored.
+func reserve(w http.ResponseWriter, r *http.Request, limiter seriesLimiter, metricName, metricType string) (*quota.Reservation, bool) {
+	if limiter == nil {
+		return nil, true
+	}
+
+	reservation, err := limiter.Reserve(handler.ClientIP(r), []models.Metrics{{ID: metricName, MType: metricType}})
+	if err != nil {
+		handler.TooManyRequests(w, r.RequestURI, err)
+		return nil, false
+	}
+
+	return reservation, true
+}
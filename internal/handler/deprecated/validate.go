@@ -0,0 +1,23 @@
+package deprecated
+
+import (
+	"net/http"
+
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/models"
+)
+
+type metricValidator interface {
+	Validate(metrics []models.Metrics) error
+}
+
+// validate checks the metric against the validation policy and writes a 400 response
+// when it is rejected. Returns false if the request must not be processed further.
+func validate(w http.ResponseWriter, r *http.Request, validator metricValidator, metric models.Metrics) bool {
+	if err := validator.Validate([]models.Metrics{metric}); err != nil {
+		handler.BadRequest(w, r.RequestURI, err.Error())
+		return false
+	}
+
+	return true
+}
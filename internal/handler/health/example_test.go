@@ -16,7 +16,7 @@ import (
 func Example_healthCheck() {
 	// Create test dependencies
 	repo := repository.NewMetricsRepository()
-	svc := service.NewMetricsService(repo, nil)
+	svc := service.NewMetricsService(repo, nil, nil, nil)
 	handler := health.NewPingHandler(svc)
 
 	// Create test server
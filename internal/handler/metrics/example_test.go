@@ -22,11 +22,11 @@ import (
 func Example_storeCounter() {
 	// Create test dependencies
 	repo := repository.NewMetricsRepository()
-	svc := service.NewMetricsService(repo, nil)
+	svc := service.NewMetricsService(repo, nil, nil, nil)
 	cfg := &config.Config{
 		StoreInterval: types.DurationInSeconds(300 * time.Second), // Non-zero to skip immediate persistence
 	}
-	handler := metrics.NewStoreHandler(svc, cfg, nil)
+	handler := metrics.NewStoreHandler(svc, cfg, nil, nil)
 
 	// Create test server
 	ts := httptest.NewServer(http.HandlerFunc(handler.Handle))
@@ -58,11 +58,11 @@ func Example_storeCounter() {
 func Example_storeGauge() {
 	// Create test dependencies
 	repo := repository.NewMetricsRepository()
-	svc := service.NewMetricsService(repo, nil)
+	svc := service.NewMetricsService(repo, nil, nil, nil)
 	cfg := &config.Config{
 		StoreInterval: types.DurationInSeconds(300 * time.Second), // Non-zero to skip immediate persistence
 	}
-	handler := metrics.NewStoreHandler(svc, cfg, nil)
+	handler := metrics.NewStoreHandler(svc, cfg, nil, nil)
 
 	// Create test server
 	ts := httptest.NewServer(http.HandlerFunc(handler.Handle))
@@ -94,11 +94,11 @@ func Example_storeGauge() {
 func Example_batchStore() {
 	// Create test dependencies
 	repo := repository.NewMetricsRepository()
-	svc := service.NewMetricsService(repo, nil)
+	svc := service.NewMetricsService(repo, nil, nil, nil)
 	cfg := &config.Config{
 		StoreInterval: types.DurationInSeconds(300 * time.Second), // Non-zero to skip immediate persistence
 	}
-	handler := metrics.NewStoreAllHandler(svc, cfg, nil)
+	handler := metrics.NewStoreAllHandler(svc, cfg, nil, nil)
 
 	// Create test server
 	ts := httptest.NewServer(http.HandlerFunc(handler.Handle))
@@ -141,7 +141,7 @@ func Example_batchStore() {
 func Example_getCounter() {
 	// Create test dependencies
 	repo := repository.NewMetricsRepository()
-	svc := service.NewMetricsService(repo, nil)
+	svc := service.NewMetricsService(repo, nil, nil, nil)
 
 	// Pre-populate with test data
 	_ = svc.StoreCounter("requests_total", 42)
@@ -181,7 +181,7 @@ func Example_getCounter() {
 func Example_getGauge() {
 	// Create test dependencies
 	repo := repository.NewMetricsRepository()
-	svc := service.NewMetricsService(repo, nil)
+	svc := service.NewMetricsService(repo, nil, nil, nil)
 
 	// Pre-populate with test data
 	_ = svc.StoreGauge("cpu_usage", 85.3)
@@ -221,11 +221,11 @@ func Example_getGauge() {
 func Example_counterAccumulation() {
 	// Create test dependencies
 	repo := repository.NewMetricsRepository()
-	svc := service.NewMetricsService(repo, nil)
+	svc := service.NewMetricsService(repo, nil, nil, nil)
 	cfg := &config.Config{
 		StoreInterval: types.DurationInSeconds(300 * time.Second), // Non-zero to skip immediate persistence
 	}
-	storeHandler := metrics.NewStoreHandler(svc, cfg, nil)
+	storeHandler := metrics.NewStoreHandler(svc, cfg, nil, nil)
 	getHandler := metrics.NewGetHandler(svc)
 
 	storeServer := httptest.NewServer(http.HandlerFunc(storeHandler.Handle))
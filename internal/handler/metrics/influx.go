@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/influx"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+type influxConverter interface {
+	Convert(points []influx.Point) (influx.Result, error)
+	Forget(ids ...string)
+}
+
+// InfluxWriteHandler handles writes in the InfluxDB line protocol, e.g. from Telegraf.
+// It processes POST requests at /write with one point per line.
+type InfluxWriteHandler struct {
+	service      metricsStorer
+	converter    influxConverter
+	cfg          *config.Config
+	auditManager *audit.Manager
+	limiter      seriesLimiter
+}
+
+// NewInfluxWriteHandler creates a new handler for line protocol writes.
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewInfluxWriteHandler(
+	service metricsStorer,
+	converter influxConverter,
+	cfg *config.Config,
+	auditManager *audit.Manager,
+	limiter seriesLimiter,
+) *InfluxWriteHandler {
+	return &InfluxWriteHandler{
+		service:      service,
+		converter:    converter,
+		cfg:          cfg,
+		auditManager: auditManager,
+		limiter:      limiter,
+	}
+}
+
+// @Summary		InfluxDB line protocol write
+// @Description	Receive points in the InfluxDB line protocol, one per line, optionally gzip-compressed.
+// @Description	Every numeric field is stored as one metric named measurement_field; tags are kept as labels,
+// @Description	e.g. cpu_usage_idle{cpu="cpu0"}, or folded into the name, e.g. cpu_usage_idle;cpu=cpu0, as set by influx_tags.
+// @Description	Fields are gauges unless their name ends with one of the influx_counter_suffixes; counters are sent as totals.
+// @Description	Lines that can't be parsed and metrics rejected by the validation policy are reported with 400
+// @Description	after the others are stored, so the sender doesn't retry them. The db and precision parameters are ignored.
+// @Tags			metrics
+// @Accept			plain
+// @Produce		plain
+// @Param			Content-Encoding	header	string	false	"gzip or zstd"
+// @Success		204	"No Content"
+// @Failure		400	{object}	dto.BatchErrorResponse	"Bad Request - Unparsable lines or metrics rejected by validation policy"
+// @Failure		401	{string}	string					"Unauthorized - Missing or invalid token"
+// @Failure		403	{string}	string					"Forbidden - Token lacks the write scope or a metric prefix"
+// @Failure		415	{string}	string					"Unsupported Media Type - Unknown content encoding"
+// @Failure		429	{string}	string					"Too Many Requests - Series quota exceeded"
+// @Failure		500	{string}	string					"Internal Server Error - Storage failure"
+// @Router			/write [post]
+func (h *InfluxWriteHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPushBodySize+1))
+	if err != nil || len(body) > maxPushBodySize {
+		logger.Log.Warn("failed to read line protocol request", logger.String("URI", r.RequestURI))
+		handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, "failed to read request body")
+		return
+	}
+
+	points := make([]influx.Point, 0)
+	var parseErrors []string
+	for i, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := influx.Parse(line)
+		if err != nil {
+			parseErrors = append(parseErrors, fmt.Sprintf("line %d: %s", i+1, err))
+			continue
+		}
+		points = append(points, p)
+	}
+
+	result, err := h.converter.Convert(points)
+	if err != nil {
+		logger.Log.Warn("failed to convert line protocol request", logger.Error(err))
+		handler.Error(w, r, http.StatusInternalServerError, handler.CodeStorageError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if result.Skipped > 0 {
+		logger.Log.Debug("line protocol string fields skipped", logger.Int("skipped", result.Skipped))
+	}
+
+	if len(result.Metrics) > 0 &&
+		!storeConverted(w, r, h.service, h.cfg, h.auditManager, h.limiter, h.converter.Forget, result.Metrics) {
+		return
+	}
+
+	if len(parseErrors) > 0 {
+		// The parsed lines are stored; a client error keeps the sender from
+		// sending them again.
+		message := fmt.Sprintf("unable to parse %d lines: %s", len(parseErrors), parseErrors[0])
+		logger.Log.Warn(message, logger.String("URI", r.RequestURI))
+		handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, message)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
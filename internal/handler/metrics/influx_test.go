@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/cumulative"
+	"github.com/koyif/metrics/internal/handler/middleware"
+	"github.com/koyif/metrics/internal/influx"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/service"
+	"github.com/koyif/metrics/internal/validation"
+	"github.com/koyif/metrics/pkg/compress"
+)
+
+func newInfluxWriteHandler(t *testing.T) (http.Handler, *repository.MetricsRepository) {
+	t.Helper()
+
+	validator, err := validation.New(validation.Policy{})
+	require.NoError(t, err)
+
+	repo := repository.NewMetricsRepository()
+	svc := service.NewMetricsService(repo, nil, validator, nil)
+	converter := influx.NewConverter(influx.Options{TagMode: influx.TagsAsLabels, CounterSuffixes: []string{"_total"}}, cumulative.NewTracker(svc))
+	h := NewInfluxWriteHandler(svc, converter, &config.Config{StoreInterval: 300}, nil, nil)
+
+	return middleware.WithDecompression(http.HandlerFunc(h.Handle)), repo
+}
+
+func influxWrite(h http.Handler, encoding string, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/write?db=telegraf&precision=s", bytes.NewReader(body))
+	if encoding != "" {
+		r.Header.Set("Content-Encoding", encoding)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	return rec
+}
+
+func TestInfluxWriteHandler_Store(t *testing.T) {
+	h, repo := newInfluxWriteHandler(t)
+
+	body := []byte("cpu,host=web1 usage_idle=97.5,requests_total=10i 1700000000\n\n# comment\nmem free=1024i\n")
+	rec := influxWrite(h, "", body)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	gzipped, err := compress.Encode(compress.Gzip, []byte("cpu,host=web1 requests_total=25i"))
+	require.NoError(t, err)
+	rec = influxWrite(h, compress.Gzip, gzipped)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	idle, err := repo.Gauge(`cpu_usage_idle{host="web1"}`)
+	require.NoError(t, err)
+	assert.InDelta(t, 97.5, idle, 0)
+
+	free, err := repo.Gauge("mem_free")
+	require.NoError(t, err)
+	assert.InDelta(t, 1024, free, 0)
+
+	requests, err := repo.Counter(`cpu_requests_total{host="web1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), requests)
+}
+
+func TestInfluxWriteHandler_PartialWrite(t *testing.T) {
+	h, repo := newInfluxWriteHandler(t)
+
+	rec := influxWrite(h, "", []byte("mem free=1\nnot a valid line\n"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "line 2")
+
+	free, err := repo.Gauge("mem_free")
+	require.NoError(t, err)
+	assert.InDelta(t, 1, free, 0, "parsed lines are stored")
+
+	rec = influxWrite(h, "", []byte("mem,host=web\\ 1 free=2\n"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "tag values with spaces fail the name pattern")
+}
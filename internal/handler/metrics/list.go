@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/pkg/dto"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const (
+	// defaultListLimit is the page size when the request doesn't set a limit.
+	defaultListLimit = 100
+	// maxListLimit caps the page size.
+	maxListLimit = 1000
+	// maxListRegexLength caps the length of the regex parameter.
+	maxListRegexLength = 1024
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type metricsLister interface {
+	ListMetrics(ctx context.Context, filter models.ListFilter) ([]models.MetricRecord, *models.ListPosition, error)
+}
+
+// ListHandler handles HTTP requests for listing metrics.
+// It processes GET requests at /api/v1/metrics and /api/v2/metrics; under /api/v2
+// errors are reported as problem details.
+type ListHandler struct {
+	service metricsLister
+}
+
+// NewListHandler creates a new handler for listing metrics.
+func NewListHandler(service metricsLister) *ListHandler {
+	return &ListHandler{
+		service: service,
+	}
+}
+
+// @Summary		List metrics
+// @Description	List stored metrics with their value and last update time, ordered by name and type.
+// @Description	Filters are combined; results are paginated with an opaque cursor returned as next_cursor.
+// @Tags			metrics
+// @Produce		json
+// @Param			type	query		string	false	"Only list metrics of this type"	Enums(gauge, counter)
+// @Param			prefix	query		string	false	"Only list metrics whose name starts with the prefix"
+// @Param			regex	query		string	false	"Only list metrics whose name matches the regular expression"
+// @Param			limit	query		int		false	"Page size, 1 to 1000"	default(100)
+// @Param			cursor	query		string	false	"Cursor from next_cursor of the previous page"
+// @Success		200		{object}	dto.MetricList	"One page of metrics the token may read"
+// @Failure		400		{string}	string			"Bad Request - Invalid type, regex, limit or cursor"
+// @Failure		401		{string}	string			"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string			"Forbidden - Token lacks the read scope"
+// @Failure		500		{string}	string			"Internal Server Error - Storage failure"
+// @Router			/api/v1/metrics [get]
+func (h *ListHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := models.ListFilter{
+		MType:  query.Get("type"),
+		Prefix: query.Get("prefix"),
+		Limit:  defaultListLimit,
+	}
+	if filter.MType != "" && filter.MType != models.Gauge && filter.MType != models.Counter {
+		listRejected(w, r, handler.CodeUnknownType, unknownMetricTypeMessage)
+		return
+	}
+
+	if expr := query.Get("regex"); expr != "" {
+		if len(expr) > maxListRegexLength {
+			listRejected(w, r, handler.CodeInvalidParameter, "regex is too long")
+			return
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			listRejected(w, r, handler.CodeInvalidParameter, "invalid regex")
+			return
+		}
+		filter.Regex = re
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxListLimit {
+			listRejected(w, r, handler.CodeInvalidParameter, "invalid limit")
+			return
+		}
+		filter.Limit = n
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		position, err := decodeCursor(cursor)
+		if err != nil {
+			listRejected(w, r, handler.CodeInvalidParameter, err.Error())
+			return
+		}
+		filter.After = position
+	}
+
+	// Metrics outside the prefixes of the request's token are left out.
+	if p := auth.FromContext(r.Context()); p != nil {
+		filter.AllowedPrefixes = p.Prefixes
+	}
+
+	records, next, err := h.service.ListMetrics(r.Context(), filter)
+	if err != nil {
+		logger.Log.Warn("failed to list metrics", logger.Error(err))
+		handler.Error(w, r, http.StatusInternalServerError, handler.CodeStorageError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	resp := dto.MetricList{
+		Metrics: make([]dto.ListedMetric, 0, len(records)),
+	}
+	for _, record := range records {
+		m := dto.ListedMetric{
+			ID:    record.ID,
+			MType: record.MType,
+			Delta: record.Delta,
+			Value: record.Value,
+		}
+		if !record.UpdatedAt.IsZero() {
+			updated := record.UpdatedAt
+			m.UpdatedAt = &updated
+		}
+		resp.Metrics = append(resp.Metrics, m)
+	}
+	if next != nil {
+		resp.NextCursor = encodeCursor(*next)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Log.Warn(failedToEncodeErrorMessage, logger.Error(err))
+	}
+}
+
+func listRejected(w http.ResponseWriter, r *http.Request, code, message string) {
+	logger.Log.Warn(message, logger.String("URI", r.RequestURI))
+	handler.Error(w, r, http.StatusBadRequest, code, message)
+}
+
+// encodeCursor turns the position into an opaque URL-safe string.
+func encodeCursor(position models.ListPosition) string {
+	data, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (*models.ListPosition, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var position models.ListPosition
+	if err := json.Unmarshal(data, &position); err != nil || position.ID == "" {
+		return nil, errInvalidCursor
+	}
+
+	return &position, nil
+}
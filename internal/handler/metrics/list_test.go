@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/service"
+	"github.com/koyif/metrics/pkg/dto"
+)
+
+func newListHandler(t *testing.T) *ListHandler {
+	t.Helper()
+
+	repo := repository.NewMetricsRepository()
+	require.NoError(t, repo.StoreGauge("host1.cpu", 0.5))
+	require.NoError(t, repo.StoreGauge("host1.mem", 1024))
+	require.NoError(t, repo.StoreGauge("host2.cpu", 0.7))
+	require.NoError(t, repo.StoreCounter("host1.cpu", 3))
+	require.NoError(t, repo.StoreCounter("requests", 10))
+
+	return NewListHandler(service.NewMetricsService(repo, nil, nil, nil))
+}
+
+func list(t *testing.T, h *ListHandler, ctx context.Context, query string) (int, dto.MetricList) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/metrics"+query, nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	h.Handle(w, req)
+
+	var resp dto.MetricList
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	}
+	return w.Code, resp
+}
+
+func names(resp dto.MetricList) []string {
+	out := make([]string, 0, len(resp.Metrics))
+	for _, m := range resp.Metrics {
+		out = append(out, m.MType+":"+m.ID)
+	}
+	return out
+}
+
+func TestListHandler_Filters(t *testing.T) {
+	h := newListHandler(t)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "all metrics ordered by name and type",
+			query: "",
+			want:  []string{"counter:host1.cpu", "gauge:host1.cpu", "gauge:host1.mem", "gauge:host2.cpu", "counter:requests"},
+		},
+		{
+			name:  "by type",
+			query: "?type=counter",
+			want:  []string{"counter:host1.cpu", "counter:requests"},
+		},
+		{
+			name:  "by prefix",
+			query: "?prefix=host1.&type=gauge",
+			want:  []string{"gauge:host1.cpu", "gauge:host1.mem"},
+		},
+		{
+			name:  "by regex",
+			query: "?regex=%5Ehost%5Cd%2Ecpu%24",
+			want:  []string{"counter:host1.cpu", "gauge:host1.cpu", "gauge:host2.cpu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := list(t, h, context.Background(), tt.query)
+			require.Equal(t, http.StatusOK, code)
+			assert.Equal(t, tt.want, names(resp))
+			assert.Empty(t, resp.NextCursor)
+		})
+	}
+}
+
+func TestListHandler_Pagination(t *testing.T) {
+	h := newListHandler(t)
+
+	var got []string
+	query := "?limit=2"
+	pages := 0
+	for {
+		code, resp := list(t, h, context.Background(), query)
+		require.Equal(t, http.StatusOK, code)
+		assert.LessOrEqual(t, len(resp.Metrics), 2)
+		got = append(got, names(resp)...)
+		pages++
+
+		if resp.NextCursor == "" {
+			break
+		}
+		query = "?limit=2&cursor=" + resp.NextCursor
+	}
+
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{"counter:host1.cpu", "gauge:host1.cpu", "gauge:host1.mem", "gauge:host2.cpu", "counter:requests"}, got)
+}
+
+func TestListHandler_ValuesAndUpdateTimes(t *testing.T) {
+	h := newListHandler(t)
+
+	code, resp := list(t, h, context.Background(), "?prefix=requests")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Metrics, 1)
+
+	m := resp.Metrics[0]
+	require.NotNil(t, m.Delta)
+	assert.Equal(t, int64(10), *m.Delta)
+	assert.Nil(t, m.Value)
+	assert.NotNil(t, m.UpdatedAt)
+}
+
+func TestListHandler_TokenPrefixes(t *testing.T) {
+	h := newListHandler(t)
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Name: "viewer", Prefixes: []string{"host2.", "requests"}})
+
+	code, resp := list(t, h, ctx, "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"gauge:host2.cpu", "counter:requests"}, names(resp))
+}
+
+func TestListHandler_InvalidParameters(t *testing.T) {
+	h := newListHandler(t)
+
+	for _, query := range []string{
+		"?type=histogram",
+		"?regex=%28",
+		"?limit=0",
+		"?limit=1001",
+		"?limit=abc",
+		"?cursor=not-a-cursor!",
+		"?cursor=e30",
+	} {
+		code, _ := list(t, h, context.Background(), query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
@@ -4,12 +4,18 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"strings"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
 	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/registry"
 	"github.com/koyif/metrics/internal/repository/dberror"
+	"github.com/koyif/metrics/internal/validation"
 
 	"github.com/koyif/metrics/internal/config"
 	"github.com/koyif/metrics/pkg/dto"
@@ -32,9 +38,15 @@ type metricsStorer interface {
 	StoreCounter(metricName string, value int64) error
 	StoreGauge(metricName string, value float64) error
 	StoreAll(metrics []models.Metrics) error
+	Validate(metrics []models.Metrics) error
 	Persist() error
 }
 
+type seriesLimiter interface {
+	Reserve(client string, metrics []models.Metrics) (*quota.Reservation, error)
+	ReservePartial(client string, metrics []models.Metrics) ([]models.Metrics, *quota.Reservation, error)
+}
+
 type metricsGetter interface {
 	Counter(metricName string) (int64, error)
 	Gauge(metricName string) (float64, error)
@@ -46,6 +58,7 @@ type StoreHandler struct {
 	service      metricsStorer
 	cfg          *config.Config
 	auditManager *audit.Manager
+	limiter      seriesLimiter
 }
 
 // StoreAllHandler handles HTTP requests for batch storing multiple metrics.
@@ -54,6 +67,7 @@ type StoreAllHandler struct {
 	service      metricsStorer
 	cfg          *config.Config
 	auditManager *audit.Manager
+	limiter      seriesLimiter
 }
 
 // GetHandler handles HTTP requests for retrieving metric values.
@@ -63,22 +77,24 @@ type GetHandler struct {
 }
 
 // NewStoreHandler creates a new handler for single metric storage.
-// The auditManager can be nil if auditing is not enabled.
-func NewStoreHandler(service metricsStorer, cfg *config.Config, auditManager *audit.Manager) *StoreHandler {
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewStoreHandler(service metricsStorer, cfg *config.Config, auditManager *audit.Manager, limiter seriesLimiter) *StoreHandler {
 	return &StoreHandler{
 		service:      service,
 		cfg:          cfg,
 		auditManager: auditManager,
+		limiter:      limiter,
 	}
 }
 
 // NewStoreAllHandler creates a new handler for batch metric storage.
-// The auditManager can be nil if auditing is not enabled.
-func NewStoreAllHandler(service metricsStorer, cfg *config.Config, auditManager *audit.Manager) *StoreAllHandler {
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewStoreAllHandler(service metricsStorer, cfg *config.Config, auditManager *audit.Manager, limiter seriesLimiter) *StoreAllHandler {
 	return &StoreAllHandler{
 		service:      service,
 		cfg:          cfg,
 		auditManager: auditManager,
+		limiter:      limiter,
 	}
 }
 
@@ -96,8 +112,11 @@ func NewGetHandler(service metricsGetter) *GetHandler {
 // @Produce		plain
 // @Param			metric	body	dto.Metrics	true	"Metric data (counter with delta or gauge with value)"
 // @Success		200		"OK"
-// @Failure		400		{string}	string	"Bad Request - Invalid JSON or unknown metric type"
+// @Failure		400		{string}	string	"Bad Request - Invalid JSON, unknown metric type or metric rejected by validation policy"
+// @Failure		401		{string}	string	"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string	"Forbidden - Token lacks the write scope or the metric prefix"
 // @Failure		404		{string}	string	"Not Found - Empty metric ID"
+// @Failure		429		{string}	string	"Too Many Requests - Series quota exceeded"
 // @Failure		500		{string}	string	"Internal Server Error - Storage failure"
 // @Router			/update/ [post]
 func (sh StoreHandler) Handle(w http.ResponseWriter, r *http.Request) {
@@ -117,17 +136,49 @@ func (sh StoreHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if m.MType != dto.CounterMetricsType && m.MType != dto.GaugeMetricsType {
+		logger.Log.Warn(unknownMetricTypeMessage, logger.String("URI", r.RequestURI))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+		return
+	}
+
+	if err := auth.CheckMetrics(r.Context(), m.ID); err != nil {
+		handler.Forbidden(w, r.RequestURI, err)
+
+		return
+	}
+
+	metric := []models.Metrics{{ID: m.ID, MType: m.MType, Delta: m.Delta, Value: m.Value}}
+	if err := sh.service.Validate(metric); err != nil {
+		handler.BadRequest(w, r.RequestURI, err.Error())
+
+		return
+	}
+
+	var reservation *quota.Reservation
+	if sh.limiter != nil {
+		var err error
+		if reservation, err = sh.limiter.Reserve(handler.ClientIP(r), metric); err != nil {
+			handler.TooManyRequests(w, r.RequestURI, err)
+
+			return
+		}
+	}
+
+	stored := false
 	switch m.MType {
 	case dto.CounterMetricsType:
-		sh.handleCounter(w, r, m.ID, m.Delta)
+		stored = sh.handleCounter(w, r, m.ID, metric[0].Delta)
 	case dto.GaugeMetricsType:
-		sh.handleGauge(w, r, m.ID, m.Value)
-	default:
-		logger.Log.Warn(unknownMetricTypeMessage, logger.String("URI", r.RequestURI))
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		stored = sh.handleGauge(w, r, m.ID, metric[0].Value)
+	}
+	if !stored {
+		reservation.Release()
 
 		return
 	}
+	reservation.Commit()
 
 	if sh.cfg.StoreInterval.Value() == 0 {
 		if err := sh.service.Persist(); err != nil {
@@ -138,25 +189,37 @@ func (sh StoreHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	sendAuditEvent(sh.auditManager, []string{m.ID}, getClientIP(r))
+	sendAuditEvent(sh.auditManager, []string{m.ID}, handler.ClientIP(r))
+	registry.RecordMetrics(r.Context(), 1)
 
 	w.WriteHeader(http.StatusOK)
 }
 
 // @Summary		Store multiple metrics in batch
-// @Description	Store an array of metrics (counters and gauges) in a single batch operation
+// @Description	Store an array of metrics (counters and gauges) in a single batch operation.
+// @Description	By default the batch is all-or-nothing: if any metric is invalid, nothing is stored.
+// @Description	With partial=true valid metrics are stored and the response lists accepted and rejected items; new series over the quota are rejected items too.
 // @Tags			metrics
 // @Accept			json
 // @Produce		plain
-// @Param			metrics	body	[]dto.Metrics	true	"Array of metrics to store"
-// @Success		200		"OK"
-// @Failure		400		{string}	string	"Bad Request - Invalid JSON format"
-// @Failure		404		{string}	string	"Not Found - Empty metric ID or empty array"
-// @Failure		500		{string}	string	"Internal Server Error - Storage failure"
+// @Produce		json
+// @Param			metrics	body		[]dto.Metrics			true	"Array of metrics to store"
+// @Param			partial	query		bool					false	"Store valid metrics even if some are rejected"
+// @Param			Idempotency-Key	header	string			false	"Batch key; a replay with the same key returns the stored response without applying the batch again"
+// @Success		200		{object}	dto.BatchResult			"OK (body is returned in partial mode only)"
+// @Failure		400		{object}	dto.BatchErrorResponse	"Bad Request - Invalid JSON format or metrics rejected by validation policy"
+// @Failure		401		{string}	string					"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string					"Forbidden - Token lacks the write scope or a metric prefix"
+// @Failure		404		{string}	string					"Not Found - Empty metric ID or empty array"
+// @Failure		409		{string}	string					"Conflict - A request with the same idempotency key is in progress"
+// @Failure		429		{string}	string					"Too Many Requests - Series quota exceeded, unless partial"
+// @Failure		500		{string}	string					"Internal Server Error - Storage failure"
 // @Router			/updates/ [post]
 func (sh StoreAllHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	var m []dto.Metrics
 
+	partial, _ := strconv.ParseBool(r.URL.Query().Get("partial"))
+
 	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
 		logger.Log.Warn(incorrectJSONFormatMessage, logger.String("URI", r.RequestURI))
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
@@ -174,7 +237,8 @@ func (sh StoreAllHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	metrics := make([]models.Metrics, 0, len(m))
 
 	for _, metric := range m {
-		if metric.ID == "" {
+		// In partial mode an empty ID is reported as a rejected item instead.
+		if metric.ID == "" && !partial {
 			logger.Log.Warn(metricIDEmptyErrorMessage, logger.String("URI", r.RequestURI))
 			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 
@@ -189,24 +253,89 @@ func (sh StoreAllHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	if err := sh.service.StoreAll(metrics); err != nil {
-		logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
-		)
+	names := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		names = append(names, metric.ID)
+	}
+	if err := auth.CheckMetrics(r.Context(), names...); err != nil {
+		handler.Forbidden(w, r.RequestURI, err)
 
 		return
 	}
 
-	metricNames := make([]string, 0, len(metrics))
-	for _, metric := range metrics {
-		metricNames = append(metricNames, metric.ID)
+	validationErr := sh.service.Validate(metrics)
+	if validationErr != nil && !partial {
+		handler.ValidationFailed(w, r.RequestURI, validationErr)
+
+		return
 	}
-	sendAuditEvent(sh.auditManager, metricNames, getClientIP(r))
 
+	valid, indexes, violations := validation.Partition(metrics, validationErr)
+
+	var reservation *quota.Reservation
+	if len(valid) > 0 && sh.limiter != nil {
+		var err error
+		if !partial {
+			if reservation, err = sh.limiter.Reserve(handler.ClientIP(r), valid); err != nil {
+				handler.TooManyRequests(w, r.RequestURI, err)
+
+				return
+			}
+		} else {
+			// New series over the quota are reported like invalid metrics.
+			_, reservation, err = sh.limiter.ReservePartial(handler.ClientIP(r), valid)
+			var rejected []validation.Violation
+			valid, indexes, rejected = quota.Partition(valid, indexes, err)
+			violations = append(violations, rejected...)
+			slices.SortFunc(violations, func(a, b validation.Violation) int { return a.Index - b.Index })
+		}
+	}
+
+	if len(valid) > 0 {
+		if err := sh.service.StoreAll(valid); err != nil {
+			reservation.Release()
+			logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
+			http.Error(
+				w,
+				http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError,
+			)
+
+			return
+		}
+		reservation.Commit()
+
+		metricNames := make([]string, 0, len(valid))
+		for _, metric := range valid {
+			metricNames = append(metricNames, metric.ID)
+		}
+		sendAuditEvent(sh.auditManager, metricNames, handler.ClientIP(r))
+		registry.RecordMetrics(r.Context(), len(valid))
+	}
+
+	if !partial {
+		w.WriteHeader(http.StatusOK)
+
+		return
+	}
+
+	result := dto.BatchResult{
+		Accepted: make([]dto.AcceptedMetric, 0, len(valid)),
+		Rejected: handler.RejectedMetrics(violations),
+	}
+	for i, metric := range valid {
+		result.Accepted = append(result.Accepted, dto.AcceptedMetric{
+			Index: indexes[i],
+			ID:    metric.ID,
+			MType: metric.MType,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Log.Warn(failedToEncodeErrorMessage, logger.Error(err))
+	}
 }
 
 // @Summary		Get a metric value
@@ -217,6 +346,8 @@ func (sh StoreAllHandler) Handle(w http.ResponseWriter, r *http.Request) {
 // @Param			metric	body		dto.Metrics	true	"Metric identifier (id and type required)"
 // @Success		200		{object}	dto.Metrics	"Metric with current value (delta for counter, value for gauge)"
 // @Failure		400		{string}	string		"Bad Request - Invalid JSON or unknown metric type"
+// @Failure		401		{string}	string		"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string		"Forbidden - Token lacks the read scope or the metric prefix"
 // @Failure		404		{string}	string		"Not Found - Empty metric ID or metric not found"
 // @Failure		500		{string}	string		"Internal Server Error - Retrieval failure"
 // @Router			/value/ [post]
@@ -237,6 +368,12 @@ func (gh GetHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.CheckMetrics(r.Context(), m.ID); err != nil {
+		handler.Forbidden(w, r.RequestURI, err)
+
+		return
+	}
+
 	var valErr error
 	switch m.MType {
 	case dto.CounterMetricsType:
@@ -282,12 +419,13 @@ func (gh GetHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (sh StoreHandler) handleCounter(w http.ResponseWriter, r *http.Request, metricName string, value *int64) {
+// handleCounter stores the counter and reports whether it was stored.
+func (sh StoreHandler) handleCounter(w http.ResponseWriter, r *http.Request, metricName string, value *int64) bool {
 	if value == nil {
 		logger.Log.Warn(nilValueErrorMessage, logger.String("URI", r.RequestURI))
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 
-		return
+		return false
 	}
 
 	if err := sh.service.StoreCounter(metricName, *value); err != nil {
@@ -298,16 +436,19 @@ func (sh StoreHandler) handleCounter(w http.ResponseWriter, r *http.Request, met
 			http.StatusInternalServerError,
 		)
 
-		return
+		return false
 	}
+
+	return true
 }
 
-func (sh StoreHandler) handleGauge(w http.ResponseWriter, r *http.Request, metricName string, value *float64) {
+// handleGauge stores the gauge and reports whether it was stored.
+func (sh StoreHandler) handleGauge(w http.ResponseWriter, r *http.Request, metricName string, value *float64) bool {
 	if value == nil {
 		logger.Log.Warn(nilValueErrorMessage, logger.String("URI", r.RequestURI))
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 
-		return
+		return false
 	}
 
 	if err := sh.service.StoreGauge(metricName, *value); err != nil {
@@ -318,27 +459,10 @@ func (sh StoreHandler) handleGauge(w http.ResponseWriter, r *http.Request, metri
 			http.StatusInternalServerError,
 		)
 
-		return
-	}
-}
-
-func getClientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		if idx := strings.Index(xff, ","); idx != -1 {
-			return strings.TrimSpace(xff[:idx])
-		}
-		return strings.TrimSpace(xff)
-	}
-
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
-	}
-
-	if idx := strings.LastIndex(r.RemoteAddr, ":"); idx != -1 {
-		return r.RemoteAddr[:idx]
+		return false
 	}
 
-	return r.RemoteAddr
+	return true
 }
 
 func sendAuditEvent(auditManager *audit.Manager, metricNames []string, ipAddress string) {
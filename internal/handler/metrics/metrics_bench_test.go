@@ -11,6 +11,7 @@ import (
 
 	"github.com/koyif/metrics/internal/config"
 	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/validation"
 	"github.com/koyif/metrics/pkg/dto"
 )
 
@@ -42,6 +43,10 @@ func (m *mockMetricsService) StoreGauge(metricName string, value float64) error
 	return nil
 }
 
+func (m *mockMetricsService) Validate(metrics []models.Metrics) error {
+	return validation.Default().Validate(metrics)
+}
+
 func (m *mockMetricsService) StoreAll(metrics []models.Metrics) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -90,7 +95,7 @@ func (m *mockMetricsService) Ping(ctx context.Context) error {
 func BenchmarkStoreHandler_Counter(b *testing.B) {
 	service := newMockMetricsService()
 	cfg := &config.Config{}
-	handler := NewStoreHandler(service, cfg, nil)
+	handler := NewStoreHandler(service, cfg, nil, nil)
 
 	delta := int64(1)
 	metric := dto.Metrics{
@@ -115,7 +120,7 @@ func BenchmarkStoreHandler_Counter(b *testing.B) {
 func BenchmarkStoreHandler_Gauge(b *testing.B) {
 	service := newMockMetricsService()
 	cfg := &config.Config{}
-	handler := NewStoreHandler(service, cfg, nil)
+	handler := NewStoreHandler(service, cfg, nil, nil)
 
 	value := 45.5
 	metric := dto.Metrics{
@@ -140,7 +145,7 @@ func BenchmarkStoreHandler_Gauge(b *testing.B) {
 func BenchmarkStoreHandler_Parallel(b *testing.B) {
 	service := newMockMetricsService()
 	cfg := &config.Config{}
-	handler := NewStoreHandler(service, cfg, nil)
+	handler := NewStoreHandler(service, cfg, nil, nil)
 
 	delta := int64(1)
 	metric := dto.Metrics{
@@ -166,7 +171,7 @@ func BenchmarkStoreHandler_Parallel(b *testing.B) {
 func BenchmarkStoreAllHandler(b *testing.B) {
 	service := newMockMetricsService()
 	cfg := &config.Config{}
-	handler := NewStoreAllHandler(service, cfg, nil)
+	handler := NewStoreAllHandler(service, cfg, nil, nil)
 
 	sizes := []struct {
 		name  string
@@ -216,7 +221,7 @@ func BenchmarkStoreAllHandler(b *testing.B) {
 func BenchmarkStoreAllHandler_Parallel(b *testing.B) {
 	service := newMockMetricsService()
 	cfg := &config.Config{}
-	handler := NewStoreAllHandler(service, cfg, nil)
+	handler := NewStoreAllHandler(service, cfg, nil, nil)
 
 	metrics := make([]dto.Metrics, 100)
 	for i := 0; i < 100; i++ {
@@ -309,7 +314,7 @@ func BenchmarkGetHandler_Parallel(b *testing.B) {
 func BenchmarkEndToEnd(b *testing.B) {
 	service := newMockMetricsService()
 	cfg := &config.Config{}
-	storeHandler := NewStoreHandler(service, cfg, nil)
+	storeHandler := NewStoreHandler(service, cfg, nil, nil)
 	getHandler := NewGetHandler(service)
 
 	delta := int64(1)
@@ -15,7 +15,9 @@ import (
 	"time"
 
 	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/quota"
 	"github.com/koyif/metrics/internal/repository/dberror"
+	"github.com/koyif/metrics/internal/validation"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -87,6 +89,10 @@ func (m *MockMetricsRepository) StoreAll(metrics []models.Metrics) error {
 	return nil
 }
 
+func (m *MockMetricsRepository) Validate(metrics []models.Metrics) error {
+	return validation.Default().Validate(metrics)
+}
+
 func (m *MockMetricsRepository) Persist() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -681,7 +687,7 @@ func TestStoreHandler_Handle(t *testing.T) {
 				tt.given.setupMock(mock)
 			}
 
-			handler := NewStoreHandler(mock, tt.given.config, nil)
+			handler := NewStoreHandler(mock, tt.given.config, nil, nil)
 
 			mux := http.NewServeMux()
 			mux.HandleFunc("/update", handler.Handle)
@@ -761,7 +767,7 @@ func TestStoreHandler_PersistBehavior(t *testing.T) {
 				StoreInterval: types.DurationInSeconds(tt.storeInterval),
 			}
 
-			handler := NewStoreHandler(mock, cfg, nil)
+			handler := NewStoreHandler(mock, cfg, nil, nil)
 
 			mux := http.NewServeMux()
 			mux.HandleFunc("/update", handler.Handle)
@@ -802,3 +808,149 @@ func TestStoreHandler_PersistBehavior(t *testing.T) {
 		})
 	}
 }
+
+func TestStoreAllHandler_SeriesQuota(t *testing.T) {
+	mock := NewMockMetricsRepository()
+	cfg := &config.Config{
+		StoreInterval: types.DurationInSeconds(300 * time.Second),
+	}
+	limiter := quota.NewLimiter(quota.Limits{MaxSeriesPerClient: 1})
+
+	handler := NewStoreAllHandler(mock, cfg, nil, limiter)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.Handle))
+	defer server.Close()
+
+	send := func(ids ...string) int {
+		metrics := make([]dto.Metrics, 0, len(ids))
+		for _, id := range ids {
+			metrics = append(metrics, dto.Metrics{ID: id, MType: dto.GaugeMetricsType, Value: new(float64)})
+		}
+		body, err := json.Marshal(metrics)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(body))
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, send("first"))
+	assert.Equal(t, http.StatusOK, send("first"))
+	assert.Equal(t, http.StatusTooManyRequests, send("first", "second"))
+
+	usage := limiter.Usage()
+	require.Len(t, usage.Clients, 1)
+	assert.Equal(t, int64(1), usage.Clients[0].RejectedSeries)
+}
+
+func TestStoreAllHandler_ValidationErrors(t *testing.T) {
+	mock := NewMockMetricsRepository()
+	cfg := &config.Config{
+		StoreInterval: types.DurationInSeconds(300 * time.Second),
+	}
+	limiter := quota.NewLimiter(quota.Limits{MaxSeries: 10})
+
+	handler := NewStoreAllHandler(mock, cfg, nil, limiter)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.Handle))
+	defer server.Close()
+
+	body := `[
+		{"id":"valid","type":"gauge","value":1},
+		{"id":"with space","type":"gauge","value":1},
+		{"id":"no_delta","type":"counter"}
+	]`
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var result dto.BatchErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(t, result.Rejected, 2)
+	assert.Equal(t, 1, result.Rejected[0].Index)
+	assert.Equal(t, validation.ReasonInvalidName, result.Rejected[0].Reason)
+	assert.Equal(t, 2, result.Rejected[1].Index)
+	assert.Equal(t, validation.ReasonMissingValue, result.Rejected[1].Reason)
+
+	assert.Zero(t, limiter.Usage().TotalSeries, "rejected batch must not consume the series quota")
+}
+
+func TestStoreAllHandler_PartialMode(t *testing.T) {
+	mock := NewMockMetricsRepository()
+	cfg := &config.Config{
+		StoreInterval: types.DurationInSeconds(300 * time.Second),
+	}
+
+	handler := NewStoreAllHandler(mock, cfg, nil, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.Handle))
+	defer server.Close()
+
+	body := `[
+		{"id":"","type":"gauge","value":1},
+		{"id":"valid","type":"gauge","value":1},
+		{"id":"unknown","type":"histogram"}
+	]`
+	resp, err := http.Post(server.URL+"?partial=true", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result dto.BatchResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(t, result.Accepted, 1)
+	assert.Equal(t, dto.AcceptedMetric{Index: 1, ID: "valid", MType: dto.GaugeMetricsType}, result.Accepted[0])
+	require.Len(t, result.Rejected, 2)
+	assert.Equal(t, validation.ReasonEmptyName, result.Rejected[0].Reason)
+	assert.Equal(t, validation.ReasonUnknownType, result.Rejected[1].Reason)
+
+	strict, err := http.Post(server.URL, "application/json", strings.NewReader(`[{"id":"valid","type":"gauge","value":1},{"id":"x","type":"histogram"}]`))
+	require.NoError(t, err)
+	defer strict.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, strict.StatusCode)
+}
+
+func TestStoreAllHandler_PartialModeSeriesQuota(t *testing.T) {
+	mock := NewMockMetricsRepository()
+	cfg := &config.Config{
+		StoreInterval: types.DurationInSeconds(300 * time.Second),
+	}
+	limiter := quota.NewLimiter(quota.Limits{MaxSeriesPerClient: 1})
+
+	handler := NewStoreAllHandler(mock, cfg, nil, limiter)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.Handle))
+	defer server.Close()
+
+	body := `[
+		{"id":"first","type":"gauge","value":1},
+		{"id":"with space","type":"gauge","value":1},
+		{"id":"second","type":"gauge","value":1}
+	]`
+	resp, err := http.Post(server.URL+"?partial=true", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "series over the quota don't fail a partial batch")
+
+	var result dto.BatchResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(t, result.Accepted, 1)
+	assert.Equal(t, dto.AcceptedMetric{Index: 0, ID: "first", MType: dto.GaugeMetricsType}, result.Accepted[0])
+	require.Len(t, result.Rejected, 2)
+	assert.Equal(t, 1, result.Rejected[0].Index)
+	assert.Equal(t, validation.ReasonInvalidName, result.Rejected[0].Reason)
+	assert.Equal(t, 2, result.Rejected[1].Index)
+	assert.Equal(t, quota.ReasonSeriesPerClient, result.Rejected[1].Reason)
+
+	assert.Equal(t, 1, limiter.Usage().TotalSeries)
+}
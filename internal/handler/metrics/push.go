@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/internal/validation"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// maxPushBodySize bounds a request of a push protocol sent uncompressed.
+const maxPushBodySize = 32 << 20
+
+// storeConverted stores metrics converted from a push protocol whose counters
+// arrive as totals. Metrics rejected by the validation policy are reported with
+// 400 after the others are stored, so the sender doesn't retry them; forget is
+// called with the counters that weren't stored, so their next totals continue
+// from the stored values. It reports whether the caller should respond with success.
+func storeConverted(
+	w http.ResponseWriter,
+	r *http.Request,
+	service metricsStorer,
+	cfg *config.Config,
+	auditManager *audit.Manager,
+	limiter seriesLimiter,
+	forget func(ids ...string),
+	metrics []models.Metrics,
+) bool {
+	validationErr := service.Validate(metrics)
+	valid, _, violations := validation.Partition(metrics, validationErr)
+
+	stored := false
+	defer func() {
+		if stored {
+			forget(counterIDs(rejectedMetrics(metrics, violations))...)
+		} else {
+			forget(counterIDs(metrics)...)
+		}
+	}()
+
+	if len(valid) > 0 {
+		names := make([]string, 0, len(valid))
+		for _, metric := range valid {
+			names = append(names, metric.ID)
+		}
+		if err := auth.CheckMetrics(r.Context(), names...); err != nil {
+			handler.Forbidden(w, r.RequestURI, err)
+			return false
+		}
+
+		var reservation *quota.Reservation
+		if limiter != nil {
+			var err error
+			if reservation, err = limiter.Reserve(handler.ClientIP(r), valid); err != nil {
+				handler.TooManyRequests(w, r.RequestURI, err)
+				return false
+			}
+		}
+
+		if err := service.StoreAll(valid); err != nil {
+			reservation.Release()
+			logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
+			handler.Error(w, r, http.StatusInternalServerError, handler.CodeStorageError, http.StatusText(http.StatusInternalServerError))
+			return false
+		}
+		reservation.Commit()
+		stored = true
+
+		if cfg.StoreInterval.Value() == 0 {
+			if err := service.Persist(); err != nil {
+				// A retry is safe: counter totals sent again add nothing.
+				logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
+				handler.Error(w, r, http.StatusInternalServerError, handler.CodeStorageError, failedToPersistMetricsErrorMessage)
+				return false
+			}
+		}
+
+		sendAuditEvent(auditManager, names, handler.ClientIP(r))
+		registry.RecordMetrics(r.Context(), len(valid))
+	}
+
+	if validationErr != nil {
+		handler.ValidationFailed(w, r.RequestURI, validationErr)
+		return false
+	}
+
+	return true
+}
+
+func rejectedMetrics(metrics []models.Metrics, violations []validation.Violation) []models.Metrics {
+	rejected := make([]models.Metrics, 0, len(violations))
+	for _, v := range violations {
+		rejected = append(rejected, metrics[v.Index])
+	}
+
+	return rejected
+}
+
+func counterIDs(metrics []models.Metrics) []string {
+	ids := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		if m.MType == models.Counter {
+			ids = append(ids, m.ID)
+		}
+	}
+
+	return ids
+}
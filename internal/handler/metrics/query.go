@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/query"
+	"github.com/koyif/metrics/pkg/dto"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// maxQueryLength caps the length of the query parameter.
+const maxQueryLength = 1024
+
+type queryEvaluator interface {
+	Eval(expr query.Expr, at time.Time, allow func(id string) bool) []query.Result
+}
+
+// QueryHandler handles HTTP requests evaluating expressions over the metrics.
+// It processes GET requests at /api/v1/query.
+type QueryHandler struct {
+	engine queryEvaluator
+}
+
+// NewQueryHandler creates a new handler for queries.
+func NewQueryHandler(engine queryEvaluator) *QueryHandler {
+	return &QueryHandler{
+		engine: engine,
+	}
+}
+
+// @Summary		Query metrics
+// @Description	Evaluate an expression over the metrics the token may read.
+// @Description	Selectors match a metric name, or a prefix when they end with "*", and report gauge values and counter totals: cpu.load, http.*.
+// @Description	rate(http.*[5m]) is the per-second increase of counters over the window; quantile(0.95, latency[10m]) is a quantile of the gauge samples within the window.
+// @Description	sum, avg, min and max reduce any expression to one value without an ID: sum(rate(http.*[1m])). Windows are durations such as 30s, 5m or 1h.
+// @Description	Windows only cover the in-memory history of recent updates since the server started, limited to history_size samples per metric.
+// @Tags			metrics
+// @Produce		json
+// @Param			query	query		string				true	"Expression to evaluate"
+// @Success		200		{object}	dto.QueryResponse	"Values of the expression"
+// @Failure		400		{string}	string				"Bad Request - Missing or invalid expression"
+// @Failure		401		{string}	string				"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string				"Forbidden - Token lacks the read scope"
+// @Router			/api/v1/query [get]
+func (h *QueryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	input := r.URL.Query().Get("query")
+	if input == "" {
+		queryRejected(w, r, "query is required")
+		return
+	}
+	if len(input) > maxQueryLength {
+		queryRejected(w, r, "query is too long")
+		return
+	}
+
+	expr, err := query.Parse(input)
+	if err != nil {
+		queryRejected(w, r, "invalid query: "+err.Error())
+		return
+	}
+
+	// Metrics outside the prefixes of the request's token are left out.
+	now := time.Now()
+	results := h.engine.Eval(expr, now, func(id string) bool {
+		return auth.AllowsMetric(r.Context(), id)
+	})
+
+	resp := dto.QueryResponse{
+		Query:       input,
+		Result:      make([]dto.QueryResult, 0, len(results)),
+		EvaluatedAt: now,
+	}
+	for _, result := range results {
+		resp.Result = append(resp.Result, dto.QueryResult{
+			ID:    result.ID,
+			MType: result.MType,
+			Value: result.Value,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Log.Warn(failedToEncodeErrorMessage, logger.Error(err))
+	}
+}
+
+func queryRejected(w http.ResponseWriter, r *http.Request, message string) {
+	logger.Log.Warn(message, logger.String("URI", r.RequestURI))
+	handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidParameter, message)
+}
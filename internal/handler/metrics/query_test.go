@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/history"
+	"github.com/koyif/metrics/internal/query"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/service"
+	"github.com/koyif/metrics/pkg/dto"
+)
+
+func newQueryHandler(t *testing.T) *QueryHandler {
+	t.Helper()
+
+	repo := repository.NewMetricsRepository()
+	store := history.New(10, 10)
+	svc := service.NewMetricsService(repo, nil, nil, store)
+	require.NoError(t, svc.StoreGauge("host1.cpu", 0.5))
+	require.NoError(t, svc.StoreGauge("host1.cpu", 0.7))
+	require.NoError(t, svc.StoreGauge("host2.cpu", 0.3))
+	require.NoError(t, svc.StoreCounter("requests", 10))
+
+	return NewQueryHandler(query.NewEngine(svc, store))
+}
+
+func runQuery(t *testing.T, h *QueryHandler, ctx context.Context, expr string) (int, dto.QueryResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/query?query="+url.QueryEscape(expr), nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	h.Handle(w, req)
+
+	var resp dto.QueryResponse
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	}
+	return w.Code, resp
+}
+
+func TestQueryHandler(t *testing.T) {
+	h := newQueryHandler(t)
+
+	code, resp := runQuery(t, h, context.Background(), "host*")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "host*", resp.Query)
+	require.Len(t, resp.Result, 2)
+	assert.Equal(t, dto.QueryResult{ID: "host1.cpu", MType: "gauge", Value: 0.7}, resp.Result[0])
+	assert.Equal(t, dto.QueryResult{ID: "host2.cpu", MType: "gauge", Value: 0.3}, resp.Result[1])
+
+	_, resp = runQuery(t, h, context.Background(), "max(quantile(1, host*[1m]))")
+	require.Len(t, resp.Result, 1)
+	assert.InDelta(t, 0.7, resp.Result[0].Value, 0)
+	assert.Empty(t, resp.Result[0].ID)
+
+	_, resp = runQuery(t, h, context.Background(), "rate(missing[1m])")
+	assert.NotNil(t, resp.Result, "empty results are reported as an empty list")
+	assert.Empty(t, resp.Result)
+}
+
+func TestQueryHandler_TokenPrefixes(t *testing.T) {
+	h := newQueryHandler(t)
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Name: "viewer", Prefixes: []string{"host2."}})
+
+	_, resp := runQuery(t, h, ctx, "sum(host*)")
+	require.Len(t, resp.Result, 1)
+	assert.InDelta(t, 0.3, resp.Result[0].Value, 0)
+}
+
+func TestQueryHandler_Invalid(t *testing.T) {
+	h := newQueryHandler(t)
+
+	for _, expr := range []string{"", "rate(requests)", "sum(host*"} {
+		code, _ := runQuery(t, h, context.Background(), expr)
+		assert.Equal(t, http.StatusBadRequest, code, expr)
+	}
+}
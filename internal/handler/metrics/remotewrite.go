@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/remotewrite"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+type remoteWriteConverter interface {
+	Convert(req *proto.WriteRequest) (remotewrite.Result, error)
+	Forget(ids ...string)
+}
+
+// RemoteWriteHandler handles Prometheus remote-write requests.
+// It processes POST requests at /api/v1/write with a snappy-compressed protobuf
+// WriteRequest, which WithDecompression has already decoded.
+type RemoteWriteHandler struct {
+	service      metricsStorer
+	converter    remoteWriteConverter
+	cfg          *config.Config
+	auditManager *audit.Manager
+	limiter      seriesLimiter
+}
+
+// NewRemoteWriteHandler creates a new handler for Prometheus remote write.
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewRemoteWriteHandler(
+	service metricsStorer,
+	converter remoteWriteConverter,
+	cfg *config.Config,
+	auditManager *audit.Manager,
+	limiter seriesLimiter,
+) *RemoteWriteHandler {
+	return &RemoteWriteHandler{
+		service:      service,
+		converter:    converter,
+		cfg:          cfg,
+		auditManager: auditManager,
+		limiter:      limiter,
+	}
+}
+
+// @Summary		Prometheus remote write
+// @Description	Receive samples with the Prometheus remote-write protocol (a snappy-compressed protobuf WriteRequest).
+// @Description	Every series is stored as one metric named after its labels, e.g. up{job="node"}.
+// @Description	The type is chosen by the remote_write_rules, then by the metadata sent, then by the name:
+// @Description	_total, _count, _sum and _bucket series are counters and get the increase since the last total, the rest are gauges.
+// @Description	Series rejected by the validation policy are reported with 400 after the others are stored,
+// @Description	so Prometheus doesn't retry them.
+// @Tags			metrics
+// @Accept			application/x-protobuf
+// @Produce		plain
+// @Param			Content-Encoding	header	string	true	"snappy"
+// @Success		204	"No Content"
+// @Failure		400	{object}	dto.BatchErrorResponse	"Bad Request - Malformed request or series rejected by validation policy"
+// @Failure		401	{string}	string					"Unauthorized - Missing or invalid token"
+// @Failure		403	{string}	string					"Forbidden - Token lacks the write scope or a metric prefix"
+// @Failure		415	{string}	string					"Unsupported Media Type - Unknown content encoding"
+// @Failure		429	{string}	string					"Too Many Requests - Series quota exceeded"
+// @Failure		500	{string}	string					"Internal Server Error - Storage failure"
+// @Router			/api/v1/write [post]
+func (h *RemoteWriteHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPushBodySize+1))
+	if err != nil || len(body) > maxPushBodySize {
+		logger.Log.Warn("failed to read remote write request", logger.String("URI", r.RequestURI))
+		handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, "failed to read request body")
+		return
+	}
+
+	var req proto.WriteRequest
+	if err := protobuf.Unmarshal(body, &req); err != nil {
+		logger.Log.Warn("malformed remote write request", logger.String("URI", r.RequestURI), logger.Error(err))
+		handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, "malformed write request")
+		return
+	}
+
+	result, err := h.converter.Convert(&req)
+	if err != nil {
+		logger.Log.Warn("failed to convert remote write request", logger.Error(err))
+		handler.Error(w, r, http.StatusInternalServerError, handler.CodeStorageError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if result.Dropped > 0 {
+		logger.Log.Debug("remote write series dropped", logger.Int("dropped", result.Dropped))
+	}
+	if len(result.Metrics) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if storeConverted(w, r, h.service, h.cfg, h.auditManager, h.limiter, h.converter.Forget, result.Metrics) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/cumulative"
+	"github.com/koyif/metrics/internal/handler/middleware"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/remotewrite"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/service"
+	"github.com/koyif/metrics/internal/validation"
+	"github.com/koyif/metrics/pkg/compress"
+)
+
+func newRemoteWriteHandler(t *testing.T) (http.Handler, *repository.MetricsRepository) {
+	t.Helper()
+
+	validator, err := validation.New(validation.Policy{})
+	require.NoError(t, err)
+
+	repo := repository.NewMetricsRepository()
+	svc := service.NewMetricsService(repo, nil, validator, nil)
+	h := NewRemoteWriteHandler(svc, remotewrite.NewConverter(nil, cumulative.NewTracker(svc)), &config.Config{StoreInterval: 300}, nil, nil)
+
+	return middleware.WithDecompression(http.HandlerFunc(h.Handle)), repo
+}
+
+func remoteWrite(t *testing.T, h http.Handler, req *proto.WriteRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	data, err := protobuf.Marshal(req)
+	require.NoError(t, err)
+	body, err := compress.Encode(compress.Snappy, data)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", compress.Snappy)
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	return rec
+}
+
+func writeRequest(value float64, names ...string) *proto.WriteRequest {
+	req := &proto.WriteRequest{}
+	for _, name := range names {
+		req.Timeseries = append(req.Timeseries, &proto.TimeSeries{
+			Labels:  []*proto.Label{{Name: "__name__", Value: name}, {Name: "job", Value: "node"}},
+			Samples: []*proto.Sample{{Value: value, Timestamp: 1}},
+		})
+	}
+	return req
+}
+
+func TestRemoteWriteHandler_Store(t *testing.T) {
+	h, repo := newRemoteWriteHandler(t)
+
+	rec := remoteWrite(t, h, writeRequest(10, "requests_total", "temperature"))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	rec = remoteWrite(t, h, writeRequest(25, "requests_total", "temperature"))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	counter, err := repo.Counter(`requests_total{job="node"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), counter, "cumulative totals are not counted twice")
+
+	gauge, err := repo.Gauge(`temperature{job="node"}`)
+	require.NoError(t, err)
+	assert.InDelta(t, 25, gauge, 0)
+}
+
+func TestRemoteWriteHandler_Rejected(t *testing.T) {
+	h, repo := newRemoteWriteHandler(t)
+
+	req := writeRequest(1, "requests_total")
+	req.Timeseries = append(req.Timeseries, &proto.TimeSeries{
+		Labels:  []*proto.Label{{Name: "__name__", Value: "with space"}},
+		Samples: []*proto.Sample{{Value: 1, Timestamp: 1}},
+	})
+
+	rec := remoteWrite(t, h, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "with space")
+
+	counter, err := repo.Counter(`requests_total{job="node"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counter, "valid series are stored")
+}
+
+func TestRemoteWriteHandler_Malformed(t *testing.T) {
+	h, _ := newRemoteWriteHandler(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader([]byte("not snappy")))
+	r.Header.Set("Content-Encoding", compress.Snappy)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	body, err := compress.Encode(compress.Snappy, []byte{0xff, 0xff})
+	require.NoError(t, err)
+	r = httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", compress.Snappy)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
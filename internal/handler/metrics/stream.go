@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/pubsub"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// streamKeepAlive is how often a comment is sent on an idle stream, so proxies
+// and clients don't close the connection.
+const streamKeepAlive = 15 * time.Second
+
+type subscriber interface {
+	Subscribe(filter pubsub.Filter) (*pubsub.Subscription, error)
+	Unsubscribe(s *pubsub.Subscription)
+}
+
+// StreamHandler streams stored metric updates as Server-Sent Events.
+// It processes GET requests at /stream.
+type StreamHandler struct {
+	hub subscriber
+}
+
+// NewStreamHandler creates a new handler for the live update stream.
+func NewStreamHandler(hub subscriber) *StreamHandler {
+	return &StreamHandler{
+		hub: hub,
+	}
+}
+
+// @Summary		Stream metric updates
+// @Description	Stream every stored metric update as Server-Sent Events. Each event is named "metric" and carries the update as JSON in its data field.
+// @Description	A client that can't keep up is disconnected with a final "dropped" event and should reconnect.
+// @Tags			metrics
+// @Produce		text/event-stream
+// @Param			prefix	query		string	false	"Only stream metrics whose name starts with the prefix"
+// @Param			type	query		string	false	"Only stream metrics of this type"	Enums(gauge, counter)
+// @Success		200		{object}	pubsub.Event	"Stream of metric events"
+// @Failure		400		{string}	string			"Bad Request - Unknown metric type"
+// @Failure		401		{string}	string			"Unauthorized - Missing or invalid token"
+// @Failure		403		{string}	string			"Forbidden - Token lacks the read scope"
+// @Failure		503		{string}	string			"Service Unavailable - Too many subscribers"
+// @Router			/stream [get]
+func (h *StreamHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	filter := pubsub.Filter{
+		Prefix: r.URL.Query().Get("prefix"),
+		MType:  r.URL.Query().Get("type"),
+	}
+	if filter.MType != "" && filter.MType != models.Gauge && filter.MType != models.Counter {
+		handler.BadRequest(w, r.RequestURI, unknownMetricTypeMessage)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	sub, err := h.hub.Subscribe(filter)
+	if errors.Is(err, pubsub.ErrTooManySubscribers) {
+		logger.Log.Warn("stream subscriber limit reached", logger.String("URI", r.RequestURI))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		handler.InternalServerError(w, err, "failed to subscribe to metric updates")
+		return
+	}
+	defer h.hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Ask reverse proxies such as nginx not to buffer the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		logger.Log.Warn("streaming is not supported by the response writer", logger.Error(err))
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	var seq uint64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.Events():
+			if !ok {
+				if sub.Dropped() {
+					logger.Log.Warn("dropped slow stream subscriber", logger.String("URI", r.RequestURI))
+					_, _ = fmt.Fprint(w, "event: dropped\ndata: subscriber fell behind\n\n")
+					_ = rc.Flush()
+				}
+				return
+			}
+
+			// Metrics outside the prefixes of the request's token are left out.
+			if !auth.AllowsMetric(r.Context(), e.ID) {
+				continue
+			}
+
+			data, err := json.Marshal(e)
+			if err != nil {
+				logger.Log.Error(failedToEncodeErrorMessage, logger.Error(err))
+				continue
+			}
+
+			seq++
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: metric\ndata: %s\n\n", seq, data); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/pubsub"
+)
+
+func TestStreamHandler(t *testing.T) {
+	hub := pubsub.New(10, 10)
+	server := httptest.NewServer(http.HandlerFunc(NewStreamHandler(hub).Handle))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?type=counter&prefix=req")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, ": connected\n", line)
+
+	require.Eventually(t, func() bool { return hub.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+
+	value := 1.5
+	delta := int64(2)
+	hub.Publish([]models.Metrics{
+		{ID: "requests_gauge", MType: models.Gauge, Value: &value},
+		{ID: "other", MType: models.Counter, Delta: &delta},
+		{ID: "requests", MType: models.Counter, Delta: &delta},
+	})
+
+	event := make([]string, 0)
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && len(event) > 0 {
+			break
+		}
+		if line != "" {
+			event = append(event, line)
+		}
+	}
+
+	require.Len(t, event, 3)
+	assert.Equal(t, "id: 1", event[0])
+	assert.Equal(t, "event: metric", event[1])
+	assert.Contains(t, event[2], `"id":"requests","type":"counter","delta":2`)
+}
+
+func TestStreamHandler_UnknownType(t *testing.T) {
+	hub := pubsub.New(10, 10)
+	rec := httptest.NewRecorder()
+	NewStreamHandler(hub).Handle(rec, httptest.NewRequest(http.MethodGet, "/stream?type=histogram", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, 0, hub.Subscribers())
+}
@@ -0,0 +1,367 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/registry"
+	"github.com/koyif/metrics/internal/repository/dberror"
+	"github.com/koyif/metrics/internal/validation"
+	"github.com/koyif/metrics/pkg/dto"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// The v2 API reports every error as RFC 7807 problem details with a stable code,
+// and uses the same status for the same failure on every route:
+//
+//	400 malformed request (invalid_json, empty_batch, unknown_type, invalid_parameter)
+//	403 token may not access a metric (metric_forbidden)
+//	404 metric does not exist (metric_not_found)
+//	422 metrics rejected by the validation policy (validation_failed)
+//	429 series quota exceeded (series_quota_exceeded)
+//	500 storage or persistence failure (storage_error)
+//
+// Reads answer 200 with a JSON body, writes answer 204 without one.
+
+// @Summary		List metrics
+// @Description	List stored metrics with their value and last update time, ordered by name and type.
+// @Description	Filters are combined; results are paginated with an opaque cursor returned as next_cursor.
+// @Tags			v2
+// @Produce		json
+// @Produce		application/problem+json
+// @Param			type	query		string	false	"Only list metrics of this type"	Enums(gauge, counter)
+// @Param			prefix	query		string	false	"Only list metrics whose name starts with the prefix"
+// @Param			regex	query		string	false	"Only list metrics whose name matches the regular expression"
+// @Param			limit	query		int		false	"Page size, 1 to 1000"	default(100)
+// @Param			cursor	query		string	false	"Cursor from next_cursor of the previous page"
+// @Success		200		{object}	dto.MetricList	"One page of metrics the token may read"
+// @Failure		400		{object}	dto.Problem		"unknown_type or invalid_parameter"
+// @Failure		401		{object}	dto.Problem		"unauthorized"
+// @Failure		403		{object}	dto.Problem		"forbidden"
+// @Failure		500		{object}	dto.Problem		"storage_error"
+// @Router			/api/v2/metrics [get]
+func (h *ListHandler) HandleV2(w http.ResponseWriter, r *http.Request) {
+	h.Handle(w, r.WithContext(handler.NewProblemContext(r.Context())))
+}
+
+// V2GetHandler handles HTTP requests for reading a single metric.
+// It processes GET requests at /api/v2/metrics/{type}/{id}.
+type V2GetHandler struct {
+	service metricsGetter
+}
+
+// NewV2GetHandler creates a new handler for reading a single metric.
+func NewV2GetHandler(service metricsGetter) *V2GetHandler {
+	return &V2GetHandler{
+		service: service,
+	}
+}
+
+// @Summary		Get a metric
+// @Description	Retrieve the current value of a counter or gauge metric. The name may contain slashes.
+// @Tags			v2
+// @Produce		json
+// @Produce		application/problem+json
+// @Param			type	path		string		true	"Metric type"	Enums(gauge, counter)
+// @Param			id		path		string		true	"Metric name"
+// @Success		200		{object}	dto.Metrics	"Metric with current value (delta for counter, value for gauge)"
+// @Failure		400		{object}	dto.Problem	"unknown_type or invalid_parameter"
+// @Failure		401		{object}	dto.Problem	"unauthorized"
+// @Failure		403		{object}	dto.Problem	"forbidden or metric_forbidden"
+// @Failure		404		{object}	dto.Problem	"metric_not_found"
+// @Failure		500		{object}	dto.Problem	"storage_error"
+// @Router			/api/v2/metrics/{type}/{id} [get]
+func (h *V2GetHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	mtype := chi.URLParam(r, "type")
+	id, err := pathMetricID(r)
+	if err != nil || id == "" {
+		rejectV2(w, r, http.StatusBadRequest, handler.CodeInvalidParameter, "invalid metric name")
+		return
+	}
+
+	if err := auth.CheckMetrics(r.Context(), id); err != nil {
+		rejectV2(w, r, http.StatusForbidden, handler.CodeMetricForbidden, err.Error())
+		return
+	}
+
+	m := dto.Metrics{ID: id, MType: mtype}
+	switch mtype {
+	case models.Counter:
+		var delta int64
+		delta, err = h.service.Counter(id)
+		m.Delta = &delta
+	case models.Gauge:
+		var value float64
+		value, err = h.service.Gauge(id)
+		m.Value = &value
+	default:
+		rejectV2(w, r, http.StatusBadRequest, handler.CodeUnknownType, unknownMetricTypeMessage)
+		return
+	}
+
+	if errors.Is(err, dberror.ErrValueNotFound) {
+		rejectV2(w, r, http.StatusNotFound, handler.CodeMetricNotFound, "metric not found")
+		return
+	}
+	if err != nil {
+		logger.Log.Warn(failedToGetMetricValueErrorMessage, logger.Error(err))
+		handler.Problem(w, r, http.StatusInternalServerError, handler.CodeStorageError, failedToGetMetricValueErrorMessage)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m); err != nil {
+		logger.Log.Warn(failedToEncodeErrorMessage, logger.Error(err))
+	}
+}
+
+// V2StoreHandler handles HTTP requests for storing a single metric.
+// It processes POST requests at /api/v2/metrics.
+type V2StoreHandler struct {
+	service      metricsStorer
+	cfg          *config.Config
+	auditManager *audit.Manager
+	limiter      seriesLimiter
+}
+
+// NewV2StoreHandler creates a new handler for storing a single metric.
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewV2StoreHandler(service metricsStorer, cfg *config.Config, auditManager *audit.Manager, limiter seriesLimiter) *V2StoreHandler {
+	return &V2StoreHandler{
+		service:      service,
+		cfg:          cfg,
+		auditManager: auditManager,
+		limiter:      limiter,
+	}
+}
+
+// @Summary		Store a metric
+// @Description	Store a single counter or gauge metric.
+// @Tags			v2
+// @Accept			json
+// @Produce		application/problem+json
+// @Param			metric	body	dto.Metrics	true	"Metric data (counter with delta or gauge with value)"
+// @Success		204		"Stored"
+// @Failure		400		{object}	dto.Problem	"invalid_json"
+// @Failure		401		{object}	dto.Problem	"unauthorized"
+// @Failure		403		{object}	dto.Problem	"forbidden or metric_forbidden"
+// @Failure		422		{object}	dto.Problem	"validation_failed, with the rejected metric in errors"
+// @Failure		429		{object}	dto.Problem	"series_quota_exceeded or rate_limited"
+// @Failure		500		{object}	dto.Problem	"storage_error"
+// @Router			/api/v2/metrics [post]
+func (h *V2StoreHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	var m dto.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		rejectV2(w, r, http.StatusBadRequest, handler.CodeInvalidJSON, incorrectJSONFormatMessage)
+		return
+	}
+
+	metrics := []models.Metrics{{ID: m.ID, MType: m.MType, Delta: m.Delta, Value: m.Value}}
+	if !storeV2(w, r, h.service, h.cfg, h.auditManager, h.limiter, metrics) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// V2BatchHandler handles HTTP requests for storing a batch of metrics.
+// It processes POST requests at /api/v2/metrics/batch.
+type V2BatchHandler struct {
+	service      metricsStorer
+	cfg          *config.Config
+	auditManager *audit.Manager
+	limiter      seriesLimiter
+}
+
+// NewV2BatchHandler creates a new handler for storing a batch of metrics.
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewV2BatchHandler(service metricsStorer, cfg *config.Config, auditManager *audit.Manager, limiter seriesLimiter) *V2BatchHandler {
+	return &V2BatchHandler{
+		service:      service,
+		cfg:          cfg,
+		auditManager: auditManager,
+		limiter:      limiter,
+	}
+}
+
+// @Summary		Store a batch of metrics
+// @Description	Store an array of metrics. By default the batch is all-or-nothing and a stored batch is answered with 204.
+// @Description	With partial=true valid metrics are stored and the response lists accepted and rejected items;
+// @Description	a partial batch in which every metric is rejected is answered with 422.
+// @Tags			v2
+// @Accept			json
+// @Produce		json
+// @Produce		application/problem+json
+// @Param			metrics			body		[]dto.Metrics	true	"Array of metrics to store"
+// @Param			partial			query		bool			false	"Store valid metrics even if some are rejected"
+// @Param			Idempotency-Key	header		string			false	"Batch key; a replay with the same key returns the stored response without applying the batch again"
+// @Success		200				{object}	dto.BatchResult	"Partial mode: accepted and rejected metrics"
+// @Success		204				"Stored"
+// @Failure		400				{object}	dto.Problem		"invalid_json, empty_batch or invalid_idempotency_key"
+// @Failure		401				{object}	dto.Problem		"unauthorized"
+// @Failure		403				{object}	dto.Problem		"forbidden or metric_forbidden"
+// @Failure		409				{object}	dto.Problem		"idempotency_conflict"
+// @Failure		422				{object}	dto.Problem		"validation_failed, with the rejected metrics in errors"
+// @Failure		429				{object}	dto.Problem		"series_quota_exceeded or rate_limited"
+// @Failure		500				{object}	dto.Problem		"storage_error"
+// @Router			/api/v2/metrics/batch [post]
+func (h *V2BatchHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	partial, err := parseOptionalBool(r.URL.Query().Get("partial"))
+	if err != nil {
+		rejectV2(w, r, http.StatusBadRequest, handler.CodeInvalidParameter, "invalid partial parameter")
+		return
+	}
+
+	var m []dto.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		rejectV2(w, r, http.StatusBadRequest, handler.CodeInvalidJSON, incorrectJSONFormatMessage)
+		return
+	}
+	if len(m) == 0 {
+		rejectV2(w, r, http.StatusBadRequest, handler.CodeEmptyBatch, emptyMetricsErrorMessage)
+		return
+	}
+
+	metrics := make([]models.Metrics, 0, len(m))
+	for _, metric := range m {
+		metrics = append(metrics, models.Metrics{ID: metric.ID, MType: metric.MType, Delta: metric.Delta, Value: metric.Value})
+	}
+
+	if !partial {
+		if storeV2(w, r, h.service, h.cfg, h.auditManager, h.limiter, metrics) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	validationErr := h.service.Validate(metrics)
+	valid, indexes, violations := validation.Partition(metrics, validationErr)
+	if len(valid) == 0 {
+		validationFailedV2(w, r, validationErr)
+		return
+	}
+	if !storeV2(w, r, h.service, h.cfg, h.auditManager, h.limiter, valid) {
+		return
+	}
+
+	result := dto.BatchResult{
+		Accepted: make([]dto.AcceptedMetric, 0, len(valid)),
+		Rejected: handler.RejectedMetrics(violations),
+	}
+	for i, metric := range valid {
+		result.Accepted = append(result.Accepted, dto.AcceptedMetric{Index: indexes[i], ID: metric.ID, MType: metric.MType})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Log.Warn(failedToEncodeErrorMessage, logger.Error(err))
+	}
+}
+
+// storeV2 validates, authorizes, admits and stores the metrics as one batch.
+// It reports a failure as problem details and returns false.
+func storeV2(
+	w http.ResponseWriter,
+	r *http.Request,
+	service metricsStorer,
+	cfg *config.Config,
+	auditManager *audit.Manager,
+	limiter seriesLimiter,
+	metrics []models.Metrics,
+) bool {
+	if err := service.Validate(metrics); err != nil {
+		validationFailedV2(w, r, err)
+		return false
+	}
+
+	names := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		names = append(names, metric.ID)
+	}
+	if err := auth.CheckMetrics(r.Context(), names...); err != nil {
+		rejectV2(w, r, http.StatusForbidden, handler.CodeMetricForbidden, err.Error())
+		return false
+	}
+
+	var reservation *quota.Reservation
+	if limiter != nil {
+		var err error
+		if reservation, err = limiter.Reserve(handler.ClientIP(r), metrics); err != nil {
+			rejectV2(w, r, http.StatusTooManyRequests, handler.CodeSeriesQuotaExceeded, err.Error())
+			return false
+		}
+	}
+
+	if err := service.StoreAll(metrics); err != nil {
+		reservation.Release()
+		logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
+		handler.Problem(w, r, http.StatusInternalServerError, handler.CodeStorageError, "failed to store metrics")
+		return false
+	}
+	reservation.Commit()
+
+	// The metrics are applied once stored: failing the request now would make the
+	// client retry and add its counters twice. They are saved with the next update.
+	if cfg.StoreInterval.Value() == 0 {
+		if err := service.Persist(); err != nil {
+			logger.Log.Warn(failedToPersistMetricsErrorMessage, logger.Error(err))
+		}
+	}
+
+	sendAuditEvent(auditManager, names, handler.ClientIP(r))
+	registry.RecordMetrics(r.Context(), len(metrics))
+
+	return true
+}
+
+// validationFailedV2 responds with 422 listing every rejected metric.
+func validationFailedV2(w http.ResponseWriter, r *http.Request, err error) {
+	logger.Log.Warn("metrics rejected by validation policy", logger.String("URI", r.RequestURI), logger.Error(err))
+
+	p := dto.Problem{
+		Status: http.StatusUnprocessableEntity,
+		Code:   handler.CodeValidationFailed,
+		Detail: "validation failed",
+	}
+	var validationErr *validation.Error
+	if errors.As(err, &validationErr) {
+		p.Errors = handler.RejectedMetrics(validationErr.Violations)
+	}
+
+	handler.WriteProblem(w, r, p)
+}
+
+func rejectV2(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	logger.Log.Warn(detail, logger.String("URI", r.RequestURI), logger.String("code", code))
+	handler.Problem(w, r, status, code, detail)
+}
+
+// pathMetricID returns the metric name matched by the trailing wildcard. chi matches
+// against the escaped path when it differs from the decoded one, so it is unescaped here.
+func pathMetricID(r *http.Request) (string, error) {
+	id := chi.URLParam(r, "*")
+	if r.URL.RawPath == "" {
+		return id, nil
+	}
+
+	return url.PathUnescape(id)
+}
+
+func parseOptionalBool(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(s)
+}
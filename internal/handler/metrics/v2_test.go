@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/config"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/handler/middleware"
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/service"
+	"github.com/koyif/metrics/pkg/dto"
+)
+
+func newV2Router(t *testing.T) (*chi.Mux, *repository.MetricsRepository) {
+	t.Helper()
+
+	repo := repository.NewMetricsRepository()
+	svc := service.NewMetricsService(repo, nil, nil, nil)
+	cfg := &config.Config{StoreInterval: 300}
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(handler.NewProblemContext(r.Context())))
+		})
+	})
+	r.Get("/api/v2/metrics/{type}/*", NewV2GetHandler(svc).Handle)
+	r.Post("/api/v2/metrics", NewV2StoreHandler(svc, cfg, nil, nil).Handle)
+	r.Post("/api/v2/metrics/batch", NewV2BatchHandler(svc, cfg, nil, nil).Handle)
+
+	return r, repo
+}
+
+func serve(r http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, target, bytes.NewBufferString(body)))
+	return rec
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) dto.Problem {
+	t.Helper()
+
+	assert.Equal(t, handler.ProblemContentType, rec.Header().Get("Content-Type"))
+	var p dto.Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	assert.Equal(t, rec.Code, p.Status)
+	return p
+}
+
+func TestV2_StoreAndGet(t *testing.T) {
+	r, _ := newV2Router(t)
+
+	rec := serve(r, http.MethodPost, "/api/v2/metrics", `{"id":"host/cpu","type":"gauge","value":0.5}`)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	rec = serve(r, http.MethodGet, "/api/v2/metrics/gauge/host/cpu", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var m dto.Metrics
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&m))
+	assert.Equal(t, "host/cpu", m.ID)
+	require.NotNil(t, m.Value)
+	assert.InDelta(t, 0.5, *m.Value, 0)
+
+	rec = serve(r, http.MethodGet, "/api/v2/metrics/gauge/host%2Fcpu", "")
+	assert.Equal(t, http.StatusOK, rec.Code, "escaped slashes are unescaped")
+}
+
+func TestV2_Errors(t *testing.T) {
+	r, _ := newV2Router(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"unknown metric", http.MethodGet, "/api/v2/metrics/counter/missing", "", http.StatusNotFound, handler.CodeMetricNotFound},
+		{"unknown type on read", http.MethodGet, "/api/v2/metrics/histogram/x", "", http.StatusBadRequest, handler.CodeUnknownType},
+		{"invalid json", http.MethodPost, "/api/v2/metrics", `{`, http.StatusBadRequest, handler.CodeInvalidJSON},
+		{"empty id", http.MethodPost, "/api/v2/metrics", `{"id":"","type":"gauge","value":1}`, http.StatusUnprocessableEntity, handler.CodeValidationFailed},
+		{"unknown type on write", http.MethodPost, "/api/v2/metrics", `{"id":"x","type":"histogram"}`, http.StatusUnprocessableEntity, handler.CodeValidationFailed},
+		{"missing value", http.MethodPost, "/api/v2/metrics", `{"id":"x","type":"counter"}`, http.StatusUnprocessableEntity, handler.CodeValidationFailed},
+		{"empty batch", http.MethodPost, "/api/v2/metrics/batch", `[]`, http.StatusBadRequest, handler.CodeEmptyBatch},
+		{"invalid batch", http.MethodPost, "/api/v2/metrics/batch", `[{"id":"","type":"gauge","value":1}]`, http.StatusUnprocessableEntity, handler.CodeValidationFailed},
+		{"invalid partial flag", http.MethodPost, "/api/v2/metrics/batch?partial=maybe", `[]`, http.StatusBadRequest, handler.CodeInvalidParameter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(r, tt.method, tt.target, tt.body)
+			require.Equal(t, tt.wantStatus, rec.Code)
+			p := decodeProblem(t, rec)
+			assert.Equal(t, tt.wantCode, p.Code)
+			if tt.wantCode == handler.CodeValidationFailed {
+				assert.NotEmpty(t, p.Errors)
+			}
+		})
+	}
+}
+
+func TestV2_Batch(t *testing.T) {
+	r, repo := newV2Router(t)
+
+	rec := serve(r, http.MethodPost, "/api/v2/metrics/batch",
+		`[{"id":"a","type":"counter","delta":1},{"id":"b","type":"gauge","value":2}]`)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serve(r, http.MethodPost, "/api/v2/metrics/batch",
+		`[{"id":"a","type":"counter","delta":1},{"id":"","type":"gauge","value":2}]`)
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	counter, err := repo.Counter("a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counter, "a rejected batch stores nothing")
+
+	rec = serve(r, http.MethodPost, "/api/v2/metrics/batch?partial=true",
+		`[{"id":"a","type":"counter","delta":1},{"id":"","type":"gauge","value":2}]`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var result dto.BatchResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+	require.Len(t, result.Accepted, 1)
+	require.Len(t, result.Rejected, 1)
+	assert.Equal(t, 1, result.Rejected[0].Index)
+
+	rec = serve(r, http.MethodPost, "/api/v2/metrics/batch?partial=true", `[{"id":"","type":"gauge","value":2}]`)
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, handler.CodeValidationFailed, decodeProblem(t, rec).Code)
+}
+
+type failingPersist struct {
+	*service.MetricsService
+}
+
+func (failingPersist) Persist() error {
+	return errors.New("disk is full")
+}
+
+func TestV2_PersistFailureAfterStore(t *testing.T) {
+	repo := repository.NewMetricsRepository()
+	svc := failingPersist{service.NewMetricsService(repo, nil, nil, nil)}
+	h := middleware.WithIdempotency(idempotency.NewMemoryStore(0, 0))(
+		http.HandlerFunc(NewV2BatchHandler(svc, &config.Config{StoreInterval: 0}, nil, nil).Handle))
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/metrics/batch",
+			bytes.NewBufferString(`[{"id":"a","type":"counter","delta":5}]`))
+		req.Header.Set(idempotency.HeaderName, "batch-1")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(handler.NewProblemContext(req.Context())))
+		require.Equal(t, http.StatusNoContent, rec.Code, "stored metrics are reported as applied")
+	}
+
+	counter, err := repo.Counter("a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter, "the retry is replayed instead of applied again")
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/registry"
+)
+
+// WithAgentRegistry creates middleware that registers agents by the identity headers they send.
+// Requests without an agent ID pass through untouched; for the others the request context
+// lets handlers attribute stored metrics to the agent with registry.RecordMetrics.
+func WithAgentRegistry(agents *registry.Registry) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity := registry.IdentityFromHeaders(r.Header)
+			if identity.ID == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			agents.Observe(identity, registry.TransportHTTP, handler.ClientIP(r))
+			h.ServeHTTP(w, r.WithContext(registry.NewContext(r.Context(), agents, identity.ID)))
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/registry"
+)
+
+func TestWithAgentRegistry(t *testing.T) {
+	agents := registry.New(time.Minute)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registry.RecordMetrics(r.Context(), 3)
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := WithAgentRegistry(agents)(next)
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	req.RemoteAddr = "10.0.0.7:1234"
+	registry.Identity{ID: "agent-1", Hostname: "host", Version: "v1", StartedAt: time.Now()}.SetHeaders(req.Header)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	anonymous := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), anonymous)
+
+	list := agents.Agents()
+	require.Len(t, list, 1)
+	assert.Equal(t, "agent-1", list[0].ID)
+	assert.Equal(t, registry.TransportHTTP, list[0].Transport)
+	assert.Equal(t, "10.0.0.7", list[0].Address)
+	assert.Equal(t, int64(3), list[0].MetricsReceived)
+	assert.True(t, list[0].Alive)
+}
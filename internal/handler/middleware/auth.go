@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// WithAuth creates middleware that requires a bearer token granted the given scope.
+// Requests without a valid token are rejected with 401, tokens lacking the scope with 403.
+// The authenticated principal is stored in the request context, so handlers can
+// enforce the token's metric-name prefixes with auth.CheckMetrics.
+func WithAuth(authenticator *auth.Authenticator, scope string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := auth.BearerToken(r.Header.Get("Authorization"))
+
+			principal, err := authenticator.Authenticate(token, scope)
+			if errors.Is(err, auth.ErrUnauthenticated) {
+				logger.Log.Warn("request rejected: missing or invalid token", logger.String("URI", r.RequestURI))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				handler.Error(w, r, http.StatusUnauthorized, handler.CodeUnauthorized, http.StatusText(http.StatusUnauthorized))
+				return
+			}
+			if err != nil {
+				logger.Log.Warn("request rejected: insufficient scope", logger.String("URI", r.RequestURI), logger.Error(err))
+				handler.Error(w, r, http.StatusForbidden, handler.CodeForbidden, http.StatusText(http.StatusForbidden))
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+		})
+	}
+}
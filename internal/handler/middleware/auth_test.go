@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/auth"
+)
+
+func TestWithAuth(t *testing.T) {
+	authenticator, err := auth.New([]auth.TokenConfig{
+		{Name: "reader", Token: "read-token", Scopes: []string{auth.ScopeRead}},
+		{Name: "writer", Token: "write-token", Scopes: []string{auth.ScopeWrite}},
+	})
+	require.NoError(t, err)
+
+	var principal *auth.Principal
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = auth.FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := WithAuth(authenticator, auth.ScopeWrite)(next)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "missing token", wantStatus: http.StatusUnauthorized},
+		{name: "unknown token", authorization: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "wrong scope", authorization: "Bearer read-token", wantStatus: http.StatusForbidden},
+		{name: "granted", authorization: "Bearer write-token", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal = nil
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+			}
+			if tt.wantStatus == http.StatusOK {
+				require.NotNil(t, principal)
+				assert.Equal(t, "writer", principal.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/koyif/metrics/internal/clientip"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// WithClientIP creates middleware that resolves the client address from the TCP peer
+// and, when the peer is a trusted proxy, from X-Forwarded-For or X-Real-IP.
+// Downstream code reads the result with handler.ClientIP.
+func WithClientIP(resolver *clientip.Resolver) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolver.Resolve(
+				r.RemoteAddr,
+				r.Header.Values(clientip.ForwardedForHeader),
+				r.Header.Get(clientip.RealIPHeader),
+			)
+			if ip == nil {
+				logger.Log.Debug("couldn't parse remote address", logger.String("RemoteAddr", r.RemoteAddr))
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(clientip.NewContext(r.Context(), ip)))
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/pkg/compress"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// maxDecompressedBodySize bounds the decoded request body, so a small compressed
+// payload can't expand into an unbounded amount of memory.
+const maxDecompressedBodySize = 32 << 20
+
+// WithDecompression creates middleware that decodes request bodies sent with
+// Content-Encoding gzip, zstd or snappy. It must run after WithDecryption, since agents
+// compress the payload before encrypting it, and before WithHashCheck, since the
+// signature covers the uncompressed body.
+// Unknown codings are rejected with 415 and oversized bodies with 413.
+func WithDecompression(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if encoding == "" || encoding == compress.Identity {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		reader, err := compress.NewReader(encoding, r.Body)
+		if errors.Is(err, compress.ErrUnsupportedEncoding) {
+			logger.Log.Warn("unsupported request content encoding", logger.String("Content-Encoding", encoding))
+			handler.Error(w, r, http.StatusUnsupportedMediaType, handler.CodeUnsupportedEncoding, "unsupported content encoding")
+			return
+		}
+		if err != nil {
+			logger.Log.Warn("error decoding request body", logger.Error(err))
+			handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, "failed to decode request body")
+			return
+		}
+		defer reader.Close()
+
+		body, err := io.ReadAll(io.LimitReader(reader, maxDecompressedBodySize+1))
+		if err != nil {
+			logger.Log.Warn("error decoding request body", logger.Error(err))
+			handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, "failed to decode request body")
+			return
+		}
+		if len(body) > maxDecompressedBodySize {
+			logger.Log.Warn("decoded request body is too large", logger.String("URI", r.RequestURI))
+			handler.Error(w, r, http.StatusRequestEntityTooLarge, handler.CodeBodyTooLarge, "request body is too large")
+			return
+		}
+		if err := r.Body.Close(); err != nil {
+			logger.Log.Debug("error closing request body", logger.Error(err))
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/compress"
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+func TestWithDecompression(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1}`), 50)
+
+	var received []byte
+	handler := WithDecompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		received, err = io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Empty(t, r.Header.Get("Content-Encoding"))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, encoding := range []string{"", compress.Gzip, compress.Zstd} {
+		t.Run(encoding, func(t *testing.T) {
+			encoded, err := compress.Encode(encoding, body)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(encoded))
+			if encoding != "" {
+				req.Header.Set("Content-Encoding", encoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, body, received)
+		})
+	}
+}
+
+func TestWithDecompression_Errors(t *testing.T) {
+	handler := WithDecompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader([]byte("data")))
+	req.Header.Set("Content-Encoding", "br")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader([]byte("not gzip")))
+	req.Header.Set("Content-Encoding", compress.Gzip)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	bomb, err := compress.Encode(compress.Gzip, make([]byte, maxDecompressedBodySize+1))
+	require.NoError(t, err)
+	req = httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(bomb))
+	req.Header.Set("Content-Encoding", compress.Gzip)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestWithDecompression_BeforeHashCheck(t *testing.T) {
+	const hashKey = "secret"
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+
+	handler := WithDecompression(WithHashCheck(hashKey, replay.New(time.Minute, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	encoded, err := compress.Encode(compress.Zstd, body)
+	require.NoError(t, err)
+
+	timestamp, nonce := replay.Timestamp(time.Now()), replay.NewNonce()
+	req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(encoded))
+	req.Header.Set("Content-Encoding", compress.Zstd)
+	req.Header.Set(replay.TimestampHeader, timestamp)
+	req.Header.Set(replay.NonceHeader, nonce)
+	req.Header.Set(crypto.HashHeader, crypto.SignRequest(hashKey, timestamp, nonce, body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code, "the signature covers the uncompressed body")
+}
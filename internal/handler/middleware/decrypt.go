@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/koyif/metrics/internal/handler"
 	"github.com/koyif/metrics/pkg/crypto"
 	"github.com/koyif/metrics/pkg/logger"
 )
@@ -21,14 +22,14 @@ func WithDecryption(privateKey *rsa.PrivateKey) func(http.Handler) http.Handler
 			contentType := r.Header.Get(contentTypeHeaderName)
 			if contentType != "application/octet-stream" {
 				logger.Log.Debug("request body is not encrypted", logger.String(contentTypeHeaderName, contentType))
-				http.Error(w, "request body is not encrypted", http.StatusBadRequest)
+				handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, "request body is not encrypted")
 				return
 			}
 
 			encryptedBody, err := io.ReadAll(r.Body)
 			if err != nil {
 				logger.Log.Error("error reading encrypted request body", logger.Error(err))
-				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, "failed to read request body")
 				return
 			}
 			err = r.Body.Close()
@@ -40,7 +41,7 @@ func WithDecryption(privateKey *rsa.PrivateKey) func(http.Handler) http.Handler
 			decryptedBody, err := crypto.DecryptData(privateKey, encryptedBody)
 			if err != nil {
 				logger.Log.Error("error decrypting request body", logger.Error(err))
-				http.Error(w, "failed to decrypt request body", http.StatusBadRequest)
+				handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, "failed to decrypt request body")
 				return
 			}
 
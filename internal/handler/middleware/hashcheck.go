@@ -2,42 +2,63 @@ package middleware
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"fmt"
 	"io"
 	"net/http"
 
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/crypto"
 	"github.com/koyif/metrics/pkg/logger"
 )
 
-func WithHashCheck(hashKey string) func(http.Handler) http.Handler {
+// WithHashCheck creates middleware that rejects requests whose signature in the HashSHA256
+// header does not match. With a replay guard the signature covers the X-Signature-Timestamp
+// and X-Signature-Nonce headers along with the body, and stale or repeated requests are
+// rejected too. The guard can be nil to check the body signature only.
+func WithHashCheck(hashKey string, guard *replay.Guard) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			headerHash := r.Header.Get("HashSHA256")
+			headerHash := r.Header.Get(crypto.HashHeader)
 			if headerHash == "" {
 				logger.Log.Warn("hash is not provided", logger.String("URI", r.RequestURI))
-				http.Error(w, "hash is not provided", http.StatusBadRequest)
+				handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidSignature, "hash is not provided")
 				return
 			}
 
 			b, err := io.ReadAll(r.Body)
 			if err != nil {
 				logger.Log.Error("error reading request body", logger.Error(err))
-				http.Error(w, "read error", http.StatusBadRequest)
+				handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidBody, "read error")
 				return
 			}
 			r.Body = io.NopCloser(bytes.NewBuffer(b))
 			r.Body.Close()
 
-			hh := hmac.New(sha256.New, []byte(hashKey))
-			hh.Write(b)
-			sum := fmt.Sprintf("%x", hh.Sum(nil))
+			if guard == nil {
+				if !crypto.Verify(hashKey, b, headerHash) {
+					logger.Log.Warn("hash is not valid", logger.String("URI", r.RequestURI))
+					handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidSignature, "hash is not valid")
+					return
+				}
 
-			if sum != headerHash {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			timestamp := r.Header.Get(replay.TimestampHeader)
+			nonce := r.Header.Get(replay.NonceHeader)
+			if !crypto.VerifyRequest(hashKey, timestamp, nonce, b, headerHash) {
 				logger.Log.Warn("hash is not valid", logger.String("URI", r.RequestURI))
-				http.Error(w, "hash is not valid", http.StatusBadRequest)
+				handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidSignature, "hash is not valid")
+				return
+			}
+
+			// The nonce is recorded only after the signature is verified,
+			// so unsigned requests can't fill the cache.
+			if err := guard.Check(timestamp, nonce); err != nil {
+				logger.Log.Warn("request rejected by replay protection", logger.String("URI", r.RequestURI), logger.Error(err))
+				handler.Error(w, r, http.StatusBadRequest, handler.CodeReplayRejected, err.Error())
 				return
 			}
 
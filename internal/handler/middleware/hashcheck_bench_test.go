@@ -63,7 +63,7 @@ func BenchmarkHashCheckMiddleware(b *testing.B) {
 			hh.Write(payload)
 			hash := fmt.Sprintf("%x", hh.Sum(nil))
 
-			middleware := WithHashCheck(hashKey)
+			middleware := WithHashCheck(hashKey, nil)
 			wrappedHandler := middleware(handler)
 
 			b.ResetTimer()
@@ -93,7 +93,7 @@ func BenchmarkHashCheckMiddlewareParallel(b *testing.B) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	middleware := WithHashCheck(hashKey)
+	middleware := WithHashCheck(hashKey, nil)
 	wrappedHandler := middleware(handler)
 
 	b.ResetTimer()
@@ -117,7 +117,7 @@ func BenchmarkInvalidHashCheck(b *testing.B) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	middleware := WithHashCheck(hashKey)
+	middleware := WithHashCheck(hashKey, nil)
 	wrappedHandler := middleware(handler)
 
 	b.ResetTimer()
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/koyif/metrics/internal/replay"
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+func TestWithHashCheck_ReplayProtection(t *testing.T) {
+	const hashKey = "secret"
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+
+	handler := WithHashCheck(hashKey, replay.New(time.Minute, 100))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(timestamp, nonce, signature string) int {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+		req.Header.Set(replay.TimestampHeader, timestamp)
+		req.Header.Set(replay.NonceHeader, nonce)
+		req.Header.Set(crypto.HashHeader, signature)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	now := replay.Timestamp(time.Now())
+	signature := crypto.SignRequest(hashKey, now, "nonce-1", body)
+
+	assert.Equal(t, http.StatusOK, send(now, "nonce-1", signature))
+	assert.Equal(t, http.StatusBadRequest, send(now, "nonce-1", signature), "replayed request")
+	assert.Equal(t, http.StatusBadRequest, send(now, "nonce-2", signature), "nonce not covered by signature")
+	assert.Equal(t, http.StatusBadRequest, send(now, "nonce-3", crypto.Sign(hashKey, body)), "body-only signature")
+
+	stale := replay.Timestamp(time.Now().Add(-time.Hour))
+	assert.Equal(t, http.StatusBadRequest, send(stale, "nonce-4", crypto.SignRequest(hashKey, stale, "nonce-4", body)))
+
+	assert.Equal(t, http.StatusOK, send(now, "nonce-5", crypto.SignRequest(hashKey, now, "nonce-5", body)))
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// recordingResponseWriter passes the response through while keeping a copy
+// of the status code and body, so the result can be stored for replays.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *recordingResponseWriter) WriteHeader(statusCode int) {
+	if rw.statusCode == 0 {
+		rw.statusCode = statusCode
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// WithIdempotency creates middleware that deduplicates requests carrying an Idempotency-Key header.
+// The first request with a key is processed normally and its response is stored; a replay with
+// the same key gets the stored response without reaching the handler. A replay that arrives
+// while the first request is still running is answered with 409 Conflict.
+//
+// Responses with a 5xx status are not stored and the client is free to retry with the same
+// key, so handlers must only answer 5xx when nothing was applied: once a batch is stored, an
+// error saving it afterwards is logged rather than returned.
+// Requests without the header are passed through unchanged.
+func WithIdempotency(store idempotency.Store) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotency.HeaderName)
+			if key == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > idempotency.MaxKeyLength {
+				logger.Log.Warn("idempotency key is too long", logger.String("URI", r.RequestURI))
+				handler.Error(w, r, http.StatusBadRequest, handler.CodeInvalidIdempotencyKey, http.StatusText(http.StatusBadRequest))
+				return
+			}
+
+			// Keys are scoped to the client and the endpoint, so clients cannot read each
+			// other's responses and the same key sent to /update/ and /updates/ does not collide.
+			scopedKey := idempotencyOwner(r) + " " + r.Method + " " + r.URL.Path + " " + key
+
+			result, err := store.Begin(r.Context(), scopedKey)
+			if errors.Is(err, idempotency.ErrInProgress) {
+				logger.Log.Warn("duplicate request is still in progress", logger.String("URI", r.RequestURI))
+				handler.Error(w, r, http.StatusConflict, handler.CodeIdempotencyConflict, http.StatusText(http.StatusConflict))
+				return
+			}
+			if err != nil {
+				logger.Log.Error("idempotency store failed", logger.Error(err))
+				handler.Error(w, r, http.StatusInternalServerError, handler.CodeInternalError, http.StatusText(http.StatusInternalServerError))
+				return
+			}
+
+			if result != nil {
+				logger.Log.Info("replaying stored response", logger.String("URI", r.RequestURI))
+				if result.ContentType != "" {
+					w.Header().Set("Content-Type", result.ContentType)
+				}
+				w.Header().Set(idempotency.ReplayedHeaderName, "true")
+				w.WriteHeader(result.StatusCode)
+				_, _ = w.Write(result.Body)
+				return
+			}
+
+			rw := &recordingResponseWriter{ResponseWriter: w}
+			h.ServeHTTP(rw, r)
+
+			// The key must be settled even if the client went away meanwhile.
+			ctx := context.WithoutCancel(r.Context())
+
+			if rw.statusCode == 0 {
+				rw.statusCode = http.StatusOK
+			}
+
+			if rw.statusCode >= http.StatusInternalServerError {
+				if err := store.Abort(ctx, scopedKey); err != nil {
+					logger.Log.Error("failed to release idempotency key", logger.Error(err))
+				}
+				return
+			}
+
+			err = store.Complete(ctx, scopedKey, idempotency.Result{
+				StatusCode:  rw.statusCode,
+				ContentType: rw.Header().Get("Content-Type"),
+				Body:        rw.body.Bytes(),
+			})
+			if err != nil {
+				logger.Log.Error("failed to store idempotent response", logger.Error(err))
+			}
+		})
+	}
+}
+
+// idempotencyOwner identifies the client owning an idempotency key: the
+// authenticated principal, or the client IP when authentication is off.
+func idempotencyOwner(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return "token:" + p.Name
+	}
+
+	return "ip:" + handler.ClientIP(r)
+}
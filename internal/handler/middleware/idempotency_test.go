@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/idempotency"
+)
+
+func TestWithIdempotency(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"calls":1}`))
+	})
+
+	handler := WithIdempotency(idempotency.NewMemoryStore(time.Minute, 100))(next)
+
+	send := func(target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader("[]"))
+		if key != "" {
+			req.Header.Set(idempotency.HeaderName, key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send("/updates/", "batch-1")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get(idempotency.ReplayedHeaderName))
+
+	replay := send("/updates/", "batch-1")
+	assert.Equal(t, http.StatusOK, replay.Code)
+	assert.Equal(t, "true", replay.Header().Get(idempotency.ReplayedHeaderName))
+	assert.Equal(t, "application/json", replay.Header().Get("Content-Type"))
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+	assert.Equal(t, 1, calls, "replay must not reach the handler")
+
+	send("/updates/", "")
+	send("/updates/", "")
+	assert.Equal(t, 3, calls, "requests without a key are not deduplicated")
+
+	send("/updates/?fail=1", "batch-2")
+	send("/updates/?fail=1", "batch-2")
+	assert.Equal(t, 5, calls, "server errors must not be stored")
+}
+
+func TestWithIdempotency_ScopedToClient(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := WithIdempotency(idempotency.NewMemoryStore(time.Minute, 100))(next)
+
+	send := func(remoteAddr string, principal *auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader("[]"))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(idempotency.HeaderName, "batch-1")
+		if principal != nil {
+			req = req.WithContext(auth.NewContext(req.Context(), principal))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	send("10.0.0.1:1000", nil)
+	assert.Equal(t, "true", send("10.0.0.1:2000", nil).Header().Get(idempotency.ReplayedHeaderName))
+	assert.Empty(t, send("10.0.0.2:1000", nil).Header().Get(idempotency.ReplayedHeaderName), "other clients' keys are not shared")
+
+	send("10.0.0.1:1000", &auth.Principal{Name: "ci"})
+	assert.Equal(t, "true", send("10.0.0.3:1000", &auth.Principal{Name: "ci"}).Header().Get(idempotency.ReplayedHeaderName),
+		"a principal owns its keys from every address")
+	assert.Empty(t, send("10.0.0.1:1000", &auth.Principal{Name: "agent"}).Header().Get(idempotency.ReplayedHeaderName))
+	assert.Equal(t, 4, calls)
+}
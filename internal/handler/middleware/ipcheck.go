@@ -2,65 +2,59 @@ package middleware
 
 import (
 	"fmt"
-	"net"
 	"net/http"
 
+	"github.com/koyif/metrics/internal/clientip"
+	"github.com/koyif/metrics/internal/handler"
 	"github.com/koyif/metrics/pkg/logger"
 )
 
-// WithIPCheck creates middleware that validates client IP against trusted subnet.
-// Returns error if trustedSubnet is invalid CIDR notation.
-func WithIPCheck(trustedSubnet string) (func(http.Handler) http.Handler, error) {
-	if trustedSubnet == "" {
+// WithIPCheck creates middleware that validates the client IP against the trusted subnets,
+// a comma-separated list of IPv4 or IPv6 networks in CIDR notation.
+// The client IP is the one resolved by WithClientIP, or the TCP peer address without it.
+// Returns error if any subnet is invalid CIDR notation.
+func WithIPCheck(trustedSubnets string) (func(http.Handler) http.Handler, error) {
+	networks, err := clientip.ParseCIDRs(trustedSubnets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted subnet: %w", err)
+	}
+
+	if len(networks) == 0 {
 		return func(h http.Handler) http.Handler {
 			return h
 		}, nil
 	}
 
-	_, ipNet, err := net.ParseCIDR(trustedSubnet)
-	if err != nil {
-		return nil, fmt.Errorf("invalid CIDR notation for trusted subnet: %w", err)
-	}
-
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			clientIP := r.Header.Get("X-Real-IP")
-			if clientIP == "" {
-				logger.Log.Warn(
-					"missing X-Real-IP header",
-					logger.String("URI", r.RequestURI),
-					logger.String("RemoteAddr", r.RemoteAddr),
-				)
-				http.Error(w, "forbidden", http.StatusForbidden)
-				return
-			}
+			clientIP := handler.ClientIP(r)
 
-			ip := net.ParseIP(clientIP)
+			ip := clientip.ParseIP(clientIP)
 			if ip == nil {
 				logger.Log.Warn(
-					"invalid IP address in X-Real-IP header",
-					logger.String("X-Real-IP", clientIP),
+					"invalid client IP address",
+					logger.String("ClientIP", clientIP),
 					logger.String("URI", r.RequestURI),
 				)
-				http.Error(w, "forbidden", http.StatusForbidden)
+				handler.Error(w, r, http.StatusForbidden, handler.CodeForbidden, "forbidden")
 				return
 			}
 
-			if !ipNet.Contains(ip) {
+			if !clientip.Contains(networks, ip) {
 				logger.Log.Warn(
 					"IP address not in trusted subnet",
-					logger.String("X-Real-IP", clientIP),
-					logger.String("TrustedSubnet", trustedSubnet),
+					logger.String("ClientIP", clientIP),
+					logger.String("TrustedSubnet", trustedSubnets),
 					logger.String("URI", r.RequestURI),
 				)
-				http.Error(w, "forbidden", http.StatusForbidden)
+				handler.Error(w, r, http.StatusForbidden, handler.CodeForbidden, "forbidden")
 				return
 			}
 
 			logger.Log.Debug(
 				"IP check passed",
-				logger.String("X-Real-IP", clientIP),
-				logger.String("TrustedSubnet", trustedSubnet),
+				logger.String("ClientIP", clientIP),
+				logger.String("TrustedSubnet", trustedSubnets),
 			)
 
 			h.ServeHTTP(w, r)
@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/koyif/metrics/internal/clientip"
 )
 
 func TestWithIPCheck_EmptySubnet(t *testing.T) {
@@ -36,7 +39,7 @@ func TestWithIPCheck_InvalidCIDR(t *testing.T) {
 	}
 }
 
-func TestWithIPCheck_MissingHeader(t *testing.T) {
+func TestWithIPCheck_PeerOutsideSubnet(t *testing.T) {
 	middleware, err := WithIPCheck("192.168.1.0/24")
 	if err != nil {
 		t.Fatalf("WithIPCheck returned error: %v", err)
@@ -58,7 +61,7 @@ func TestWithIPCheck_MissingHeader(t *testing.T) {
 	}
 }
 
-func TestWithIPCheck_EmptyHeader(t *testing.T) {
+func TestWithIPCheck_IgnoresForwardedHeadersFromUntrustedPeer(t *testing.T) {
 	middleware, err := WithIPCheck("192.168.1.0/24")
 	if err != nil {
 		t.Fatalf("WithIPCheck returned error: %v", err)
@@ -71,10 +74,12 @@ func TestWithIPCheck_EmptyHeader(t *testing.T) {
 	handler := middleware(testHandler)
 
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
-	req.Header.Set("X-Real-IP", "")
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Real-IP", "192.168.1.5")
+	req.Header.Set("X-Forwarded-For", "192.168.1.5")
 	w := httptest.NewRecorder()
 
-	handler.ServeHTTP(w, req)
+	WithClientIP(clientip.NewResolver(nil))(handler).ServeHTTP(w, req)
 
 	if w.Code != http.StatusForbidden {
 		t.Errorf("Expected status 403, got %d", w.Code)
@@ -94,7 +99,7 @@ func TestWithIPCheck_InvalidIPFormat(t *testing.T) {
 	handler := middleware(testHandler)
 
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
-	req.Header.Set("X-Real-IP", "not-an-ip")
+	req.RemoteAddr = "not-an-ip:1234"
 	w := httptest.NewRecorder()
 
 	handler.ServeHTTP(w, req)
@@ -127,7 +132,7 @@ func TestWithIPCheck_IPInSubnet(t *testing.T) {
 	for _, ip := range testCases {
 		t.Run(ip, func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/test", nil)
-			req.Header.Set("X-Real-IP", ip)
+			req.RemoteAddr = net.JoinHostPort(ip, "1234")
 			w := httptest.NewRecorder()
 
 			handler.ServeHTTP(w, req)
@@ -161,7 +166,7 @@ func TestWithIPCheck_IPNotInSubnet(t *testing.T) {
 	for _, ip := range testCases {
 		t.Run(ip, func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/test", nil)
-			req.Header.Set("X-Real-IP", ip)
+			req.RemoteAddr = net.JoinHostPort(ip, "1234")
 			w := httptest.NewRecorder()
 
 			handler.ServeHTTP(w, req)
@@ -186,7 +191,7 @@ func TestWithIPCheck_SubnetBoundaries(t *testing.T) {
 	handler := middleware(testHandler)
 
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
-	req.Header.Set("X-Real-IP", "192.168.1.10")
+	req.RemoteAddr = "192.168.1.10:1234"
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 
@@ -195,7 +200,7 @@ func TestWithIPCheck_SubnetBoundaries(t *testing.T) {
 	}
 
 	req = httptest.NewRequest(http.MethodGet, "/test", nil)
-	req.Header.Set("X-Real-IP", "192.168.1.11")
+	req.RemoteAddr = "192.168.1.11:1234"
 	w = httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 
@@ -217,7 +222,7 @@ func TestWithIPCheck_IPv6(t *testing.T) {
 	handler := middleware(testHandler)
 
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
-	req.Header.Set("X-Real-IP", "2001:db8::1")
+	req.RemoteAddr = "[2001:db8::1]:1234"
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 
@@ -226,7 +231,7 @@ func TestWithIPCheck_IPv6(t *testing.T) {
 	}
 
 	req = httptest.NewRequest(http.MethodGet, "/test", nil)
-	req.Header.Set("X-Real-IP", "2001:db9::1")
+	req.RemoteAddr = "[2001:db9::1]:1234"
 	w = httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 
@@ -234,3 +239,79 @@ func TestWithIPCheck_IPv6(t *testing.T) {
 		t.Errorf("IPv6 not in subnet should be rejected, got status %d", w.Code)
 	}
 }
+
+func TestWithIPCheck_MultipleSubnets(t *testing.T) {
+	middleware, err := WithIPCheck("192.168.1.0/24, 10.0.0.0/8,2001:db8::/32")
+	if err != nil {
+		t.Fatalf("WithIPCheck returned error: %v", err)
+	}
+
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := map[string]int{
+		"192.168.1.7:1234":   http.StatusOK,
+		"10.20.30.40:1234":   http.StatusOK,
+		"[2001:db8::7]:1234": http.StatusOK,
+		"172.16.0.1:1234":    http.StatusForbidden,
+		"[2001:db9::7]:1234": http.StatusForbidden,
+	}
+
+	for remoteAddr, want := range testCases {
+		t.Run(remoteAddr, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = remoteAddr
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != want {
+				t.Errorf("Expected status %d, got %d", want, w.Code)
+			}
+		})
+	}
+}
+
+func TestWithIPCheck_TrustedProxy(t *testing.T) {
+	proxies, err := clientip.ParseCIDRs("172.16.0.0/12")
+	if err != nil {
+		t.Fatalf("ParseCIDRs returned error: %v", err)
+	}
+
+	middleware, err := WithIPCheck("192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("WithIPCheck returned error: %v", err)
+	}
+
+	handler := WithClientIP(clientip.NewResolver(proxies))(middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	testCases := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         int
+	}{
+		{name: "client behind proxy", remoteAddr: "172.16.0.2:1234", forwardedFor: "192.168.1.5", want: http.StatusOK},
+		{name: "client behind two proxies", remoteAddr: "172.16.0.2:1234", forwardedFor: "192.168.1.5, 172.16.0.3", want: http.StatusOK},
+		{name: "spoofed leftmost entry", remoteAddr: "172.16.0.2:1234", forwardedFor: "192.168.1.5, 8.8.8.8", want: http.StatusForbidden},
+		{name: "untrusted peer", remoteAddr: "8.8.8.8:1234", forwardedFor: "192.168.1.5", want: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.want {
+				t.Errorf("Expected status %d, got %d", tc.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/koyif/metrics/internal/handler"
+)
+
+// WithProblemDetails creates middleware that makes requests under the path prefix
+// report errors as RFC 7807 problem details. It must run before any middleware that
+// can reject the request, so those rejections are reported the same way.
+func WithProblemDetails(prefix string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == strings.TrimSuffix(prefix, "/") || strings.HasPrefix(r.URL.Path, prefix) {
+				r = r.WithContext(handler.NewProblemContext(r.Context()))
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/auth"
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/pkg/dto"
+)
+
+func TestWithProblemDetails(t *testing.T) {
+	authenticator, err := auth.New([]auth.TokenConfig{
+		{Name: "reader", Token: "read-token", Scopes: []string{auth.ScopeRead}},
+	})
+	require.NoError(t, err)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := WithProblemDetails("/api/v2/")(WithAuth(authenticator, auth.ScopeWrite)(next))
+
+	t.Run("v2 rejections are problem details", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v2/metrics", nil))
+
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, handler.ProblemContentType, rec.Header().Get("Content-Type"))
+
+		var p dto.Problem
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+		assert.Equal(t, handler.CodeUnauthorized, p.Code)
+		assert.Equal(t, http.StatusUnauthorized, p.Status)
+		assert.Equal(t, "Unauthorized", p.Title)
+		assert.Equal(t, "urn:metrics:problem:unauthorized", p.Type)
+		assert.Equal(t, "/api/v2/metrics", p.Instance)
+	})
+
+	t.Run("legacy rejections stay plain text", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/updates/", nil))
+
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "Unauthorized\n", rec.Body.String())
+	})
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/koyif/metrics/internal/handler"
+	"github.com/koyif/metrics/internal/ratelimit"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+type rateLimiter interface {
+	Allow(clientIP string) (bool, time.Duration)
+}
+
+// WithRateLimit creates middleware that applies a per-client token bucket.
+// Requests over the limit are rejected with 429 and a Retry-After header
+// telling the client how many seconds to wait before the next attempt.
+func WithRateLimit(limiter rateLimiter) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clientIP := handler.ClientIP(r)
+
+			allowed, wait := limiter.Allow(clientIP)
+			if !allowed {
+				retryAfter := ratelimit.RetryAfterSeconds(wait)
+				logger.Log.Warn(
+					"rate limit exceeded",
+					logger.String("client", clientIP),
+					logger.String("URI", r.RequestURI),
+					logger.Int("retry_after", retryAfter),
+				)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				handler.Error(w, r, http.StatusTooManyRequests, handler.CodeRateLimited, http.StatusText(http.StatusTooManyRequests))
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
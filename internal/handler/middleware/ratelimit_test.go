@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koyif/metrics/internal/ratelimit"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	limiter := ratelimit.New(0.5, 1, nil)
+
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := WithRateLimit(limiter)(testHandler)
+
+	send := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("192.168.1.1"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	w := send("192.168.1.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+
+	if w := send("192.168.1.2"); w.Code != http.StatusOK {
+		t.Errorf("Other clients must not be limited, got status %d", w.Code)
+	}
+}
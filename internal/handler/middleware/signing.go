@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/koyif/metrics/pkg/crypto"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// bufferingResponseWriter holds the response back until the handler returns,
+// so headers depending on the whole body can still be set.
+type bufferingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+	streaming  bool
+}
+
+func (rw *bufferingResponseWriter) Write(b []byte) (int, error) {
+	if rw.streaming {
+		return rw.ResponseWriter.Write(b)
+	}
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusOK
+	}
+	return rw.body.Write(b)
+}
+
+func (rw *bufferingResponseWriter) WriteHeader(statusCode int) {
+	if rw.statusCode == 0 {
+		rw.statusCode = statusCode
+	}
+}
+
+// Flush switches the writer to pass-through. A streamed response has no end to sign,
+// so it is sent without a signature.
+func (rw *bufferingResponseWriter) Flush() {
+	if !rw.streaming {
+		rw.streaming = true
+		if rw.statusCode == 0 {
+			rw.statusCode = http.StatusOK
+		}
+		rw.ResponseWriter.WriteHeader(rw.statusCode)
+		if _, err := rw.ResponseWriter.Write(rw.body.Bytes()); err != nil {
+			logger.Log.Debug("failed to write streamed response", logger.Error(err))
+		}
+		rw.body.Reset()
+	}
+
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// WithResponseSigning creates middleware that signs response bodies with HMAC-SHA256
+// under hashKey and sends the signature in the HashSHA256 header, so clients sharing
+// the key can check the response was not altered on the way.
+// The signature covers the uncompressed body. Responses that are flushed while
+// being written, such as event streams, are passed through unsigned.
+func WithResponseSigning(hashKey string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bw := &bufferingResponseWriter{ResponseWriter: w}
+			h.ServeHTTP(bw, r)
+			if bw.streaming {
+				return
+			}
+
+			if bw.statusCode == 0 {
+				bw.statusCode = http.StatusOK
+			}
+
+			body := bw.body.Bytes()
+			w.Header().Set(crypto.HashHeader, crypto.Sign(hashKey, body))
+			w.WriteHeader(bw.statusCode)
+			if _, err := w.Write(body); err != nil {
+				logger.Log.Debug("failed to write signed response", logger.Error(err))
+			}
+		})
+	}
+}
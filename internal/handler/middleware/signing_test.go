@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+func TestWithResponseSigning(t *testing.T) {
+	handler := WithResponseSigning("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"accepted":`))
+		_, _ = w.Write([]byte(`[]}`))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/updates/", nil))
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, `{"accepted":[]}`, rec.Body.String())
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.True(t, crypto.Verify("secret", rec.Body.Bytes(), rec.Header().Get(crypto.HashHeader)))
+}
+
+func TestWithResponseSigning_EmptyBody(t *testing.T) {
+	handler := WithResponseSigning("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/updates/", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, crypto.Sign("secret", nil), rec.Header().Get(crypto.HashHeader))
+}
+
+func TestWithResponseSigning_StreamingPassesThrough(t *testing.T) {
+	handler := WithResponseSigning("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(crypto.HashHeader))
+}
@@ -1,46 +1,260 @@
 package middleware
 
 import (
+	"bytes"
 	"compress/gzip"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/koyif/metrics/pkg/logger"
+	"github.com/koyif/metrics/pkg/pool"
 )
 
-type gzipWriter struct {
+// gzipMinSize is the smallest response worth compressing; below it the gzip
+// header and trailer outweigh the savings.
+const gzipMinSize = 1024
+
+// gzipContentTypes lists the media types that are compressed. Everything else,
+// such as images, archives and octet streams, is passed through.
+var gzipContentTypes = map[string]bool{
+	"application/json":         true,
+	"application/problem+json": true,
+	"application/javascript":   true,
+	"application/xml":          true,
+	"image/svg+xml":            true,
+	"text/css":                 true,
+	"text/csv":                 true,
+	"text/html":                true,
+	"text/javascript":          true,
+	"text/plain":               true,
+	"text/xml":                 true,
+}
+
+// pooledGzipWriter adapts gzip.Writer to pool.Resetter.
+type pooledGzipWriter struct {
+	*gzip.Writer
+}
+
+func (w *pooledGzipWriter) Reset() {
+	w.Writer.Reset(io.Discard)
+}
+
+var gzipWriters = pool.New(func() *pooledGzipWriter {
+	gz, _ := gzip.NewWriterLevel(io.Discard, gzip.BestSpeed)
+	return &pooledGzipWriter{Writer: gz}
+})
+
+// gzipResponseWriter buffers the beginning of the response until it knows whether
+// compression pays off: the status allows a body, the content type is compressible,
+// and at least gzipMinSize bytes are written or the handler finishes.
+type gzipResponseWriter struct {
 	http.ResponseWriter
-	Writer io.Writer
+	statusCode  int
+	buf         bytes.Buffer
+	decided     bool
+	gz          *pooledGzipWriter
+	wroteHeader bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader || w.statusCode != 0 {
+		return
+	}
+	// Informational responses are sent right away and don't start the real response.
+	if statusCode >= 100 && statusCode < 200 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.statusCode = statusCode
+	if !bodyAllowed(statusCode) {
+		w.decide(false)
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+
+	if !w.decided {
+		w.buf.Write(b)
+		if w.buf.Len() >= gzipMinSize {
+			if err := w.flushBuffer(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client, so streaming handlers keep working.
+// A response flushed before reaching gzipMinSize is compressed only if it is
+// already known to be compressible, since the final size can't be predicted.
+func (w *gzipResponseWriter) Flush() {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if !w.decided {
+		if err := w.flushBuffer(true); err != nil {
+			logger.Log.Debug("error flushing response", logger.Error(err))
+			return
+		}
+	}
+	if w.gz != nil {
+		if err := w.gz.Flush(); err != nil {
+			logger.Log.Debug("error flushing gzip writer", logger.Error(err))
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close finishes the response once the handler returns.
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		if w.statusCode == 0 && w.buf.Len() == 0 {
+			// The handler wrote nothing; let net/http send its default response.
+			return
+		}
+		if err := w.flushBuffer(w.buf.Len() >= gzipMinSize); err != nil {
+			logger.Log.Debug("error writing response", logger.Error(err))
+		}
+	}
+
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			logger.Log.Warn("error closing gzip.Writer", logger.Error(err))
+		}
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// flushBuffer makes the compression decision and writes out what has been buffered.
+func (w *gzipResponseWriter) flushBuffer(largeEnough bool) error {
+	h := w.Header()
+	if h.Get("Content-Type") == "" && w.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+
+	w.decide(largeEnough && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")))
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	data := w.buf.Bytes()
+	w.buf.Reset()
+
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(data)
+	} else {
+		_, err = w.ResponseWriter.Write(data)
+	}
+	return err
 }
 
-func (w gzipWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+func (w *gzipResponseWriter) decide(compress bool) {
+	w.decided = true
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzipWriters.Get()
+		w.gz.Writer.Reset(w.ResponseWriter)
+	}
+
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(w.statusCode)
 }
 
+// WithGzip compresses responses for clients that accept gzip. Only responses with
+// a compressible content type and at least gzipMinSize bytes of body are compressed;
+// responses without a body (204, 304, HEAD) and responses that already carry a
+// Content-Encoding are left alone. Vary: Accept-Encoding is always set, so caches
+// keep the compressed and plain variants apart.
 func WithGzip(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		gz, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
-		if err != nil {
-			_, err := io.WriteString(w, err.Error())
-			if err != nil {
-				return
-			}
-			return
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip parses Accept-Encoding with its q-values. gzip is acceptable when it
+// is listed with a non-zero weight, or when it isn't listed and "*" has a non-zero weight.
+func acceptsGzip(header string) bool {
+	gzipQ, wildcardQ := -1.0, -1.0
+
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
 		}
-		defer func(gz *gzip.Writer) {
-			err := gz.Close()
-			if err != nil {
-				logger.Log.Warn("error closing gzip.Writer")
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
 			}
-		}(gz)
+			q = parsed
+		}
 
-		w.Header().Set("Content-Encoding", "gzip")
-		next.ServeHTTP(gzipWriter{ResponseWriter: w, Writer: gz}, r)
-	})
+		switch coding {
+		case "gzip", "x-gzip":
+			gzipQ = max(gzipQ, q)
+		case "*":
+			wildcardQ = q
+		}
+	}
+
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return wildcardQ > 0
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return gzipContentTypes[mediaType]
+}
+
+func bodyAllowed(statusCode int) bool {
+	return statusCode != http.StatusNoContent && statusCode != http.StatusNotModified
 }
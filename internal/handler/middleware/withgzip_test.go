@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                       false,
+		"gzip":                   true,
+		"GZIP":                   true,
+		"deflate, gzip;q=0.5":    true,
+		"gzip;q=0":               false,
+		"gzip; q=0.000":          false,
+		"br, *":                  true,
+		"*;q=0":                  false,
+		"*, gzip;q=0":            false,
+		"x-gzip":                 true,
+		"identity":               false,
+		"notgzip":                false,
+		"gzip;q=invalid, br":     false,
+		"gzip;level=1;q=1, br":   true,
+		"deflate;q=1, *;q=0.001": true,
+	}
+
+	for header, want := range tests {
+		assert.Equal(t, want, acceptsGzip(header), "Accept-Encoding: %q", header)
+	}
+}
+
+func serveGzip(t *testing.T, h http.HandlerFunc, acceptEncoding string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	WithGzip(h).ServeHTTP(rec, req)
+
+	return rec
+}
+
+func gunzip(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	r, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+func TestWithGzip_CompressesLargeCompressibleResponses(t *testing.T) {
+	body := strings.Repeat(`{"id":"Alloc"}`, 200)
+	rec := serveGzip(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(body[:100]))
+		_, _ = w.Write([]byte(body[100:]))
+	}, "gzip")
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	assert.Equal(t, body, gunzip(t, rec))
+}
+
+func TestWithGzip_PassesThrough(t *testing.T) {
+	large := strings.Repeat("a", 2*gzipMinSize)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		wantBody       string
+	}{
+		{
+			name:           "client does not accept gzip",
+			acceptEncoding: "br",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write([]byte(large))
+			},
+			wantBody: large,
+		},
+		{
+			name:           "small response",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{}`))
+			},
+			wantBody: `{}`,
+		},
+		{
+			name:           "binary content type",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/octet-stream")
+				_, _ = w.Write([]byte(large))
+			},
+			wantBody: large,
+		},
+		{
+			name:           "already encoded",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", "br")
+				_, _ = w.Write([]byte(large))
+			},
+			wantBody: large,
+		},
+		{
+			name:           "no content",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveGzip(t, tt.handler, tt.acceptEncoding)
+
+			assert.NotEqual(t, "gzip", rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			assert.Equal(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
+
+func TestWithGzip_Flush(t *testing.T) {
+	rec := serveGzip(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		assert.Equal(t, "data: 1\n\n", w.(interface{ Unwrap() http.ResponseWriter }).Unwrap().(*httptest.ResponseRecorder).Body.String(),
+			"flushed data must reach the client before the handler returns")
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	}, "gzip")
+
+	assert.True(t, rec.Flushed)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", rec.Body.String())
+
+	rec = serveGzip(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("second"))
+	}, "gzip")
+
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "first second", gunzip(t, rec))
+}
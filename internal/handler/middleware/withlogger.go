@@ -30,6 +30,18 @@ func (lrw *loggingResponseWriter) WriteHeader(statusCode int) {
 	lrw.responseData.status = statusCode
 }
 
+// Flush passes flushes through, so streaming handlers work behind the logger.
+func (lrw *loggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 func WithLogger(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
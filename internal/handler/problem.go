@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/koyif/metrics/pkg/dto"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the error code to form the problem type URI.
+const problemTypePrefix = "urn:metrics:problem:"
+
+// Error codes reported in problem details. They are part of the API and must stay stable;
+// clients should branch on the code rather than on the status or the detail text.
+const (
+	CodeInvalidJSON           = "invalid_json"
+	CodeInvalidParameter      = "invalid_parameter"
+	CodeInvalidBody           = "invalid_body"
+	CodeEmptyBatch            = "empty_batch"
+	CodeValidationFailed      = "validation_failed"
+	CodeUnknownType           = "unknown_type"
+	CodeMetricNotFound        = "metric_not_found"
+	CodeNotFound              = "not_found"
+	CodeMethodNotAllowed      = "method_not_allowed"
+	CodeUnauthorized          = "unauthorized"
+	CodeForbidden             = "forbidden"
+	CodeMetricForbidden       = "metric_forbidden"
+	CodeSeriesQuotaExceeded   = "series_quota_exceeded"
+	CodeRateLimited           = "rate_limited"
+	CodeInvalidIdempotencyKey = "invalid_idempotency_key"
+	CodeIdempotencyConflict   = "idempotency_conflict"
+	CodeInvalidSignature      = "invalid_signature"
+	CodeReplayRejected        = "replay_rejected"
+	CodeUnsupportedEncoding   = "unsupported_encoding"
+	CodeBodyTooLarge          = "body_too_large"
+	CodeUnavailable           = "unavailable"
+	CodeStorageError          = "storage_error"
+	CodeInternalError         = "internal_error"
+)
+
+type problemKey struct{}
+
+// NewProblemContext returns a context whose request reports errors as problem details.
+func NewProblemContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, problemKey{}, true)
+}
+
+// WantsProblem reports whether errors of the request are reported as problem details.
+func WantsProblem(r *http.Request) bool {
+	v, _ := r.Context().Value(problemKey{}).(bool)
+	return v
+}
+
+// Error reports a failure in the format of the request's API: problem details with
+// the code for requests marked by NewProblemContext, and the plain-text message the
+// legacy routes have always returned otherwise.
+func Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if WantsProblem(r) {
+		Problem(w, r, status, code, message)
+		return
+	}
+
+	http.Error(w, message, status)
+}
+
+// Problem responds with problem details for the status and error code.
+func Problem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	WriteProblem(w, r, dto.Problem{
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	})
+}
+
+// WriteProblem responds with the problem details. Type, Title and Instance
+// are filled in from the code, the status and the request when left empty.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p dto.Problem) {
+	if p.Type == "" {
+		p.Type = problemTypePrefix + p.Code
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ProblemContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		logger.Log.Warn("failed to encode problem details", logger.Error(err))
+	}
+}
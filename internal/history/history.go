@@ -0,0 +1,222 @@
+// Package history keeps a short in-memory history of every metric.
+//
+// Each series is a fixed-size ring buffer of samples. Gauges record their value,
+// counters record their running total, so consecutive samples can be compared
+// directly. The history is fed with stored updates through Publish and is lost
+// on restart.
+package history
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const (
+	// DefaultCapacity is the number of samples kept per series.
+	DefaultCapacity = 60
+	// DefaultMaxSeries limits the number of tracked series.
+	DefaultMaxSeries = 10000
+)
+
+// Sample is the value of a series at a point in time.
+type Sample struct {
+	Timestamp time.Time `json:"t"`
+	Value     float64   `json:"v"`
+}
+
+// Series is a snapshot of the history of one metric, oldest sample first.
+type Series struct {
+	ID      string    `json:"id"`
+	MType   string    `json:"type"`
+	Updated time.Time `json:"updated_at"`
+	Samples []Sample  `json:"samples"`
+}
+
+type key struct {
+	mtype string
+	id    string
+}
+
+type ring struct {
+	samples []Sample
+	next    int
+	full    bool
+	total   int64
+}
+
+func (r *ring) add(s Sample) {
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *ring) snapshot() []Sample {
+	if !r.full {
+		return append([]Sample(nil), r.samples[:r.next]...)
+	}
+
+	out := make([]Sample, 0, len(r.samples))
+	out = append(out, r.samples[r.next:]...)
+	return append(out, r.samples[:r.next]...)
+}
+
+func (r *ring) last() (Sample, bool) {
+	if !r.full && r.next == 0 {
+		return Sample{}, false
+	}
+
+	return r.samples[(r.next-1+len(r.samples))%len(r.samples)], true
+}
+
+// Store holds the ring buffers of all tracked series.
+type Store struct {
+	capacity  int
+	maxSeries int
+	now       func() time.Time
+
+	mu       sync.RWMutex
+	series   map[key]*ring
+	warned   bool
+	baseline map[string]int64
+}
+
+// New creates a store keeping capacity samples for up to maxSeries series.
+// Non-positive values fall back to DefaultCapacity and DefaultMaxSeries.
+func New(capacity, maxSeries int) *Store {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	if maxSeries <= 0 {
+		maxSeries = DefaultMaxSeries
+	}
+
+	return &Store{
+		capacity:  capacity,
+		maxSeries: maxSeries,
+		now:       time.Now,
+		series:    make(map[key]*ring),
+		baseline:  make(map[string]int64),
+	}
+}
+
+// Seed sets the counter totals stored before the history started, so the
+// recorded counter samples continue from the stored values. It must be called
+// before the first Publish.
+func (s *Store) Seed(counters map[string]int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, total := range counters {
+		s.baseline[id] = total
+	}
+}
+
+// Publish records stored metrics. It implements the publisher of service.MetricsService.
+func (s *Store) Publish(metrics []models.Metrics) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range metrics {
+		if m.MType != models.Counter && m.MType != models.Gauge {
+			continue
+		}
+
+		k := key{mtype: m.MType, id: m.ID}
+		r, ok := s.series[k]
+		if !ok {
+			if len(s.series) >= s.maxSeries {
+				if !s.warned {
+					s.warned = true
+					logger.Log.Warn("metric history is full, new series are not tracked", logger.Int("max_series", s.maxSeries))
+				}
+				continue
+			}
+			r = &ring{samples: make([]Sample, s.capacity)}
+			if m.MType == models.Counter {
+				r.total = s.baseline[m.ID]
+				delete(s.baseline, m.ID)
+			}
+			s.series[k] = r
+		}
+
+		switch m.MType {
+		case models.Counter:
+			if m.Delta == nil {
+				continue
+			}
+			r.total += *m.Delta
+			r.add(Sample{Timestamp: now, Value: float64(r.total)})
+		case models.Gauge:
+			if m.Value == nil {
+				continue
+			}
+			r.add(Sample{Timestamp: now, Value: *m.Value})
+		}
+	}
+}
+
+// Get returns the history of one metric.
+func (s *Store) Get(mtype, id string) (Series, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k := key{mtype: mtype, id: id}
+	r, ok := s.series[k]
+	if !ok {
+		return Series{}, false
+	}
+
+	return snapshot(k, r), true
+}
+
+// All returns the history of every tracked metric sorted by type and ID.
+func (s *Store) All() []Series {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make([]Series, 0, len(s.series))
+	for k, r := range s.series {
+		all = append(all, snapshot(k, r))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].MType != all[j].MType {
+			return all[i].MType < all[j].MType
+		}
+		return all[i].ID < all[j].ID
+	})
+
+	return all
+}
+
+// Select returns the history of the metrics of the type whose ID matches, sorted by ID.
+func (s *Store) Select(mtype string, match func(id string) bool) []Series {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var selected []Series
+	for k, r := range s.series {
+		if k.mtype == mtype && match(k.id) {
+			selected = append(selected, snapshot(k, r))
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].ID < selected[j].ID })
+
+	return selected
+}
+
+func snapshot(k key, r *ring) Series {
+	series := Series{ID: k.id, MType: k.mtype, Samples: r.snapshot()}
+	if last, ok := r.last(); ok {
+		series.Updated = last.Timestamp
+	}
+
+	return series
+}
@@ -0,0 +1,96 @@
+package history
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+func gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Gauge, Value: &v}
+}
+
+func counter(id string, d int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Counter, Delta: &d}
+}
+
+func values(s Series) []float64 {
+	out := make([]float64, 0, len(s.Samples))
+	for _, sample := range s.Samples {
+		out = append(out, sample.Value)
+	}
+	return out
+}
+
+func TestStore_KeepsLatestSamples(t *testing.T) {
+	store := New(3, 10)
+	now := time.Unix(1000, 0)
+	store.now = func() time.Time { return now }
+
+	for i := 1; i <= 5; i++ {
+		now = now.Add(time.Second)
+		store.Publish([]models.Metrics{gauge("cpu", float64(i))})
+	}
+
+	series, ok := store.Get(models.Gauge, "cpu")
+	require.True(t, ok)
+	assert.Equal(t, []float64{3, 4, 5}, values(series))
+	assert.Equal(t, time.Unix(1005, 0), series.Updated)
+}
+
+func TestStore_CountersRecordRunningTotal(t *testing.T) {
+	store := New(10, 10)
+	store.Seed(map[string]int64{"requests": 100})
+
+	store.Publish([]models.Metrics{counter("requests", 5), counter("requests", 2)})
+	store.Publish([]models.Metrics{counter("fresh", 1)})
+
+	series, ok := store.Get(models.Counter, "requests")
+	require.True(t, ok)
+	assert.Equal(t, []float64{105, 107}, values(series))
+
+	series, ok = store.Get(models.Counter, "fresh")
+	require.True(t, ok)
+	assert.Equal(t, []float64{1}, values(series))
+}
+
+func TestStore_SeparatesTypes(t *testing.T) {
+	store := New(10, 10)
+	store.Publish([]models.Metrics{gauge("x", 1.5), counter("x", 2)})
+
+	all := store.All()
+	require.Len(t, all, 2)
+	assert.Equal(t, models.Counter, all[0].MType)
+	assert.Equal(t, []float64{2}, values(all[0]))
+	assert.Equal(t, models.Gauge, all[1].MType)
+	assert.Equal(t, []float64{1.5}, values(all[1]))
+
+	_, ok := store.Get(models.Gauge, "missing")
+	assert.False(t, ok)
+}
+
+func TestStore_Select(t *testing.T) {
+	store := New(10, 10)
+	store.Publish([]models.Metrics{gauge("http.b", 1), gauge("http.a", 2), counter("http.c", 3), gauge("db", 4)})
+
+	selected := store.Select(models.Gauge, func(id string) bool { return strings.HasPrefix(id, "http.") })
+	require.Len(t, selected, 2)
+	assert.Equal(t, "http.a", selected[0].ID)
+	assert.Equal(t, "http.b", selected[1].ID)
+}
+
+func TestStore_LimitsSeries(t *testing.T) {
+	store := New(10, 2)
+	store.Publish([]models.Metrics{gauge("a", 1), gauge("b", 1), gauge("c", 1), gauge("a", 2)})
+
+	all := store.All()
+	require.Len(t, all, 2)
+	assert.Equal(t, "a", all[0].ID)
+	assert.Equal(t, []float64{1, 2}, values(all[0]))
+	assert.Equal(t, "b", all[1].ID)
+}
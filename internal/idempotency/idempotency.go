@@ -0,0 +1,197 @@
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderName is the HTTP header carrying the idempotency key of a batch.
+	HeaderName = "Idempotency-Key"
+	// MetadataKey is the gRPC metadata key carrying the idempotency key of a batch.
+	MetadataKey = "idempotency-key"
+	// ReplayedHeaderName marks HTTP responses served from the dedup cache.
+	ReplayedHeaderName = "Idempotent-Replayed"
+	// MaxKeyLength limits the size of client supplied keys.
+	MaxKeyLength = 128
+)
+
+const (
+	// DefaultTTL is how long a completed request is remembered.
+	DefaultTTL = 10 * time.Minute
+	// DefaultCapacity is the maximum number of keys kept by the in-memory store.
+	DefaultCapacity = 10000
+)
+
+var (
+	// ErrInProgress is returned by Store.Begin when a request with the same key
+	// is still being processed.
+	ErrInProgress = errors.New("request with the same idempotency key is in progress")
+	// ErrFull is returned by MemoryStore when every key it holds belongs to
+	// a request still being processed.
+	ErrFull = errors.New("idempotency store is full")
+)
+
+// Result is the outcome of a request stored under its idempotency key.
+// For HTTP it holds the response status, content type and body; for gRPC the status
+// is the code, the content type is the full name of the response message and the body
+// is the marshalled message.
+type Result struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Store remembers results of processed requests by idempotency key.
+//
+// Begin reserves the key for the caller. It returns the stored result if the key
+// has already been completed, ErrInProgress if another request holds it, or a nil
+// result if the caller now owns the key and must call either Complete or Abort.
+type Store interface {
+	Begin(ctx context.Context, key string) (*Result, error)
+	Complete(ctx context.Context, key string, result Result) error
+	Abort(ctx context.Context, key string) error
+}
+
+// NewKey generates a random idempotency key.
+func NewKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type entry struct {
+	key     string
+	result  *Result
+	expires time.Time
+	element *list.Element
+}
+
+// MemoryStore is a bounded in-memory Store. Completed keys expire after the TTL,
+// and when the capacity is reached the oldest completed keys are evicted first.
+// Keys of requests still being processed are kept until they expire, so that
+// their replays keep conflicting.
+type MemoryStore struct {
+	ttl      time.Duration
+	capacity int
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	order   *list.List
+}
+
+// NewMemoryStore creates an in-memory store. Non-positive values fall back to the defaults.
+func NewMemoryStore(ttl time.Duration, capacity int) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+
+	return &MemoryStore{
+		ttl:      ttl,
+		capacity: capacity,
+		now:      time.Now,
+		entries:  make(map[string]*entry),
+		order:    list.New(),
+	}
+}
+
+// Begin implements Store.
+func (s *MemoryStore) Begin(_ context.Context, key string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if e, ok := s.entries[key]; ok {
+		if now.Before(e.expires) {
+			if e.result == nil {
+				return nil, ErrInProgress
+			}
+			return e.result, nil
+		}
+		s.remove(e)
+	}
+
+	if err := s.evict(now); err != nil {
+		return nil, err
+	}
+
+	// A pending key expires too, so a crashed request does not block its key forever.
+	e := &entry{key: key, expires: now.Add(s.ttl)}
+	e.element = s.order.PushBack(e)
+	s.entries[key] = e
+
+	return nil, nil
+}
+
+// Complete implements Store.
+func (s *MemoryStore) Complete(_ context.Context, key string, result Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	e, ok := s.entries[key]
+	if !ok {
+		// The reservation expired while the request was running.
+		if err := s.evict(now); err != nil {
+			return err
+		}
+		e = &entry{key: key}
+		e.element = s.order.PushBack(e)
+		s.entries[key] = e
+	}
+	e.result = &result
+	e.expires = now.Add(s.ttl)
+
+	return nil
+}
+
+// Abort implements Store.
+func (s *MemoryStore) Abort(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.result == nil {
+		s.remove(e)
+	}
+
+	return nil
+}
+
+// Len returns the number of keys currently held.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+// evict makes room for a new key by removing the oldest completed or expired
+// keys.
+func (s *MemoryStore) evict(now time.Time) error {
+	for el := s.order.Front(); el != nil && s.order.Len() >= s.capacity; {
+		e := el.Value.(*entry)
+		el = el.Next()
+		if e.result != nil || !now.Before(e.expires) {
+			s.remove(e)
+		}
+	}
+	if s.order.Len() >= s.capacity {
+		return ErrFull
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) remove(e *entry) {
+	s.order.Remove(e.element)
+	delete(s.entries, e.key)
+}
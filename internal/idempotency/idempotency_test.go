@@ -0,0 +1,95 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute, 10)
+
+	result, err := store.Begin(ctx, "key")
+	require.NoError(t, err)
+	assert.Nil(t, result, "first request owns the key")
+
+	_, err = store.Begin(ctx, "key")
+	assert.ErrorIs(t, err, ErrInProgress)
+
+	require.NoError(t, store.Complete(ctx, "key", Result{StatusCode: 200, Body: []byte("ok")}))
+
+	result, err = store.Begin(ctx, "key")
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, []byte("ok"), result.Body)
+}
+
+func TestMemoryStore_AbortReleasesKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute, 10)
+
+	_, err := store.Begin(ctx, "key")
+	require.NoError(t, err)
+	require.NoError(t, store.Abort(ctx, "key"))
+
+	result, err := store.Begin(ctx, "key")
+	require.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestMemoryStore_Expiration(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryStore(time.Minute, 10)
+	store.now = func() time.Time { return now }
+
+	_, err := store.Begin(ctx, "key")
+	require.NoError(t, err)
+	require.NoError(t, store.Complete(ctx, "key", Result{StatusCode: 200}))
+
+	now = now.Add(2 * time.Minute)
+	result, err := store.Begin(ctx, "key")
+	require.NoError(t, err)
+	assert.Nil(t, result, "expired key must be processed again")
+}
+
+func TestMemoryStore_EvictsOldestWhenFull(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute, 2)
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := store.Begin(ctx, key)
+		require.NoError(t, err)
+		require.NoError(t, store.Complete(ctx, key, Result{StatusCode: 200}))
+	}
+
+	assert.Equal(t, 2, store.Len())
+
+	result, err := store.Begin(ctx, "a")
+	require.NoError(t, err)
+	assert.Nil(t, result, "oldest key must have been evicted")
+}
+
+func TestMemoryStore_KeepsRunningRequestsWhenFull(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute, 2)
+
+	_, err := store.Begin(ctx, "running")
+	require.NoError(t, err)
+	_, err = store.Begin(ctx, "done")
+	require.NoError(t, err)
+	require.NoError(t, store.Complete(ctx, "done", Result{StatusCode: 200}))
+
+	_, err = store.Begin(ctx, "new")
+	require.NoError(t, err)
+	_, err = store.Begin(ctx, "running")
+	assert.ErrorIs(t, err, ErrInProgress, "a running request is not evicted")
+
+	_, err = store.Begin(ctx, "another")
+	assert.ErrorIs(t, err, ErrFull)
+}
@@ -0,0 +1,159 @@
+package influx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/koyif/metrics/internal/cumulative"
+	"github.com/koyif/metrics/internal/models"
+)
+
+// Tag modes: how tags become part of the metric ID.
+const (
+	TagsAsLabels = "labels"
+	TagsInName   = "name"
+)
+
+// Options configure a Converter.
+type Options struct {
+	// TagMode is TagsAsLabels or TagsInName.
+	TagMode string
+	// CounterSuffixes mark metrics whose name ends with any of them as counters.
+	CounterSuffixes []string
+}
+
+// ParseOptions validates the tag mode and parses the comma-separated counter suffixes.
+func ParseOptions(tagMode, counterSuffixes string) (Options, error) {
+	opts := Options{TagMode: tagMode}
+	switch tagMode {
+	case "":
+		opts.TagMode = TagsAsLabels
+	case TagsAsLabels, TagsInName:
+	default:
+		return Options{}, fmt.Errorf("invalid influx tag mode %q: expected %s or %s", tagMode, TagsAsLabels, TagsInName)
+	}
+
+	for _, suffix := range strings.Split(counterSuffixes, ",") {
+		if suffix = strings.TrimSpace(suffix); suffix != "" {
+			opts.CounterSuffixes = append(opts.CounterSuffixes, suffix)
+		}
+	}
+
+	return opts, nil
+}
+
+// Result is the outcome of converting a batch of points.
+type Result struct {
+	// Metrics holds one metric per series of the batch.
+	Metrics []models.Metrics
+	// Skipped counts the string fields.
+	Skipped int
+}
+
+// Converter turns points into metrics, tracking counter totals with a
+// cumulative.Tracker. It is safe for concurrent use.
+type Converter struct {
+	opts   Options
+	totals *cumulative.Tracker
+}
+
+// NewConverter creates a converter.
+func NewConverter(opts Options, totals *cumulative.Tracker) *Converter {
+	return &Converter{
+		opts:   opts,
+		totals: totals,
+	}
+}
+
+// Convert maps every series of the batch to a metric: the last value for gauges
+// and the increase since the previous total for counters. Points are taken in
+// the order they were sent.
+// Counter totals are advanced right away; call Forget for counters that end up
+// not being stored.
+func (c *Converter) Convert(points []Point) (Result, error) {
+	type series struct {
+		mtype  string
+		values []float64
+	}
+
+	var result Result
+	order := make([]string, 0)
+	batch := make(map[string]*series)
+	for _, p := range points {
+		result.Skipped += p.Skipped
+		for _, f := range p.Fields {
+			name := p.Measurement + "_" + f.Key
+			id := c.id(name, p.Tags)
+
+			s, ok := batch[id]
+			if !ok {
+				s = &series{mtype: c.metricType(name)}
+				batch[id] = s
+				order = append(order, id)
+			}
+			s.values = append(s.values, f.Value)
+		}
+	}
+
+	result.Metrics = make([]models.Metrics, 0, len(order))
+	for _, id := range order {
+		s := batch[id]
+		if s.mtype == models.Gauge {
+			value := s.values[len(s.values)-1]
+			result.Metrics = append(result.Metrics, models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+			continue
+		}
+
+		delta, err := c.totals.Advance(id, s.values...)
+		if err != nil {
+			// Nothing of the batch is stored, so neither are the totals.
+			for _, m := range result.Metrics {
+				if m.MType == models.Counter {
+					c.totals.Forget(m.ID)
+				}
+			}
+			return Result{}, err
+		}
+		result.Metrics = append(result.Metrics, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+	}
+
+	return result, nil
+}
+
+// Forget discards the totals of the counters, so their next points continue
+// from the stored values again.
+func (c *Converter) Forget(ids ...string) {
+	c.totals.Forget(ids...)
+}
+
+func (c *Converter) metricType(name string) string {
+	for _, suffix := range c.opts.CounterSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return models.Counter
+		}
+	}
+
+	return models.Gauge
+}
+
+func (c *Converter) id(name string, tags []models.Label) string {
+	if c.opts.TagMode == TagsAsLabels {
+		return models.LabeledName(name, tags)
+	}
+
+	sorted := make([]models.Label, len(tags))
+	copy(sorted, tags)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, tag := range sorted {
+		b.WriteByte(';')
+		b.WriteString(tag.Name)
+		b.WriteByte('=')
+		b.WriteString(tag.Value)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/cumulative"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/repository/dberror"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse(`cpu,host=web\ 1,cpu=cpu0 usage_idle=97.5,usage_user=2i,up=true,note="a, b=c d" 1700000000000000000`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "cpu", p.Measurement)
+	assert.Equal(t, []models.Label{{Name: "host", Value: "web 1"}, {Name: "cpu", Value: "cpu0"}}, p.Tags)
+	assert.Equal(t, []Field{{Key: "usage_idle", Value: 97.5}, {Key: "usage_user", Value: 2}, {Key: "up", Value: 1}}, p.Fields)
+	assert.Equal(t, 1, p.Skipped)
+
+	p, err = Parse(`disk\,io free=12u`)
+	require.NoError(t, err)
+	assert.Equal(t, "disk,io", p.Measurement)
+	assert.Empty(t, p.Tags)
+	assert.Equal(t, []Field{{Key: "free", Value: 12}}, p.Fields)
+
+	for _, line := range []string{
+		"cpu",
+		"cpu usage",
+		"cpu,host usage=1",
+		"cpu usage=abc",
+		"cpu usage=1x2i",
+		`cpu note="unterminated`,
+		"cpu usage=1 notatime",
+		"cpu usage=1 1 extra",
+		" usage=1",
+	} {
+		_, err := Parse(line)
+		assert.Error(t, err, line)
+	}
+}
+
+type storedCounters map[string]int64
+
+func (s storedCounters) Counter(name string) (int64, error) {
+	if v, ok := s[name]; ok {
+		return v, nil
+	}
+	return 0, dberror.ErrValueNotFound
+}
+
+func parseAll(t *testing.T, lines ...string) []Point {
+	t.Helper()
+	points := make([]Point, 0, len(lines))
+	for _, line := range lines {
+		p, err := Parse(line)
+		require.NoError(t, err, line)
+		points = append(points, p)
+	}
+	return points
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions("", " _total, ,bytes_recv")
+	require.NoError(t, err)
+	assert.Equal(t, TagsAsLabels, opts.TagMode)
+	assert.Equal(t, []string{"_total", "bytes_recv"}, opts.CounterSuffixes)
+
+	_, err = ParseOptions("fold", "")
+	assert.Error(t, err)
+}
+
+func TestConverter(t *testing.T) {
+	opts, err := ParseOptions(TagsAsLabels, "_total,bytes_recv")
+	require.NoError(t, err)
+	c := NewConverter(opts, cumulative.NewTracker(storedCounters{}))
+
+	result, err := c.Convert(parseAll(t,
+		"net,iface=eth0 bytes_recv=100i,speed=1000",
+		"net,iface=eth0 bytes_recv=150i,speed=100",
+		`net,iface=eth0 note="x"`,
+	))
+	require.NoError(t, err)
+	require.Len(t, result.Metrics, 2)
+	assert.Equal(t, 1, result.Skipped)
+
+	assert.Equal(t, `net_bytes_recv{iface="eth0"}`, result.Metrics[0].ID)
+	assert.Equal(t, models.Counter, result.Metrics[0].MType)
+	assert.Equal(t, int64(150), *result.Metrics[0].Delta)
+
+	assert.Equal(t, `net_speed{iface="eth0"}`, result.Metrics[1].ID)
+	assert.Equal(t, models.Gauge, result.Metrics[1].MType)
+	assert.InDelta(t, 100, *result.Metrics[1].Value, 0, "the last value wins")
+
+	result, err = c.Convert(parseAll(t, "net,iface=eth0 bytes_recv=175i"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), *result.Metrics[0].Delta, "counters are stored as the increase of the total")
+}
+
+func TestConverter_TagsInName(t *testing.T) {
+	c := NewConverter(Options{TagMode: TagsInName}, cumulative.NewTracker(storedCounters{}))
+
+	result, err := c.Convert(parseAll(t, "cpu,host=web1,cpu=cpu0 usage_idle=97", "mem free=1"))
+	require.NoError(t, err)
+	require.Len(t, result.Metrics, 2)
+	assert.Equal(t, "cpu_usage_idle;cpu=cpu0;host=web1", result.Metrics[0].ID)
+	assert.Equal(t, "mem_free", result.Metrics[1].ID)
+}
@@ -0,0 +1,146 @@
+// Package influx converts InfluxDB line protocol into metrics.
+//
+// A line has the form measurement[,tag=value...] field=value[,field=value...] [timestamp].
+// Every numeric field becomes one metric named measurement_field, with the tags
+// kept as labels, e.g. cpu_usage_idle{cpu="cpu0",host="web1"}, or folded into
+// the name as Graphite tags, e.g. cpu_usage_idle;cpu=cpu0;host=web1. Fields are
+// gauges unless their name ends with one of the configured counter suffixes;
+// counters arrive as totals and are stored as the increase since the last total.
+// Boolean fields are stored as 0 and 1; string fields are skipped.
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+var errMalformedLine = errors.New("malformed line")
+
+// Field is a numeric field of a point.
+type Field struct {
+	Key   string
+	Value float64
+}
+
+// Point is a parsed line.
+type Point struct {
+	Measurement string
+	Tags        []models.Label
+	Fields      []Field
+	// Skipped counts the string fields, which can't be stored as metrics.
+	Skipped int
+}
+
+// Parse parses a line of the line protocol. Timestamps are validated but not kept:
+// metrics only hold the latest value.
+func Parse(line string) (Point, error) {
+	// Quotes only delimit strings in the field set, so the key is split off first.
+	sections := split(line, ' ', false)
+	sections = append(sections[:1], split(strings.Join(sections[1:], " "), ' ', true)...)
+	if len(sections) < 2 || len(sections) > 3 {
+		return Point{}, fmt.Errorf("%w: expected measurement, fields and optional timestamp", errMalformedLine)
+	}
+
+	var p Point
+	key := split(sections[0], ',', false)
+	p.Measurement = unescape(key[0])
+	if p.Measurement == "" {
+		return Point{}, fmt.Errorf("%w: empty measurement", errMalformedLine)
+	}
+	for _, tag := range key[1:] {
+		parts := split(tag, '=', false)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return Point{}, fmt.Errorf("%w: invalid tag %q", errMalformedLine, tag)
+		}
+		p.Tags = append(p.Tags, models.Label{Name: unescape(parts[0]), Value: unescape(parts[1])})
+	}
+
+	for _, field := range split(sections[1], ',', true) {
+		parts := split(field, '=', true)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return Point{}, fmt.Errorf("%w: invalid field %q", errMalformedLine, field)
+		}
+
+		value, numeric, err := parseFieldValue(parts[1])
+		if err != nil {
+			return Point{}, fmt.Errorf("%w: field %q: %w", errMalformedLine, field, err)
+		}
+		if !numeric {
+			p.Skipped++
+			continue
+		}
+		p.Fields = append(p.Fields, Field{Key: unescape(parts[0]), Value: value})
+	}
+
+	if len(sections) == 3 {
+		if _, err := strconv.ParseInt(sections[2], 10, 64); err != nil {
+			return Point{}, fmt.Errorf("%w: invalid timestamp %q", errMalformedLine, sections[2])
+		}
+	}
+
+	return p, nil
+}
+
+// parseFieldValue parses a field value. Strings are reported as not numeric.
+func parseFieldValue(raw string) (float64, bool, error) {
+	if strings.HasPrefix(raw, `"`) {
+		if len(raw) < 2 || !strings.HasSuffix(raw, `"`) {
+			return 0, false, errors.New("unterminated string")
+		}
+		return 0, false, nil
+	}
+
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	switch raw[len(raw)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		return float64(v), err == nil, err
+	case 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		return float64(v), err == nil, err
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return v, true, nil
+}
+
+// split splits s at sep, skipping separators escaped with a backslash and,
+// when quotes is set, separators within double-quoted strings.
+func split(s string, sep byte, quotes bool) []string {
+	var parts []string
+	start := 0
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+var unescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ", `\\`, `\`)
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
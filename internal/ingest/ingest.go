@@ -0,0 +1,169 @@
+// Package ingest stores metrics received by the protocol listeners. They have
+// no request to answer, so problems are logged instead of reported to the sender.
+package ingest
+
+import (
+	"net"
+	"time"
+
+	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/clientip"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/validation"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+type metricsService interface {
+	Validate(metrics []models.Metrics) error
+	StoreAll(metrics []models.Metrics) error
+	Persist() error
+}
+
+type seriesLimiter interface {
+	ReservePartial(client string, metrics []models.Metrics) ([]models.Metrics, *quota.Reservation, error)
+}
+
+// RateLimiter limits the lines or packets of a sender.
+type RateLimiter interface {
+	Allow(clientIP string) (bool, time.Duration)
+}
+
+// Sink stores the metrics of one listener.
+type Sink struct {
+	client       string
+	service      metricsService
+	auditManager *audit.Manager
+	limiter      seriesLimiter
+	persist      bool
+}
+
+// NewSink creates a sink. The client identifies the listener in audit events,
+// since its metrics mix many senders, and in series quotas of metrics whose
+// sender is unknown. With persist set the
+// storage is saved after every store, as with a zero store interval.
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewSink(client string, service metricsService, auditManager *audit.Manager, limiter seriesLimiter, persist bool) *Sink {
+	return &Sink{
+		client:       client,
+		service:      service,
+		auditManager: auditManager,
+		limiter:      limiter,
+		persist:      persist,
+	}
+}
+
+// Store stores the metrics and returns the ones stored. Metrics rejected by
+// the validation policy or the series quota are dropped. Senders maps metric
+// IDs to the sender that sent them first, whose quota the new series count
+// against.
+func (s *Sink) Store(metrics []models.Metrics, senders map[string]string) []models.Metrics {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	validationErr := s.service.Validate(metrics)
+	valid, _, violations := validation.Partition(metrics, validationErr)
+	for _, v := range violations {
+		logger.Log.Warn(s.client+" metric rejected", logger.String("name", v.ID), logger.String("reason", v.Reason))
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	var reservations []*quota.Reservation
+	if s.limiter != nil {
+		valid, reservations = s.reserve(valid, senders)
+		if len(valid) == 0 {
+			return nil
+		}
+	}
+
+	if err := s.service.StoreAll(valid); err != nil {
+		for _, r := range reservations {
+			r.Release()
+		}
+		logger.Log.Error("failed to store "+s.client+" metrics", logger.Error(err))
+		return nil
+	}
+	for _, r := range reservations {
+		r.Commit()
+	}
+
+	if s.persist {
+		if err := s.service.Persist(); err != nil {
+			logger.Log.Error("failed to persist metrics", logger.Error(err))
+		}
+	}
+
+	if s.auditManager != nil && s.auditManager.IsEnabled() {
+		names := make([]string, 0, len(valid))
+		for _, m := range valid {
+			names = append(names, m.ID)
+		}
+		s.auditManager.NotifyAll(models.AuditEvent{
+			Timestamp: time.Now().Unix(),
+			Metrics:   names,
+			IPAddress: s.client,
+		})
+	}
+
+	return valid
+}
+
+// reserve admits the series of every sender separately. A batch mixes the
+// series of many senders, so one sender over the quota must not keep the
+// others from being stored.
+func (s *Sink) reserve(metrics []models.Metrics, senders map[string]string) ([]models.Metrics, []*quota.Reservation) {
+	var order []string
+	bySender := make(map[string][]models.Metrics)
+	for _, m := range metrics {
+		sender, ok := senders[m.ID]
+		if !ok {
+			sender = s.client
+		}
+		if _, ok := bySender[sender]; !ok {
+			order = append(order, sender)
+		}
+		bySender[sender] = append(bySender[sender], m)
+	}
+
+	admitted := make([]models.Metrics, 0, len(metrics))
+	reservations := make([]*quota.Reservation, 0, len(order))
+	for _, sender := range order {
+		stored, reservation, err := s.limiter.ReservePartial(sender, bySender[sender])
+		if err != nil {
+			logger.Log.Warn(s.client+" new series rejected by series quota", logger.String("sender", sender), logger.Error(err))
+		}
+		admitted = append(admitted, stored...)
+		reservations = append(reservations, reservation)
+	}
+
+	return admitted, reservations
+}
+
+// Sender returns the IP address of the sender, or the address itself if it
+// has no IP.
+func Sender(addr net.Addr) string {
+	if ip := clientip.ParseIP(addr.String()); ip != nil {
+		return ip.String()
+	}
+
+	return addr.String()
+}
+
+// Allowed reports whether the rate limiter lets a line or packet of the
+// sender through; a nil limiter allows everything. The client names the
+// listener in logs.
+func Allowed(client string, limiter RateLimiter, sender string) bool {
+	if limiter == nil {
+		return true
+	}
+	if allowed, _ := limiter.Allow(sender); allowed {
+		return true
+	}
+
+	logger.Log.Debug(client+" sender rate limited", logger.String("remote", sender))
+
+	return false
+}
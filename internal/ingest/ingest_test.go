@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/service"
+)
+
+func counter(id string, delta int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Counter, Delta: &delta}
+}
+
+func TestSink_StoresKnownSeriesOverQuota(t *testing.T) {
+	repo := repository.NewMetricsRepository()
+	svc := service.NewMetricsService(repo, nil, nil, nil)
+	limiter := quota.NewLimiter(quota.Limits{MaxSeries: 1})
+	sink := NewSink("statsd", svc, nil, limiter, false)
+
+	require.Len(t, sink.Store([]models.Metrics{counter("hits", 1)}, nil), 1)
+
+	stored := sink.Store([]models.Metrics{counter("hits", 2), counter("misses", 1)}, nil)
+	assert.Equal(t, []models.Metrics{counter("hits", 2)}, stored, "only the new series is dropped")
+
+	hits, err := repo.Counter("hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), hits)
+	_, err = repo.Counter("misses")
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), limiter.Usage().RejectedByReason[quota.ReasonMaxSeries])
+}
+
+func TestSink_KeepsQuotaPerSender(t *testing.T) {
+	svc := service.NewMetricsService(repository.NewMetricsRepository(), nil, nil, nil)
+	limiter := quota.NewLimiter(quota.Limits{MaxSeriesPerClient: 1})
+	sink := NewSink("statsd", svc, nil, limiter, false)
+
+	metrics := []models.Metrics{counter("a", 1), counter("b", 1), counter("c", 1)}
+	senders := map[string]string{"a": "10.0.0.1", "b": "10.0.0.2", "c": "10.0.0.2"}
+	stored := sink.Store(metrics, senders)
+
+	assert.Equal(t, []models.Metrics{counter("a", 1), counter("b", 1)}, stored, "a sender over its quota keeps only its own series out")
+	usage := limiter.Usage()
+	assert.Equal(t, 2, usage.TotalSeries)
+	assert.Equal(t, int64(1), usage.RejectedByReason[quota.ReasonSeriesPerClient])
+}
+
+type failingStore struct {
+	*service.MetricsService
+}
+
+func (failingStore) StoreAll([]models.Metrics) error {
+	return errors.New("database is down")
+}
+
+func TestSink_ReleasesSeriesWhenStoreFails(t *testing.T) {
+	svc := failingStore{service.NewMetricsService(repository.NewMetricsRepository(), nil, nil, nil)}
+	limiter := quota.NewLimiter(quota.Limits{MaxSeries: 1})
+	sink := NewSink("statsd", svc, nil, limiter, false)
+
+	assert.Empty(t, sink.Store([]models.Metrics{counter("hits", 1)}, nil))
+	assert.Equal(t, 0, limiter.Usage().TotalSeries)
+}
@@ -0,0 +1,144 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/koyif/metrics/internal/clientip"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+// maxLineLength bounds a line received over TCP.
+const maxLineLength = 64 << 10
+
+// LineListener accepts TCP connections of trusted senders and hands every
+// non-empty line they send, trimmed, to a handler along with the sender's
+// IP address. Lines of different connections are handled concurrently.
+type LineListener struct {
+	client   string
+	subnets  []*net.IPNet
+	handle   func(sender, line string)
+	listener net.Listener
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	closed  bool
+	readers sync.WaitGroup
+}
+
+// ListenLines listens on the TCP address and starts accepting connections.
+// The client names the listener in logs. Empty subnets allow every sender.
+func ListenLines(client, addr string, subnets []*net.IPNet, handle func(sender, line string)) (*LineListener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LineListener{
+		client:   client,
+		subnets:  subnets,
+		handle:   handle,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	l.readers.Add(1)
+	go l.acceptConns()
+
+	return l, nil
+}
+
+// Addr returns the address listened on.
+func (l *LineListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Close closes the listener and the connections, and waits until the lines
+// read are handled.
+func (l *LineListener) Close() {
+	if err := l.listener.Close(); err != nil {
+		logger.Log.Warn("failed to close "+l.client+" TCP listener", logger.Error(err))
+	}
+
+	l.mu.Lock()
+	l.closed = true
+	for conn := range l.conns {
+		_ = conn.Close()
+	}
+	l.mu.Unlock()
+
+	l.readers.Wait()
+}
+
+func (l *LineListener) acceptConns() {
+	defer l.readers.Done()
+
+	for {
+		conn, err := l.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logger.Log.Warn("failed to accept "+l.client+" connection", logger.Error(err))
+			continue
+		}
+		if !Trusted(l.client, l.subnets, conn.RemoteAddr()) {
+			_ = conn.Close()
+			continue
+		}
+
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		l.conns[conn] = struct{}{}
+		l.readers.Add(1)
+		l.mu.Unlock()
+
+		go l.readConn(conn)
+	}
+}
+
+func (l *LineListener) readConn(conn net.Conn) {
+	defer l.readers.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	sender := Sender(conn.RemoteAddr())
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineLength)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			l.handle(sender, line)
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		logger.Log.Warn("failed to read "+l.client+" connection", logger.String("remote", conn.RemoteAddr().String()), logger.Error(err))
+	}
+}
+
+// Trusted reports whether the sender is in the subnets; empty subnets trust
+// everyone. The client names the listener in logs.
+func Trusted(client string, subnets []*net.IPNet, addr net.Addr) bool {
+	if len(subnets) == 0 {
+		return true
+	}
+
+	ip := clientip.ParseIP(addr.String())
+	if ip != nil && clientip.Contains(subnets, ip) {
+		return true
+	}
+
+	logger.Log.Debug(client+" sender not in trusted subnet", logger.String("remote", addr.String()))
+
+	return false
+}
@@ -0,0 +1,73 @@
+package ingest
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lineRecorder struct {
+	mu      sync.Mutex
+	lines   []string
+	senders []string
+}
+
+func (r *lineRecorder) handle(sender, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, line)
+	r.senders = append(r.senders, sender)
+}
+
+func (r *lineRecorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.lines...)
+}
+
+func TestLineListener(t *testing.T) {
+	rec := &lineRecorder{}
+	l, err := ListenLines("test", "127.0.0.1:0", nil, rec.handle)
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	_, err = fmt.Fprint(conn, "  one \n\n\ttwo\r\n")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(rec.get()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"one", "two"}, rec.get(), "lines are trimmed and empty ones skipped")
+	rec.mu.Lock()
+	assert.Equal(t, []string{"127.0.0.1", "127.0.0.1"}, rec.senders, "lines come with the sender's IP")
+	rec.mu.Unlock()
+
+	l.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err, "closing the listener closes the connections")
+}
+
+func TestLineListener_UntrustedSender(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	rec := &lineRecorder{}
+	l, err := ListenLines("test", "127.0.0.1:0", []*net.IPNet{subnet}, rec.handle)
+	require.NoError(t, err)
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, _ = fmt.Fprint(conn, "one\n")
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err, "the connection is closed")
+	assert.Empty(t, rec.get())
+}
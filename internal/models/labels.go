@@ -0,0 +1,95 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// Label is a name-value pair identifying a series of a labelled protocol.
+type Label struct {
+	Name  string
+	Value string
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// LabeledName returns the metric ID of a labelled series in the Prometheus
+// exposition format, e.g. http_requests_total{code="200",method="GET"}, with
+// labels sorted by name. Without labels the ID is the name itself.
+func LabeledName(name string, labels []Label) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	sorted := make([]Label, len(labels))
+	copy(sorted, labels)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, l := range sorted {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(l.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// SplitLabeledName is the inverse of LabeledName: it splits a metric ID in the
+// exposition format into the name and labels. IDs without labels, or whose
+// labels can't be parsed, are returned as the name with ok set only for the former.
+func SplitLabeledName(id string) (name string, labels []Label, ok bool) {
+	open := strings.IndexByte(id, '{')
+	if open < 0 {
+		return id, nil, true
+	}
+	if open == 0 || !strings.HasSuffix(id, "}") {
+		return id, nil, false
+	}
+
+	rest := id[open+1 : len(id)-1]
+	for rest != "" {
+		eq := strings.Index(rest, `="`)
+		if eq <= 0 {
+			return id, nil, false
+		}
+		labelName := rest[:eq]
+
+		var value strings.Builder
+		i := eq + 2
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(rest[i])
+				}
+				continue
+			}
+			value.WriteByte(rest[i])
+		}
+		if i == len(rest) {
+			return id, nil, false
+		}
+		labels = append(labels, Label{Name: labelName, Value: value.String()})
+
+		rest = rest[i+1:]
+		if rest != "" {
+			if rest[0] != ',' {
+				return id, nil, false
+			}
+			rest = rest[1:]
+		}
+	}
+
+	return id[:open], labels, true
+}
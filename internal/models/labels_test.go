@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLabeledName(t *testing.T) {
+	labels := []Label{{Name: "path", Value: `C:\tmp "x"` + "\n"}, {Name: "code", Value: "200"}}
+	id := LabeledName("http_requests_total", labels)
+
+	name, got, ok := SplitLabeledName(id)
+	assert.True(t, ok)
+	assert.Equal(t, "http_requests_total", name)
+	assert.Equal(t, []Label{{Name: "code", Value: "200"}, {Name: "path", Value: `C:\tmp "x"` + "\n"}}, got)
+
+	name, got, ok = SplitLabeledName("Alloc")
+	assert.True(t, ok)
+	assert.Equal(t, "Alloc", name)
+	assert.Empty(t, got)
+
+	for _, id := range []string{`x{a="1"`, `{a="1"}`, `x{a=1}`, `x{a="1"b="2"}`, `x{a="1}`} {
+		name, _, ok := SplitLabeledName(id)
+		assert.False(t, ok, id)
+		assert.Equal(t, id, name, id)
+	}
+}
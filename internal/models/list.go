@@ -0,0 +1,68 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MetricRecord is a stored metric together with the time of its last update.
+// UpdatedAt is zero when the storage doesn't know it, e.g. for metrics restored from a file.
+type MetricRecord struct {
+	Metrics
+	UpdatedAt time.Time
+}
+
+// ListPosition identifies a metric in the listing order: by ID, then by type.
+type ListPosition struct {
+	ID    string `json:"id"`
+	MType string `json:"type"`
+}
+
+// ListFilter selects the metrics returned by a listing. Zero fields match everything.
+type ListFilter struct {
+	// MType keeps metrics of this type only.
+	MType string
+	// Prefix keeps metrics whose name starts with it.
+	Prefix string
+	// Regex keeps metrics whose name matches it.
+	Regex *regexp.Regexp
+	// AllowedPrefixes keeps metrics whose name starts with any of them,
+	// e.g. the prefixes the request's token may read.
+	AllowedPrefixes []string
+	// After starts the listing right after the given position.
+	After *ListPosition
+	// Limit caps the number of returned metrics. Zero means no limit.
+	Limit int
+}
+
+// Match reports whether the metric passes every condition of the filter except After and Limit.
+func (f ListFilter) Match(id, mtype string) bool {
+	if f.MType != "" && f.MType != mtype {
+		return false
+	}
+	if !strings.HasPrefix(id, f.Prefix) {
+		return false
+	}
+	if f.Regex != nil && !f.Regex.MatchString(id) {
+		return false
+	}
+	if len(f.AllowedPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range f.AllowedPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Less reports whether the position sorts before other.
+func (p ListPosition) Less(other ListPosition) bool {
+	if p.ID != other.ID {
+		return p.ID < other.ID
+	}
+	return p.MType < other.MType
+}
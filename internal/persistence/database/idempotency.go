@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/koyif/metrics/internal/idempotency"
+	"github.com/koyif/metrics/pkg/errutil"
+)
+
+// purgeInterval limits how often expired idempotency keys are deleted.
+const purgeInterval = time.Minute
+
+// IdempotencyStore keeps idempotency keys in the idempotency_keys table,
+// so that deduplication survives restarts and is shared between server instances.
+// Keys expire after the TTL; expired rows are purged at most once per purgeInterval.
+type IdempotencyStore struct {
+	db        *Database
+	ttl       time.Duration
+	lastPurge atomic.Int64
+}
+
+// NewIdempotencyStore creates a Postgres-backed idempotency store.
+// A non-positive ttl falls back to idempotency.DefaultTTL.
+func NewIdempotencyStore(db *Database, ttl time.Duration) *IdempotencyStore {
+	if ttl <= 0 {
+		ttl = idempotency.DefaultTTL
+	}
+
+	return &IdempotencyStore{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// Begin reserves the key, or returns the stored result if the key was already completed.
+func (s *IdempotencyStore) Begin(ctx context.Context, key string) (*idempotency.Result, error) {
+	reserve := `INSERT INTO idempotency_keys (idempotency_key, expires_at) VALUES ($1, $2)
+		ON CONFLICT (idempotency_key) DO UPDATE
+		SET
+		    status_code = NULL,
+		    content_type = NULL,
+		    body = NULL,
+		    expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < $3
+		RETURNING idempotency_key`
+	lookup := "SELECT status_code, content_type, body FROM idempotency_keys WHERE idempotency_key = $1"
+
+	now := time.Now()
+	var result *idempotency.Result
+	err := errutil.Retry(NewPostgresErrorClassifier(), func() error {
+		result = nil
+
+		var reserved string
+		err := s.db.pool.QueryRow(ctx, reserve, key, now.Add(s.ttl), now).Scan(&reserved)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		var statusCode *int
+		var contentType *string
+		var body []byte
+		if err := s.db.pool.QueryRow(ctx, lookup, key).Scan(&statusCode, &contentType, &body); err != nil {
+			return err
+		}
+		if statusCode == nil {
+			return idempotency.ErrInProgress
+		}
+
+		result = &idempotency.Result{StatusCode: *statusCode, Body: body}
+		if contentType != nil {
+			result.ContentType = *contentType
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Complete stores the result of the request that reserved the key.
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, result idempotency.Result) error {
+	sql := `UPDATE idempotency_keys
+		SET status_code = $2, content_type = $3, body = $4, expires_at = $5
+		WHERE idempotency_key = $1`
+
+	now := time.Now()
+	err := errutil.Retry(NewPostgresErrorClassifier(), func() error {
+		_, err := s.db.pool.Exec(ctx, sql, key, result.StatusCode, result.ContentType, result.Body, now.Add(s.ttl))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.purgeExpired(ctx, now)
+}
+
+// Abort releases a reservation that did not produce a result worth remembering.
+func (s *IdempotencyStore) Abort(ctx context.Context, key string) error {
+	sql := "DELETE FROM idempotency_keys WHERE idempotency_key = $1 AND status_code IS NULL"
+
+	return errutil.Retry(NewPostgresErrorClassifier(), func() error {
+		_, err := s.db.pool.Exec(ctx, sql, key)
+		return err
+	})
+}
+
+func (s *IdempotencyStore) purgeExpired(ctx context.Context, now time.Time) error {
+	last := s.lastPurge.Load()
+	if now.UnixNano()-last < int64(purgeInterval) || !s.lastPurge.CompareAndSwap(last, now.UnixNano()) {
+		return nil
+	}
+
+	_, err := s.db.pool.Exec(ctx, "DELETE FROM idempotency_keys WHERE expires_at < $1", now)
+	return err
+}
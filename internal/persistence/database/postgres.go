@@ -3,6 +3,8 @@ package database
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -14,8 +16,13 @@ import (
 	"github.com/koyif/metrics/pkg/logger"
 )
 
+// regexPageSize is the number of rows read at a time when listing the metrics
+// matching a regular expression.
+const regexPageSize = 1000
+
 type Database struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	samples bool
 }
 
 func New(ctx context.Context, url string) (*Database, error) {
@@ -34,6 +41,10 @@ func New(ctx context.Context, url string) (*Database, error) {
 }
 
 func (db *Database) StoreMetric(metric models.Metrics) error {
+	if db.samples {
+		return db.StoreAll([]models.Metrics{metric})
+	}
+
 	sql := `INSERT INTO metrics (metric_name, metric_type, metric_value, metric_delta, updated_at) 
 		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (metric_name) DO UPDATE 
 		SET 
@@ -53,7 +64,19 @@ func (db *Database) StoreMetric(metric models.Metrics) error {
 	return nil
 }
 
+// StoreAll upserts the metrics in a single transaction. The batch is all-or-nothing:
+// if any statement fails the transaction is rolled back and no metric is changed.
+// Transient failures retry the whole transaction. With samples enabled the
+// samples of the batch are recorded in the same transaction.
 func (db *Database) StoreAll(metrics []models.Metrics) error {
+	ctx := context.Background()
+
+	return errutil.Retry(NewPostgresErrorClassifier(), func() error {
+		return db.storeAll(ctx, metrics)
+	})
+}
+
+func (db *Database) storeAll(ctx context.Context, metrics []models.Metrics) (err error) {
 	sql := `INSERT INTO metrics (metric_name, metric_type, metric_value, metric_delta, updated_at) 
 		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (metric_name) DO UPDATE
 		SET 
@@ -61,39 +84,66 @@ func (db *Database) StoreAll(metrics []models.Metrics) error {
 		    metric_delta = $4 + metrics.metric_delta,
 		    updated_at = $5
 		`
-
-	ctx := context.Background()
-	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return err
+	if db.samples {
+		sql += "RETURNING metric_value, metric_delta"
 	}
 
-	_, err = tx.Prepare(ctx, "insert_metric", sql)
+	tx, err := db.pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, ignoreClosedTx(tx.Rollback(ctx)))
+		}
+	}()
 
 	batch := &pgx.Batch{}
 	updatedAt := time.Now()
 	for _, metric := range metrics {
-		batch.Queue("insert_metric", metric.ID, metric.MType, metric.Value, metric.Delta, updatedAt)
+		batch.Queue(sql, metric.ID, metric.MType, metric.Value, metric.Delta, updatedAt)
 	}
+
+	var samples [][]any
 	br := tx.SendBatch(ctx, batch)
+	for _, metric := range metrics {
+		if !db.samples {
+			if _, err = br.Exec(); err != nil {
+				_ = br.Close()
+				return err
+			}
+			continue
+		}
 
-	err = errutil.Retry(NewPostgresErrorClassifier(), func() error {
-		errBr := br.Close()
-		return errors.Join(errBr, tx.Commit(ctx))
-	})
-	if err != nil {
+		var value *float64
+		var total *int64
+		if err = br.QueryRow().Scan(&value, &total); err != nil {
+			_ = br.Close()
+			return err
+		}
+		if row, ok := sampleRow(metric, value, total, updatedAt); ok {
+			samples = append(samples, row)
+		}
+	}
+	if err = br.Close(); err != nil {
 		return err
 	}
 
-	err = br.Close()
-	if err != nil {
-		return err
+	if len(samples) > 0 {
+		if _, err = tx.CopyFrom(ctx, pgx.Identifier{"metric_samples"}, sampleColumns, pgx.CopyFromRows(samples)); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return tx.Commit(ctx)
+}
+
+func ignoreClosedTx(err error) error {
+	if errors.Is(err, pgx.ErrTxClosed) {
+		return nil
+	}
+
+	return err
 }
 
 func (db *Database) Metric(metricName string) (models.Metrics, error) {
@@ -142,6 +192,125 @@ func (db *Database) AllMetrics() []models.Metrics {
 	return metrics
 }
 
+// ListMetrics selects the metrics matching the filter ordered by name and type.
+// The filter is applied in the query and pagination is keyset based, so only
+// the requested page is read from the table. The regular expression is
+// matched here rather than by PostgreSQL, whose syntax differs from Go's:
+// the other conditions select the rows, which are read in pages until the
+// requested page is filled.
+func (db *Database) ListMetrics(ctx context.Context, filter models.ListFilter) ([]models.MetricRecord, error) {
+	if filter.Regex == nil {
+		return db.listMetrics(ctx, filter)
+	}
+
+	return listMatching(filter, func(page models.ListFilter) ([]models.MetricRecord, error) {
+		return db.listMetrics(ctx, page)
+	})
+}
+
+// listMatching returns the records matching the regular expression of the
+// filter, reading pages of the records matching the other conditions with list.
+func listMatching(filter models.ListFilter, list func(models.ListFilter) ([]models.MetricRecord, error)) ([]models.MetricRecord, error) {
+	regex, limit := filter.Regex, filter.Limit
+	filter.Regex = nil
+	filter.Limit = max(limit, regexPageSize)
+
+	records := make([]models.MetricRecord, 0)
+	for {
+		page, err := list(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range page {
+			if !regex.MatchString(record.ID) {
+				continue
+			}
+			records = append(records, record)
+			if len(records) == limit {
+				return records, nil
+			}
+		}
+
+		if len(page) < filter.Limit {
+			return records, nil
+		}
+		last := page[len(page)-1]
+		filter.After = &models.ListPosition{ID: last.ID, MType: last.MType}
+	}
+}
+
+// listMetrics selects the metrics matching the filter, except its regular expression.
+func (db *Database) listMetrics(ctx context.Context, filter models.ListFilter) ([]models.MetricRecord, error) {
+	sql, args := listQuery(filter)
+
+	var records []models.MetricRecord
+	err := errutil.Retry(NewPostgresErrorClassifier(), func() error {
+		rows, err := db.pool.Query(ctx, sql, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		records = make([]models.MetricRecord, 0)
+		for rows.Next() {
+			var record models.MetricRecord
+			if err := rows.Scan(&record.ID, &record.MType, &record.Value, &record.Delta, &record.UpdatedAt); err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// listQuery returns the selection of the metrics matching the filter, except
+// its regular expression.
+func listQuery(filter models.ListFilter) (string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.MType != "" {
+		conditions = append(conditions, "metric_type = "+arg(filter.MType))
+	}
+	if filter.Prefix != "" {
+		conditions = append(conditions, "starts_with(metric_name, "+arg(filter.Prefix)+")")
+	}
+	if len(filter.AllowedPrefixes) > 0 {
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM unnest("+arg(filter.AllowedPrefixes)+"::text[]) AS p WHERE starts_with(metric_name, p))")
+	}
+	if filter.After != nil {
+		conditions = append(conditions,
+			"(metric_name, metric_type) > ("+arg(filter.After.ID)+", "+arg(filter.After.MType)+")")
+	}
+
+	var sql strings.Builder
+	sql.WriteString("SELECT metric_name, metric_type, metric_value, metric_delta, updated_at FROM metrics")
+	if len(conditions) > 0 {
+		sql.WriteString(" WHERE ")
+		sql.WriteString(strings.Join(conditions, " AND "))
+	}
+	sql.WriteString(" ORDER BY metric_name, metric_type")
+	if filter.Limit > 0 {
+		sql.WriteString(" LIMIT " + arg(filter.Limit))
+	}
+
+	return sql.String(), args
+}
+
 func (db *Database) Ping(ctx context.Context) error {
 	return db.pool.Ping(ctx)
 }
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+func TestListQuery(t *testing.T) {
+	sql, args := listQuery(models.ListFilter{})
+	assert.Equal(t, "SELECT metric_name, metric_type, metric_value, metric_delta, updated_at FROM metrics ORDER BY metric_name, metric_type", sql)
+	assert.Empty(t, args)
+
+	sql, args = listQuery(models.ListFilter{
+		MType:           models.Gauge,
+		Prefix:          "host1.",
+		Regex:           regexp.MustCompile(`cpu$`),
+		AllowedPrefixes: []string{"host1.", "host2."},
+		After:           &models.ListPosition{ID: "host1.a", MType: models.Counter},
+		Limit:           11,
+	})
+	assert.Equal(t, "SELECT metric_name, metric_type, metric_value, metric_delta, updated_at FROM metrics"+
+		" WHERE metric_type = $1"+
+		" AND starts_with(metric_name, $2)"+
+		" AND EXISTS (SELECT 1 FROM unnest($3::text[]) AS p WHERE starts_with(metric_name, p))"+
+		" AND (metric_name, metric_type) > ($4, $5)"+
+		" ORDER BY metric_name, metric_type LIMIT $6", sql)
+	assert.Equal(t, []any{models.Gauge, "host1.", []string{"host1.", "host2."}, "host1.a", models.Counter, 11}, args,
+		"the regular expression is matched after the query")
+}
+
+func TestListMatching(t *testing.T) {
+	var table []models.MetricRecord
+	for i := range 2*regexPageSize + 10 {
+		table = append(table, models.MetricRecord{Metrics: models.Metrics{ID: fmt.Sprintf("m%05d", i), MType: models.Gauge}})
+	}
+
+	var queries int
+	list := func(filter models.ListFilter) ([]models.MetricRecord, error) {
+		queries++
+		assert.Nil(t, filter.Regex, "the query doesn't get the regular expression")
+		page := make([]models.MetricRecord, 0)
+		for _, r := range table {
+			if filter.After != nil && !filter.After.Less(models.ListPosition{ID: r.ID, MType: r.MType}) {
+				continue
+			}
+			if len(page) == filter.Limit {
+				break
+			}
+			page = append(page, r)
+		}
+		return page, nil
+	}
+
+	// \z ends the text in Go; PostgreSQL spells it \Z.
+	regex := regexp.MustCompile(`^m\d{4}[05]\z`)
+	records, err := listMatching(models.ListFilter{Regex: regex, Limit: 3}, list)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m00000", "m00005", "m00010"}, recordIDs(records))
+	assert.Equal(t, 1, queries)
+
+	queries = 0
+	records, err = listMatching(models.ListFilter{Regex: regexp.MustCompile(`^m0200[5-9]$`)}, list)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m02005", "m02006", "m02007", "m02008", "m02009"}, recordIDs(records))
+	assert.Equal(t, 3, queries, "pages are read until the table ends")
+}
+
+func recordIDs(records []models.MetricRecord) []string {
+	ids := make([]string, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestSamplePartitions(t *testing.T) {
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS metric_samples_p20261019 PARTITION OF metric_samples"+
+		" FOR VALUES FROM ('2026-10-19 00:00:00+00:00') TO ('2026-10-20 00:00:00+00:00')", createPartitionQuery(day))
+
+	got, ok := partitionDay("metric_samples_p20261019")
+	assert.True(t, ok)
+	assert.Equal(t, day, got)
+
+	for _, name := range []string{"metric_samples_default", "metric_samples_p2026", "metrics"} {
+		_, ok := partitionDay(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestSampleRow(t *testing.T) {
+	at := time.Now()
+	value, total := 0.5, int64(42)
+
+	row, ok := sampleRow(models.Metrics{ID: "load", MType: models.Gauge}, &value, nil, at)
+	assert.True(t, ok)
+	assert.Equal(t, []any{"load", models.Gauge, 0.5, at}, row)
+
+	row, ok = sampleRow(models.Metrics{ID: "hits", MType: models.Counter}, nil, &total, at)
+	assert.True(t, ok)
+	assert.Equal(t, []any{"hits", models.Counter, 42.0, at}, row, "counters record their total")
+
+	_, ok = sampleRow(models.Metrics{ID: "hits", MType: models.Counter}, &value, nil, at)
+	assert.False(t, ok)
+}
+
+func TestRollupQuery(t *testing.T) {
+	raw := rollupQuery(0)
+	assert.Contains(t, raw, "FROM metric_samples")
+	assert.NotContains(t, raw, "$4")
+
+	rollups := rollupQuery(time.Minute)
+	assert.Contains(t, rollups, "FROM metric_rollups")
+	assert.Contains(t, rollups, "resolution_seconds = $4")
+	assert.Contains(t, rollups, "sum(avg_value * sample_count) / sum(sample_count)", "averages are weighted by sample count")
+}
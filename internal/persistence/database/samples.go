@@ -0,0 +1,283 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/pkg/errutil"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const (
+	// samplePartitionPrefix prefixes the names of the daily sample partitions,
+	// which end with the day as YYYYMMDD.
+	samplePartitionPrefix = "metric_samples_p"
+	samplePartitionLayout = "20060102"
+
+	// compactionLockID is the advisory lock held while compacting.
+	compactionLockID = 7_102_023_001
+
+	// partitionLockTimeout limits how long partition changes wait for the
+	// table lock, so they don't hold up ingestion behind them.
+	partitionLockTimeout = "2s"
+)
+
+var sampleColumns = []string{"metric_name", "metric_type", "value", "recorded_at"}
+
+// EnableSamples makes every stored update also record a raw sample in the
+// metric_samples table: the gauge value or the counter total after the
+// update. It must be called before any metric is stored.
+func (db *Database) EnableSamples() {
+	db.samples = true
+}
+
+// sampleRow returns the sample of a metric stored with the returned value and total.
+func sampleRow(metric models.Metrics, value *float64, total *int64, recordedAt time.Time) ([]any, bool) {
+	switch {
+	case metric.MType == models.Gauge && value != nil:
+		return []any{metric.ID, metric.MType, *value, recordedAt}, true
+	case metric.MType == models.Counter && total != nil:
+		return []any{metric.ID, metric.MType, float64(*total), recordedAt}, true
+	default:
+		return nil, false
+	}
+}
+
+// LockCompaction takes the compaction advisory lock on a dedicated
+// connection. It reports false if another server holds it.
+func (db *Database) LockCompaction(ctx context.Context) (func(), bool, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", compactionLockID).Scan(&locked); err != nil {
+		conn.Release()
+		return nil, false, err
+	}
+	if !locked {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", compactionLockID); err != nil {
+			logger.Log.Warn("failed to release compaction lock", logger.Error(err))
+		}
+		conn.Release()
+	}
+
+	return unlock, true, nil
+}
+
+// CreateSamplePartitions creates the missing daily partitions of the days
+// from the day of from on.
+func (db *Database) CreateSamplePartitions(ctx context.Context, from time.Time, days int) error {
+	day := from.UTC().Truncate(24 * time.Hour)
+
+	var errs []error
+	for i := 0; i < days; i++ {
+		if err := db.alterPartitions(ctx, createPartitionQuery(day.AddDate(0, 0, i))); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DropSamplePartitions drops the daily partitions that end before the time.
+func (db *Database) DropSamplePartitions(ctx context.Context, before time.Time) (int, error) {
+	sql := `SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'metric_samples'::regclass`
+
+	var names []string
+	err := errutil.Retry(NewPostgresErrorClassifier(), func() error {
+		rows, err := db.pool.Query(ctx, sql)
+		if err != nil {
+			return err
+		}
+		names, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	dropped := 0
+	for _, name := range names {
+		day, ok := partitionDay(name)
+		if !ok || day.Add(24*time.Hour).After(before) {
+			continue
+		}
+		if err := db.alterPartitions(ctx, "DROP TABLE IF EXISTS "+name); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+
+	return dropped, nil
+}
+
+// alterPartitions runs a partition change that gives up when the table lock
+// isn't granted in time.
+func (db *Database) alterPartitions(ctx context.Context, sql string) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = ignoreClosedTx(tx.Rollback(ctx)) }()
+
+	if _, err := tx.Exec(ctx, "SET LOCAL lock_timeout = '"+partitionLockTimeout+"'"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteSamples deletes the samples recorded before the time.
+func (db *Database) DeleteSamples(ctx context.Context, before time.Time) (int64, error) {
+	return db.exec(ctx, "DELETE FROM metric_samples WHERE recorded_at < $1", before)
+}
+
+// DeleteRollups deletes the rollups of the resolution whose buckets start before the time.
+func (db *Database) DeleteRollups(ctx context.Context, resolution time.Duration, before time.Time) (int64, error) {
+	return db.exec(ctx, "DELETE FROM metric_rollups WHERE resolution_seconds = $1 AND bucket_start < $2",
+		int(resolution.Seconds()), before)
+}
+
+func (db *Database) exec(ctx context.Context, sql string, args ...any) (int64, error) {
+	var affected int64
+	err := errutil.Retry(NewPostgresErrorClassifier(), func() error {
+		tag, err := db.pool.Exec(ctx, sql, args...)
+		affected = tag.RowsAffected()
+		return err
+	})
+
+	return affected, err
+}
+
+// RollupWatermark returns the end of the last bucket rolled up at the
+// resolution. It reports false if nothing was rolled up yet.
+func (db *Database) RollupWatermark(ctx context.Context, resolution time.Duration) (time.Time, bool, error) {
+	sql := "SELECT compacted_until FROM metric_rollup_progress WHERE resolution_seconds = $1"
+
+	var watermark time.Time
+	err := errutil.Retry(NewPostgresErrorClassifier(), func() error {
+		return db.pool.QueryRow(ctx, sql, int(resolution.Seconds())).Scan(&watermark)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return watermark, true, nil
+}
+
+// Rollup computes the rollups of the buckets in [from, to) from the raw
+// samples, or from the rollups of the source resolution when it isn't zero,
+// and moves the watermark of the resolution to to in the same transaction.
+// Rolling up a bucket again replaces its rollups.
+func (db *Database) Rollup(ctx context.Context, resolution, source time.Duration, from, to time.Time) (int64, error) {
+	progress := `INSERT INTO metric_rollup_progress (resolution_seconds, compacted_until) VALUES ($1, $2)
+		ON CONFLICT (resolution_seconds) DO UPDATE SET compacted_until = EXCLUDED.compacted_until`
+
+	args := []any{int(resolution.Seconds()), from, to}
+	if source > 0 {
+		args = append(args, int(source.Seconds()))
+	}
+
+	var rollups int64
+	err := errutil.Retry(NewPostgresErrorClassifier(), func() (err error) {
+		tx, err := db.pool.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				err = errors.Join(err, ignoreClosedTx(tx.Rollback(ctx)))
+			}
+		}()
+
+		tag, err := tx.Exec(ctx, rollupQuery(source), args...)
+		if err != nil {
+			return err
+		}
+		rollups = tag.RowsAffected()
+
+		if _, err = tx.Exec(ctx, progress, int(resolution.Seconds()), to); err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	})
+
+	return rollups, err
+}
+
+// rollupQuery returns the upsert of the rollups with the resolution in
+// seconds as $1 and the bucket range as $2 and $3. Raw samples are rolled
+// up when source is zero; otherwise the rollups with the resolution in $4.
+func rollupQuery(source time.Duration) string {
+	bucket := "to_timestamp((floor(extract(epoch FROM %s) / $1::integer) * $1::integer)::double precision)"
+
+	var selectSQL string
+	if source == 0 {
+		selectSQL = `SELECT $1::integer, metric_name, metric_type, ` + fmt.Sprintf(bucket, "recorded_at") + `,
+		       min(value), max(value), avg(value),
+		       (array_agg(value ORDER BY recorded_at DESC))[1], count(*)
+		FROM metric_samples
+		WHERE recorded_at >= $2 AND recorded_at < $3`
+	} else {
+		selectSQL = `SELECT $1::integer, metric_name, metric_type, ` + fmt.Sprintf(bucket, "bucket_start") + `,
+		       min(min_value), max(max_value), sum(avg_value * sample_count) / sum(sample_count),
+		       (array_agg(last_value ORDER BY bucket_start DESC))[1], sum(sample_count)
+		FROM metric_rollups
+		WHERE resolution_seconds = $4 AND bucket_start >= $2 AND bucket_start < $3`
+	}
+
+	return `INSERT INTO metric_rollups
+		(resolution_seconds, metric_name, metric_type, bucket_start, min_value, max_value, avg_value, last_value, sample_count)
+		` + selectSQL + `
+		GROUP BY 2, 3, 4
+		ON CONFLICT (resolution_seconds, metric_name, metric_type, bucket_start) DO UPDATE
+		SET
+		    min_value = EXCLUDED.min_value,
+		    max_value = EXCLUDED.max_value,
+		    avg_value = EXCLUDED.avg_value,
+		    last_value = EXCLUDED.last_value,
+		    sample_count = EXCLUDED.sample_count`
+}
+
+// createPartitionQuery returns the creation of the partition of the day.
+func createPartitionQuery(day time.Time) string {
+	const layout = "2006-01-02 15:04:05-07:00"
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s%s PARTITION OF metric_samples FOR VALUES FROM ('%s') TO ('%s')",
+		samplePartitionPrefix, day.Format(samplePartitionLayout), day.Format(layout), day.AddDate(0, 0, 1).Format(layout))
+}
+
+// partitionDay returns the day of a daily partition from its name.
+func partitionDay(name string) (time.Time, bool) {
+	suffix, ok := strings.CutPrefix(name, samplePartitionPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	day, err := time.Parse(samplePartitionLayout, suffix)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return day, true
+}
@@ -141,8 +141,12 @@ func (x *Metric) GetValue() float64 {
 
 // UpdateMetricsRequest содержит список метрик для обновления.
 type UpdateMetricsRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Metrics []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	// Режим частичного успеха: корректные метрики сохраняются,
+	// некорректные отклоняются с указанием причины.
+	// По умолчанию батч сохраняется целиком или не сохраняется вовсе.
+	Partial       bool `protobuf:"varint,2,opt,name=partial,proto3" json:"partial,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -184,16 +188,103 @@ func (x *UpdateMetricsRequest) GetMetrics() []*Metric {
 	return nil
 }
 
-// UpdateMetricsResponse — пустой ответ для подтверждения успешного обновления.
+func (x *UpdateMetricsRequest) GetPartial() bool {
+	if x != nil {
+		return x.Partial
+	}
+	return false
+}
+
+// MetricResult описывает результат обработки одной метрики из батча.
+type MetricResult struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Index    int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`       // позиция метрики в запросе
+	Id       string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`              // имя метрики
+	Accepted bool                   `protobuf:"varint,3,opt,name=accepted,proto3" json:"accepted,omitempty"` // метрика сохранена
+	// Машиночитаемый код причины отказа, например invalid_name.
+	Reason string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	// Описание причины отказа.
+	Message       string `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricResult) Reset() {
+	*x = MetricResult{}
+	mi := &file_api_proto_metrics_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricResult) ProtoMessage() {}
+
+func (x *MetricResult) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_metrics_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricResult.ProtoReflect.Descriptor instead.
+func (*MetricResult) Descriptor() ([]byte, []int) {
+	return file_api_proto_metrics_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MetricResult) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *MetricResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *MetricResult) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+func (x *MetricResult) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *MetricResult) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// UpdateMetricsResponse содержит результат обработки каждой метрики из запроса.
 type UpdateMetricsResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*MetricResult        `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *UpdateMetricsResponse) Reset() {
 	*x = UpdateMetricsResponse{}
-	mi := &file_api_proto_metrics_proto_msgTypes[2]
+	mi := &file_api_proto_metrics_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -205,7 +296,7 @@ func (x *UpdateMetricsResponse) String() string {
 func (*UpdateMetricsResponse) ProtoMessage() {}
 
 func (x *UpdateMetricsResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_metrics_proto_msgTypes[2]
+	mi := &file_api_proto_metrics_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -218,7 +309,312 @@ func (x *UpdateMetricsResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateMetricsResponse.ProtoReflect.Descriptor instead.
 func (*UpdateMetricsResponse) Descriptor() ([]byte, []int) {
-	return file_api_proto_metrics_proto_rawDescGZIP(), []int{2}
+	return file_api_proto_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UpdateMetricsResponse) GetResults() []*MetricResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// ListMetricsRequest — запрос текущих значений метрик.
+type ListMetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"` // только метрики с этим префиксом имени
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMetricsRequest) Reset() {
+	*x = ListMetricsRequest{}
+	mi := &file_api_proto_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMetricsRequest) ProtoMessage() {}
+
+func (x *ListMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMetricsRequest.ProtoReflect.Descriptor instead.
+func (*ListMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListMetricsRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+// ListMetricsResponse содержит текущие значения метрик, отсортированные по имени.
+// Для счётчиков поле delta содержит накопленное значение.
+type ListMetricsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMetricsResponse) Reset() {
+	*x = ListMetricsResponse{}
+	mi := &file_api_proto_metrics_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMetricsResponse) ProtoMessage() {}
+
+func (x *ListMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_metrics_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMetricsResponse.ProtoReflect.Descriptor instead.
+func (*ListMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_api_proto_metrics_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListMetricsResponse) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+// ListAgentsRequest — запрос списка агентов.
+type ListAgentsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAgentsRequest) Reset() {
+	*x = ListAgentsRequest{}
+	mi := &file_api_proto_metrics_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAgentsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAgentsRequest) ProtoMessage() {}
+
+func (x *ListAgentsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_metrics_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAgentsRequest.ProtoReflect.Descriptor instead.
+func (*ListAgentsRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_metrics_proto_rawDescGZIP(), []int{6}
+}
+
+// Agent описывает агента, отправлявшего метрики на сервер.
+type Agent struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`                                                    // стабильный идентификатор агента
+	Hostname        string                 `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`                                        // имя хоста агента
+	Version         string                 `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`                                          // версия сборки агента
+	StartedAtUnix   int64                  `protobuf:"varint,4,opt,name=started_at_unix,json=startedAtUnix,proto3" json:"started_at_unix,omitempty"`      // время запуска агента, Unix-время в секундах
+	FirstSeenUnix   int64                  `protobuf:"varint,5,opt,name=first_seen_unix,json=firstSeenUnix,proto3" json:"first_seen_unix,omitempty"`      // время первого запроса агента
+	LastSeenUnix    int64                  `protobuf:"varint,6,opt,name=last_seen_unix,json=lastSeenUnix,proto3" json:"last_seen_unix,omitempty"`         // время последнего запроса агента
+	Transport       string                 `protobuf:"bytes,7,opt,name=transport,proto3" json:"transport,omitempty"`                                      // транспорт последнего запроса: http или grpc
+	Address         string                 `protobuf:"bytes,8,opt,name=address,proto3" json:"address,omitempty"`                                          // адрес клиента в последнем запросе
+	Requests        int64                  `protobuf:"varint,9,opt,name=requests,proto3" json:"requests,omitempty"`                                       // количество запросов
+	MetricsReceived int64                  `protobuf:"varint,10,opt,name=metrics_received,json=metricsReceived,proto3" json:"metrics_received,omitempty"` // количество сохранённых метрик
+	Alive           bool                   `protobuf:"varint,11,opt,name=alive,proto3" json:"alive,omitempty"`                                            // агент присылал запросы в пределах таймаута
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Agent) Reset() {
+	*x = Agent{}
+	mi := &file_api_proto_metrics_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Agent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Agent) ProtoMessage() {}
+
+func (x *Agent) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_metrics_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Agent.ProtoReflect.Descriptor instead.
+func (*Agent) Descriptor() ([]byte, []int) {
+	return file_api_proto_metrics_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Agent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Agent) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *Agent) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Agent) GetStartedAtUnix() int64 {
+	if x != nil {
+		return x.StartedAtUnix
+	}
+	return 0
+}
+
+func (x *Agent) GetFirstSeenUnix() int64 {
+	if x != nil {
+		return x.FirstSeenUnix
+	}
+	return 0
+}
+
+func (x *Agent) GetLastSeenUnix() int64 {
+	if x != nil {
+		return x.LastSeenUnix
+	}
+	return 0
+}
+
+func (x *Agent) GetTransport() string {
+	if x != nil {
+		return x.Transport
+	}
+	return ""
+}
+
+func (x *Agent) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *Agent) GetRequests() int64 {
+	if x != nil {
+		return x.Requests
+	}
+	return 0
+}
+
+func (x *Agent) GetMetricsReceived() int64 {
+	if x != nil {
+		return x.MetricsReceived
+	}
+	return 0
+}
+
+func (x *Agent) GetAlive() bool {
+	if x != nil {
+		return x.Alive
+	}
+	return false
+}
+
+// ListAgentsResponse содержит список известных агентов.
+type ListAgentsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Agents        []*Agent               `protobuf:"bytes,1,rep,name=agents,proto3" json:"agents,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAgentsResponse) Reset() {
+	*x = ListAgentsResponse{}
+	mi := &file_api_proto_metrics_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAgentsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAgentsResponse) ProtoMessage() {}
+
+func (x *ListAgentsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_metrics_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAgentsResponse.ProtoReflect.Descriptor instead.
+func (*ListAgentsResponse) Descriptor() ([]byte, []int) {
+	return file_api_proto_metrics_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListAgentsResponse) GetAgents() []*Agent {
+	if x != nil {
+		return x.Agents
+	}
+	return nil
 }
 
 var File_api_proto_metrics_proto protoreflect.FileDescriptor
@@ -233,12 +629,44 @@ const file_api_proto_metrics_proto_rawDesc = "" +
 	"\x05value\x18\x04 \x01(\x01R\x05value\"\x1f\n" +
 	"\x05MType\x12\t\n" +
 	"\x05GAUGE\x10\x00\x12\v\n" +
-	"\aCOUNTER\x10\x01\"A\n" +
+	"\aCOUNTER\x10\x01\"[\n" +
 	"\x14UpdateMetricsRequest\x12)\n" +
-	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\"\x17\n" +
-	"\x15UpdateMetricsResponse2Y\n" +
+	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\x12\x18\n" +
+	"\apartial\x18\x02 \x01(\bR\apartial\"\x82\x01\n" +
+	"\fMetricResult\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x1a\n" +
+	"\baccepted\x18\x03 \x01(\bR\baccepted\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\tR\amessage\"H\n" +
+	"\x15UpdateMetricsResponse\x12/\n" +
+	"\aresults\x18\x01 \x03(\v2\x15.metrics.MetricResultR\aresults\",\n" +
+	"\x12ListMetricsRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\"@\n" +
+	"\x13ListMetricsResponse\x12)\n" +
+	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\"\x13\n" +
+	"\x11ListAgentsRequest\"\xd8\x02\n" +
+	"\x05Agent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\bhostname\x18\x02 \x01(\tR\bhostname\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\tR\aversion\x12&\n" +
+	"\x0fstarted_at_unix\x18\x04 \x01(\x03R\rstartedAtUnix\x12&\n" +
+	"\x0ffirst_seen_unix\x18\x05 \x01(\x03R\rfirstSeenUnix\x12$\n" +
+	"\x0elast_seen_unix\x18\x06 \x01(\x03R\flastSeenUnix\x12\x1c\n" +
+	"\ttransport\x18\a \x01(\tR\ttransport\x12\x18\n" +
+	"\aaddress\x18\b \x01(\tR\aaddress\x12\x1a\n" +
+	"\brequests\x18\t \x01(\x03R\brequests\x12)\n" +
+	"\x10metrics_received\x18\n" +
+	" \x01(\x03R\x0fmetricsReceived\x12\x14\n" +
+	"\x05alive\x18\v \x01(\bR\x05alive\"<\n" +
+	"\x12ListAgentsResponse\x12&\n" +
+	"\x06agents\x18\x01 \x03(\v2\x0e.metrics.AgentR\x06agents2\xa3\x01\n" +
 	"\aMetrics\x12N\n" +
-	"\rUpdateMetrics\x12\x1d.metrics.UpdateMetricsRequest\x1a\x1e.metrics.UpdateMetricsResponseB)Z'github.com/koyif/metrics/internal/protob\x06proto3"
+	"\rUpdateMetrics\x12\x1d.metrics.UpdateMetricsRequest\x1a\x1e.metrics.UpdateMetricsResponse\x12H\n" +
+	"\vListMetrics\x12\x1b.metrics.ListMetricsRequest\x1a\x1c.metrics.ListMetricsResponse2O\n" +
+	"\x06Agents\x12E\n" +
+	"\n" +
+	"ListAgents\x12\x1a.metrics.ListAgentsRequest\x1a\x1b.metrics.ListAgentsResponseB)Z'github.com/koyif/metrics/internal/protob\x06proto3"
 
 var (
 	file_api_proto_metrics_proto_rawDescOnce sync.Once
@@ -253,23 +681,36 @@ func file_api_proto_metrics_proto_rawDescGZIP() []byte {
 }
 
 var file_api_proto_metrics_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_api_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_api_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_api_proto_metrics_proto_goTypes = []any{
 	(Metric_MType)(0),             // 0: metrics.Metric.MType
 	(*Metric)(nil),                // 1: metrics.Metric
 	(*UpdateMetricsRequest)(nil),  // 2: metrics.UpdateMetricsRequest
-	(*UpdateMetricsResponse)(nil), // 3: metrics.UpdateMetricsResponse
+	(*MetricResult)(nil),          // 3: metrics.MetricResult
+	(*UpdateMetricsResponse)(nil), // 4: metrics.UpdateMetricsResponse
+	(*ListMetricsRequest)(nil),    // 5: metrics.ListMetricsRequest
+	(*ListMetricsResponse)(nil),   // 6: metrics.ListMetricsResponse
+	(*ListAgentsRequest)(nil),     // 7: metrics.ListAgentsRequest
+	(*Agent)(nil),                 // 8: metrics.Agent
+	(*ListAgentsResponse)(nil),    // 9: metrics.ListAgentsResponse
 }
 var file_api_proto_metrics_proto_depIdxs = []int32{
 	0, // 0: metrics.Metric.type:type_name -> metrics.Metric.MType
 	1, // 1: metrics.UpdateMetricsRequest.metrics:type_name -> metrics.Metric
-	2, // 2: metrics.Metrics.UpdateMetrics:input_type -> metrics.UpdateMetricsRequest
-	3, // 3: metrics.Metrics.UpdateMetrics:output_type -> metrics.UpdateMetricsResponse
-	3, // [3:4] is the sub-list for method output_type
-	2, // [2:3] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	3, // 2: metrics.UpdateMetricsResponse.results:type_name -> metrics.MetricResult
+	1, // 3: metrics.ListMetricsResponse.metrics:type_name -> metrics.Metric
+	8, // 4: metrics.ListAgentsResponse.agents:type_name -> metrics.Agent
+	2, // 5: metrics.Metrics.UpdateMetrics:input_type -> metrics.UpdateMetricsRequest
+	5, // 6: metrics.Metrics.ListMetrics:input_type -> metrics.ListMetricsRequest
+	7, // 7: metrics.Agents.ListAgents:input_type -> metrics.ListAgentsRequest
+	4, // 8: metrics.Metrics.UpdateMetrics:output_type -> metrics.UpdateMetricsResponse
+	6, // 9: metrics.Metrics.ListMetrics:output_type -> metrics.ListMetricsResponse
+	9, // 10: metrics.Agents.ListAgents:output_type -> metrics.ListAgentsResponse
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_api_proto_metrics_proto_init() }
@@ -283,9 +724,9 @@ func file_api_proto_metrics_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_proto_metrics_proto_rawDesc), len(file_api_proto_metrics_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   3,
+			NumMessages:   9,
 			NumExtensions: 0,
-			NumServices:   1,
+			NumServices:   2,
 		},
 		GoTypes:           file_api_proto_metrics_proto_goTypes,
 		DependencyIndexes: file_api_proto_metrics_proto_depIdxs,
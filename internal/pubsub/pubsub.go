@@ -0,0 +1,205 @@
+// Package pubsub fans stored metric updates out to live subscribers.
+//
+// Publishing never blocks: every subscriber has a bounded buffer, and a subscriber
+// that falls behind is dropped instead of slowing down ingestion.
+package pubsub
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+const (
+	// DefaultBufferSize is the number of events a subscriber may lag behind before it is dropped.
+	DefaultBufferSize = 256
+	// DefaultMaxSubscribers limits the number of concurrent subscribers.
+	DefaultMaxSubscribers = 1000
+)
+
+// ErrTooManySubscribers is returned by Subscribe when the subscriber limit is reached.
+var ErrTooManySubscribers = errors.New("too many subscribers")
+
+// Event is a single stored metric update.
+type Event struct {
+	ID        string    `json:"id"`
+	MType     string    `json:"type"`
+	Delta     *int64    `json:"delta,omitempty"`
+	Value     *float64  `json:"value,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Filter selects the events a subscriber receives. Empty fields match everything.
+type Filter struct {
+	Prefix string
+	MType  string
+}
+
+// Match reports whether the event passes the filter.
+func (f Filter) Match(e Event) bool {
+	if f.MType != "" && f.MType != e.MType {
+		return false
+	}
+
+	return strings.HasPrefix(e.ID, f.Prefix)
+}
+
+// Subscription receives the events matching its filter until it is closed by
+// Hub.Unsubscribe or dropped for falling behind.
+type Subscription struct {
+	events  chan Event
+	filter  Filter
+	dropped atomic.Bool
+}
+
+// Events returns the channel of events. It is closed when the subscription ends.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped reports whether the subscription was ended because its buffer overflowed.
+func (s *Subscription) Dropped() bool {
+	return s.dropped.Load()
+}
+
+// Hub distributes published metrics to subscribers.
+type Hub struct {
+	bufferSize     int
+	maxSubscribers int
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	dropped     int64
+}
+
+// New creates a hub. Non-positive values fall back to DefaultBufferSize and DefaultMaxSubscribers.
+func New(bufferSize, maxSubscribers int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	if maxSubscribers <= 0 {
+		maxSubscribers = DefaultMaxSubscribers
+	}
+
+	return &Hub{
+		bufferSize:     bufferSize,
+		maxSubscribers: maxSubscribers,
+		subscribers:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber receiving the events that match filter.
+// The caller must call Unsubscribe when it stops reading.
+func (h *Hub) Subscribe(filter Filter) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subscribers) >= h.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	s := &Subscription{
+		events: make(chan Event, h.bufferSize),
+		filter: filter,
+	}
+	h.subscribers[s] = struct{}{}
+
+	return s, nil
+}
+
+// Unsubscribe ends the subscription. It is safe to call more than once
+// and after the subscription has been dropped.
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Publish sends the stored metrics to every matching subscriber without blocking.
+// Subscribers whose buffer is full are dropped.
+func (h *Hub) Publish(metrics []models.Metrics) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	now := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.subscribers) == 0 {
+		return
+	}
+
+	for _, m := range metrics {
+		e := newEvent(m, now)
+		for s := range h.subscribers {
+			if !s.filter.Match(e) {
+				continue
+			}
+
+			select {
+			case s.events <- e:
+			default:
+				s.dropped.Store(true)
+				delete(h.subscribers, s)
+				close(s.events)
+				h.dropped++
+			}
+		}
+	}
+}
+
+// newEvent copies the metric, so subscribers never share memory with the caller.
+func newEvent(m models.Metrics, now time.Time) Event {
+	e := Event{ID: m.ID, MType: m.MType, Timestamp: now}
+	if m.Delta != nil {
+		delta := *m.Delta
+		e.Delta = &delta
+	}
+	if m.Value != nil {
+		value := *m.Value
+		e.Value = &value
+	}
+
+	return e
+}
+
+// Subscribers returns the number of active subscribers.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers)
+}
+
+// DroppedSubscribers returns how many subscribers have been dropped for falling behind.
+func (h *Hub) DroppedSubscribers() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.dropped
+}
+
+// Publisher receives stored metrics.
+type Publisher interface {
+	Publish(metrics []models.Metrics)
+}
+
+// Publishers passes stored metrics to every publisher in order.
+type Publishers []Publisher
+
+// Publish sends the metrics to every publisher.
+func (p Publishers) Publish(metrics []models.Metrics) {
+	for _, publisher := range p {
+		publisher.Publish(metrics)
+	}
+}
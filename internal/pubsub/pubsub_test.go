@@ -0,0 +1,85 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+func gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Gauge, Value: &v}
+}
+
+func counter(id string, d int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Counter, Delta: &d}
+}
+
+func TestHub_PublishFiltersEvents(t *testing.T) {
+	hub := New(10, 10)
+
+	all, err := hub.Subscribe(Filter{})
+	require.NoError(t, err)
+	counters, err := hub.Subscribe(Filter{MType: models.Counter})
+	require.NoError(t, err)
+	prefixed, err := hub.Subscribe(Filter{Prefix: "host1."})
+	require.NoError(t, err)
+
+	hub.Publish([]models.Metrics{gauge("host1.cpu", 0.5), counter("requests", 3)})
+
+	assert.Len(t, all.Events(), 2)
+	require.Len(t, counters.Events(), 1)
+	e := <-counters.Events()
+	assert.Equal(t, "requests", e.ID)
+	assert.Equal(t, int64(3), *e.Delta)
+	require.Len(t, prefixed.Events(), 1)
+	assert.Equal(t, "host1.cpu", (<-prefixed.Events()).ID)
+}
+
+func TestHub_EventsDoNotShareMemory(t *testing.T) {
+	hub := New(10, 10)
+	sub, err := hub.Subscribe(Filter{})
+	require.NoError(t, err)
+
+	m := gauge("cpu", 1)
+	hub.Publish([]models.Metrics{m})
+	*m.Value = 2
+
+	assert.Equal(t, 1.0, *(<-sub.Events()).Value)
+}
+
+func TestHub_DropsSlowSubscribers(t *testing.T) {
+	hub := New(2, 10)
+	slow, err := hub.Subscribe(Filter{})
+	require.NoError(t, err)
+
+	hub.Publish([]models.Metrics{gauge("a", 1), gauge("b", 2), gauge("c", 3)})
+
+	assert.True(t, slow.Dropped())
+	assert.Equal(t, 0, hub.Subscribers())
+	assert.Equal(t, int64(1), hub.DroppedSubscribers())
+
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	assert.Equal(t, 2, received, "buffered events are still delivered before the channel closes")
+
+	hub.Unsubscribe(slow) // must not panic on a dropped subscription
+}
+
+func TestHub_SubscriberLimit(t *testing.T) {
+	hub := New(1, 1)
+	sub, err := hub.Subscribe(Filter{})
+	require.NoError(t, err)
+
+	_, err = hub.Subscribe(Filter{})
+	assert.ErrorIs(t, err, ErrTooManySubscribers)
+
+	hub.Unsubscribe(sub)
+	hub.Unsubscribe(sub)
+	_, err = hub.Subscribe(Filter{})
+	assert.NoError(t, err)
+}
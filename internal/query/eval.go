@@ -0,0 +1,191 @@
+package query
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/koyif/metrics/internal/history"
+	"github.com/koyif/metrics/internal/models"
+)
+
+// Result is one value of an evaluated expression.
+type Result struct {
+	// ID and MType are the metric the value was computed from.
+	// Both are empty for aggregations.
+	ID    string
+	MType string
+	Value float64
+}
+
+type metricsGetter interface {
+	AllMetrics() []models.Metrics
+}
+
+type historySelector interface {
+	Select(mtype string, match func(id string) bool) []history.Series
+}
+
+// Engine evaluates expressions over the current metrics and their history.
+type Engine struct {
+	service metricsGetter
+	history historySelector
+}
+
+// NewEngine creates an engine reading current values from the service and
+// samples from the history.
+func NewEngine(service metricsGetter, history historySelector) *Engine {
+	return &Engine{
+		service: service,
+		history: history,
+	}
+}
+
+// evaluation holds what the nodes of an expression are evaluated with.
+type evaluation struct {
+	engine *Engine
+	// at is the time windows end at.
+	at    time.Time
+	allow func(id string) bool
+}
+
+// Eval evaluates the expression at the time over the metrics allow accepts.
+// Results are sorted by ID and type.
+func (e *Engine) Eval(expr Expr, at time.Time, allow func(id string) bool) []Result {
+	results := expr.eval(evaluation{engine: e, at: at, allow: allow})
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].ID != results[j].ID {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].MType < results[j].MType
+	})
+
+	return results
+}
+
+// series returns the history of the selected metrics of the type.
+func (ev evaluation) series(mtype string, sel selector) []history.Series {
+	return ev.engine.history.Select(mtype, func(id string) bool {
+		return sel.matches(id) && ev.allow(id)
+	})
+}
+
+func (c current) eval(ev evaluation) []Result {
+	var results []Result
+	for _, m := range ev.engine.service.AllMetrics() {
+		if !c.selector.matches(m.ID) || !ev.allow(m.ID) {
+			continue
+		}
+		switch m.MType {
+		case models.Gauge:
+			results = append(results, Result{ID: m.ID, MType: models.Gauge, Value: *m.Value})
+		case models.Counter:
+			results = append(results, Result{ID: m.ID, MType: models.Counter, Value: float64(*m.Delta)})
+		}
+	}
+
+	return results
+}
+
+func (r rate) eval(ev evaluation) []Result {
+	now := ev.at
+	start := now.Add(-r.window)
+
+	var results []Result
+	for _, series := range ev.series(models.Counter, r.selector) {
+		if value, ok := perSecond(series.Samples, start, now); ok {
+			results = append(results, Result{ID: series.ID, MType: models.Counter, Value: value})
+		}
+	}
+
+	return results
+}
+
+// perSecond computes the increase of the counter totals between start and
+// now divided by the elapsed time. The total at start is the last sample
+// before it; without one, the oldest sample and its time are used.
+func perSecond(samples []history.Sample, start, now time.Time) (float64, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	base := samples[0]
+	last := samples[0]
+	for _, s := range samples {
+		if s.Timestamp.After(now) {
+			break
+		}
+		if !s.Timestamp.After(start) {
+			base = s
+		}
+		last = s
+	}
+
+	from := start
+	if base.Timestamp.After(start) {
+		from = base.Timestamp
+	}
+	elapsed := now.Sub(from).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	return (last.Value - base.Value) / elapsed, true
+}
+
+func (q quantile) eval(ev evaluation) []Result {
+	now := ev.at
+	start := now.Add(-q.window)
+
+	var results []Result
+	for _, series := range ev.series(models.Gauge, q.selector) {
+		var values []float64
+		for _, s := range series.Samples {
+			if s.Timestamp.After(start) && !s.Timestamp.After(now) {
+				values = append(values, s.Value)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		results = append(results, Result{ID: series.ID, MType: models.Gauge, Value: quantileOf(q.q, values)})
+	}
+
+	return results
+}
+
+// quantileOf interpolates linearly between the closest ranks of the values.
+func quantileOf(q float64, values []float64) float64 {
+	sort.Float64s(values)
+
+	rank := q * float64(len(values)-1)
+	lower := math.Floor(rank)
+	upper := math.Ceil(rank)
+	weight := rank - lower
+
+	return values[int(lower)]*(1-weight) + values[int(upper)]*weight
+}
+
+func (a aggregate) eval(ev evaluation) []Result {
+	results := a.expr.eval(ev)
+	if len(results) == 0 {
+		return nil
+	}
+
+	value := results[0].Value
+	for _, r := range results[1:] {
+		switch a.op {
+		case opSum, opAvg:
+			value += r.Value
+		case opMin:
+			value = math.Min(value, r.Value)
+		case opMax:
+			value = math.Max(value, r.Value)
+		}
+	}
+	if a.op == opAvg {
+		value /= float64(len(results))
+	}
+
+	return []Result{{Value: value}}
+}
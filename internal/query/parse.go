@@ -0,0 +1,307 @@
+// Package query evaluates expressions over the stored metrics and their
+// recent history, as served by GET /api/v1/query.
+//
+// An expression is a selector or a function call:
+//
+//	cpu.load                      current value of the metrics named cpu.load
+//	http.*                        current value of the metrics whose name starts with "http."
+//	rate(http.requests[5m])       per-second increase of counters over the window
+//	quantile(0.95, latency[10m])  quantile of the gauge samples within the window
+//	sum(expr)                     sum of the values of expr; also avg, min and max
+//
+// Selectors match metric names exactly or, when they end with "*", by prefix.
+// Names may carry labels, as in http.requests{code="200",method="GET"}, and
+// names with delimiters can be quoted, as in "disk (sda)". Plain selectors
+// report gauge values and counter totals. Windows are Go durations such as
+// 30s, 5m or 1h. Aggregations take any expression, for example
+// sum(rate(http.*[1m])), and report a single value without an ID.
+//
+// Windows are evaluated over the in-memory history, which keeps a bounded
+// number of samples per series updated since the server started. When the
+// history doesn't reach back to the start of a window, rates cover the time
+// since the oldest sample instead. Series without samples are left out.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a parsed expression.
+type Expr interface {
+	eval(ev evaluation) []Result
+}
+
+// selector matches metric names exactly or by prefix.
+type selector struct {
+	name   string
+	prefix bool
+}
+
+func (s selector) matches(id string) bool {
+	if s.prefix {
+		return strings.HasPrefix(id, s.name)
+	}
+	return id == s.name
+}
+
+// current is a plain selector reporting the current values.
+type current struct {
+	selector selector
+}
+
+// rate is the per-second increase of the selected counters over the window.
+type rate struct {
+	selector selector
+	window   time.Duration
+}
+
+// quantile is the q-quantile of the samples of the selected gauges within the window.
+type quantile struct {
+	q        float64
+	selector selector
+	window   time.Duration
+}
+
+// aggregate reduces the values of an expression to one.
+type aggregate struct {
+	op   string
+	expr Expr
+}
+
+const (
+	opSum = "sum"
+	opAvg = "avg"
+	opMin = "min"
+	opMax = "max"
+)
+
+// delimiters end metric names, function names, numbers and durations, unless
+// they are quoted or within the braces of labels.
+const delimiters = "()[], \t\r\n"
+
+type parser struct {
+	input string
+	pos   int
+}
+
+// Parse parses an expression.
+func Parse(input string) (Expr, error) {
+	p := &parser{input: input}
+
+	expr, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+
+	return expr, nil
+}
+
+func (p *parser) expr() (Expr, error) {
+	start := p.pos
+	word := p.word()
+	if word == "" {
+		return nil, p.errorf("expected a metric name or a function")
+	}
+
+	if !p.accept('(') {
+		sel, err := p.selector(word, start)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek('[') {
+			return nil, p.errorf("windows are only allowed in rate and quantile")
+		}
+		return current{selector: sel}, nil
+	}
+
+	var expr Expr
+	switch word {
+	case "rate":
+		sel, window, err := p.rangeSelector()
+		if err != nil {
+			return nil, err
+		}
+		expr = rate{selector: sel, window: window}
+	case "quantile":
+		q, err := p.quantile()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		sel, window, err := p.rangeSelector()
+		if err != nil {
+			return nil, err
+		}
+		expr = quantile{q: q, selector: sel, window: window}
+	case opSum, opAvg, opMin, opMax:
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		expr = aggregate{op: word, expr: inner}
+	default:
+		return nil, fmt.Errorf("unknown function %q at position %d", word, start)
+	}
+
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+
+	return expr, nil
+}
+
+// selector parses a metric name, optionally ending with "*". A quoted name is unquoted.
+func (p *parser) selector(word string, start int) (selector, error) {
+	name, prefix := strings.CutSuffix(word, "*")
+
+	depth := 0
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '"':
+			end, ok := skipQuoted(name, i)
+			if !ok {
+				return selector{}, fmt.Errorf("unterminated quote at position %d", start+i)
+			}
+			i = end - 1
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return selector{}, fmt.Errorf("unexpected \"}\" at position %d", start+i)
+			}
+		case '*':
+			return selector{}, fmt.Errorf("\"*\" is only allowed at the end of a metric name at position %d", start)
+		}
+	}
+	if depth > 0 {
+		return selector{}, fmt.Errorf("unclosed \"{\" at position %d", start)
+	}
+
+	if strings.HasPrefix(name, `"`) {
+		unquoted, err := strconv.Unquote(name)
+		if err != nil {
+			return selector{}, fmt.Errorf("invalid quoted metric name at position %d", start)
+		}
+		name = unquoted
+	}
+
+	return selector{name: name, prefix: prefix}, nil
+}
+
+// rangeSelector parses a selector followed by a window, as in http.*[5m].
+func (p *parser) rangeSelector() (selector, time.Duration, error) {
+	start := p.pos
+	word := p.word()
+	if word == "" {
+		return selector{}, 0, p.errorf("expected a metric name")
+	}
+	sel, err := p.selector(word, start)
+	if err != nil {
+		return selector{}, 0, err
+	}
+
+	if err := p.expect('['); err != nil {
+		return selector{}, 0, err
+	}
+	start = p.pos
+	window, err := time.ParseDuration(p.word())
+	if err != nil || window <= 0 {
+		return selector{}, 0, fmt.Errorf("invalid window at position %d", start)
+	}
+	if err := p.expect(']'); err != nil {
+		return selector{}, 0, err
+	}
+
+	return sel, window, nil
+}
+
+func (p *parser) quantile() (float64, error) {
+	start := p.pos
+	q, err := strconv.ParseFloat(p.word(), 64)
+	if err != nil || q < 0 || q > 1 {
+		return 0, fmt.Errorf("quantile must be a number from 0 to 1 at position %d", start)
+	}
+
+	return q, nil
+}
+
+// word reads up to the next delimiter outside quotes and braces, skipping
+// leading spaces.
+func (p *parser) word() string {
+	p.skipSpace()
+	start := p.pos
+	depth := 0
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		switch {
+		case c == '"':
+			p.pos, _ = skipQuoted(p.input, p.pos)
+			continue
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case depth == 0 && strings.IndexByte(delimiters, c) >= 0:
+			return p.input[start:p.pos]
+		}
+		p.pos++
+	}
+
+	return p.input[start:p.pos]
+}
+
+// skipQuoted returns the position after the string quoted at i, honoring
+// backslash escapes. It reports false and the end of s if the quote isn't closed.
+func skipQuoted(s string, i int) (int, bool) {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, true
+		}
+	}
+
+	return len(s), false
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) peek(c byte) bool {
+	p.skipSpace()
+	return p.pos < len(p.input) && p.input[p.pos] == c
+}
+
+func (p *parser) accept(c byte) bool {
+	if !p.peek(c) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) expect(c byte) error {
+	if !p.accept(c) {
+		return p.errorf("expected %q", c)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf(format+" at position %d", append(args, p.pos)...)
+}
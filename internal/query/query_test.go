@@ -0,0 +1,199 @@
+package query
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/history"
+	"github.com/koyif/metrics/internal/models"
+)
+
+type metrics struct {
+	counters map[string]int64
+	gauges   map[string]float64
+}
+
+func (m metrics) AllMetrics() []models.Metrics {
+	all := make([]models.Metrics, 0, len(m.counters)+len(m.gauges))
+	for id, delta := range m.counters {
+		all = append(all, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+	}
+	for id, value := range m.gauges {
+		all = append(all, models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+	}
+	return all
+}
+
+type fakeHistory []history.Series
+
+func (h fakeHistory) Select(mtype string, match func(id string) bool) []history.Series {
+	var selected []history.Series
+	for _, s := range h {
+		if s.MType == mtype && match(s.ID) {
+			selected = append(selected, s)
+		}
+	}
+	return selected
+}
+
+var now = time.Unix(10000, 0)
+
+// samples builds samples from pairs of seconds before now and values.
+func samples(pairs ...float64) []history.Sample {
+	out := make([]history.Sample, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		out = append(out, history.Sample{Timestamp: now.Add(-time.Duration(pairs[i]) * time.Second), Value: pairs[i+1]})
+	}
+	return out
+}
+
+func allowAll(string) bool { return true }
+
+func newEngine() *Engine {
+	return NewEngine(
+		metrics{
+			counters: map[string]int64{
+				"http.requests": 500, "http.errors": 7, "db.queries": 40,
+				`api{code="200",path="/a, b"}`: 3, `api{code="500",path="/a, b"}`: 1,
+			},
+			gauges: map[string]float64{"http.latency": 0.2, "cpu.load": 0.5, "cpu.temp": 60, "disk (sda)": 2},
+		},
+		fakeHistory{
+			// 120 before the window, 300 at its end: 3 per second over 60s.
+			{ID: "http.requests", MType: models.Counter, Samples: samples(90, 100, 60, 120, 30, 200, 0, 300)},
+			// History starts within the window: 20 over the last 10s.
+			{ID: "http.errors", MType: models.Counter, Samples: samples(10, 5, 0, 25)},
+			// Not updated within the window.
+			{ID: "db.queries", MType: models.Counter, Samples: samples(120, 40)},
+			{ID: "http.latency", MType: models.Gauge, Samples: samples(120, 100, 50, 1, 40, 2, 30, 3, 20, 4, 10, 5)},
+			{ID: "cpu.load", MType: models.Gauge, Samples: samples(10, 0.5)},
+		},
+	)
+}
+
+func eval(t *testing.T, e *Engine, input string) []Result {
+	t.Helper()
+
+	expr, err := Parse(input)
+	require.NoError(t, err, input)
+	return e.Eval(expr, now, allowAll)
+}
+
+func TestEngine_Eval(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []Result
+	}{
+		{
+			query: "cpu.load",
+			want:  []Result{{ID: "cpu.load", MType: models.Gauge, Value: 0.5}},
+		},
+		{
+			query: "http.*",
+			want: []Result{
+				{ID: "http.errors", MType: models.Counter, Value: 7},
+				{ID: "http.latency", MType: models.Gauge, Value: 0.2},
+				{ID: "http.requests", MType: models.Counter, Value: 500},
+			},
+		},
+		{
+			query: "rate(http.*[1m])",
+			want: []Result{
+				{ID: "http.errors", MType: models.Counter, Value: 2},
+				{ID: "http.requests", MType: models.Counter, Value: 3},
+			},
+		},
+		{
+			query: "rate(db.queries[1m])",
+			want:  []Result{{ID: "db.queries", MType: models.Counter, Value: 0}},
+		},
+		{
+			query: "quantile(0.5, http.latency[1m])",
+			want:  []Result{{ID: "http.latency", MType: models.Gauge, Value: 3}},
+		},
+		{
+			query: "quantile(0.9, http.latency[1m])",
+			want:  []Result{{ID: "http.latency", MType: models.Gauge, Value: 4.6}},
+		},
+		{query: "sum(cpu.*)", want: []Result{{Value: 60.5}}},
+		{query: "avg(cpu.*)", want: []Result{{Value: 30.25}}},
+		{query: "min(cpu.*)", want: []Result{{Value: 0.5}}},
+		{query: "max(cpu.*)", want: []Result{{Value: 60}}},
+		{query: " sum ( rate ( http.* [ 1m ] ) ) ", want: []Result{{Value: 5}}},
+		{
+			query: `api{code="200",path="/a, b"}`,
+			want:  []Result{{ID: `api{code="200",path="/a, b"}`, MType: models.Counter, Value: 3}},
+		},
+		{query: "sum(api*)", want: []Result{{Value: 4}}},
+		{
+			query: `"disk (sda)"`,
+			want:  []Result{{ID: "disk (sda)", MType: models.Gauge, Value: 2}},
+		},
+		{query: "max(missing)", want: nil},
+		{query: "quantile(1, cpu.temp[1m])", want: nil},
+	}
+
+	e := newEngine()
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := eval(t, e, tt.query)
+			require.Len(t, got, len(tt.want))
+			for i := range tt.want {
+				assert.Equal(t, tt.want[i].ID, got[i].ID)
+				assert.Equal(t, tt.want[i].MType, got[i].MType)
+				assert.InDelta(t, tt.want[i].Value, got[i].Value, 1e-9)
+			}
+		})
+	}
+}
+
+func TestEngine_EvalAllow(t *testing.T) {
+	expr, err := Parse("sum(http.*)")
+	require.NoError(t, err)
+
+	got := newEngine().Eval(expr, now, func(id string) bool { return !strings.HasSuffix(id, "requests") })
+	require.Len(t, got, 1)
+	assert.InDelta(t, 7.2, got[0].Value, 1e-9)
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"rate(http.requests)",
+		"rate(http.requests[0s])",
+		"rate(http.requests[5x])",
+		"http.requests[5m]",
+		"quantile(1.5, latency[5m])",
+		"quantile(latency[5m])",
+		"median(latency)",
+		"sum(cpu.*",
+		"sum(cpu.*))",
+		"cpu.*.load",
+		"sum()",
+		`api{code="200"`,
+		`api{code="200}`,
+		`api}`,
+		`"unterminated`,
+	} {
+		_, err := Parse(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParse_LabeledID(t *testing.T) {
+	expr, err := Parse(`rate(x{a="1",b="2 (3)"}[1m])`)
+	require.NoError(t, err)
+	assert.Equal(t, rate{selector: selector{name: `x{a="1",b="2 (3)"}`}, window: time.Minute}, expr)
+
+	expr, err = Parse(`x{path="/*"}*`)
+	require.NoError(t, err)
+	assert.Equal(t, current{selector: selector{name: `x{path="/*"}`, prefix: true}}, expr, "stars in label values are not prefixes")
+
+	expr, err = Parse(`"a \"b\" (c)"`)
+	require.NoError(t, err)
+	assert.Equal(t, current{selector: selector{name: `a "b" (c)`}}, expr)
+}
@@ -0,0 +1,469 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/validation"
+)
+
+// idleTimeout is how long a client stays unseen before its state is dropped.
+const idleTimeout = 10 * time.Minute
+
+// Rejection reasons reported in ExceededError and in usage statistics.
+const (
+	ReasonMaxSeries          = "max_series"
+	ReasonNewSeriesPerMinute = "new_series_per_minute"
+	ReasonSeriesPerClient    = "series_per_client"
+)
+
+// ErrLimitExceeded is returned (wrapped in ExceededError) when admitting
+// a request would exceed one of the configured series limits.
+var ErrLimitExceeded = errors.New("series limit exceeded")
+
+// ExceededError describes which limit rejected a request.
+type ExceededError struct {
+	Reason    string
+	Client    string
+	NewSeries int
+	Limit     int
+
+	// rejected holds the reason of every series ReservePartial rejected.
+	rejected map[seriesKey]string
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s: %s (client %s, %d new series, limit %d)", ErrLimitExceeded, e.Reason, e.Client, e.NewSeries, e.Limit)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Limits holds the configured series quotas. A zero value disables the corresponding limit.
+type Limits struct {
+	MaxSeries             int `json:"max_series"`
+	MaxNewSeriesPerMinute int `json:"max_new_series_per_minute"`
+	MaxSeriesPerClient    int `json:"max_series_per_client"`
+}
+
+// Enabled reports whether at least one limit is configured.
+func (l Limits) Enabled() bool {
+	return l.MaxSeries > 0 || l.MaxNewSeriesPerMinute > 0 || l.MaxSeriesPerClient > 0
+}
+
+// ClientUsage reports how many series a single client has created and how many were rejected.
+type ClientUsage struct {
+	Client         string `json:"client"`
+	Series         int    `json:"series"`
+	RejectedSeries int64  `json:"rejected_series"`
+}
+
+// Usage is a point-in-time view of the limiter state exposed through the admin API.
+type Usage struct {
+	Limits           Limits           `json:"limits"`
+	TotalSeries      int              `json:"total_series"`
+	NewSeriesWindow  int              `json:"new_series_current_minute"`
+	RejectedByReason map[string]int64 `json:"rejected_by_reason"`
+	Clients          []ClientUsage    `json:"clients"`
+}
+
+type clientState struct {
+	series   seriesSet
+	rejected int64
+	lastSeen time.Time
+}
+
+// seriesKey identifies a series: a counter and a gauge with the same ID are
+// different series.
+type seriesKey struct {
+	mtype string
+	id    string
+}
+
+type seriesState struct {
+	// pending is the number of reservations holding the series before it is stored.
+	pending int
+	stored  bool
+}
+
+// seriesSet holds the known series. A series only reserved so far is removed
+// again when every reservation holding it is released.
+type seriesSet map[seriesKey]*seriesState
+
+// hold adds the series to the reservation, creating it if it is unknown.
+func (s seriesSet) hold(key seriesKey) {
+	state, ok := s[key]
+	if !ok {
+		state = &seriesState{}
+		s[key] = state
+	}
+	state.pending++
+}
+
+// settle ends a reservation of the series and reports whether it was removed.
+func (s seriesSet) settle(key seriesKey, stored bool) bool {
+	state := s[key]
+	state.pending--
+	state.stored = state.stored || stored
+	if state.pending == 0 && !state.stored {
+		delete(s, key)
+		return true
+	}
+
+	return false
+}
+
+// pending reports whether a reservation still holds one of the series.
+func (s seriesSet) pending() bool {
+	for _, state := range s {
+		if state.pending > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// holding returns the series of the keys that are unknown or only reserved so far.
+func (s seriesSet) holding(keys []seriesKey) (unknown, held []seriesKey) {
+	for _, key := range keys {
+		state, ok := s[key]
+		switch {
+		case !ok:
+			unknown = append(unknown, key)
+			held = append(held, key)
+		case !state.stored:
+			held = append(held, key)
+		}
+	}
+
+	return unknown, held
+}
+
+// Limiter enforces cardinality limits on ingested metrics.
+// It keeps track of every known series, the series each client has written,
+// and the number of series created within the current minute. Clients idle
+// for ten minutes are forgotten unless the per-client limit still needs
+// their series.
+//
+// A request is admitted or rejected as a whole: when any limit would be exceeded,
+// none of its new series are recorded. The new series of an admitted request are
+// reserved until the request is stored, and released if storing fails, so they
+// only take up quota once they exist.
+type Limiter struct {
+	limits Limits
+	now    func() time.Time
+
+	mu          sync.Mutex
+	series      seriesSet
+	clients     map[string]*clientState
+	windowStart time.Time
+	windowCount int
+	rejected    map[string]int64
+	lastSweep   time.Time
+}
+
+// NewLimiter creates a limiter with the given limits.
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits:   limits,
+		now:      time.Now,
+		series:   make(seriesSet),
+		clients:  make(map[string]*clientState),
+		rejected: make(map[string]int64),
+	}
+}
+
+// Seed registers series of the type that already exist in storage, e.g. restored
+// from a file or present in the database, so that they count towards the total
+// limit without being attributed to any client.
+func (l *Limiter) Seed(mtype string, ids []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, id := range ids {
+		l.series[seriesKey{mtype: mtype, id: id}] = &seriesState{stored: true}
+	}
+}
+
+// Reservation holds the new series of an admitted request until the request
+// is stored. Exactly one of Commit and Release must be called. A nil
+// Reservation, returned when no limit is configured, does nothing.
+type Reservation struct {
+	limiter *Limiter
+	client  string
+	global  []seriesKey
+	own     []seriesKey
+	window  time.Time
+	done    bool
+}
+
+// Reserve checks whether the client may write the given metrics and reserves
+// any new series on success. Returns an *ExceededError when a limit is hit.
+func (l *Limiter) Reserve(client string, metrics []models.Metrics) (*Reservation, error) {
+	if !l.limits.Enabled() {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cs := l.begin(client)
+	keys := seriesKeys(metrics)
+	newGlobal, global := l.series.holding(keys)
+	newForClient, own := cs.series.holding(keys)
+
+	if err := l.check(client, len(newGlobal), len(newForClient), cs); err != nil {
+		l.reject(cs, err)
+		return nil, err
+	}
+
+	r := &Reservation{limiter: l, client: client, window: l.windowStart}
+	r.hold(cs, global, own, len(newGlobal))
+
+	return r, nil
+}
+
+// ReservePartial reserves the series of the metrics that fit within the limits
+// and returns the metrics admitted. Known series are always admitted and new
+// ones in order while they fit. The error is an *ExceededError counting the
+// rejected series, with the reason of the first one.
+func (l *Limiter) ReservePartial(client string, metrics []models.Metrics) ([]models.Metrics, *Reservation, error) {
+	if !l.limits.Enabled() {
+		return metrics, nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cs := l.begin(client)
+	r := &Reservation{limiter: l, client: client, window: l.windowStart}
+	var exceeded *ExceededError
+	for _, key := range seriesKeys(metrics) {
+		newGlobal, global := l.series.holding([]seriesKey{key})
+		newForClient, own := cs.series.holding([]seriesKey{key})
+
+		if err := l.check(client, len(newGlobal), len(newForClient), cs); err != nil {
+			l.reject(cs, err)
+			if exceeded == nil {
+				exceeded = &ExceededError{Reason: err.Reason, Client: client, Limit: err.Limit, rejected: make(map[seriesKey]string)}
+			}
+			exceeded.rejected[key] = err.Reason
+			exceeded.NewSeries++
+			continue
+		}
+		r.hold(cs, global, own, len(newGlobal))
+	}
+	if exceeded == nil {
+		return metrics, r, nil
+	}
+
+	admitted := make([]models.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		if _, ok := exceeded.rejected[seriesKey{mtype: metric.MType, id: metric.ID}]; !ok {
+			admitted = append(admitted, metric)
+		}
+	}
+
+	return admitted, r, exceeded
+}
+
+// Partition splits the metrics passed to ReservePartial by the error it
+// returned, like validation.Partition: it returns the admitted metrics with
+// their indexes, taken from the batch indexes of the metrics, and reports the
+// rejected ones as violations, so they can be listed next to the invalid ones.
+func Partition(metrics []models.Metrics, indexes []int, err error) ([]models.Metrics, []int, []validation.Violation) {
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || len(exceeded.rejected) == 0 {
+		return metrics, indexes, nil
+	}
+
+	admitted := make([]models.Metrics, 0, len(metrics))
+	admittedIndexes := make([]int, 0, len(metrics))
+	var violations []validation.Violation
+	for i, metric := range metrics {
+		reason, ok := exceeded.rejected[seriesKey{mtype: metric.MType, id: metric.ID}]
+		if !ok {
+			admitted = append(admitted, metric)
+			admittedIndexes = append(admittedIndexes, indexes[i])
+			continue
+		}
+		violations = append(violations, validation.Violation{
+			Index:   indexes[i],
+			ID:      metric.ID,
+			MType:   metric.MType,
+			Reason:  reason,
+			Message: fmt.Sprintf("%s: %s", ErrLimitExceeded, reason),
+		})
+	}
+
+	return admitted, admittedIndexes, violations
+}
+
+// begin returns the state of the client and starts a new window when the
+// current one is over.
+func (l *Limiter) begin(client string) *clientState {
+	now := l.now()
+	l.sweep(now)
+
+	cs, ok := l.clients[client]
+	if !ok {
+		cs = &clientState{series: make(seriesSet)}
+		l.clients[client] = cs
+	}
+	cs.lastSeen = now
+
+	if now.Sub(l.windowStart) >= time.Minute {
+		l.windowStart = now.Truncate(time.Minute)
+		l.windowCount = 0
+	}
+
+	return cs
+}
+
+// sweep drops the state of clients that have been idle for a while to keep
+// memory bounded. Clients with reservations in flight are kept, and so are
+// the ones owning series while the per-client limit counts them.
+// Must be called with l.mu held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTimeout {
+		return
+	}
+	l.lastSweep = now
+
+	for client, cs := range l.clients {
+		if now.Sub(cs.lastSeen) < idleTimeout || cs.series.pending() {
+			continue
+		}
+		if l.limits.MaxSeriesPerClient > 0 && len(cs.series) > 0 {
+			continue
+		}
+		delete(l.clients, client)
+	}
+}
+
+func (l *Limiter) reject(cs *clientState, err *ExceededError) {
+	cs.rejected += int64(err.NewSeries)
+	l.rejected[err.Reason] += int64(err.NewSeries)
+}
+
+// seriesKeys returns the distinct series of the metrics in order.
+func seriesKeys(metrics []models.Metrics) []seriesKey {
+	keys := make([]seriesKey, 0, len(metrics))
+	seen := make(map[seriesKey]struct{}, len(metrics))
+	for _, metric := range metrics {
+		key := seriesKey{mtype: metric.MType, id: metric.ID}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// hold adds the series to the reservation; created of them are new.
+func (r *Reservation) hold(cs *clientState, global, own []seriesKey, created int) {
+	l := r.limiter
+	for _, key := range global {
+		l.series.hold(key)
+	}
+	for _, key := range own {
+		cs.series.hold(key)
+	}
+	l.windowCount += created
+	r.global = append(r.global, global...)
+	r.own = append(r.own, own...)
+}
+
+// Commit keeps the reserved series once the request is stored.
+func (r *Reservation) Commit() {
+	r.settle(true)
+}
+
+// Release frees the reserved series when the request wasn't stored.
+func (r *Reservation) Release() {
+	r.settle(false)
+}
+
+func (r *Reservation) settle(stored bool) {
+	if r == nil || r.done {
+		return
+	}
+	r.done = true
+
+	l := r.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	removed := 0
+	for _, key := range r.global {
+		if l.series.settle(key, stored) {
+			removed++
+		}
+	}
+	if cs, ok := l.clients[r.client]; ok {
+		for _, key := range r.own {
+			cs.series.settle(key, stored)
+		}
+	}
+	if l.windowStart.Equal(r.window) {
+		l.windowCount = max(l.windowCount-removed, 0)
+	}
+}
+
+// check reports the limit exceeded by the new series. Known series are always
+// admitted, even when more series than the limits allow were seeded.
+func (l *Limiter) check(client string, newGlobal, newForClient int, cs *clientState) *ExceededError {
+	if l.limits.MaxSeries > 0 && newGlobal > 0 && len(l.series)+newGlobal > l.limits.MaxSeries {
+		return &ExceededError{Reason: ReasonMaxSeries, Client: client, NewSeries: newGlobal, Limit: l.limits.MaxSeries}
+	}
+
+	if l.limits.MaxNewSeriesPerMinute > 0 && newGlobal > 0 && l.windowCount+newGlobal > l.limits.MaxNewSeriesPerMinute {
+		return &ExceededError{Reason: ReasonNewSeriesPerMinute, Client: client, NewSeries: newGlobal, Limit: l.limits.MaxNewSeriesPerMinute}
+	}
+
+	if l.limits.MaxSeriesPerClient > 0 && newForClient > 0 && len(cs.series)+newForClient > l.limits.MaxSeriesPerClient {
+		return &ExceededError{Reason: ReasonSeriesPerClient, Client: client, NewSeries: newForClient, Limit: l.limits.MaxSeriesPerClient}
+	}
+
+	return nil
+}
+
+// Usage returns the current limiter state with clients sorted by name.
+func (l *Limiter) Usage() Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	usage := Usage{
+		Limits:           l.limits,
+		TotalSeries:      len(l.series),
+		RejectedByReason: make(map[string]int64, len(l.rejected)),
+		Clients:          make([]ClientUsage, 0, len(l.clients)),
+	}
+	if l.now().Sub(l.windowStart) < time.Minute {
+		usage.NewSeriesWindow = l.windowCount
+	}
+	for reason, count := range l.rejected {
+		usage.RejectedByReason[reason] = count
+	}
+	for client, cs := range l.clients {
+		usage.Clients = append(usage.Clients, ClientUsage{
+			Client:         client,
+			Series:         len(cs.series),
+			RejectedSeries: cs.rejected,
+		})
+	}
+	slices.SortFunc(usage.Clients, func(a, b ClientUsage) int {
+		return strings.Compare(a.Client, b.Client)
+	})
+
+	return usage
+}
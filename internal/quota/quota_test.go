@@ -0,0 +1,222 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+func gauges(names ...string) []models.Metrics {
+	metrics := make([]models.Metrics, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, models.Metrics{ID: name, MType: models.Gauge})
+	}
+	return metrics
+}
+
+// admit reserves the series of the metrics and commits them, as after a successful store.
+func admit(l *Limiter, client string, metrics []models.Metrics) error {
+	reservation, err := l.Reserve(client, metrics)
+	reservation.Commit()
+	return err
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l := NewLimiter(Limits{})
+
+	for range 10 {
+		require.NoError(t, admit(l, "10.0.0.1", gauges("a", "b", "c")))
+	}
+}
+
+func TestLimiter_MaxSeries(t *testing.T) {
+	l := NewLimiter(Limits{MaxSeries: 3})
+	l.Seed(models.Gauge, []string{"existing"})
+
+	require.NoError(t, admit(l, "10.0.0.1", gauges("a", "b")))
+	require.NoError(t, admit(l, "10.0.0.2", gauges("a", "b")), "known series must not count again")
+
+	err := admit(l, "10.0.0.1", gauges("c"))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+
+	var exceeded *ExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.Equal(t, ReasonMaxSeries, exceeded.Reason)
+
+	usage := l.Usage()
+	assert.Equal(t, 3, usage.TotalSeries)
+	assert.Equal(t, int64(1), usage.RejectedByReason[ReasonMaxSeries])
+}
+
+func TestLimiter_RejectedBatchRecordsNothing(t *testing.T) {
+	l := NewLimiter(Limits{MaxSeries: 2})
+
+	require.Error(t, admit(l, "10.0.0.1", gauges("a", "b", "c")))
+	assert.Equal(t, 0, l.Usage().TotalSeries)
+
+	require.NoError(t, admit(l, "10.0.0.1", gauges("a", "b")))
+}
+
+func TestLimiter_NewSeriesPerMinute(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(Limits{MaxNewSeriesPerMinute: 2})
+	l.now = func() time.Time { return now }
+
+	require.NoError(t, admit(l, "10.0.0.1", gauges("a", "b")))
+
+	err := admit(l, "10.0.0.1", gauges("c"))
+	var exceeded *ExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.Equal(t, ReasonNewSeriesPerMinute, exceeded.Reason)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, admit(l, "10.0.0.1", gauges("c")))
+}
+
+func TestLimiter_SeriesPerClient(t *testing.T) {
+	l := NewLimiter(Limits{MaxSeriesPerClient: 2})
+
+	require.NoError(t, admit(l, "10.0.0.1", gauges("a", "b")))
+	require.NoError(t, admit(l, "10.0.0.2", gauges("a", "b")))
+
+	err := admit(l, "10.0.0.1", gauges("c", "d"))
+	var exceeded *ExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.Equal(t, ReasonSeriesPerClient, exceeded.Reason)
+
+	usage := l.Usage()
+	require.Len(t, usage.Clients, 2)
+	assert.Equal(t, ClientUsage{Client: "10.0.0.1", Series: 2, RejectedSeries: 2}, usage.Clients[0])
+	assert.Equal(t, ClientUsage{Client: "10.0.0.2", Series: 2}, usage.Clients[1])
+}
+
+func TestLimiter_ReleaseFreesSeries(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(Limits{MaxSeries: 2, MaxNewSeriesPerMinute: 2, MaxSeriesPerClient: 2})
+	l.now = func() time.Time { return now }
+
+	first, err := l.Reserve("10.0.0.1", gauges("a", "b"))
+	require.NoError(t, err)
+	_, err = l.Reserve("10.0.0.2", gauges("c"))
+	require.Error(t, err, "reserved series count until released")
+
+	second, err := l.Reserve("10.0.0.2", gauges("a"))
+	require.NoError(t, err, "a reserved series is not new")
+	first.Release()
+	first.Release()
+	second.Commit()
+
+	usage := l.Usage()
+	assert.Equal(t, 1, usage.TotalSeries, "the series stored by another request is kept")
+	assert.Equal(t, 1, usage.NewSeriesWindow)
+	assert.Equal(t, []ClientUsage{
+		{Client: "10.0.0.1"},
+		{Client: "10.0.0.2", Series: 1, RejectedSeries: 1},
+	}, usage.Clients)
+
+	require.NoError(t, admit(l, "10.0.0.1", gauges("b")), "released series free their quota")
+}
+
+func TestLimiter_SeriesKeyedByType(t *testing.T) {
+	l := NewLimiter(Limits{MaxSeries: 2})
+	l.Seed(models.Counter, []string{"requests"})
+
+	require.NoError(t, admit(l, "10.0.0.1", []models.Metrics{{ID: "requests", MType: models.Counter}}))
+	require.NoError(t, admit(l, "10.0.0.1", gauges("requests")), "a gauge is a new series")
+	assert.Equal(t, 2, l.Usage().TotalSeries)
+	require.Error(t, admit(l, "10.0.0.1", []models.Metrics{{ID: "errors", MType: models.Counter}}))
+}
+
+func TestLimiter_RejectionsPerReason(t *testing.T) {
+	l := NewLimiter(Limits{MaxSeries: 3, MaxSeriesPerClient: 2})
+	l.Seed(models.Gauge, []string{"a", "b"})
+
+	// Three series are new for the client, but only two are new to the server.
+	err := admit(l, "10.0.0.1", gauges("b", "c", "d"))
+	var exceeded *ExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.Equal(t, ReasonMaxSeries, exceeded.Reason)
+
+	usage := l.Usage()
+	assert.Equal(t, map[string]int64{ReasonMaxSeries: 2}, usage.RejectedByReason)
+	assert.Equal(t, int64(2), usage.Clients[0].RejectedSeries)
+}
+
+func TestLimiter_ReservePartial(t *testing.T) {
+	l := NewLimiter(Limits{MaxSeries: 3})
+	l.Seed(models.Gauge, []string{"a", "b", "c", "d"})
+
+	require.NoError(t, admit(l, "10.0.0.1", gauges("a")), "known series are admitted over the limit")
+
+	admitted, reservation, err := l.ReservePartial("10.0.0.1", gauges("e", "a", "f", "b"))
+	reservation.Commit()
+	var exceeded *ExceededError
+	require.ErrorAs(t, err, &exceeded)
+	assert.Equal(t, ReasonMaxSeries, exceeded.Reason)
+	assert.Equal(t, 2, exceeded.NewSeries)
+	assert.Equal(t, gauges("a", "b"), admitted)
+	assert.Equal(t, int64(2), l.Usage().RejectedByReason[ReasonMaxSeries])
+}
+
+func TestPartition(t *testing.T) {
+	l := NewLimiter(Limits{MaxSeriesPerClient: 1})
+
+	metrics := gauges("a", "b", "a")
+	_, reservation, err := l.ReservePartial("10.0.0.1", metrics)
+	reservation.Commit()
+
+	admitted, indexes, violations := Partition(metrics, []int{0, 2, 5}, err)
+	assert.Equal(t, gauges("a", "a"), admitted)
+	assert.Equal(t, []int{0, 5}, indexes, "indexes are those of the batch")
+	require.Len(t, violations, 1)
+	assert.Equal(t, 2, violations[0].Index)
+	assert.Equal(t, "b", violations[0].ID)
+	assert.Equal(t, ReasonSeriesPerClient, violations[0].Reason)
+
+	admitted, indexes, violations = Partition(metrics, []int{0, 1, 2}, nil)
+	assert.Equal(t, metrics, admitted)
+	assert.Equal(t, []int{0, 1, 2}, indexes)
+	assert.Empty(t, violations)
+}
+
+func TestLimiter_SweepsIdleClients(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		want   []string
+	}{
+		{name: "without per-client limit", limits: Limits{MaxSeries: 10}, want: []string{"10.0.0.2", "10.0.0.3"}},
+		{name: "with per-client limit", limits: Limits{MaxSeriesPerClient: 10}, want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.limits)
+			now := time.Now()
+			l.now = func() time.Time { return now }
+
+			require.NoError(t, admit(l, "10.0.0.1", gauges("a")))
+			// 10.0.0.2 has a reservation in flight while idle.
+			pending, err := l.Reserve("10.0.0.2", gauges("b"))
+			require.NoError(t, err)
+
+			now = now.Add(idleTimeout)
+			require.NoError(t, admit(l, "10.0.0.3", gauges("c")))
+			pending.Commit()
+
+			usage := l.Usage()
+			clients := make([]string, 0, len(usage.Clients))
+			for _, c := range usage.Clients {
+				clients = append(clients, c.Client)
+			}
+			assert.Equal(t, tt.want, clients)
+			assert.Equal(t, 3, usage.TotalSeries, "series outlive their clients")
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idleTimeout is how long a bucket may stay unused before it is evicted.
+const idleTimeout = 10 * time.Minute
+
+// Rule defines the token bucket parameters applied to clients from a subnet.
+// A zero Rate means that clients matching the rule are not limited.
+type Rule struct {
+	Network *net.IPNet
+	Rate    float64
+	Burst   int
+}
+
+type bucket struct {
+	rule     *Rule
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Limiter is a token bucket rate limiter keyed by client IP.
+// Each client gets its own bucket; its rate and burst come from the most
+// specific matching CIDR rule, falling back to the global rule.
+type Limiter struct {
+	global Rule
+	rules  []Rule
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New creates a rate limiter with the global rate (requests per second) and burst,
+// plus optional per-CIDR overrides. A burst below one defaults to the rounded-up rate.
+func New(rate float64, burst int, rules []Rule) *Limiter {
+	rules = slices.Clone(rules)
+	// Longer prefixes first, so the most specific rule wins.
+	slices.SortStableFunc(rules, func(a, b Rule) int {
+		aOnes, _ := a.Network.Mask.Size()
+		bOnes, _ := b.Network.Mask.Size()
+		return bOnes - aOnes
+	})
+
+	return &Limiter{
+		global:  Rule{Rate: rate, Burst: defaultBurst(rate, burst)},
+		rules:   rules,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Enabled reports whether any client can be limited at all.
+func (l *Limiter) Enabled() bool {
+	if l.global.Rate > 0 {
+		return true
+	}
+	for _, rule := range l.rules {
+		if rule.Rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow takes a token from the client's bucket. When the bucket is empty it
+// returns false together with the time until the next token becomes available.
+func (l *Limiter) Allow(clientIP string) (bool, time.Duration) {
+	rule := l.ruleFor(clientIP)
+	if rule.Rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[clientIP]
+	if !ok || b.rule != rule {
+		b = &bucket{rule: rule, tokens: float64(rule.Burst), lastSeen: now}
+		l.buckets[clientIP] = b
+	}
+
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.lastSeen).Seconds()*rule.Rate)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second))
+	return false, wait
+}
+
+func (l *Limiter) ruleFor(clientIP string) *Rule {
+	if ip := net.ParseIP(clientIP); ip != nil {
+		for i := range l.rules {
+			if l.rules[i].Network.Contains(ip) {
+				return &l.rules[i]
+			}
+		}
+	}
+
+	return &l.global
+}
+
+// sweep drops buckets that have been idle for a while to keep memory bounded.
+// Must be called with l.mu held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTimeout {
+		return
+	}
+	l.lastSweep = now
+
+	for ip, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= idleTimeout {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// ParseRules parses per-CIDR rules in the form "cidr=rate:burst" separated by commas,
+// e.g. "10.0.0.0/8=100:200,2001:db8::/32=5". The burst part is optional.
+func ParseRules(spec string) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		cidr, limit, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit rule %q: expected cidr=rate[:burst]", item)
+		}
+
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit rule %q: %w", item, err)
+		}
+
+		rateStr, burstStr, hasBurst := strings.Cut(strings.TrimSpace(limit), ":")
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid rate in rule %q", item)
+		}
+
+		burst := 0
+		if hasBurst {
+			burst, err = strconv.Atoi(burstStr)
+			if err != nil || burst < 0 {
+				return nil, fmt.Errorf("invalid burst in rule %q", item)
+			}
+		}
+
+		rules = append(rules, Rule{Network: network, Rate: rate, Burst: defaultBurst(rate, burst)})
+	}
+
+	return rules, nil
+}
+
+// RetryAfterSeconds rounds the wait up to whole seconds, as used by the Retry-After header.
+func RetryAfterSeconds(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+func defaultBurst(rate float64, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	return max(1, int(math.Ceil(rate)))
+}
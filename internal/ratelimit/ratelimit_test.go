@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New(1, 2, nil)
+	l.now = func() time.Time { return now }
+
+	allowed, _ := l.Allow("10.0.0.1")
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("10.0.0.1")
+	assert.True(t, allowed)
+
+	allowed, wait := l.Allow("10.0.0.1")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, wait)
+
+	allowed, _ = l.Allow("10.0.0.2")
+	assert.True(t, allowed, "buckets must be independent per client")
+
+	now = now.Add(time.Second)
+	allowed, _ = l.Allow("10.0.0.1")
+	assert.True(t, allowed, "a token must be refilled after one second")
+}
+
+func TestLimiter_CIDRRules(t *testing.T) {
+	rules, err := ParseRules("10.0.0.0/8=1:1, 10.1.0.0/16=0, 2001:db8::/32=1:1")
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+
+	l := New(0, 0, rules)
+	require.True(t, l.Enabled())
+
+	allowed, _ := l.Allow("10.2.0.1")
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("10.2.0.1")
+	assert.False(t, allowed, "10.0.0.0/8 allows a burst of one")
+
+	for range 5 {
+		allowed, _ = l.Allow("10.1.0.1")
+		assert.True(t, allowed, "the more specific unlimited rule must win")
+	}
+
+	allowed, _ = l.Allow("2001:db8::1")
+	assert.True(t, allowed)
+	allowed, _ = l.Allow("2001:db8::1")
+	assert.False(t, allowed)
+
+	for range 5 {
+		allowed, _ = l.Allow("192.168.0.1")
+		assert.True(t, allowed, "clients outside any rule fall back to the disabled global limit")
+	}
+}
+
+func TestParseRules_Invalid(t *testing.T) {
+	for _, spec := range []string{"10.0.0.0/8", "not-a-cidr=1", "10.0.0.0/8=abc", "10.0.0.0/8=1:x", "10.0.0.0/8=-1"} {
+		_, err := ParseRules(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, 1, RetryAfterSeconds(0))
+	assert.Equal(t, 1, RetryAfterSeconds(100*time.Millisecond))
+	assert.Equal(t, 3, RetryAfterSeconds(2100*time.Millisecond))
+}
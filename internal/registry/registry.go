@@ -0,0 +1,239 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Headers carrying the agent identity on HTTP requests.
+// The same names in lower case are used as gRPC metadata keys.
+const (
+	HeaderAgentID   = "X-Agent-ID"
+	HeaderHostname  = "X-Agent-Hostname"
+	HeaderVersion   = "X-Agent-Version"
+	HeaderStartedAt = "X-Agent-Started-At"
+)
+
+// Transports an agent can report through.
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+const (
+	// DefaultAliveTimeout is how long an agent is considered alive after its last request.
+	DefaultAliveTimeout = time.Minute
+	// maxAgents bounds the registry; the agent seen least recently is evicted first.
+	maxAgents = 10000
+	// maxFieldLength bounds identity values supplied by clients.
+	maxFieldLength = 256
+)
+
+// Identity describes an agent instance. Agents send it with every request,
+// so the registry recovers after a server restart without a separate handshake.
+type Identity struct {
+	ID        string
+	Hostname  string
+	Version   string
+	StartedAt time.Time
+}
+
+// SetHeaders adds the identity to HTTP request headers.
+func (i Identity) SetHeaders(h http.Header) {
+	h.Set(HeaderAgentID, i.ID)
+	h.Set(HeaderHostname, i.Hostname)
+	h.Set(HeaderVersion, i.Version)
+	h.Set(HeaderStartedAt, i.StartedAt.UTC().Format(time.RFC3339))
+}
+
+// MetadataPairs returns the identity as gRPC metadata key-value pairs.
+func (i Identity) MetadataPairs() []string {
+	return []string{
+		strings.ToLower(HeaderAgentID), i.ID,
+		strings.ToLower(HeaderHostname), i.Hostname,
+		strings.ToLower(HeaderVersion), i.Version,
+		strings.ToLower(HeaderStartedAt), i.StartedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// IdentityFromHeaders reads the identity from HTTP request headers.
+// The returned identity has an empty ID if the request was not sent by an agent.
+func IdentityFromHeaders(h http.Header) Identity {
+	return newIdentity(h.Get(HeaderAgentID), h.Get(HeaderHostname), h.Get(HeaderVersion), h.Get(HeaderStartedAt))
+}
+
+// IdentityFromMetadata reads the identity from incoming gRPC metadata.
+func IdentityFromMetadata(md metadata.MD) Identity {
+	get := func(key string) string {
+		if values := md.Get(strings.ToLower(key)); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	return newIdentity(get(HeaderAgentID), get(HeaderHostname), get(HeaderVersion), get(HeaderStartedAt))
+}
+
+func newIdentity(id, hostname, version, startedAt string) Identity {
+	identity := Identity{
+		ID:       truncate(id),
+		Hostname: truncate(hostname),
+		Version:  truncate(version),
+	}
+	if t, err := time.Parse(time.RFC3339, startedAt); err == nil {
+		identity.StartedAt = t
+	}
+
+	return identity
+}
+
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxFieldLength {
+		return s[:maxFieldLength]
+	}
+	return s
+}
+
+// Agent is the registry record of a single agent exposed through the API.
+type Agent struct {
+	ID              string    `json:"id"`
+	Hostname        string    `json:"hostname"`
+	Version         string    `json:"version"`
+	StartedAt       time.Time `json:"started_at"`
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+	Transport       string    `json:"transport"`
+	Address         string    `json:"address"`
+	Requests        int64     `json:"requests"`
+	MetricsReceived int64     `json:"metrics_received"`
+	Alive           bool      `json:"alive"`
+}
+
+// Registry keeps track of the agents reporting to the server.
+type Registry struct {
+	aliveTimeout time.Duration
+	now          func() time.Time
+
+	mu     sync.Mutex
+	agents map[string]*Agent
+}
+
+// New creates an empty registry. A non-positive aliveTimeout falls back to DefaultAliveTimeout.
+func New(aliveTimeout time.Duration) *Registry {
+	if aliveTimeout <= 0 {
+		aliveTimeout = DefaultAliveTimeout
+	}
+
+	return &Registry{
+		aliveTimeout: aliveTimeout,
+		now:          time.Now,
+		agents:       make(map[string]*Agent),
+	}
+}
+
+// Observe records a request from the agent, registering it on first contact.
+// Identity fields sent by the agent replace the stored ones, so a restarted agent
+// shows its new version and start time.
+func (r *Registry) Observe(identity Identity, transport, address string) {
+	if identity.ID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	agent, ok := r.agents[identity.ID]
+	if !ok {
+		if len(r.agents) >= maxAgents {
+			r.evictOldest()
+		}
+		agent = &Agent{ID: identity.ID, FirstSeen: now}
+		r.agents[identity.ID] = agent
+	}
+
+	if identity.Hostname != "" {
+		agent.Hostname = identity.Hostname
+	}
+	if identity.Version != "" {
+		agent.Version = identity.Version
+	}
+	if !identity.StartedAt.IsZero() {
+		agent.StartedAt = identity.StartedAt
+	}
+	agent.LastSeen = now
+	agent.Transport = transport
+	agent.Address = address
+	agent.Requests++
+}
+
+// AddMetrics adds to the number of metrics received from the agent.
+func (r *Registry) AddMetrics(agentID string, count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if agent, ok := r.agents[agentID]; ok {
+		agent.MetricsReceived += int64(count)
+	}
+}
+
+// Agents returns all known agents sorted by ID.
+func (r *Registry) Agents() []Agent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	agents := make([]Agent, 0, len(r.agents))
+	for _, agent := range r.agents {
+		a := *agent
+		a.Alive = now.Sub(a.LastSeen) <= r.aliveTimeout
+		agents = append(agents, a)
+	}
+	slices.SortFunc(agents, func(a, b Agent) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return agents
+}
+
+func (r *Registry) evictOldest() {
+	var oldest *Agent
+	for _, agent := range r.agents {
+		if oldest == nil || agent.LastSeen.Before(oldest.LastSeen) {
+			oldest = agent
+		}
+	}
+	if oldest != nil {
+		delete(r.agents, oldest.ID)
+	}
+}
+
+type contextKey struct{}
+
+type visit struct {
+	registry *Registry
+	agentID  string
+}
+
+// NewContext returns a context that attributes metrics recorded with RecordMetrics to the agent.
+func NewContext(ctx context.Context, r *Registry, agentID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, visit{registry: r, agentID: agentID})
+}
+
+// RecordMetrics adds count to the metrics received from the agent that sent the request.
+// It does nothing if the request did not come from a registered agent.
+func RecordMetrics(ctx context.Context, count int) {
+	v, ok := ctx.Value(contextKey{}).(visit)
+	if !ok {
+		return
+	}
+
+	v.registry.AddMetrics(v.agentID, count)
+}
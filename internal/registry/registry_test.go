@@ -0,0 +1,62 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestIdentity_RoundTrip(t *testing.T) {
+	identity := Identity{
+		ID:        "agent-1",
+		Hostname:  "host",
+		Version:   "v1.2.3",
+		StartedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	h := http.Header{}
+	identity.SetHeaders(h)
+	assert.Equal(t, identity, IdentityFromHeaders(h))
+
+	md := metadata.Pairs(identity.MetadataPairs()...)
+	assert.Equal(t, identity, IdentityFromMetadata(md))
+
+	assert.Empty(t, IdentityFromHeaders(http.Header{}).ID)
+}
+
+func TestRegistry_ObserveAndRecordMetrics(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := New(time.Minute)
+	r.now = func() time.Time { return now }
+
+	r.Observe(Identity{ID: "b", Hostname: "host-b", Version: "v1"}, TransportHTTP, "10.0.0.2")
+	r.Observe(Identity{ID: "a"}, TransportGRPC, "10.0.0.1")
+	r.Observe(Identity{}, TransportHTTP, "10.0.0.3")
+
+	ctx := NewContext(context.Background(), r, "b")
+	RecordMetrics(ctx, 5)
+	RecordMetrics(context.Background(), 100)
+
+	now = now.Add(2 * time.Minute)
+	r.Observe(Identity{ID: "b", Version: "v2"}, TransportHTTP, "10.0.0.2")
+
+	agents := r.Agents()
+	require.Len(t, agents, 2)
+
+	assert.Equal(t, "a", agents[0].ID)
+	assert.Equal(t, TransportGRPC, agents[0].Transport)
+	assert.False(t, agents[0].Alive)
+
+	assert.Equal(t, "b", agents[1].ID)
+	assert.Equal(t, "host-b", agents[1].Hostname, "empty fields must not erase known values")
+	assert.Equal(t, "v2", agents[1].Version)
+	assert.Equal(t, int64(2), agents[1].Requests)
+	assert.Equal(t, int64(5), agents[1].MetricsReceived)
+	assert.Equal(t, now, agents[1].LastSeen)
+	assert.True(t, agents[1].Alive)
+}
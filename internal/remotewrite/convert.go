@@ -0,0 +1,136 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+
+	"github.com/koyif/metrics/internal/cumulative"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/typerule"
+)
+
+// nameLabel is the label holding the metric name of a series.
+const nameLabel = "__name__"
+
+// Result is the outcome of converting a write request.
+type Result struct {
+	// Metrics holds one metric per converted series.
+	Metrics []models.Metrics
+	// Dropped counts series without a metric name or a usable sample,
+	// and series discarded by a rule.
+	Dropped int
+}
+
+// Converter turns write requests into metrics, tracking counter totals with a
+// cumulative.Tracker. It is safe for concurrent use.
+type Converter struct {
+	rules  []typerule.Rule
+	totals *cumulative.Tracker
+}
+
+// NewConverter creates a converter applying the rules before the built-in type mapping.
+func NewConverter(rules []typerule.Rule, totals *cumulative.Tracker) *Converter {
+	return &Converter{
+		rules:  rules,
+		totals: totals,
+	}
+}
+
+// Convert maps every series of the request to a metric: the latest sample for
+// gauges and the increase since the previous total for counters. A counter total
+// lower than the previous one is taken as a reset.
+// Counter totals are advanced right away; call Forget for counters that end up
+// not being stored.
+func (c *Converter) Convert(req *proto.WriteRequest) (Result, error) {
+	metadata := make(map[string]proto.MetricMetadata_MetricType, len(req.GetMetadata()))
+	for _, m := range req.GetMetadata() {
+		metadata[m.GetMetricFamilyName()] = m.GetType()
+	}
+
+	result := Result{
+		Metrics: make([]models.Metrics, 0, len(req.GetTimeseries())),
+	}
+
+	for _, ts := range req.GetTimeseries() {
+		name, id := seriesName(ts.GetLabels())
+		samples := usableSamples(ts.GetSamples())
+		if name == "" || len(samples) == 0 {
+			result.Dropped++
+			continue
+		}
+
+		switch metricType(c.rules, metadata, name) {
+		case models.Counter:
+			totals := make([]float64, 0, len(samples))
+			for _, s := range samples {
+				totals = append(totals, s.GetValue())
+			}
+			delta, err := c.totals.Advance(id, totals...)
+			if err != nil {
+				// Nothing of the request is stored, so neither are the totals.
+				c.Forget(counterIDs(result.Metrics)...)
+				return Result{}, err
+			}
+			result.Metrics = append(result.Metrics, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+		case models.Gauge:
+			value := samples[len(samples)-1].GetValue()
+			result.Metrics = append(result.Metrics, models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+		default:
+			result.Dropped++
+		}
+	}
+
+	return result, nil
+}
+
+// Forget discards the totals of the counters, so their next samples continue
+// from the stored values again.
+func (c *Converter) Forget(ids ...string) {
+	c.totals.Forget(ids...)
+}
+
+func counterIDs(metrics []models.Metrics) []string {
+	ids := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		if m.MType == models.Counter {
+			ids = append(ids, m.ID)
+		}
+	}
+
+	return ids
+}
+
+// seriesName returns the metric name of the series and the metric ID built
+// from it and the remaining labels.
+func seriesName(labels []*proto.Label) (string, string) {
+	var name string
+	rest := make([]models.Label, 0, len(labels))
+	for _, l := range labels {
+		if l.GetName() == nameLabel {
+			name = l.GetValue()
+			continue
+		}
+		rest = append(rest, models.Label{Name: l.GetName(), Value: l.GetValue()})
+	}
+	if name == "" {
+		return "", ""
+	}
+
+	return name, models.LabeledName(name, rest)
+}
+
+// usableSamples returns the samples ordered by time without NaN and infinite
+// values; Prometheus marks stale series with a NaN sample.
+func usableSamples(samples []*proto.Sample) []*proto.Sample {
+	usable := make([]*proto.Sample, 0, len(samples))
+	for _, s := range samples {
+		if math.IsNaN(s.GetValue()) || math.IsInf(s.GetValue(), 0) {
+			continue
+		}
+		usable = append(usable, s)
+	}
+	sort.SliceStable(usable, func(i, j int) bool { return usable[i].GetTimestamp() < usable[j].GetTimestamp() })
+
+	return usable
+}
@@ -0,0 +1,170 @@
+package remotewrite
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/cumulative"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/repository/dberror"
+	"github.com/koyif/metrics/internal/typerule"
+)
+
+type storedCounters map[string]int64
+
+func (s storedCounters) Counter(name string) (int64, error) {
+	if v, ok := s[name]; ok {
+		return v, nil
+	}
+	return 0, dberror.ErrValueNotFound
+}
+
+func series(value float64, labels ...string) *proto.TimeSeries {
+	ts := &proto.TimeSeries{Samples: []*proto.Sample{{Value: value, Timestamp: 1}}}
+	for i := 0; i+1 < len(labels); i += 2 {
+		ts.Labels = append(ts.Labels, &proto.Label{Name: labels[i], Value: labels[i+1]})
+	}
+	return ts
+}
+
+func byID(metrics []models.Metrics) map[string]models.Metrics {
+	m := make(map[string]models.Metrics, len(metrics))
+	for _, metric := range metrics {
+		m[metric.ID] = metric
+	}
+	return m
+}
+
+func TestMetricType(t *testing.T) {
+	rules, err := typerule.Parse("^go_memstats_.*_total$=gauge,^debug_=drop")
+	require.NoError(t, err)
+
+	metadata := map[string]proto.MetricMetadata_MetricType{
+		"requests":         proto.MetricMetadata_COUNTER,
+		"latency_seconds":  proto.MetricMetadata_SUMMARY,
+		"inflight_current": proto.MetricMetadata_GAUGE,
+		"queue_total":      proto.MetricMetadata_GAUGE,
+	}
+
+	tests := map[string]string{
+		"go_memstats_alloc_bytes_total": models.Gauge,
+		"debug_anything":                typerule.Drop,
+		"requests":                      models.Counter,
+		"requests_total":                models.Counter,
+		"latency_seconds":               models.Gauge,
+		"latency_seconds_count":         models.Counter,
+		"latency_seconds_sum":           models.Counter,
+		"inflight_current":              models.Gauge,
+		"queue_total":                   models.Gauge,
+		"http_requests_total":           models.Counter,
+		"http_duration_bucket":          models.Counter,
+		"up":                            models.Gauge,
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, metricType(rules, metadata, name), name)
+	}
+}
+
+func TestConverter_SeriesNames(t *testing.T) {
+	c := NewConverter(nil, cumulative.NewTracker(storedCounters{}))
+
+	result, err := c.Convert(&proto.WriteRequest{Timeseries: []*proto.TimeSeries{
+		series(1, "job", "node", "__name__", "up", "instance", `host "a"`),
+		series(2, "__name__", "temperature"),
+		series(3, "job", "nameless"),
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.Dropped)
+	metrics := byID(result.Metrics)
+	require.Len(t, metrics, 2)
+	assert.Contains(t, metrics, `up{instance="host \"a\"",job="node"}`)
+	assert.Contains(t, metrics, "temperature")
+}
+
+func TestConverter_Gauges(t *testing.T) {
+	c := NewConverter(nil, cumulative.NewTracker(storedCounters{}))
+
+	ts := series(0, "__name__", "temperature")
+	ts.Samples = []*proto.Sample{
+		{Value: 3, Timestamp: 30},
+		{Value: 1, Timestamp: 10},
+		{Value: math.NaN(), Timestamp: 40},
+	}
+	stale := series(math.NaN(), "__name__", "gone")
+
+	result, err := c.Convert(&proto.WriteRequest{Timeseries: []*proto.TimeSeries{ts, stale}})
+	require.NoError(t, err)
+
+	require.Len(t, result.Metrics, 1)
+	assert.Equal(t, 1, result.Dropped, "stale series are dropped")
+	assert.Equal(t, models.Gauge, result.Metrics[0].MType)
+	assert.InDelta(t, 3, *result.Metrics[0].Value, 0, "the latest sample wins")
+}
+
+func TestConverter_Counters(t *testing.T) {
+	c := NewConverter(nil, cumulative.NewTracker(storedCounters{"restored_total": 100}))
+
+	requests := &proto.TimeSeries{
+		Labels:  []*proto.Label{{Name: "__name__", Value: "requests_total"}},
+		Samples: []*proto.Sample{{Value: 15, Timestamp: 20}, {Value: 12, Timestamp: 10}},
+	}
+	result, err := c.Convert(&proto.WriteRequest{Timeseries: []*proto.TimeSeries{
+		requests,
+		series(120, "__name__", "restored_total"),
+	}})
+	require.NoError(t, err)
+
+	metrics := byID(result.Metrics)
+	assert.Equal(t, int64(15), *metrics["requests_total"].Delta)
+	assert.Equal(t, int64(20), *metrics["restored_total"].Delta, "continues from the stored counter")
+
+	result, err = c.Convert(&proto.WriteRequest{Timeseries: []*proto.TimeSeries{series(18, "__name__", "requests_total")}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *result.Metrics[0].Delta)
+}
+
+type failingCounters struct{}
+
+func (failingCounters) Counter(name string) (int64, error) {
+	if name == "broken_total" {
+		return 0, errors.New("connection refused")
+	}
+	return 0, dberror.ErrValueNotFound
+}
+
+func TestConverter_StorageError(t *testing.T) {
+	c := NewConverter(nil, cumulative.NewTracker(failingCounters{}))
+
+	req := &proto.WriteRequest{Timeseries: []*proto.TimeSeries{
+		series(5, "__name__", "requests_total"),
+		series(1, "__name__", "broken_total"),
+	}}
+	_, err := c.Convert(req)
+	require.Error(t, err)
+
+	req.Timeseries = req.Timeseries[:1]
+	result, err := c.Convert(req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *result.Metrics[0].Delta, "totals of a failed request are forgotten")
+}
+
+func TestConverter_Drop(t *testing.T) {
+	rules, err := typerule.Parse("^debug_=drop")
+	require.NoError(t, err)
+	c := NewConverter(rules, cumulative.NewTracker(storedCounters{}))
+
+	result, err := c.Convert(&proto.WriteRequest{Timeseries: []*proto.TimeSeries{
+		series(1, "__name__", "debug_total"),
+		series(1, "__name__", "up"),
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Dropped)
+	require.Len(t, result.Metrics, 1)
+	assert.Equal(t, "up", result.Metrics[0].ID)
+}
@@ -0,0 +1,58 @@
+// Package remotewrite converts Prometheus remote-write requests into metrics.
+//
+// Every series becomes one metric named after the series in the exposition
+// format, e.g. http_requests_total{code="200",method="GET"}. Its type is decided
+// by the configured rules, then by the metadata sent with the request, then by
+// the conventional name suffixes. Counters arrive as cumulative totals and are
+// turned into deltas against the last total seen for the series.
+package remotewrite
+
+import (
+	"strings"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/proto/api/proto"
+	"github.com/koyif/metrics/internal/typerule"
+)
+
+// counterSuffixes mark series that are cumulative when no rule or metadata says otherwise.
+var counterSuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+
+// metricType decides the type of the series named name. metadata maps metric
+// family names to their type as sent with the request.
+func metricType(rules []typerule.Rule, metadata map[string]proto.MetricMetadata_MetricType, name string) string {
+	if mtype, ok := typerule.Match(rules, name); ok {
+		return mtype
+	}
+
+	if family, ok := metadata[name]; ok {
+		return familyType(family, "")
+	}
+	for _, suffix := range counterSuffixes {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			if family, ok := metadata[base]; ok {
+				return familyType(family, suffix)
+			}
+			return models.Counter
+		}
+	}
+
+	return models.Gauge
+}
+
+// familyType maps a series of a metric family to a type; suffix is the part of
+// the series name after the family name.
+func familyType(family proto.MetricMetadata_MetricType, suffix string) string {
+	switch family {
+	case proto.MetricMetadata_COUNTER:
+		return models.Counter
+	case proto.MetricMetadata_HISTOGRAM, proto.MetricMetadata_SUMMARY:
+		// Buckets, counts and sums are cumulative; summary quantiles are not.
+		if suffix != "" {
+			return models.Counter
+		}
+		return models.Gauge
+	default:
+		return models.Gauge
+	}
+}
@@ -0,0 +1,185 @@
+// Package replay protects signed requests from being replayed.
+//
+// Every signed request carries a timestamp and a random nonce that are covered by its HMAC.
+// The server accepts a request only if its timestamp is within the allowed clock skew and
+// its nonce has not been seen before. Nonces only need to be remembered for as long as their
+// timestamp is acceptable, which keeps the cache bounded.
+package replay
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+const (
+	// TimestampHeader carries the Unix time in seconds at which the request was signed.
+	TimestampHeader = "X-Signature-Timestamp"
+	// NonceHeader carries the random nonce of the request.
+	NonceHeader = "X-Signature-Nonce"
+	// TimestampMetadataKey and NonceMetadataKey are the gRPC metadata counterparts.
+	TimestampMetadataKey = "x-signature-timestamp"
+	NonceMetadataKey     = "x-signature-nonce"
+	// MaxNonceLength limits the size of client supplied nonces.
+	MaxNonceLength = 128
+)
+
+const (
+	// DefaultMaxSkew is how far the request timestamp may differ from the server clock.
+	DefaultMaxSkew = 5 * time.Minute
+	// DefaultCapacity is the maximum number of nonces remembered.
+	DefaultCapacity = 100000
+)
+
+var (
+	// ErrMissing is returned when the timestamp or the nonce is absent or malformed.
+	ErrMissing = errors.New("signature timestamp or nonce is missing or malformed")
+	// ErrStale is returned when the timestamp is outside the allowed clock skew.
+	ErrStale = errors.New("signature timestamp is outside the allowed clock skew")
+	// ErrReplayed is returned when the nonce has already been used.
+	ErrReplayed = errors.New("request has already been received")
+)
+
+// NewNonce generates a random nonce.
+func NewNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Timestamp formats t as sent in TimestampHeader.
+func Timestamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// SignHTTP sets the HashSHA256 signature of the body bound to a fresh
+// timestamp and nonce, and the headers carrying them, on the request.
+func SignHTTP(req *http.Request, key string, body []byte) {
+	timestamp := Timestamp(time.Now())
+	nonce := NewNonce()
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(NonceHeader, nonce)
+	req.Header.Set(crypto.HashHeader, crypto.SignRequest(key, timestamp, nonce, body))
+}
+
+type entry struct {
+	nonce     string
+	timestamp time.Time
+	element   *list.Element
+}
+
+// Guard remembers nonces of accepted requests and rejects stale or repeated ones.
+//
+// The cache holds at most capacity nonces. When it is full the oldest nonce is evicted and
+// requests signed at or before its timestamp are no longer accepted, so eviction never lets
+// a replay through; it only narrows the window for delayed requests.
+type Guard struct {
+	maxSkew  time.Duration
+	capacity int
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	order   *list.List
+	floor   time.Time
+}
+
+// New creates a guard accepting timestamps within maxSkew of the server clock and remembering
+// up to capacity nonces. Non-positive values fall back to the defaults.
+func New(maxSkew time.Duration, capacity int) *Guard {
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSkew
+	}
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+
+	return &Guard{
+		maxSkew:  maxSkew,
+		capacity: capacity,
+		now:      time.Now,
+		entries:  make(map[string]*entry),
+		order:    list.New(),
+	}
+}
+
+// Check validates the timestamp and nonce of a request whose signature has already been
+// verified, and records the nonce. It returns ErrMissing, ErrStale or ErrReplayed on rejection.
+func (g *Guard) Check(timestamp, nonce string) error {
+	if nonce == "" || len(nonce) > MaxNonceLength {
+		return ErrMissing
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMissing, err)
+	}
+	signedAt := time.Unix(seconds, 0)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	if signedAt.Before(now.Add(-g.maxSkew)) || signedAt.After(now.Add(g.maxSkew)) {
+		return ErrStale
+	}
+
+	g.sweep(now)
+
+	if _, ok := g.entries[nonce]; ok {
+		return ErrReplayed
+	}
+	if !signedAt.After(g.floor) {
+		// The nonce may have been evicted, so it can't be told apart from a replay.
+		return ErrStale
+	}
+
+	for g.order.Len() >= g.capacity {
+		evicted := g.order.Front().Value.(*entry)
+		if evicted.timestamp.After(g.floor) {
+			g.floor = evicted.timestamp
+		}
+		g.remove(evicted)
+	}
+
+	e := &entry{nonce: nonce, timestamp: signedAt}
+	e.element = g.order.PushBack(e)
+	g.entries[nonce] = e
+
+	return nil
+}
+
+// Len returns the number of nonces currently held.
+func (g *Guard) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return len(g.entries)
+}
+
+// sweep drops nonces whose timestamps can no longer pass the skew check.
+// Entries are ordered by arrival, which is close enough to timestamp order for cleanup.
+// Must be called with g.mu held.
+func (g *Guard) sweep(now time.Time) {
+	cutoff := now.Add(-g.maxSkew)
+	for g.order.Len() > 0 {
+		e := g.order.Front().Value.(*entry)
+		if !e.timestamp.Before(cutoff) {
+			return
+		}
+		g.remove(e)
+	}
+}
+
+func (g *Guard) remove(e *entry) {
+	g.order.Remove(e.element)
+	delete(g.entries, e.nonce)
+}
@@ -0,0 +1,70 @@
+package replay
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/koyif/metrics/pkg/crypto"
+)
+
+func TestGuard_Check(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	g := New(time.Minute, 10)
+	g.now = func() time.Time { return now }
+
+	assert.NoError(t, g.Check(Timestamp(now), "a"))
+	assert.ErrorIs(t, g.Check(Timestamp(now), "a"), ErrReplayed)
+	assert.NoError(t, g.Check(Timestamp(now.Add(-30*time.Second)), "b"))
+
+	assert.ErrorIs(t, g.Check(Timestamp(now.Add(-2*time.Minute)), "c"), ErrStale)
+	assert.ErrorIs(t, g.Check(Timestamp(now.Add(2*time.Minute)), "c"), ErrStale)
+
+	assert.ErrorIs(t, g.Check("", "c"), ErrMissing)
+	assert.ErrorIs(t, g.Check("yesterday", "c"), ErrMissing)
+	assert.ErrorIs(t, g.Check(Timestamp(now), ""), ErrMissing)
+}
+
+func TestGuard_ExpiredNoncesAreDropped(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	g := New(time.Minute, 10)
+	g.now = func() time.Time { return now }
+
+	assert.NoError(t, g.Check(Timestamp(now), "a"))
+	assert.Equal(t, 1, g.Len())
+
+	now = now.Add(2 * time.Minute)
+	assert.NoError(t, g.Check(Timestamp(now), "b"))
+	assert.Equal(t, 1, g.Len())
+
+	// The old request is still rejected, by its timestamp rather than its nonce.
+	assert.ErrorIs(t, g.Check(Timestamp(now.Add(-2*time.Minute)), "a"), ErrStale)
+}
+
+func TestGuard_EvictionDoesNotAllowReplays(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	g := New(time.Minute, 2)
+	g.now = func() time.Time { return now }
+
+	assert.NoError(t, g.Check(Timestamp(now.Add(-3*time.Second)), "a"))
+	assert.NoError(t, g.Check(Timestamp(now.Add(-2*time.Second)), "b"))
+	assert.NoError(t, g.Check(Timestamp(now.Add(-1*time.Second)), "c"))
+	assert.Equal(t, 2, g.Len())
+
+	// "a" was evicted, but its timestamp is now below the floor.
+	assert.ErrorIs(t, g.Check(Timestamp(now.Add(-3*time.Second)), "a"), ErrStale)
+	assert.NoError(t, g.Check(Timestamp(now), "d"))
+}
+
+func TestSignHTTP(t *testing.T) {
+	body := []byte(`[{"id":"hits","type":"counter","delta":1}]`)
+	req := httptest.NewRequest("POST", "/updates/", nil)
+	SignHTTP(req, "secret", body)
+
+	timestamp, nonce := req.Header.Get(TimestampHeader), req.Header.Get(NonceHeader)
+	assert.NotEmpty(t, timestamp)
+	assert.NotEmpty(t, nonce)
+	assert.True(t, crypto.VerifyRequest("secret", timestamp, nonce, body, req.Header.Get(crypto.HashHeader)))
+}
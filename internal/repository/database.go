@@ -11,6 +11,7 @@ type database interface {
 	StoreAll(metrics []models.Metrics) error
 	Metric(metricName string) (models.Metrics, error)
 	AllMetrics() []models.Metrics
+	ListMetrics(ctx context.Context, filter models.ListFilter) ([]models.MetricRecord, error)
 	Ping(ctx context.Context) error
 }
 
@@ -57,6 +58,7 @@ func (r DatabaseRepository) StoreCounter(metricName string, value int64) error {
 
 // StoreAll stores or updates multiple metrics in a single database transaction.
 // This is more efficient than individual updates for batch operations.
+// Like the in-memory repository, the batch is all-or-nothing.
 func (r DatabaseRepository) StoreAll(metrics []models.Metrics) error {
 	return r.db.StoreAll(metrics)
 }
@@ -111,6 +113,17 @@ func (r DatabaseRepository) AllGauges() map[string]float64 {
 	return gauges
 }
 
+// AllMetrics retrieves all counter and gauge metrics from the database in one query.
+func (r DatabaseRepository) AllMetrics() []models.Metrics {
+	return r.db.AllMetrics()
+}
+
+// ListMetrics retrieves the metrics matching the filter ordered by ID and type.
+// Filtering and pagination happen in the database query.
+func (r DatabaseRepository) ListMetrics(ctx context.Context, filter models.ListFilter) ([]models.MetricRecord, error) {
+	return r.db.ListMetrics(ctx, filter)
+}
+
 // Ping checks the database connection health.
 // Returns an error if the database is unreachable or connection has failed.
 func (r DatabaseRepository) Ping(ctx context.Context) error {
@@ -1,67 +1,216 @@
 package repository
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/koyif/metrics/internal/models"
 	"github.com/koyif/metrics/internal/repository/dberror"
 )
 
+// defaultShardCount is the number of shards used by NewMetricsRepository.
+// It should be a power of two so that shard selection is a simple mask.
+const defaultShardCount = 32
+
+type counterEntry struct {
+	value   int64
+	updated time.Time
+}
+
+type gaugeEntry struct {
+	value   float64
+	updated time.Time
+}
+
+// changes holds the metrics of a shard changed since the last snapshot.
+type changes struct {
+	counters map[string]counterEntry
+	gauges   map[string]gaugeEntry
+}
+
+// shard holds a subset of metrics, selected by the hash of the metric name.
+type shard struct {
+	mu       sync.RWMutex
+	counters map[string]counterEntry
+	gauges   map[string]gaugeEntry
+	// changed is nil until a metric changes after the last snapshot.
+	changed *changes
+	// Keeps neighbouring shards on separate cache lines.
+	_ [64]byte
+}
+
+// snapshot is an immutable copy of all metrics, made of one part per shard.
+// It is never modified once published, so readers share it without locking,
+// and the next snapshot shares the parts of the shards that didn't change.
+type snapshot struct {
+	shards []*shardSnapshot
+}
+
+// shardSnapshot is the immutable copy of the metrics of one shard.
+type shardSnapshot struct {
+	counters map[string]counterEntry
+	gauges   map[string]gaugeEntry
+}
+
 // MetricsRepository provides thread-safe in-memory storage for metrics.
-// It maintains separate maps for counter and gauge metrics, protected by a read-write mutex.
+// Metrics are spread across shards keyed by a hash of the metric name, and each
+// shard is protected by its own read-write mutex, so writers touching different
+// metrics do not contend with each other.
+//
+// AllCounters, AllGauges, AllMetrics and ListMetrics are served from an
+// immutable snapshot. Writers also record what they change in their shard, and
+// the first read after a write builds the next snapshot from the previous one
+// and those changes, copying only the parts of the shards that changed. Writers
+// are only held up while the changes are taken from every shard at once, which
+// doesn't depend on the number of metrics; the copy is made without any shard
+// lock. Taking the changes of all shards together is what makes a cross-shard
+// StoreAll batch appear atomically to readers: a snapshot contains either none
+// or all of it.
 //
 // This repository is used when database storage is not configured,
 // and can be persisted to file using the file service.
 type MetricsRepository struct {
-	mu       sync.RWMutex
-	counters map[string]int64
-	gauges   map[string]float64
+	shards []*shard
+	mask   uint32
+
+	snapshot atomic.Pointer[snapshot]
+	// dirty is set by writers and cleared when their changes are taken.
+	dirty atomic.Bool
+	// rebuild serializes building snapshots.
+	rebuild sync.Mutex
 }
 
-// NewMetricsRepository creates a new in-memory metrics repository.
+// NewMetricsRepository creates a new in-memory metrics repository
+// with the default number of shards.
 // The repository is safe for concurrent access.
 func NewMetricsRepository() *MetricsRepository {
-	return &MetricsRepository{
-		counters: make(map[string]int64),
-		gauges:   make(map[string]float64),
+	return NewShardedMetricsRepository(defaultShardCount)
+}
+
+// NewShardedMetricsRepository creates a new in-memory metrics repository with
+// the given number of shards. The count is rounded up to the next power of two;
+// a value below one yields a single shard, which behaves like a global lock.
+func NewShardedMetricsRepository(shardCount int) *MetricsRepository {
+	n := 1
+	for n < shardCount {
+		n <<= 1
 	}
+
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{
+			counters: make(map[string]counterEntry),
+			gauges:   make(map[string]gaugeEntry),
+		}
+	}
+
+	m := &MetricsRepository{
+		shards: shards,
+		mask:   uint32(n - 1),
+	}
+	empty := &shardSnapshot{
+		counters: make(map[string]counterEntry),
+		gauges:   make(map[string]gaugeEntry),
+	}
+	snap := &snapshot{shards: make([]*shardSnapshot, n)}
+	for i := range snap.shards {
+		snap.shards[i] = empty
+	}
+	m.snapshot.Store(snap)
+
+	return m
 }
 
 // AllCounters returns a copy of all counter metrics.
 // The returned map can be safely modified without affecting the repository.
 func (m *MetricsRepository) AllCounters() map[string]int64 {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	result := make(map[string]int64, len(m.counters))
-	maps.Copy(result, m.counters)
-
-	return result
+	return m.currentSnapshot().allCounters()
 }
 
 // AllGauges returns a copy of all gauge metrics.
 // The returned map can be safely modified without affecting the repository.
 func (m *MetricsRepository) AllGauges() map[string]float64 {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	return m.currentSnapshot().allGauges()
+}
 
-	result := make(map[string]float64, len(m.gauges))
-	maps.Copy(result, m.gauges)
+// AllMetrics returns all counters and gauges, taken from the same snapshot,
+// unlike separate calls of AllCounters and AllGauges.
+func (m *MetricsRepository) AllMetrics() []models.Metrics {
+	snap := m.currentSnapshot()
 
-	return result
+	counters, gauges := snap.len()
+	metrics := make([]models.Metrics, 0, counters+gauges)
+	for _, part := range snap.shards {
+		for id, e := range part.counters {
+			delta := e.value
+			metrics = append(metrics, models.Metrics{ID: id, MType: models.Counter, Delta: &delta})
+		}
+		for id, e := range part.gauges {
+			value := e.value
+			metrics = append(metrics, models.Metrics{ID: id, MType: models.Gauge, Value: &value})
+		}
+	}
+
+	return metrics
+}
+
+// ListMetrics returns the metrics matching the filter ordered by ID and type,
+// with the time of their last update. Like AllCounters and AllGauges it is
+// served from the snapshot and never blocks writers.
+func (m *MetricsRepository) ListMetrics(_ context.Context, filter models.ListFilter) ([]models.MetricRecord, error) {
+	snap := m.currentSnapshot()
+
+	records := make([]models.MetricRecord, 0)
+	for _, part := range snap.shards {
+		for id, e := range part.gauges {
+			if filter.Match(id, models.Gauge) && after(filter.After, id, models.Gauge) {
+				value := e.value
+				records = append(records, models.MetricRecord{
+					Metrics:   models.Metrics{ID: id, MType: models.Gauge, Value: &value},
+					UpdatedAt: e.updated,
+				})
+			}
+		}
+		for id, e := range part.counters {
+			if filter.Match(id, models.Counter) && after(filter.After, id, models.Counter) {
+				delta := e.value
+				records = append(records, models.MetricRecord{
+					Metrics:   models.Metrics{ID: id, MType: models.Counter, Delta: &delta},
+					UpdatedAt: e.updated,
+				})
+			}
+		}
+	}
+
+	slices.SortFunc(records, func(a, b models.MetricRecord) int {
+		return cmp.Or(cmp.Compare(a.ID, b.ID), cmp.Compare(a.MType, b.MType))
+	})
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[:filter.Limit]
+	}
+
+	return records, nil
+}
+
+func after(position *models.ListPosition, id, mtype string) bool {
+	return position == nil || position.Less(models.ListPosition{ID: id, MType: mtype})
 }
 
 // Counter retrieves the value of a counter metric by name.
 // Returns dberror.ErrValueNotFound if the metric doesn't exist.
 func (m *MetricsRepository) Counter(metricName string) (int64, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	s := m.shardFor(metricName)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	if v, ok := m.counters[metricName]; ok {
-		return v, nil
+	if e, ok := s.counters[metricName]; ok {
+		return e.value, nil
 	}
 	return 0, dberror.ErrValueNotFound
 }
@@ -69,11 +218,12 @@ func (m *MetricsRepository) Counter(metricName string) (int64, error) {
 // Gauge retrieves the value of a gauge metric by name.
 // Returns dberror.ErrValueNotFound if the metric doesn't exist.
 func (m *MetricsRepository) Gauge(metricName string) (float64, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	s := m.shardFor(metricName)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	if v, ok := m.gauges[metricName]; ok {
-		return v, nil
+	if e, ok := s.gauges[metricName]; ok {
+		return e.value, nil
 	}
 	return 0, dberror.ErrValueNotFound
 }
@@ -82,42 +232,217 @@ func (m *MetricsRepository) Gauge(metricName string) (float64, error) {
 // If the counter doesn't exist, it is created with the given value.
 // Counter values are cumulative and always increase.
 func (m *MetricsRepository) StoreCounter(metricName string, value int64) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	s := m.shardFor(metricName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	m.counters[metricName] += value
+	s.storeCounter(metricName, value, time.Now())
+	m.dirty.Store(true)
 	return nil
 }
 
 // StoreGauge sets the gauge metric to the given value.
 // If the gauge doesn't exist, it is created. Existing values are replaced.
 func (m *MetricsRepository) StoreGauge(metricName string, value float64) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	s := m.shardFor(metricName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	m.gauges[metricName] = value
+	s.storeGauge(metricName, value, time.Now())
+	m.dirty.Store(true)
 	return nil
 }
 
 // StoreAll stores multiple metrics in a single batch operation.
-// All updates are performed atomically under a single lock.
+// The batch is validated before anything is written, so an invalid metric
+// leaves the repository untouched. All shards touched by the batch are locked
+// in index order for the duration of the update, which keeps the batch atomic
+// for readers and avoids deadlocks between concurrent batches.
 // Returns an error if any metric has invalid data (nil value/delta or unknown type).
 func (m *MetricsRepository) StoreAll(metrics []models.Metrics) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	if err := validateBatch(metrics); err != nil {
+		return err
+	}
+
+	indexes := make([]uint32, len(metrics))
+	touched := make([]uint32, 0, len(m.shards))
+	for i, metric := range metrics {
+		indexes[i] = m.shardIndex(metric.ID)
+		touched = append(touched, indexes[i])
+	}
+	slices.Sort(touched)
+	touched = slices.Compact(touched)
+
+	for _, idx := range touched {
+		m.shards[idx].mu.Lock()
+	}
+	defer func() {
+		for _, idx := range touched {
+			m.shards[idx].mu.Unlock()
+		}
+	}()
 
+	now := time.Now()
+	for i, metric := range metrics {
+		s := m.shards[indexes[i]]
+		switch metric.MType {
+		case models.Gauge:
+			s.storeGauge(metric.ID, *metric.Value, now)
+		case models.Counter:
+			s.storeCounter(metric.ID, *metric.Delta, now)
+		}
+	}
+	m.dirty.Store(true)
+
+	return nil
+}
+
+// Ping always returns nil for in-memory storage.
+// This method exists to satisfy the repository interface.
+func (m *MetricsRepository) Ping(_ context.Context) error {
+	return nil
+}
+
+// currentSnapshot returns a snapshot that reflects every write completed before the call.
+// The current snapshot is reused while no writes have happened since it was built.
+func (m *MetricsRepository) currentSnapshot() *snapshot {
+	if !m.dirty.Load() {
+		return m.snapshot.Load()
+	}
+
+	m.rebuild.Lock()
+	defer m.rebuild.Unlock()
+
+	// Another reader may have built it while this one waited.
+	if !m.dirty.Load() {
+		return m.snapshot.Load()
+	}
+
+	pending := make([]*changes, len(m.shards))
+	for _, s := range m.shards {
+		s.mu.Lock()
+	}
+	m.dirty.Store(false)
+	for i, s := range m.shards {
+		pending[i] = s.changed
+		s.changed = nil
+	}
+	for _, s := range m.shards {
+		s.mu.Unlock()
+	}
+
+	prev := m.snapshot.Load()
+	next := &snapshot{shards: slices.Clone(prev.shards)}
+	for i, c := range pending {
+		if c == nil {
+			continue
+		}
+		part := &shardSnapshot{
+			counters: maps.Clone(prev.shards[i].counters),
+			gauges:   maps.Clone(prev.shards[i].gauges),
+		}
+		maps.Copy(part.counters, c.counters)
+		maps.Copy(part.gauges, c.gauges)
+		next.shards[i] = part
+	}
+	m.snapshot.Store(next)
+
+	return next
+}
+
+// len returns the number of counters and gauges in the snapshot.
+func (snap *snapshot) len() (counters, gauges int) {
+	for _, part := range snap.shards {
+		counters += len(part.counters)
+		gauges += len(part.gauges)
+	}
+
+	return counters, gauges
+}
+
+func (snap *snapshot) allCounters() map[string]int64 {
+	n, _ := snap.len()
+	counters := make(map[string]int64, n)
+	for _, part := range snap.shards {
+		for id, e := range part.counters {
+			counters[id] = e.value
+		}
+	}
+
+	return counters
+}
+
+func (snap *snapshot) allGauges() map[string]float64 {
+	_, n := snap.len()
+	gauges := make(map[string]float64, n)
+	for _, part := range snap.shards {
+		for id, e := range part.gauges {
+			gauges[id] = e.value
+		}
+	}
+
+	return gauges
+}
+
+// storeCounter adds to the counter and records the change. The shard must be locked.
+func (s *shard) storeCounter(id string, delta int64, now time.Time) {
+	e := s.counters[id]
+	e.value += delta
+	e.updated = now
+	s.counters[id] = e
+	s.changes().counters[id] = e
+}
+
+// storeGauge sets the gauge and records the change. The shard must be locked.
+func (s *shard) storeGauge(id string, value float64, now time.Time) {
+	e := gaugeEntry{value: value, updated: now}
+	s.gauges[id] = e
+	s.changes().gauges[id] = e
+}
+
+func (s *shard) changes() *changes {
+	if s.changed == nil {
+		s.changed = &changes{
+			counters: make(map[string]counterEntry),
+			gauges:   make(map[string]gaugeEntry),
+		}
+	}
+
+	return s.changed
+}
+
+func (m *MetricsRepository) shardFor(metricName string) *shard {
+	return m.shards[m.shardIndex(metricName)]
+}
+
+// shardIndex hashes the metric name with 32-bit FNV-1a.
+// The hash is computed inline to avoid allocating a hash.Hash32 per call.
+func (m *MetricsRepository) shardIndex(metricName string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	h := uint32(offset32)
+	for i := 0; i < len(metricName); i++ {
+		h ^= uint32(metricName[i])
+		h *= prime32
+	}
+
+	return h & m.mask
+}
+
+func validateBatch(metrics []models.Metrics) error {
 	for _, metric := range metrics {
 		switch metric.MType {
 		case models.Gauge:
 			if metric.Value == nil {
 				return fmt.Errorf("gauge value is nil")
 			}
-			m.gauges[metric.ID] = *metric.Value
 		case models.Counter:
 			if metric.Delta == nil {
 				return fmt.Errorf("counter delta is nil")
 			}
-			m.counters[metric.ID] += *metric.Delta
 		default:
 			return fmt.Errorf("unknown metric type")
 		}
@@ -125,9 +450,3 @@ func (m *MetricsRepository) StoreAll(metrics []models.Metrics) error {
 
 	return nil
 }
-
-// Ping always returns nil for in-memory storage.
-// This method exists to satisfy the repository interface.
-func (m *MetricsRepository) Ping(_ context.Context) error {
-	return nil
-}
@@ -1,6 +1,11 @@
 package repository
 
 import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/koyif/metrics/internal/models"
@@ -211,3 +216,193 @@ func BenchmarkMixedOperations(b *testing.B) {
 		_, _ = repo.Gauge("cpu_usage")
 	}
 }
+
+// shardConfigurations compares a single shard, which behaves like one global lock,
+// against the default sharded layout.
+var shardConfigurations = []struct {
+	name   string
+	shards int
+}{
+	{"single_shard", 1},
+	{"sharded", defaultShardCount},
+}
+
+// BenchmarkStoreCounterParallelDistinct measures concurrent writes to many distinct counters
+func BenchmarkStoreCounterParallelDistinct(b *testing.B) {
+	names := make([]string, 1024)
+	for i := range names {
+		names[i] = fmt.Sprintf("counter_%d", i)
+	}
+
+	for _, sc := range shardConfigurations {
+		b.Run(sc.name, func(b *testing.B) {
+			repo := NewShardedMetricsRepository(sc.shards)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					_ = repo.StoreCounter(names[i%len(names)], 1)
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStoreAllParallelShared measures concurrent batches written into one shared repository
+func BenchmarkStoreAllParallelShared(b *testing.B) {
+	metrics := make([]models.Metrics, 30)
+	for i := range metrics {
+		value := float64(i)
+		metrics[i] = models.Metrics{
+			ID:    fmt.Sprintf("gauge_%d", i),
+			MType: models.Gauge,
+			Value: &value,
+		}
+	}
+
+	for _, sc := range shardConfigurations {
+		b.Run(sc.name, func(b *testing.B) {
+			repo := NewShardedMetricsRepository(sc.shards)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = repo.StoreAll(metrics)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMixedReadWriteParallel simulates agents writing while the summary page reads all metrics
+func BenchmarkMixedReadWriteParallel(b *testing.B) {
+	names := make([]string, 256)
+	for i := range names {
+		names[i] = fmt.Sprintf("gauge_%d", i)
+	}
+
+	for _, sc := range shardConfigurations {
+		b.Run(sc.name, func(b *testing.B) {
+			repo := NewShardedMetricsRepository(sc.shards)
+			for i, name := range names {
+				_ = repo.StoreGauge(name, float64(i))
+			}
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if i%64 == 0 {
+						_ = repo.AllGauges()
+					} else {
+						_ = repo.StoreGauge(names[i%len(names)], float64(i))
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStoreThenList interleaves a write and a read, so every read has to
+// build a new snapshot. With a single shard the whole snapshot is copied each
+// time, as before snapshots were kept per shard; sharded, only the part of the
+// changed shard is.
+func BenchmarkStoreThenList(b *testing.B) {
+	names := make([]string, 10000)
+	for i := range names {
+		names[i] = fmt.Sprintf("gauge_%d", i)
+	}
+	filter := models.ListFilter{Prefix: "gauge_999"}
+
+	for _, sc := range shardConfigurations {
+		b.Run(sc.name, func(b *testing.B) {
+			repo := NewShardedMetricsRepository(sc.shards)
+			for i, name := range names {
+				_ = repo.StoreGauge(name, float64(i))
+			}
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				_ = repo.StoreGauge(names[i%len(names)], float64(i))
+				_, _ = repo.ListMetrics(context.Background(), filter)
+			}
+		})
+	}
+}
+
+// globalLockRepository is the layout the repository had before sharding: one
+// lock over both maps, with lists copied under the read lock. It is kept as the
+// baseline for BenchmarkStoreWhileListing.
+type globalLockRepository struct {
+	mu       sync.RWMutex
+	counters map[string]int64
+	gauges   map[string]float64
+}
+
+func (g *globalLockRepository) StoreGauge(name string, value float64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.gauges[name] = value
+	return nil
+}
+
+func (g *globalLockRepository) list() {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	_ = maps.Clone(g.counters)
+	_ = maps.Clone(g.gauges)
+}
+
+// BenchmarkStoreWhileListing measures writes while another goroutine keeps
+// listing all of 10k metrics, as the file service, dashboard and exporter do.
+func BenchmarkStoreWhileListing(b *testing.B) {
+	const series = 10_000
+	names := make([]string, series)
+	for i := range names {
+		names[i] = fmt.Sprintf("gauge_%d", i)
+	}
+
+	type repository interface {
+		StoreGauge(name string, value float64) error
+	}
+	run := func(b *testing.B, repo repository, list func()) {
+		for i, name := range names {
+			_ = repo.StoreGauge(name, float64(i))
+		}
+
+		var stop atomic.Bool
+		var wg sync.WaitGroup
+		listing := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			list()
+			close(listing)
+			for !stop.Load() {
+				list()
+			}
+		}()
+		<-listing
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = repo.StoreGauge(names[i%series], float64(i))
+		}
+		b.StopTimer()
+
+		stop.Store(true)
+		wg.Wait()
+	}
+
+	b.Run("global_lock", func(b *testing.B) {
+		repo := &globalLockRepository{counters: make(map[string]int64), gauges: make(map[string]float64)}
+		run(b, repo, repo.list)
+	})
+	b.Run("snapshot", func(b *testing.B) {
+		repo := NewMetricsRepository()
+		run(b, repo, func() { _ = repo.AllMetrics() })
+	})
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/repository/dberror"
+)
+
+func TestMetricsRepository_StoreAndGet(t *testing.T) {
+	repo := NewMetricsRepository()
+
+	require.NoError(t, repo.StoreCounter("requests", 2))
+	require.NoError(t, repo.StoreCounter("requests", 3))
+	require.NoError(t, repo.StoreGauge("cpu", 1.5))
+	require.NoError(t, repo.StoreGauge("cpu", 2.5))
+
+	counter, err := repo.Counter("requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+
+	gauge, err := repo.Gauge("cpu")
+	require.NoError(t, err)
+	assert.InDelta(t, 2.5, gauge, 0)
+
+	_, err = repo.Counter("missing")
+	assert.ErrorIs(t, err, dberror.ErrValueNotFound)
+	_, err = repo.Gauge("missing")
+	assert.ErrorIs(t, err, dberror.ErrValueNotFound)
+}
+
+func TestMetricsRepository_SnapshotReflectsWrites(t *testing.T) {
+	repo := NewMetricsRepository()
+	require.NoError(t, repo.StoreGauge("a", 1))
+
+	first := repo.AllGauges()
+	assert.Equal(t, map[string]float64{"a": 1}, first)
+
+	first["a"] = 100
+	assert.Equal(t, map[string]float64{"a": 1}, repo.AllGauges(), "returned map must be a copy")
+
+	require.NoError(t, repo.StoreGauge("b", 2))
+	assert.Equal(t, map[string]float64{"a": 1, "b": 2}, repo.AllGauges())
+}
+
+func TestMetricsRepository_StoreAllInvalidBatchLeavesRepositoryUntouched(t *testing.T) {
+	repo := NewMetricsRepository()
+	delta := int64(1)
+
+	err := repo.StoreAll([]models.Metrics{
+		{ID: "valid", MType: models.Counter, Delta: &delta},
+		{ID: "invalid", MType: models.Gauge},
+	})
+	require.Error(t, err)
+
+	assert.Empty(t, repo.AllCounters())
+	assert.Empty(t, repo.AllGauges())
+}
+
+func TestMetricsRepository_StoreAllIsAtomicForReaders(t *testing.T) {
+	const (
+		batchSize = 64
+		rounds    = 200
+	)
+
+	repo := NewMetricsRepository()
+	delta := int64(1)
+	batch := make([]models.Metrics, batchSize)
+	for i := range batch {
+		batch[i] = models.Metrics{ID: fmt.Sprintf("counter_%d", i), MType: models.Counter, Delta: &delta}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range rounds {
+			_ = repo.StoreAll(batch)
+		}
+	}()
+
+	for range rounds {
+		counters := repo.AllCounters()
+		if len(counters) == 0 {
+			continue
+		}
+
+		require.Len(t, counters, batchSize)
+		expected := counters["counter_0"]
+		for name, value := range counters {
+			require.Equal(t, expected, value, "counter %s observed a partially applied batch", name)
+		}
+	}
+
+	wg.Wait()
+	assert.Equal(t, int64(rounds), repo.AllCounters()["counter_0"])
+}
+
+func TestMetricsRepository_AllMetricsSeesBothTypesTogether(t *testing.T) {
+	const rounds = 200
+
+	repo := NewMetricsRepository()
+	delta := int64(1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range rounds {
+			value := float64(i + 1)
+			_ = repo.StoreAll([]models.Metrics{
+				{ID: "requests", MType: models.Counter, Delta: &delta},
+				{ID: "last_request", MType: models.Gauge, Value: &value},
+			})
+		}
+	}()
+
+	for range rounds {
+		var counter int64
+		var gauge float64
+		for _, m := range repo.AllMetrics() {
+			switch m.MType {
+			case models.Counter:
+				counter = *m.Delta
+			case models.Gauge:
+				gauge = *m.Value
+			}
+		}
+		require.Equal(t, float64(counter), gauge, "the counter and gauge come from different writes")
+	}
+
+	wg.Wait()
+	assert.Len(t, repo.AllMetrics(), 2)
+}
+
+func TestMetricsRepository_ListMetrics(t *testing.T) {
+	repo := NewMetricsRepository()
+	require.NoError(t, repo.StoreGauge("b", 2))
+	require.NoError(t, repo.StoreCounter("b", 1))
+	require.NoError(t, repo.StoreGauge("a", 1))
+	require.NoError(t, repo.StoreCounter("c", 3))
+
+	records, err := repo.ListMetrics(context.Background(), models.ListFilter{})
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	got := make([]string, 0, len(records))
+	for _, r := range records {
+		got = append(got, r.MType+":"+r.ID)
+		assert.False(t, r.UpdatedAt.IsZero())
+	}
+	assert.Equal(t, []string{"gauge:a", "counter:b", "gauge:b", "counter:c"}, got)
+
+	records, err = repo.ListMetrics(context.Background(), models.ListFilter{
+		After: &models.ListPosition{ID: "b", MType: models.Counter},
+		Limit: 1,
+	})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "b", records[0].ID)
+	assert.Equal(t, models.Gauge, records[0].MType)
+	assert.InDelta(t, 2.0, *records[0].Value, 0)
+}
@@ -0,0 +1,291 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const (
+	// DefaultInterval is how often the compactor runs.
+	DefaultInterval = time.Minute
+	// MetricPrefix prefixes the names of the compactor's own metrics.
+	MetricPrefix = "server.compactor."
+	// PartitionDays is the number of daily sample partitions kept created
+	// from the current day on.
+	PartitionDays = 3
+
+	// settleDelay gives samples recorded by running transactions time to be
+	// committed before their buckets are rolled up.
+	settleDelay = time.Minute
+)
+
+type store interface {
+	// LockCompaction keeps other servers from compacting at the same time.
+	// It reports false if another server holds the lock.
+	LockCompaction(ctx context.Context) (unlock func(), ok bool, err error)
+	CreateSamplePartitions(ctx context.Context, from time.Time, days int) error
+	RollupWatermark(ctx context.Context, resolution time.Duration) (time.Time, bool, error)
+	// Rollup computes the rollups of the buckets in [from, to) from the raw
+	// samples, or from the rollups of the source resolution when it isn't
+	// zero, and moves the watermark of the resolution to to.
+	Rollup(ctx context.Context, resolution, source time.Duration, from, to time.Time) (int64, error)
+	DropSamplePartitions(ctx context.Context, before time.Time) (int, error)
+	DeleteSamples(ctx context.Context, before time.Time) (int64, error)
+	DeleteRollups(ctx context.Context, resolution time.Duration, before time.Time) (int64, error)
+}
+
+type metricsStorer interface {
+	StoreAll(metrics []models.Metrics) error
+}
+
+// Stats describes one compaction.
+type Stats struct {
+	// Skipped is set when another server was compacting.
+	Skipped           bool
+	Rollups           int64
+	PartitionsDropped int
+	SamplesDeleted    int64
+	RollupsDeleted    int64
+	// Lag is how far the finest rollups are behind; zero without tiers.
+	Lag time.Duration
+}
+
+// Compactor rolls up and deletes samples according to the policy.
+type Compactor struct {
+	store    store
+	policy   Policy
+	interval time.Duration
+	metrics  metricsStorer
+	now      func() time.Time
+}
+
+// NewCompactor creates a compactor running every interval. Its own metrics
+// are stored through metrics under MetricPrefix.
+// A non-positive interval falls back to DefaultInterval.
+func NewCompactor(store store, policy Policy, interval time.Duration, metrics metricsStorer) *Compactor {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	return &Compactor{
+		store:    store,
+		policy:   policy,
+		interval: interval,
+		metrics:  metrics,
+		now:      time.Now,
+	}
+}
+
+// Prepare creates the sample partitions of the coming days. It must be
+// called before samples are stored, since samples stored before their
+// partition exists keep it from being created.
+func (c *Compactor) Prepare(ctx context.Context) error {
+	return c.store.CreateSamplePartitions(ctx, c.now(), PartitionDays)
+}
+
+// Run compacts every interval until the context is done.
+func (c *Compactor) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.run(ctx)
+		}
+	}
+}
+
+func (c *Compactor) run(ctx context.Context) {
+	start := time.Now()
+	stats, err := c.Compact(ctx)
+	duration := time.Since(start)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return
+	case err != nil:
+		logger.Log.Warn("sample compaction failed", logger.Error(err))
+	case stats.Skipped:
+		logger.Log.Debug("sample compaction skipped, another server is compacting")
+		return
+	case stats.Rollups > 0 || stats.PartitionsDropped > 0 || stats.SamplesDeleted > 0 || stats.RollupsDeleted > 0:
+		logger.Log.Info("sample compaction finished",
+			logger.Int("rollups", int(stats.Rollups)),
+			logger.Int("partitions_dropped", stats.PartitionsDropped),
+			logger.Int("samples_deleted", int(stats.SamplesDeleted)),
+			logger.Int("rollups_deleted", int(stats.RollupsDeleted)),
+			logger.String("duration", duration.String()),
+		)
+	default:
+		logger.Log.Debug("sample compaction finished, nothing to do", logger.String("duration", duration.String()))
+	}
+
+	c.record(stats, err, duration)
+}
+
+// record stores the compactor's own metrics.
+func (c *Compactor) record(stats Stats, err error, duration time.Duration) {
+	var failures int64
+	if err != nil {
+		failures = 1
+	}
+	counter := func(name string, delta int64) models.Metrics {
+		return models.Metrics{ID: MetricPrefix + name, MType: models.Counter, Delta: &delta}
+	}
+	gauge := func(name string, value float64) models.Metrics {
+		return models.Metrics{ID: MetricPrefix + name, MType: models.Gauge, Value: &value}
+	}
+
+	metrics := []models.Metrics{
+		counter("runs", 1),
+		counter("failures", failures),
+		counter("rollups_written", stats.Rollups),
+		counter("partitions_dropped", int64(stats.PartitionsDropped)),
+		counter("samples_deleted", stats.SamplesDeleted),
+		counter("rollups_deleted", stats.RollupsDeleted),
+		gauge("duration_seconds", duration.Seconds()),
+	}
+	if len(c.policy.Tiers) > 0 && err == nil {
+		metrics = append(metrics, gauge("lag_seconds", stats.Lag.Seconds()))
+	}
+
+	if err := c.metrics.StoreAll(metrics); err != nil {
+		logger.Log.Warn("failed to store compactor metrics", logger.Error(err))
+	}
+}
+
+// Compact rolls up the samples that settled since the last compaction and
+// deletes expired data. Data is only deleted once the next tier holds its
+// rollups.
+func (c *Compactor) Compact(ctx context.Context) (Stats, error) {
+	var stats Stats
+
+	unlock, ok, err := c.store.LockCompaction(ctx)
+	if err != nil {
+		return stats, err
+	}
+	if !ok {
+		stats.Skipped = true
+		return stats, nil
+	}
+	defer unlock()
+
+	now := c.now()
+	if err := c.store.CreateSamplePartitions(ctx, now, PartitionDays); err != nil {
+		// Samples still go to the default partition, which is cleaned by deletion.
+		logger.Log.Warn("failed to create sample partitions", logger.Error(err))
+	}
+
+	watermarks, err := c.rollup(ctx, now, &stats)
+	if err != nil {
+		return stats, err
+	}
+	if len(watermarks) > 0 && !watermarks[0].IsZero() {
+		stats.Lag = now.Sub(watermarks[0])
+	}
+
+	// Raw samples are deleted once the finest tier holds them.
+	cutoff := now.Add(-c.policy.Raw)
+	if len(c.policy.Tiers) > 0 {
+		cutoff = earliest(cutoff, watermarks[0])
+	}
+	if !cutoff.IsZero() {
+		dropped, err := c.store.DropSamplePartitions(ctx, cutoff)
+		stats.PartitionsDropped = dropped
+		if err != nil {
+			return stats, err
+		}
+		if stats.SamplesDeleted, err = c.store.DeleteSamples(ctx, cutoff); err != nil {
+			return stats, err
+		}
+	}
+
+	for i, tier := range c.policy.Tiers {
+		cutoff := now.Add(-tier.Retention)
+		if i+1 < len(watermarks) {
+			cutoff = earliest(cutoff, watermarks[i+1])
+		}
+		if cutoff.IsZero() {
+			continue
+		}
+
+		deleted, err := c.store.DeleteRollups(ctx, tier.Resolution, cutoff)
+		stats.RollupsDeleted += deleted
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// rollup rolls up every tier from its source and returns the watermarks of
+// the tiers; a zero watermark means the tier holds no rollups yet.
+func (c *Compactor) rollup(ctx context.Context, now time.Time, stats *Stats) ([]time.Time, error) {
+	watermarks := make([]time.Time, len(c.policy.Tiers))
+
+	// The raw samples are complete up to the settle delay.
+	var source time.Duration
+	sourceRetention := c.policy.Raw
+	complete := now.Add(-settleDelay)
+
+	for i, tier := range c.policy.Tiers {
+		watermark, ok, err := c.store.RollupWatermark(ctx, tier.Resolution)
+		if err != nil {
+			return nil, err
+		}
+
+		from := watermark
+		if !ok {
+			from = truncate(now.Add(-sourceRetention), tier.Resolution)
+		}
+
+		// A tier whose source holds no rollups yet has nothing to roll up.
+		if !complete.IsZero() {
+			to := truncate(complete, tier.Resolution)
+			if to.After(from) {
+				n, err := c.store.Rollup(ctx, tier.Resolution, source, from, to)
+				stats.Rollups += n
+				if err != nil {
+					return nil, err
+				}
+				watermark, ok = to, true
+			}
+		}
+		if ok {
+			watermarks[i] = watermark
+		}
+
+		source = tier.Resolution
+		sourceRetention = tier.Retention
+		complete = watermarks[i]
+	}
+
+	return watermarks, nil
+}
+
+// truncate rounds t down to a multiple of d since the Unix epoch, the way
+// the database computes buckets.
+func truncate(t time.Time, d time.Duration) time.Time {
+	nanos := t.UnixNano()
+	return time.Unix(0, nanos-nanos%int64(d)).In(t.Location())
+}
+
+// earliest returns the earlier time; a zero time wins, as it means nothing
+// may be deleted yet.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || b.IsZero() {
+		return time.Time{}
+	}
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,123 @@
+// Package retention keeps raw metric samples and their rollups in the
+// database within configured retention tiers.
+//
+// Every stored update is recorded as a raw sample in a table partitioned by
+// day. A background compactor rolls the raw samples up into buckets of each
+// tier's resolution, with the min, max, average and last value per series,
+// and deletes data older than its tier's retention. Each tier is computed
+// from the next finer one, and data is only deleted once it has been rolled
+// up, so a compactor falling behind delays deletion instead of losing data.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Raw names the raw samples in a retention spec.
+const Raw = "raw"
+
+var errNoRaw = errors.New("raw retention is required")
+
+// Tier is a rollup resolution and how long its rollups are kept.
+type Tier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// Policy is how long raw samples and the rollups of each tier are kept.
+// The zero Policy disables sample storage.
+type Policy struct {
+	Raw time.Duration
+	// Tiers are sorted by resolution, each a multiple of the previous one.
+	Tiers []Tier
+}
+
+// Enabled reports whether samples are stored.
+func (p Policy) Enabled() bool {
+	return p.Raw > 0
+}
+
+func (p Policy) String() string {
+	parts := []string{Raw + "=" + p.Raw.String()}
+	for _, t := range p.Tiers {
+		parts = append(parts, t.Resolution.String()+"="+t.Retention.String())
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Parse parses a comma-separated list of retentions such as
+// "raw=24h,1m=30d,1h=365d". Each entry is "raw" or a rollup resolution,
+// followed by the retention. Durations are Go durations or whole days
+// with a "d" suffix. Resolutions are whole seconds, each a multiple of the
+// previous one. An empty spec returns the zero Policy.
+func Parse(spec string) (Policy, error) {
+	var p Policy
+	if strings.TrimSpace(spec) == "" {
+		return p, nil
+	}
+
+	resolutions := make(map[time.Duration]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return Policy{}, fmt.Errorf("invalid retention %q: expected <resolution>=<retention>", entry)
+		}
+
+		retention, err := parseDuration(value)
+		if err != nil || retention <= 0 {
+			return Policy{}, fmt.Errorf("invalid retention %q", value)
+		}
+
+		key = strings.TrimSpace(key)
+		if key == Raw {
+			if p.Raw > 0 {
+				return Policy{}, errors.New("raw retention is set twice")
+			}
+			p.Raw = retention
+			continue
+		}
+
+		resolution, err := parseDuration(key)
+		if err != nil || resolution < time.Second || resolution%time.Second != 0 {
+			return Policy{}, fmt.Errorf("invalid resolution %q: expected whole seconds", key)
+		}
+		if resolutions[resolution] {
+			return Policy{}, fmt.Errorf("resolution %s is set twice", resolution)
+		}
+		resolutions[resolution] = true
+		p.Tiers = append(p.Tiers, Tier{Resolution: resolution, Retention: retention})
+	}
+
+	if p.Raw == 0 {
+		return Policy{}, errNoRaw
+	}
+
+	sort.Slice(p.Tiers, func(i, j int) bool { return p.Tiers[i].Resolution < p.Tiers[j].Resolution })
+	for i := 1; i < len(p.Tiers); i++ {
+		if p.Tiers[i].Resolution%p.Tiers[i-1].Resolution != 0 {
+			return Policy{}, fmt.Errorf("resolution %s is not a multiple of %s", p.Tiers[i].Resolution, p.Tiers[i-1].Resolution)
+		}
+	}
+
+	return p, nil
+}
+
+// parseDuration accepts Go durations and whole days such as "30d".
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
+}
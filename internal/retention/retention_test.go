@@ -0,0 +1,219 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse("1h=365d, raw=24h, 1m=30d")
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, p.Raw)
+	assert.Equal(t, []Tier{
+		{Resolution: time.Minute, Retention: 30 * 24 * time.Hour},
+		{Resolution: time.Hour, Retention: 365 * 24 * time.Hour},
+	}, p.Tiers)
+	assert.True(t, p.Enabled())
+	assert.Equal(t, "raw=24h0m0s,1m0s=720h0m0s,1h0m0s=8760h0m0s", p.String())
+
+	p, err = Parse("")
+	require.NoError(t, err)
+	assert.False(t, p.Enabled())
+
+	for _, spec := range []string{
+		"1m=30d",
+		"raw",
+		"raw=0s",
+		"raw=1x",
+		"raw=1h,raw=2h",
+		"raw=1h,500ms=1h",
+		"raw=1h,1m=1h,1m=2h",
+		"raw=1h,1m=1h,90s=1h",
+	} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+type rollupCall struct {
+	resolution, source time.Duration
+	from, to           time.Time
+}
+
+type fakeStore struct {
+	locked     bool
+	watermarks map[time.Duration]time.Time
+	rollups    []rollupCall
+	samples    time.Time
+	deleted    map[time.Duration]time.Time
+	rollupErr  error
+}
+
+func (s *fakeStore) LockCompaction(context.Context) (func(), bool, error) {
+	if s.locked {
+		return nil, false, nil
+	}
+	s.locked = true
+	return func() { s.locked = false }, true, nil
+}
+
+func (s *fakeStore) CreateSamplePartitions(context.Context, time.Time, int) error {
+	return nil
+}
+
+func (s *fakeStore) RollupWatermark(_ context.Context, resolution time.Duration) (time.Time, bool, error) {
+	w, ok := s.watermarks[resolution]
+	return w, ok, nil
+}
+
+func (s *fakeStore) Rollup(_ context.Context, resolution, source time.Duration, from, to time.Time) (int64, error) {
+	if s.rollupErr != nil {
+		return 0, s.rollupErr
+	}
+	s.rollups = append(s.rollups, rollupCall{resolution: resolution, source: source, from: from, to: to})
+	s.watermarks[resolution] = to
+	return 1, nil
+}
+
+func (s *fakeStore) DropSamplePartitions(_ context.Context, before time.Time) (int, error) {
+	s.samples = before
+	return 0, nil
+}
+
+func (s *fakeStore) DeleteSamples(_ context.Context, before time.Time) (int64, error) {
+	s.samples = before
+	return 5, nil
+}
+
+func (s *fakeStore) DeleteRollups(_ context.Context, resolution time.Duration, before time.Time) (int64, error) {
+	s.deleted[resolution] = before
+	return 1, nil
+}
+
+type recorder struct {
+	metrics map[string]models.Metrics
+}
+
+func (r *recorder) StoreAll(metrics []models.Metrics) error {
+	for _, m := range metrics {
+		r.metrics[m.ID] = m
+	}
+	return nil
+}
+
+func newCompactor(t *testing.T, store *fakeStore, now time.Time) (*Compactor, *recorder) {
+	t.Helper()
+
+	policy, err := Parse("raw=24h,1m=30d,1h=365d")
+	require.NoError(t, err)
+	rec := &recorder{metrics: make(map[string]models.Metrics)}
+	c := NewCompactor(store, policy, 0, rec)
+	c.now = func() time.Time { return now }
+	return c, rec
+}
+
+func TestCompactor_Compact(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 30, 30, 0, time.UTC)
+	store := &fakeStore{
+		watermarks: map[time.Duration]time.Time{time.Minute: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+		deleted:    make(map[time.Duration]time.Time),
+	}
+	c, _ := newCompactor(t, store, now)
+
+	stats, err := c.Compact(context.Background())
+	require.NoError(t, err)
+
+	// Minutes are rolled up from the last watermark to the settled minute;
+	// hours, seen for the first time, from the minutes kept.
+	require.Len(t, store.rollups, 2)
+	assert.Equal(t, rollupCall{
+		resolution: time.Minute,
+		from:       time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		to:         time.Date(2026, 10, 19, 12, 29, 0, 0, time.UTC),
+	}, store.rollups[0])
+	assert.Equal(t, rollupCall{
+		resolution: time.Hour,
+		source:     time.Minute,
+		from:       time.Date(2026, 9, 19, 12, 0, 0, 0, time.UTC),
+		to:         time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+	}, store.rollups[1])
+	assert.Equal(t, int64(2), stats.Rollups)
+	assert.Equal(t, 90*time.Second, stats.Lag)
+
+	assert.Equal(t, now.Add(-24*time.Hour), store.samples)
+	assert.Equal(t, now.Add(-30*24*time.Hour), store.deleted[time.Minute])
+	assert.Equal(t, now.Add(-365*24*time.Hour), store.deleted[time.Hour])
+	assert.False(t, store.locked, "the lock is released")
+}
+
+func TestCompactor_KeepsDataUntilRolledUp(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 30, 30, 0, time.UTC)
+	store := &fakeStore{
+		watermarks: map[time.Duration]time.Time{time.Minute: now.Add(-48 * time.Hour)},
+		deleted:    make(map[time.Duration]time.Time),
+		rollupErr:  errors.New("database is down"),
+	}
+	c, _ := newCompactor(t, store, now)
+
+	_, err := c.Compact(context.Background())
+	require.Error(t, err)
+	assert.True(t, store.samples.IsZero(), "nothing is deleted when rolling up fails")
+
+	// With short retentions the data is kept until the next tier holds it.
+	store.rollupErr = nil
+	store.watermarks[time.Hour] = time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC)
+	c.policy.Raw = time.Minute
+	c.policy.Tiers[0].Retention = 10 * time.Minute
+
+	_, err = c.Compact(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 19, 12, 29, 0, 0, time.UTC), store.samples,
+		"raw samples are kept until the minutes hold them")
+	assert.Equal(t, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), store.deleted[time.Minute],
+		"minutes are kept until the hours hold them")
+}
+
+func TestCompactor_SkipsWhenLocked(t *testing.T) {
+	store := &fakeStore{locked: true, watermarks: map[time.Duration]time.Time{}, deleted: map[time.Duration]time.Time{}}
+	c, rec := newCompactor(t, store, time.Now())
+
+	stats, err := c.Compact(context.Background())
+	require.NoError(t, err)
+	assert.True(t, stats.Skipped)
+	assert.Empty(t, store.rollups)
+
+	c.run(context.Background())
+	assert.Empty(t, rec.metrics, "skipped runs are not recorded")
+}
+
+func TestCompactor_RecordsMetrics(t *testing.T) {
+	store := &fakeStore{watermarks: map[time.Duration]time.Time{}, deleted: map[time.Duration]time.Time{}}
+	now := time.Now()
+	c, rec := newCompactor(t, store, now)
+
+	c.run(context.Background())
+	assert.Equal(t, int64(1), *rec.metrics[MetricPrefix+"runs"].Delta)
+	assert.Equal(t, int64(0), *rec.metrics[MetricPrefix+"failures"].Delta)
+	assert.Equal(t, int64(5), *rec.metrics[MetricPrefix+"samples_deleted"].Delta)
+	assert.Equal(t, models.Gauge, rec.metrics[MetricPrefix+"duration_seconds"].MType)
+	assert.Contains(t, rec.metrics, MetricPrefix+"lag_seconds")
+
+	store.rollupErr = errors.New("database is down")
+	c.now = func() time.Time { return now.Add(time.Minute) }
+	c.run(context.Background())
+	assert.Equal(t, int64(1), *rec.metrics[MetricPrefix+"failures"].Delta)
+}
+
+func TestTruncate(t *testing.T) {
+	at := time.Date(2026, 10, 19, 12, 34, 56, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 10, 19, 12, 34, 0, 0, time.UTC), truncate(at, time.Minute))
+	assert.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), truncate(at, 24*time.Hour))
+	assert.Equal(t, time.Unix(at.Unix()/420*420, 0).UTC(), truncate(at, 7*time.Minute), "buckets are aligned to the epoch")
+}
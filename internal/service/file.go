@@ -16,6 +16,7 @@ type metricsRepository interface {
 	StoreGauge(metricName string, value float64) error
 	Gauge(metricName string) (float64, error)
 	AllGauges() map[string]float64
+	AllMetrics() []models.Metrics
 }
 
 type fileRepository interface {
@@ -38,23 +39,7 @@ func NewFileService(fileRepository fileRepository, metricsRepository metricsRepo
 func (s *FileService) Persist() error {
 	logger.Log.Info("persisting metrics")
 
-	metrics := make([]models.Metrics, 0)
-	for metricName, value := range s.metricsRepository.AllGauges() {
-		metrics = append(metrics, models.Metrics{
-			ID:    metricName,
-			MType: models.Gauge,
-			Value: &value,
-		})
-	}
-	for metricName, value := range s.metricsRepository.AllCounters() {
-		metrics = append(metrics, models.Metrics{
-			ID:    metricName,
-			MType: models.Counter,
-			Delta: &value,
-		})
-	}
-
-	return s.fileRepository.Save(metrics)
+	return s.fileRepository.Save(s.metricsRepository.AllMetrics())
 }
 
 func (s *FileService) Restore() error {
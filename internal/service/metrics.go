@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/validation"
 )
 
 type repository interface {
@@ -13,7 +14,9 @@ type repository interface {
 	StoreGauge(metricName string, value float64) error
 	Gauge(metricName string) (float64, error)
 	AllGauges() map[string]float64
+	AllMetrics() []models.Metrics
 	StoreAll(metrics []models.Metrics) error
+	ListMetrics(ctx context.Context, filter models.ListFilter) ([]models.MetricRecord, error)
 	Ping(ctx context.Context) error
 }
 
@@ -21,25 +24,49 @@ type fileService interface {
 	Persist() error
 }
 
+type publisher interface {
+	Publish(metrics []models.Metrics)
+}
+
 // MetricsService provides business logic for metrics storage and retrieval.
 // It acts as an intermediary between HTTP handlers and the storage layer (repository).
 //
 // The service supports both in-memory and database-backed storage through
 // the repository interface, and handles file persistence when configured.
+// Every write is checked against the validation policy before it reaches the repository,
+// and every successful write is published to live subscribers.
 type MetricsService struct {
 	repository  repository
 	fileService fileService
+	validator   *validation.Validator
+	publisher   publisher
 }
 
-// NewMetricsService creates a new metrics service with the specified repository and file service.
+// NewMetricsService creates a new metrics service with the specified repository, file service,
+// validator and publisher.
 // The fileService can be nil if file persistence is not required (e.g., when using database storage).
-func NewMetricsService(repository repository, fileService fileService) *MetricsService {
+// A nil validator means the default validation policy.
+// The publisher can be nil if live updates are not needed.
+func NewMetricsService(repository repository, fileService fileService, validator *validation.Validator, publisher publisher) *MetricsService {
+	if validator == nil {
+		validator = validation.Default()
+	}
+
 	return &MetricsService{
 		repository:  repository,
 		fileService: fileService,
+		validator:   validator,
+		publisher:   publisher,
 	}
 }
 
+// Validate checks the metrics against the validation policy without storing them.
+// Returns a *validation.Error listing every rejected metric. Under the clamp policy
+// negative counter deltas in the slice are replaced with zero.
+func (m MetricsService) Validate(metrics []models.Metrics) error {
+	return m.validator.Validate(metrics)
+}
+
 // Persist triggers immediate file persistence of all metrics.
 // This is typically called when StoreInterval is set to 0 (synchronous mode).
 // Returns an error if file writing fails.
@@ -50,19 +77,54 @@ func (m MetricsService) Persist() error {
 // StoreGauge stores or updates a gauge metric with the given name and value.
 // Gauge metrics represent current state and are replaced on each update.
 func (m MetricsService) StoreGauge(metricName string, value float64) error {
-	return m.repository.StoreGauge(metricName, value)
+	if err := m.validator.Validate([]models.Metrics{{ID: metricName, MType: models.Gauge, Value: &value}}); err != nil {
+		return err
+	}
+
+	if err := m.repository.StoreGauge(metricName, value); err != nil {
+		return err
+	}
+
+	m.publish([]models.Metrics{{ID: metricName, MType: models.Gauge, Value: &value}})
+	return nil
 }
 
 // StoreCounter stores or updates a counter metric with the given name and delta value.
 // Counter metrics are cumulative - the delta is added to the existing value.
 func (m MetricsService) StoreCounter(metricName string, value int64) error {
-	return m.repository.StoreCounter(metricName, value)
+	metrics := []models.Metrics{{ID: metricName, MType: models.Counter, Delta: &value}}
+	if err := m.validator.Validate(metrics); err != nil {
+		return err
+	}
+
+	if err := m.repository.StoreCounter(metricName, *metrics[0].Delta); err != nil {
+		return err
+	}
+
+	m.publish(metrics)
+	return nil
 }
 
 // StoreAll stores or updates multiple metrics in a single batch operation.
 // This is more efficient than individual updates when processing many metrics at once.
+// The batch is rejected as a whole if any metric fails validation.
 func (m MetricsService) StoreAll(metrics []models.Metrics) error {
-	return m.repository.StoreAll(metrics)
+	if err := m.validator.Validate(metrics); err != nil {
+		return err
+	}
+
+	if err := m.repository.StoreAll(metrics); err != nil {
+		return err
+	}
+
+	m.publish(metrics)
+	return nil
+}
+
+func (m MetricsService) publish(metrics []models.Metrics) {
+	if m.publisher != nil {
+		m.publisher.Publish(metrics)
+	}
 }
 
 // Counter retrieves the current value of a counter metric by name.
@@ -89,6 +151,35 @@ func (m MetricsService) AllGauges() map[string]float64 {
 	return m.repository.AllGauges()
 }
 
+// AllMetrics returns all counters and gauges from a single read, so the two
+// types reflect the same writes.
+func (m MetricsService) AllMetrics() []models.Metrics {
+	return m.repository.AllMetrics()
+}
+
+// ListMetrics returns one page of the metrics matching the filter, ordered by ID and type.
+// The returned position is where the next page starts; it is nil on the last page.
+func (m MetricsService) ListMetrics(ctx context.Context, filter models.ListFilter) ([]models.MetricRecord, *models.ListPosition, error) {
+	limit := filter.Limit
+	if limit > 0 {
+		// One extra record tells whether there is a next page.
+		filter.Limit = limit + 1
+	}
+
+	records, err := m.repository.ListMetrics(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if limit <= 0 || len(records) <= limit {
+		return records, nil, nil
+	}
+
+	records = records[:limit]
+	last := records[limit-1]
+	return records, &models.ListPosition{ID: last.ID, MType: last.MType}, nil
+}
+
 // Ping checks the health of the underlying storage layer.
 // For database storage, this performs a database connectivity check.
 // For in-memory storage, this always returns nil.
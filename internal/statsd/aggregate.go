@@ -0,0 +1,208 @@
+package statsd
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/repository/dberror"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const (
+	// DefaultMaxSeries limits the number of series aggregated within one flush.
+	DefaultMaxSeries = 100000
+	// maxTimerSamples limits the values kept per timer and flush; beyond it a
+	// uniform sample of the values is kept, while count and max stay exact.
+	maxTimerSamples = 10000
+)
+
+type gaugeGetter interface {
+	Gauge(metricName string) (float64, error)
+}
+
+type gauge struct {
+	value float64
+	// absolute is set once the flush saw an absolute value; until then value
+	// is a sum of adjustments to the stored gauge.
+	absolute bool
+}
+
+type timer struct {
+	count  float64
+	seen   int
+	max    float64
+	sum    float64
+	values []float64
+}
+
+// Aggregator collects samples between flushes. It is safe for concurrent use.
+type Aggregator struct {
+	maxSeries int
+
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]*gauge
+	timers   map[string]*timer
+	// senders holds the sender that started each series of the flush.
+	senders map[string]string
+	limited bool
+}
+
+// NewAggregator creates an aggregator holding at most maxSeries series per flush.
+func NewAggregator(maxSeries int) *Aggregator {
+	a := &Aggregator{maxSeries: maxSeries}
+	a.reset()
+
+	return a
+}
+
+func (a *Aggregator) reset() {
+	a.counters = make(map[string]float64)
+	a.gauges = make(map[string]*gauge)
+	a.timers = make(map[string]*timer)
+	a.senders = make(map[string]string)
+	a.limited = false
+}
+
+func (a *Aggregator) series() int {
+	return len(a.counters) + len(a.gauges) + len(a.timers)
+}
+
+// admit reports whether a new series of the sender fits into the flush.
+func (a *Aggregator) admit(name, sender string) bool {
+	if a.series() < a.maxSeries {
+		if _, ok := a.senders[name]; !ok {
+			a.senders[name] = sender
+		}
+		return true
+	}
+	if !a.limited {
+		a.limited = true
+		logger.Log.Warn("statsd series limit reached, dropping new series until the next flush", logger.Int("max_series", a.maxSeries))
+	}
+
+	return false
+}
+
+// Add records a sample of the sender.
+func (a *Aggregator) Add(sender string, s Sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch s.Type {
+	case TypeCounter:
+		if _, ok := a.counters[s.Name]; !ok && !a.admit(s.Name, sender) {
+			return
+		}
+		a.counters[s.Name] += s.Value / s.Rate
+	case TypeGauge:
+		g, ok := a.gauges[s.Name]
+		if !ok {
+			if !a.admit(s.Name, sender) {
+				return
+			}
+			g = &gauge{}
+			a.gauges[s.Name] = g
+		}
+		if s.Relative {
+			g.value += s.Value
+		} else {
+			g.value = s.Value
+			g.absolute = true
+		}
+	case TypeTimer:
+		t, ok := a.timers[s.Name]
+		if !ok {
+			if !a.admit(s.Name, sender) {
+				return
+			}
+			t = &timer{max: s.Value}
+			a.timers[s.Name] = t
+		}
+		t.add(s.Value, s.Rate)
+	}
+}
+
+func (t *timer) add(value, rate float64) {
+	t.count += 1 / rate
+	t.sum += value
+	t.max = max(t.max, value)
+	t.seen++
+
+	// Reservoir sampling keeps every value with the same probability.
+	if len(t.values) < maxTimerSamples {
+		t.values = append(t.values, value)
+	} else if i := rand.IntN(t.seen); i < maxTimerSamples {
+		t.values[i] = value
+	}
+}
+
+// Flush returns the aggregated metrics and starts a new flush. Relative-only
+// gauges are applied to their stored value, read from gauges. The senders map
+// metric IDs to the sender that started their series.
+func (a *Aggregator) Flush(gauges gaugeGetter) (metrics []models.Metrics, senders map[string]string) {
+	a.mu.Lock()
+	counters, gaugeUpdates, timers, seriesSenders := a.counters, a.gauges, a.timers, a.senders
+	a.reset()
+	a.mu.Unlock()
+
+	metrics = make([]models.Metrics, 0, len(counters)+len(gaugeUpdates)+5*len(timers))
+	senders = make(map[string]string, cap(metrics))
+
+	for name, sum := range counters {
+		delta := int64(math.Round(sum))
+		metrics = append(metrics, models.Metrics{ID: name, MType: models.Counter, Delta: &delta})
+		senders[name] = seriesSenders[name]
+	}
+
+	for name, g := range gaugeUpdates {
+		value := g.value
+		if !g.absolute {
+			stored, err := gauges.Gauge(name)
+			if err != nil && !errors.Is(err, dberror.ErrValueNotFound) {
+				logger.Log.Warn("failed to read gauge for statsd adjustment", logger.String("name", name), logger.Error(err))
+				continue
+			}
+			value += stored
+		}
+		metrics = append(metrics, gaugeMetric(name, value))
+		senders[name] = seriesSenders[name]
+	}
+
+	for name, t := range timers {
+		for _, m := range t.summary(name) {
+			metrics = append(metrics, m)
+			senders[m.ID] = seriesSenders[name]
+		}
+	}
+
+	return metrics, senders
+}
+
+// summary returns the summary gauges of the timer.
+func (t *timer) summary(name string) []models.Metrics {
+	sort.Float64s(t.values)
+
+	return []models.Metrics{
+		gaugeMetric(name+".count", t.count),
+		gaugeMetric(name+".mean", t.sum/float64(t.seen)),
+		gaugeMetric(name+".p50", percentile(t.values, 0.5)),
+		gaugeMetric(name+".p95", percentile(t.values, 0.95)),
+		gaugeMetric(name+".max", t.max),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+
+	return sorted[max(rank, 0)]
+}
+
+func gaugeMetric(name string, value float64) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &value}
+}
@@ -0,0 +1,80 @@
+// Package statsd receives metrics in the StatsD line protocol over UDP and TCP.
+//
+// Lines have the form name:value|type[|@rate][|#tags]. Samples are aggregated
+// in memory and stored once per flush interval: counters as the sum scaled by
+// the sample rate, gauges as their last value, where a leading + or - adjusts
+// the current value, and timers as summary gauges name.count, name.mean,
+// name.p50, name.p95 and name.max. Tags are ignored.
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metric types of the protocol.
+const (
+	TypeCounter   = "c"
+	TypeGauge     = "g"
+	TypeTimer     = "ms"
+	TypeHistogram = "h"
+)
+
+var errMalformedLine = errors.New("malformed statsd line")
+
+// Sample is a single parsed line.
+type Sample struct {
+	Name  string
+	Type  string
+	Value float64
+	// Rate is the sample rate in (0, 1]; the sender kept one in 1/Rate samples.
+	Rate float64
+	// Relative marks a gauge value with a leading sign, which adjusts the gauge.
+	Relative bool
+}
+
+// Parse parses a line of the StatsD protocol. Histograms are parsed as timers.
+func Parse(line string) (Sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return Sample{}, fmt.Errorf("%w: %q", errMalformedLine, line)
+	}
+
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return Sample{}, fmt.Errorf("%w: %q", errMalformedLine, line)
+	}
+
+	s := Sample{Name: name, Type: fields[1], Rate: 1}
+	if s.Type == TypeHistogram {
+		s.Type = TypeTimer
+	}
+	switch s.Type {
+	case TypeCounter, TypeGauge, TypeTimer:
+	default:
+		return Sample{}, fmt.Errorf("%w: unsupported type %q", errMalformedLine, s.Type)
+	}
+
+	raw := fields[0]
+	s.Relative = s.Type == TypeGauge && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-"))
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Sample{}, fmt.Errorf("%w: invalid value %q", errMalformedLine, raw)
+	}
+	s.Value = value
+
+	for _, field := range fields[2:] {
+		if rate, ok := strings.CutPrefix(field, "@"); ok {
+			r, err := strconv.ParseFloat(rate, 64)
+			if err != nil || r <= 0 || r > 1 {
+				return Sample{}, fmt.Errorf("%w: invalid sample rate %q", errMalformedLine, rate)
+			}
+			s.Rate = r
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,185 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koyif/metrics/internal/audit"
+	"github.com/koyif/metrics/internal/ingest"
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/quota"
+	"github.com/koyif/metrics/pkg/logger"
+)
+
+const (
+	// DefaultFlushInterval is used when Options leave the flush interval unset.
+	DefaultFlushInterval = 10 * time.Second
+	// Client identifies StatsD updates in audit events, since a flush mixes
+	// samples of many senders.
+	Client = "statsd"
+	// maxPacketSize is the largest UDP datagram.
+	maxPacketSize = 65535
+)
+
+type metricsService interface {
+	Validate(metrics []models.Metrics) error
+	StoreAll(metrics []models.Metrics) error
+	Gauge(metricName string) (float64, error)
+	Persist() error
+}
+
+type seriesLimiter interface {
+	ReservePartial(client string, metrics []models.Metrics) ([]models.Metrics, *quota.Reservation, error)
+}
+
+// Options configure a Server.
+type Options struct {
+	// Addr is the address listened on with both UDP and TCP.
+	Addr string
+	// FlushInterval is how often aggregated metrics are stored, DefaultFlushInterval if unset.
+	FlushInterval time.Duration
+	// TrustedSubnets restricts the senders; empty allows everyone.
+	TrustedSubnets []*net.IPNet
+	// RateLimiter limits every UDP packet and TCP line of a sender; nil disables rate limiting.
+	RateLimiter ingest.RateLimiter
+	// Persist saves the storage after every flush, as with a zero store interval.
+	Persist bool
+}
+
+// Server receives StatsD lines and stores them once per flush interval.
+type Server struct {
+	opts       Options
+	service    metricsService
+	sink       *ingest.Sink
+	aggregator *Aggregator
+
+	packetConn net.PacketConn
+	lines      *ingest.LineListener
+	packets    sync.WaitGroup
+}
+
+// NewServer creates a StatsD server.
+// The auditManager and limiter can be nil if auditing or series quotas are not enabled.
+func NewServer(opts Options, service metricsService, auditManager *audit.Manager, limiter seriesLimiter) *Server {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+
+	return &Server{
+		opts:       opts,
+		service:    service,
+		sink:       ingest.NewSink(Client, service, auditManager, limiter, opts.Persist),
+		aggregator: NewAggregator(DefaultMaxSeries),
+	}
+}
+
+// Listen opens the UDP and TCP listeners and starts receiving.
+func (s *Server) Listen() error {
+	packetConn, err := net.ListenPacket("udp", s.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for statsd over UDP: %w", err)
+	}
+
+	lines, err := ingest.ListenLines(Client, s.opts.Addr, s.opts.TrustedSubnets, s.handleLine)
+	if err != nil {
+		_ = packetConn.Close()
+		return fmt.Errorf("failed to listen for statsd over TCP: %w", err)
+	}
+
+	s.packetConn = packetConn
+	s.lines = lines
+
+	s.packets.Add(1)
+	go s.readPackets()
+
+	return nil
+}
+
+// Serve flushes aggregated metrics until the context is done, then closes
+// the listeners and connections and flushes what was received last.
+func (s *Server) Serve(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.close()
+			s.Flush()
+			return
+		case <-ticker.C:
+			s.Flush()
+		}
+	}
+}
+
+func (s *Server) close() {
+	if err := s.packetConn.Close(); err != nil {
+		logger.Log.Warn("failed to close statsd UDP listener", logger.Error(err))
+	}
+	s.lines.Close()
+	s.packets.Wait()
+}
+
+// Flush stores the metrics aggregated since the previous flush. Metrics
+// rejected by the validation policy or the series quota of their sender are
+// dropped.
+func (s *Server) Flush() {
+	metrics, senders := s.aggregator.Flush(s.service)
+	s.sink.Store(metrics, senders)
+}
+
+func (s *Server) readPackets() {
+	defer s.packets.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.packetConn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logger.Log.Warn("failed to read statsd packet", logger.Error(err))
+			continue
+		}
+		if !ingest.Trusted(Client, s.opts.TrustedSubnets, addr) {
+			continue
+		}
+		sender := ingest.Sender(addr)
+		if !ingest.Allowed(Client, s.opts.RateLimiter, sender) {
+			continue
+		}
+
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			s.add(sender, string(line))
+		}
+	}
+}
+
+// handleLine handles a line received over TCP.
+func (s *Server) handleLine(sender, line string) {
+	if ingest.Allowed(Client, s.opts.RateLimiter, sender) {
+		s.add(sender, line)
+	}
+}
+
+func (s *Server) add(sender, line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	sample, err := Parse(line)
+	if err != nil {
+		logger.Log.Debug("invalid statsd line", logger.Error(err))
+		return
+	}
+
+	s.aggregator.Add(sender, sample)
+}
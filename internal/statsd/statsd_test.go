@@ -0,0 +1,197 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+	"github.com/koyif/metrics/internal/repository"
+	"github.com/koyif/metrics/internal/service"
+	"github.com/koyif/metrics/internal/validation"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want Sample
+	}{
+		{"hits:1|c", Sample{Name: "hits", Type: TypeCounter, Value: 1, Rate: 1}},
+		{"hits:2|c|@0.5", Sample{Name: "hits", Type: TypeCounter, Value: 2, Rate: 0.5}},
+		{"hits:2|c|#env:prod|@0.1", Sample{Name: "hits", Type: TypeCounter, Value: 2, Rate: 0.1}},
+		{"temp:3.2|g", Sample{Name: "temp", Type: TypeGauge, Value: 3.2, Rate: 1}},
+		{"temp:-4|g", Sample{Name: "temp", Type: TypeGauge, Value: -4, Rate: 1, Relative: true}},
+		{"temp:+4|g", Sample{Name: "temp", Type: TypeGauge, Value: 4, Rate: 1, Relative: true}},
+		{"latency:12|ms", Sample{Name: "latency", Type: TypeTimer, Value: 12, Rate: 1}},
+		{"latency:12|h", Sample{Name: "latency", Type: TypeTimer, Value: 12, Rate: 1}},
+		{"db.query:-1|c", Sample{Name: "db.query", Type: TypeCounter, Value: -1, Rate: 1}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.line)
+		require.NoError(t, err, tt.line)
+		assert.Equal(t, tt.want, got, tt.line)
+	}
+
+	for _, line := range []string{"", "hits", ":1|c", "hits:1", "hits:x|c", "hits:1|s", "hits:1|c|@0", "hits:1|c|@2", "hits:NaN|g"} {
+		_, err := Parse(line)
+		assert.Error(t, err, line)
+	}
+}
+
+type storedGauges map[string]float64
+
+func (s storedGauges) Gauge(name string) (float64, error) {
+	return s[name], nil
+}
+
+func flushed(a *Aggregator, gauges gaugeGetter) map[string]models.Metrics {
+	m := make(map[string]models.Metrics)
+	metrics, _ := a.Flush(gauges)
+	for _, metric := range metrics {
+		m[metric.MType+":"+metric.ID] = metric
+	}
+	return m
+}
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator(DefaultMaxSeries)
+	for _, line := range []string{
+		"hits:1|c", "hits:2|c|@0.5",
+		"temp:10|g", "temp:+5|g", "temp:-3|g",
+		"level:+2|g", "level:+1|g",
+	} {
+		s, err := Parse(line)
+		require.NoError(t, err)
+		a.Add("10.0.0.1", s)
+	}
+	for i := 1; i <= 100; i++ {
+		a.Add("10.0.0.1", Sample{Name: "latency", Type: TypeTimer, Value: float64(i), Rate: 1})
+	}
+
+	m := flushed(a, storedGauges{"level": 7, "temp": 100})
+	assert.Equal(t, int64(5), *m["counter:hits"].Delta, "counters are scaled by the sample rate")
+	assert.InDelta(t, 12, *m["gauge:temp"].Value, 0, "adjustments follow the last absolute value")
+	assert.InDelta(t, 10, *m["gauge:level"].Value, 0, "adjustments apply to the stored gauge")
+
+	assert.InDelta(t, 100, *m["gauge:latency.count"].Value, 0)
+	assert.InDelta(t, 50.5, *m["gauge:latency.mean"].Value, 0)
+	assert.InDelta(t, 50, *m["gauge:latency.p50"].Value, 0)
+	assert.InDelta(t, 95, *m["gauge:latency.p95"].Value, 0)
+	assert.InDelta(t, 100, *m["gauge:latency.max"].Value, 0)
+	assert.Len(t, m, 8)
+
+	metrics, _ := a.Flush(storedGauges{})
+	assert.Empty(t, metrics, "a flush starts over")
+}
+
+func TestAggregator_TimerSampling(t *testing.T) {
+	a := NewAggregator(DefaultMaxSeries)
+	for i := 0; i < 2*maxTimerSamples; i++ {
+		a.Add("10.0.0.1", Sample{Name: "latency", Type: TypeTimer, Value: float64(i), Rate: 0.5})
+	}
+	assert.Len(t, a.timers["latency"].values, maxTimerSamples)
+
+	m := flushed(a, storedGauges{})
+	assert.InDelta(t, 4*maxTimerSamples, *m["gauge:latency.count"].Value, 0)
+	assert.InDelta(t, 2*maxTimerSamples-1, *m["gauge:latency.max"].Value, 0)
+}
+
+func TestAggregator_MaxSeries(t *testing.T) {
+	a := NewAggregator(2)
+	for _, name := range []string{"a", "b", "c"} {
+		a.Add("10.0.0.1", Sample{Name: name, Type: TypeCounter, Value: 1, Rate: 1})
+	}
+	a.Add("10.0.0.1", Sample{Name: "a", Type: TypeCounter, Value: 1, Rate: 1})
+
+	m := flushed(a, storedGauges{})
+	assert.Len(t, m, 2)
+	assert.Equal(t, int64(2), *m["counter:a"].Delta, "known series keep aggregating")
+}
+
+func TestAggregator_Senders(t *testing.T) {
+	a := NewAggregator(DefaultMaxSeries)
+	a.Add("10.0.0.1", Sample{Name: "hits", Type: TypeCounter, Value: 1, Rate: 1})
+	a.Add("10.0.0.2", Sample{Name: "hits", Type: TypeCounter, Value: 1, Rate: 1})
+	a.Add("10.0.0.2", Sample{Name: "latency", Type: TypeTimer, Value: 1, Rate: 1})
+
+	_, senders := a.Flush(storedGauges{})
+	assert.Equal(t, "10.0.0.1", senders["hits"], "the sender that started the series owns it")
+	for _, suffix := range []string{".count", ".mean", ".p50", ".p95", ".max"} {
+		assert.Equal(t, "10.0.0.2", senders["latency"+suffix])
+	}
+}
+
+type denyAll struct{}
+
+func (denyAll) Allow(string) (bool, time.Duration) {
+	return false, time.Second
+}
+
+func TestServer_RateLimited(t *testing.T) {
+	svc := service.NewMetricsService(repository.NewMetricsRepository(), nil, nil, nil)
+	srv := NewServer(Options{Addr: "127.0.0.1:0", RateLimiter: denyAll{}}, svc, nil, nil)
+
+	srv.handleLine("10.0.0.1", "hits:1|c")
+
+	metrics, _ := srv.aggregator.Flush(storedGauges{})
+	assert.Empty(t, metrics)
+}
+
+func TestServer(t *testing.T) {
+	validator, err := validation.New(validation.Policy{})
+	require.NoError(t, err)
+	repo := repository.NewMetricsRepository()
+	svc := service.NewMetricsService(repo, nil, validator, nil)
+
+	srv := NewServer(Options{Addr: "127.0.0.1:0", FlushInterval: time.Hour}, svc, nil, nil)
+	require.NoError(t, srv.Listen())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.Serve(ctx)
+		close(done)
+	}()
+
+	udp, err := net.Dial("udp", srv.packetConn.LocalAddr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = fmt.Fprint(udp, "hits:1|c\nhits:1|c\ninvalid line\nbad name:1|g\n")
+	require.NoError(t, err)
+
+	tcp, err := net.Dial("tcp", srv.lines.Addr().String())
+	require.NoError(t, err)
+	_, err = fmt.Fprint(tcp, "temp:21.5|g\nhits:3|c\n")
+	require.NoError(t, err)
+	require.NoError(t, tcp.Close())
+
+	require.Eventually(t, func() bool {
+		srv.aggregator.mu.Lock()
+		defer srv.aggregator.mu.Unlock()
+		return srv.aggregator.counters["hits"] == 5 && len(srv.aggregator.gauges) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// Shutting down flushes what was received.
+	cancel()
+	<-done
+
+	hits, err := repo.Counter("hits")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), hits)
+
+	temp, err := repo.Gauge("temp")
+	require.NoError(t, err)
+	assert.InDelta(t, 21.5, temp, 0)
+
+	names := make([]string, 0)
+	for name := range repo.AllGauges() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"temp"}, names, "invalid names are dropped")
+}
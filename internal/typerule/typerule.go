@@ -0,0 +1,65 @@
+// Package typerule maps metric names to metric types with regular expressions,
+// for protocols that don't say whether a value is a counter or a gauge.
+package typerule
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+// Drop is the rule type that discards matching metrics.
+const Drop = "drop"
+
+// Rule maps metric names matching Pattern to Type: models.Counter, models.Gauge or Drop.
+type Rule struct {
+	Pattern *regexp.Regexp
+	Type    string
+}
+
+// Parse parses rules in the form pattern=type separated by commas,
+// e.g. "^go_memstats_.*_total$=gauge,^debug_=drop". The pattern ends at the
+// last equals sign and can't contain commas.
+func Parse(spec string) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		i := strings.LastIndex(item, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid type rule %q: expected pattern=type", item)
+		}
+
+		pattern, err := regexp.Compile(strings.TrimSpace(item[:i]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid type rule %q: %w", item, err)
+		}
+
+		mtype := strings.TrimSpace(item[i+1:])
+		switch mtype {
+		case models.Counter, models.Gauge, Drop:
+		default:
+			return nil, fmt.Errorf("invalid type in rule %q: expected counter, gauge or drop", item)
+		}
+
+		rules = append(rules, Rule{Pattern: pattern, Type: mtype})
+	}
+
+	return rules, nil
+}
+
+// Match returns the type of the first rule matching the name.
+func Match(rules []Rule, name string) (string, bool) {
+	for _, rule := range rules {
+		if rule.Pattern.MatchString(name) {
+			return rule.Type, true
+		}
+	}
+
+	return "", false
+}
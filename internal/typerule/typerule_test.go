@@ -0,0 +1,44 @@
+package typerule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	rules, err := Parse(" ^node_=gauge , ^debug_=drop,a=b=counter")
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+	assert.Equal(t, models.Gauge, rules[0].Type)
+	assert.Equal(t, Drop, rules[1].Type)
+	assert.Equal(t, "a=b", rules[2].Pattern.String(), "the pattern ends at the last equals sign")
+
+	rules, err = Parse("")
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, spec := range []string{"node_", "node_=histogram", "(=gauge"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules, err := Parse("^jobs\\..*\\.processed$=counter,^jobs\\.=gauge")
+	require.NoError(t, err)
+
+	mtype, ok := Match(rules, "jobs.backup.processed")
+	assert.True(t, ok)
+	assert.Equal(t, models.Counter, mtype, "the first matching rule wins")
+
+	mtype, ok = Match(rules, "jobs.backup.duration")
+	assert.True(t, ok)
+	assert.Equal(t, models.Gauge, mtype)
+
+	_, ok = Match(rules, "cpu.load")
+	assert.False(t, ok)
+}
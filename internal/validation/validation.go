@@ -0,0 +1,215 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+// Reasons reported for rejected metrics. They are part of the API and must stay stable.
+const (
+	ReasonEmptyName      = "empty_name"
+	ReasonNameTooLong    = "name_too_long"
+	ReasonInvalidName    = "invalid_name"
+	ReasonUnknownType    = "unknown_type"
+	ReasonMissingValue   = "missing_value"
+	ReasonNonFiniteValue = "non_finite_value"
+	ReasonNegativeDelta  = "negative_delta"
+)
+
+// NegativeDeltaPolicy defines what happens to counter updates with a negative delta.
+type NegativeDeltaPolicy string
+
+const (
+	// NegativeDeltaAllow stores negative deltas as is, decreasing the counter.
+	NegativeDeltaAllow NegativeDeltaPolicy = "allow"
+	// NegativeDeltaReject rejects metrics with negative deltas.
+	NegativeDeltaReject NegativeDeltaPolicy = "reject"
+	// NegativeDeltaClamp replaces negative deltas with zero.
+	NegativeDeltaClamp NegativeDeltaPolicy = "clamp"
+)
+
+const (
+	// DefaultNamePattern accepts any printable ASCII name without whitespace.
+	DefaultNamePattern = `^[[:graph:]]+$`
+	// DefaultMaxNameLength is the maximum metric name length in bytes.
+	DefaultMaxNameLength = 255
+)
+
+// ErrInvalidMetric is wrapped by Error so callers can detect validation failures with errors.Is.
+var ErrInvalidMetric = errors.New("invalid metric")
+
+// Violation describes why a single metric was rejected.
+// Index is the position of the metric in the validated batch.
+type Violation struct {
+	Index   int
+	ID      string
+	MType   string
+	Reason  string
+	Message string
+}
+
+// Error is returned when one or more metrics fail validation.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, fmt.Sprintf("%q: %s", v.ID, v.Message))
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalidMetric, strings.Join(messages, "; "))
+}
+
+func (e *Error) Unwrap() error {
+	return ErrInvalidMetric
+}
+
+// Policy holds the configurable validation rules.
+type Policy struct {
+	NamePattern   string
+	MaxNameLength int
+	NegativeDelta NegativeDeltaPolicy
+}
+
+// Validator checks metrics against a Policy. Non-finite gauge values are always rejected.
+type Validator struct {
+	namePattern   *regexp.Regexp
+	maxNameLength int
+	negativeDelta NegativeDeltaPolicy
+}
+
+// New creates a validator from the policy. Empty fields fall back to the defaults.
+// Returns an error if the name pattern does not compile or the delta policy is unknown.
+func New(policy Policy) (*Validator, error) {
+	if policy.NamePattern == "" {
+		policy.NamePattern = DefaultNamePattern
+	}
+	if policy.MaxNameLength <= 0 {
+		policy.MaxNameLength = DefaultMaxNameLength
+	}
+	if policy.NegativeDelta == "" {
+		policy.NegativeDelta = NegativeDeltaAllow
+	}
+
+	pattern, err := regexp.Compile(policy.NamePattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metric name pattern: %w", err)
+	}
+
+	switch policy.NegativeDelta {
+	case NegativeDeltaAllow, NegativeDeltaReject, NegativeDeltaClamp:
+	default:
+		return nil, fmt.Errorf("unknown negative delta policy %q", policy.NegativeDelta)
+	}
+
+	return &Validator{
+		namePattern:   pattern,
+		maxNameLength: policy.MaxNameLength,
+		negativeDelta: policy.NegativeDelta,
+	}, nil
+}
+
+// Default returns a validator with the default policy.
+func Default() *Validator {
+	v, _ := New(Policy{})
+	return v
+}
+
+// Validate checks every metric of the batch and returns an *Error listing all violations,
+// or nil if the batch is valid. Under the clamp policy negative deltas are replaced
+// with zero in place, so the slice must be owned by the caller.
+func (v *Validator) Validate(metrics []models.Metrics) error {
+	violations := make([]Violation, 0)
+	for i := range metrics {
+		if reason, message := v.check(&metrics[i]); reason != "" {
+			violations = append(violations, Violation{
+				Index:   i,
+				ID:      metrics[i].ID,
+				MType:   metrics[i].MType,
+				Reason:  reason,
+				Message: message,
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+
+	return nil
+}
+
+func (v *Validator) check(m *models.Metrics) (string, string) {
+	switch {
+	case m.ID == "":
+		return ReasonEmptyName, "metric name cannot be empty"
+	case len(m.ID) > v.maxNameLength:
+		return ReasonNameTooLong, fmt.Sprintf("metric name is longer than %d bytes", v.maxNameLength)
+	case !v.namePattern.MatchString(m.ID):
+		return ReasonInvalidName, fmt.Sprintf("metric name does not match %s", v.namePattern)
+	}
+
+	switch m.MType {
+	case models.Gauge:
+		if m.Value == nil {
+			return ReasonMissingValue, "gauge value is missing"
+		}
+		if math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0) {
+			return ReasonNonFiniteValue, "gauge value must be a finite number"
+		}
+	case models.Counter:
+		if m.Delta == nil {
+			return ReasonMissingValue, "counter delta is missing"
+		}
+		if *m.Delta < 0 {
+			switch v.negativeDelta {
+			case NegativeDeltaReject:
+				return ReasonNegativeDelta, "counter delta cannot be negative"
+			case NegativeDeltaClamp:
+				zero := int64(0)
+				m.Delta = &zero
+			}
+		}
+	default:
+		return ReasonUnknownType, fmt.Sprintf("unknown metric type %q", m.MType)
+	}
+
+	return "", ""
+}
+
+// Partition splits a batch using the result of Validate. It returns the metrics that passed
+// validation together with their positions in the original batch, and the violations
+// of the rejected ones. A nil error yields the whole batch as valid.
+func Partition(metrics []models.Metrics, err error) ([]models.Metrics, []int, []Violation) {
+	var validationErr *Error
+	if !errors.As(err, &validationErr) {
+		indexes := make([]int, len(metrics))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return metrics, indexes, nil
+	}
+
+	rejected := make(map[int]struct{}, len(validationErr.Violations))
+	for _, v := range validationErr.Violations {
+		rejected[v.Index] = struct{}{}
+	}
+
+	valid := make([]models.Metrics, 0, len(metrics)-len(rejected))
+	indexes := make([]int, 0, len(metrics)-len(rejected))
+	for i, m := range metrics {
+		if _, ok := rejected[i]; ok {
+			continue
+		}
+		valid = append(valid, m)
+		indexes = append(indexes, i)
+	}
+
+	return valid, indexes, validationErr.Violations
+}
@@ -0,0 +1,123 @@
+package validation
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/koyif/metrics/internal/models"
+)
+
+func gauge(id string, value float64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Gauge, Value: &value}
+}
+
+func counter(id string, delta int64) models.Metrics {
+	return models.Metrics{ID: id, MType: models.Counter, Delta: &delta}
+}
+
+func TestValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric models.Metrics
+		reason string
+	}{
+		{name: "valid gauge", metric: gauge("cpu.usage", 1.5)},
+		{name: "valid counter", metric: counter("requests_total", 1)},
+		{name: "negative delta allowed by default", metric: counter("requests_total", -1)},
+		{name: "empty name", metric: gauge("", 1), reason: ReasonEmptyName},
+		{name: "name too long", metric: gauge(strings.Repeat("a", DefaultMaxNameLength+1), 1), reason: ReasonNameTooLong},
+		{name: "whitespace in name", metric: gauge("cpu usage", 1), reason: ReasonInvalidName},
+		{name: "unknown type", metric: models.Metrics{ID: "x", MType: "histogram"}, reason: ReasonUnknownType},
+		{name: "missing gauge value", metric: models.Metrics{ID: "x", MType: models.Gauge}, reason: ReasonMissingValue},
+		{name: "missing counter delta", metric: models.Metrics{ID: "x", MType: models.Counter}, reason: ReasonMissingValue},
+		{name: "NaN gauge", metric: gauge("x", math.NaN()), reason: ReasonNonFiniteValue},
+		{name: "+Inf gauge", metric: gauge("x", math.Inf(1)), reason: ReasonNonFiniteValue},
+		{name: "-Inf gauge", metric: gauge("x", math.Inf(-1)), reason: ReasonNonFiniteValue},
+	}
+
+	v := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate([]models.Metrics{tt.metric})
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *Error
+			require.ErrorAs(t, err, &validationErr)
+			assert.ErrorIs(t, err, ErrInvalidMetric)
+			require.Len(t, validationErr.Violations, 1)
+			assert.Equal(t, tt.reason, validationErr.Violations[0].Reason)
+		})
+	}
+}
+
+func TestValidator_ReportsEveryViolation(t *testing.T) {
+	err := Default().Validate([]models.Metrics{
+		gauge("ok", 1),
+		gauge("bad name", 1),
+		gauge("nan", math.NaN()),
+	})
+
+	var validationErr *Error
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Violations, 2)
+	assert.Equal(t, 1, validationErr.Violations[0].Index)
+	assert.Equal(t, 2, validationErr.Violations[1].Index)
+}
+
+func TestValidator_NegativeDeltaPolicy(t *testing.T) {
+	reject, err := New(Policy{NegativeDelta: NegativeDeltaReject})
+	require.NoError(t, err)
+	err = reject.Validate([]models.Metrics{counter("c", -1)})
+	var validationErr *Error
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, ReasonNegativeDelta, validationErr.Violations[0].Reason)
+
+	clamp, err := New(Policy{NegativeDelta: NegativeDeltaClamp})
+	require.NoError(t, err)
+	metrics := []models.Metrics{counter("c", -5)}
+	require.NoError(t, clamp.Validate(metrics))
+	assert.Equal(t, int64(0), *metrics[0].Delta)
+}
+
+func TestNew_CustomPolicy(t *testing.T) {
+	v, err := New(Policy{NamePattern: `^[a-z_]+$`, MaxNameLength: 5})
+	require.NoError(t, err)
+
+	assert.NoError(t, v.Validate([]models.Metrics{gauge("cpu", 1)}))
+	assert.Error(t, v.Validate([]models.Metrics{gauge("CPU", 1)}))
+	assert.Error(t, v.Validate([]models.Metrics{gauge("memory", 1)}))
+
+	_, err = New(Policy{NamePattern: "("})
+	assert.Error(t, err)
+
+	_, err = New(Policy{NegativeDelta: "ignore"})
+	assert.Error(t, err)
+}
+
+func TestPartition(t *testing.T) {
+	metrics := []models.Metrics{
+		gauge("first", 1),
+		gauge("bad name", 1),
+		counter("third", 1),
+	}
+
+	valid, indexes, violations := Partition(metrics, Default().Validate(metrics))
+	require.Len(t, valid, 2)
+	assert.Equal(t, []int{0, 2}, indexes)
+	assert.Equal(t, "third", valid[1].ID)
+	require.Len(t, violations, 1)
+	assert.Equal(t, 1, violations[0].Index)
+
+	valid, indexes, violations = Partition(metrics[:1], nil)
+	assert.Len(t, valid, 1)
+	assert.Equal(t, []int{0}, indexes)
+	assert.Empty(t, violations)
+}
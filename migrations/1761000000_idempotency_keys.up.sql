@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    idempotency_key TEXT      PRIMARY KEY,
+    status_code     INTEGER,
+    content_type    TEXT,
+    body            BYTEA,
+    expires_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
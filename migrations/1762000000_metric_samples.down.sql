@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS metric_rollup_progress;
+DROP TABLE IF EXISTS metric_rollups;
+DROP TABLE IF EXISTS metric_samples;
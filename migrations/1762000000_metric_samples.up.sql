@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS metric_samples
+(
+    metric_name TEXT             NOT NULL,
+    metric_type TEXT             NOT NULL,
+    value       DOUBLE PRECISION NOT NULL,
+    recorded_at TIMESTAMPTZ      NOT NULL
+) PARTITION BY RANGE (recorded_at);
+
+-- Daily partitions are created ahead by the server; the default partition
+-- keeps samples no daily partition covers.
+CREATE TABLE IF NOT EXISTS metric_samples_default PARTITION OF metric_samples DEFAULT;
+
+CREATE INDEX IF NOT EXISTS metric_samples_recorded_at_idx ON metric_samples (recorded_at);
+
+CREATE TABLE IF NOT EXISTS metric_rollups
+(
+    resolution_seconds INTEGER          NOT NULL,
+    metric_name        TEXT             NOT NULL,
+    metric_type        TEXT             NOT NULL,
+    bucket_start       TIMESTAMPTZ      NOT NULL,
+    min_value          DOUBLE PRECISION NOT NULL,
+    max_value          DOUBLE PRECISION NOT NULL,
+    avg_value          DOUBLE PRECISION NOT NULL,
+    last_value         DOUBLE PRECISION NOT NULL,
+    sample_count       BIGINT           NOT NULL,
+    PRIMARY KEY (resolution_seconds, metric_name, metric_type, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS metric_rollups_bucket_start_idx ON metric_rollups (resolution_seconds, bucket_start);
+
+-- compacted_until is the end of the last bucket rolled up at each resolution.
+CREATE TABLE IF NOT EXISTS metric_rollup_progress
+(
+    resolution_seconds INTEGER     PRIMARY KEY,
+    compacted_until    TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,144 @@
+// Package compress encodes and decodes payloads with the content codings
+// understood by the metrics server: gzip, zstd and snappy.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported content codings, as used in the Content-Encoding header and as gRPC compressor names.
+const (
+	Gzip     = "gzip"
+	Zstd     = "zstd"
+	Snappy   = "snappy"
+	Identity = "identity"
+)
+
+// maxSnappyBlockSize bounds the decoded size of a snappy payload. Snappy payloads,
+// as sent by Prometheus remote write, are a single block decoded in one piece.
+const maxSnappyBlockSize = 64 << 20
+
+// ErrUnsupportedEncoding is returned for content codings other than gzip, zstd, snappy and identity.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// Encode compresses data with the given coding. An empty coding or identity returns data unchanged.
+func Encode(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch encoding {
+	case "", Identity:
+		return data, nil
+	case Gzip:
+		w, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case Zstd:
+		w, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case Snappy:
+		return snappy.Encode(nil, data), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// NewReader returns a reader decoding r with the given coding. An empty coding or identity
+// returns r as is. The caller must close the returned reader.
+func NewReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "", Identity:
+		return io.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case Snappy:
+		return &snappyReader{r: r}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// Supported reports whether the coding can be encoded and decoded.
+func Supported(encoding string) bool {
+	switch encoding {
+	case "", Identity, Gzip, Zstd, Snappy:
+		return true
+	default:
+		return false
+	}
+}
+
+// snappyReader decodes a snappy block on the first read. Unlike the framed
+// stream format, a block can't be decoded incrementally.
+type snappyReader struct {
+	r       io.Reader
+	decoded *bytes.Reader
+	err     error
+}
+
+func (s *snappyReader) Read(p []byte) (int, error) {
+	if s.decoded == nil && s.err == nil {
+		s.err = s.decode()
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	return s.decoded.Read(p)
+}
+
+func (s *snappyReader) decode() error {
+	block, err := io.ReadAll(io.LimitReader(s.r, int64(snappy.MaxEncodedLen(maxSnappyBlockSize))))
+	if err != nil {
+		return err
+	}
+
+	n, err := snappy.DecodedLen(block)
+	if err != nil {
+		return err
+	}
+	if n > maxSnappyBlockSize {
+		return fmt.Errorf("snappy block of %d bytes exceeds %d bytes", n, maxSnappyBlockSize)
+	}
+
+	data, err := snappy.Decode(nil, block)
+	if err != nil {
+		return err
+	}
+	s.decoded = bytes.NewReader(data)
+
+	return nil
+}
+
+func (s *snappyReader) Close() error {
+	return nil
+}
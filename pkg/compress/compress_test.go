@@ -0,0 +1,52 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1}`), 100)
+
+	for _, encoding := range []string{"", Identity, Gzip, Zstd, Snappy} {
+		t.Run(encoding, func(t *testing.T) {
+			encoded, err := Encode(encoding, data)
+			require.NoError(t, err)
+			if encoding == Gzip || encoding == Zstd || encoding == Snappy {
+				assert.Less(t, len(encoded), len(data))
+			}
+
+			r, err := NewReader(encoding, bytes.NewReader(encoded))
+			require.NoError(t, err)
+			defer r.Close()
+
+			decoded, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, data, decoded)
+		})
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	_, err := Encode("br", nil)
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+
+	_, err = NewReader("br", bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+
+	assert.False(t, Supported("br"))
+	assert.True(t, Supported(Zstd))
+}
+
+func TestSnappyCorruptBlock(t *testing.T) {
+	r, err := NewReader(Snappy, bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0x00}))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = io.ReadAll(r)
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashHeader is the HTTP header carrying the HMAC-SHA256 of a request or response body.
+// HashMetadataKey is its gRPC metadata counterpart.
+const (
+	HashHeader      = "HashSHA256"
+	HashMetadataKey = "hashsha256"
+)
+
+// Sign returns the hex-encoded HMAC-SHA256 of data under key.
+func Sign(key string, data []byte) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify reports whether signature is the hex-encoded HMAC-SHA256 of data under key.
+// The comparison takes constant time.
+func Verify(key string, data []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+	return hmac.Equal(h.Sum(nil), expected)
+}
+
+// SignRequest returns the hex-encoded HMAC-SHA256 of a request body bound to its
+// timestamp and nonce, so a captured request can't be replayed with fresh values.
+func SignRequest(key, timestamp, nonce string, body []byte) string {
+	return Sign(key, requestMessage(timestamp, nonce, body))
+}
+
+// VerifyRequest reports whether signature matches SignRequest for the same values.
+func VerifyRequest(key, timestamp, nonce string, body []byte, signature string) bool {
+	return Verify(key, requestMessage(timestamp, nonce, body), signature)
+}
+
+func requestMessage(timestamp, nonce string, body []byte) []byte {
+	msg := make([]byte, 0, len(timestamp)+len(nonce)+len(body)+2)
+	msg = append(msg, timestamp...)
+	msg = append(msg, '\n')
+	msg = append(msg, nonce...)
+	msg = append(msg, '\n')
+	return append(msg, body...)
+}
@@ -0,0 +1,28 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignVerify(t *testing.T) {
+	data := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+	signature := Sign("secret", data)
+
+	assert.True(t, Verify("secret", data, signature))
+	assert.False(t, Verify("other", data, signature))
+	assert.False(t, Verify("secret", []byte("tampered"), signature))
+	assert.False(t, Verify("secret", data, "not-hex"))
+	assert.False(t, Verify("secret", data, ""))
+}
+
+func TestSignVerifyRequest(t *testing.T) {
+	body := []byte(`[]`)
+	signature := SignRequest("secret", "1700000000", "nonce", body)
+
+	assert.True(t, VerifyRequest("secret", "1700000000", "nonce", body, signature))
+	assert.False(t, VerifyRequest("secret", "1700000001", "nonce", body, signature))
+	assert.False(t, VerifyRequest("secret", "1700000000", "other", body, signature))
+	assert.False(t, Verify("secret", body, signature), "the signature must cover the timestamp and nonce")
+}
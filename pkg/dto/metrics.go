@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 const (
 	// CounterMetricsType is the type identifier for counter metrics.
 	CounterMetricsType = "counter"
@@ -22,3 +24,132 @@ type Metrics struct {
 	// Value holds the gauge value. Non-nil only for gauge metrics.
 	Value *float64 `json:"value,omitempty"`
 }
+
+// RejectedMetric describes a metric the server refused to store.
+type RejectedMetric struct {
+	// Index is the position of the metric in the request batch.
+	Index int `json:"index"`
+	// ID is the name of the rejected metric.
+	ID string `json:"id"`
+	// MType is the type of the rejected metric as sent by the client.
+	MType string `json:"type"`
+	// Reason is a stable machine-readable rejection code, e.g. "invalid_name", or the series quota exceeded, e.g. "max_series".
+	Reason string `json:"reason"`
+	// Message is a human-readable explanation.
+	Message string `json:"message"`
+}
+
+// BatchErrorResponse is returned when a batch is rejected because some of its metrics are invalid.
+type BatchErrorResponse struct {
+	// Error is a short description of the failure.
+	Error string `json:"error"`
+	// Rejected lists every metric that failed validation.
+	Rejected []RejectedMetric `json:"rejected"`
+}
+
+// AcceptedMetric identifies a metric the server stored.
+type AcceptedMetric struct {
+	// Index is the position of the metric in the request batch.
+	Index int `json:"index"`
+	// ID is the name of the stored metric.
+	ID string `json:"id"`
+	// MType is the type of the stored metric.
+	MType string `json:"type"`
+}
+
+// BatchResult is returned for batches sent in partial mode.
+// Valid metrics are stored even when some items of the batch are rejected.
+type BatchResult struct {
+	// Accepted lists the metrics that were stored.
+	Accepted []AcceptedMetric `json:"accepted"`
+	// Rejected lists the metrics that were refused, with reasons.
+	Rejected []RejectedMetric `json:"rejected"`
+}
+
+// DashboardMetric is a metric as shown on the dashboard: its current value,
+// when it was last updated and its recent history.
+type DashboardMetric struct {
+	// ID is the unique name/identifier of the metric.
+	ID string `json:"id"`
+	// MType specifies the metric type: "counter" or "gauge".
+	MType string `json:"type"`
+	// Delta holds the counter total. Non-nil only for counter metrics.
+	Delta *int64 `json:"delta,omitempty"`
+	// Value holds the gauge value. Non-nil only for gauge metrics.
+	Value *float64 `json:"value,omitempty"`
+	// UpdatedAt is the time of the last update since the server started, if any.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// History holds the recent values, oldest first. Counters report their running total.
+	History []float64 `json:"history"`
+}
+
+// DashboardResponse is the data shown on the dashboard.
+type DashboardResponse struct {
+	// Gauges lists the gauge metrics sorted by ID.
+	Gauges []DashboardMetric `json:"gauges"`
+	// Counters lists the counter metrics sorted by ID.
+	Counters []DashboardMetric `json:"counters"`
+	// GeneratedAt is the server time the snapshot was taken.
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// ListedMetric is a metric in a listing: its current value and last update time.
+type ListedMetric struct {
+	// ID is the unique name/identifier of the metric.
+	ID string `json:"id"`
+	// MType specifies the metric type: "counter" or "gauge".
+	MType string `json:"type"`
+	// Delta holds the counter total. Non-nil only for counter metrics.
+	Delta *int64 `json:"delta,omitempty"`
+	// Value holds the gauge value. Non-nil only for gauge metrics.
+	Value *float64 `json:"value,omitempty"`
+	// UpdatedAt is the time of the last update. Omitted when the storage doesn't know it.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// MetricList is one page of a metric listing.
+type MetricList struct {
+	// Metrics lists the metrics of the page ordered by ID and type.
+	Metrics []ListedMetric `json:"metrics"`
+	// NextCursor is passed as the cursor parameter to fetch the next page.
+	// It is omitted on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// QueryResult is one value of an evaluated query.
+type QueryResult struct {
+	// ID is the metric the value was computed from. Omitted for aggregations.
+	ID string `json:"id,omitempty"`
+	// MType is the type of the metric. Omitted for aggregations.
+	MType string `json:"type,omitempty"`
+	// Value is the computed value.
+	Value float64 `json:"value"`
+}
+
+// QueryResponse is the result of GET /api/v1/query.
+type QueryResponse struct {
+	// Query is the evaluated expression.
+	Query string `json:"query"`
+	// Result lists the values sorted by ID and type; it is empty when nothing matched.
+	Result []QueryResult `json:"result"`
+	// EvaluatedAt is the server time the windows end at.
+	EvaluatedAt time.Time `json:"evaluated_at"`
+}
+
+// Problem is an RFC 7807 problem details body returned by the v2 API on errors.
+type Problem struct {
+	// Type is a URI identifying the problem type.
+	Type string `json:"type"`
+	// Title is a short summary of the problem type.
+	Title string `json:"title"`
+	// Status is the HTTP status code.
+	Status int `json:"status"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request that failed.
+	Instance string `json:"instance,omitempty"`
+	// Code is a stable machine-readable error code, e.g. "validation_failed".
+	Code string `json:"code"`
+	// Errors lists the rejected metrics when validation failed.
+	Errors []RejectedMetric `json:"errors,omitempty"`
+}